@@ -33,16 +33,83 @@ func addCmdMain(db *sqlx.DB) error {
 			return fmt.Errorf("解析 %s 配置文件失败: %w", *addConfig, err)
 		}
 
+		// 解析备份总大小上限
+		quota, err := tools.ParseQuota(addTaskConfig.Task.Retention.Size)
+		if err != nil {
+			return fmt.Errorf("解析备份总大小上限失败: %w", err)
+		}
+
+		// 解析失败重试和超时设置
+		retry, err := tools.ParseRetryPolicy(addTaskConfig.Task.Retry.Retries, addTaskConfig.Task.Retry.Backoff, addTaskConfig.Task.Retry.Timeout)
+		if err != nil {
+			return err
+		}
+
 		// 添加任务
-		if err := addTask(db, addTaskConfig.Task.Name, addTaskConfig.Task.Target, addTaskConfig.Task.Backup, addTaskConfig.Task.BackupDirName, addTaskConfig.Task.Retention.Count, addTaskConfig.Task.Retention.Days, addTaskConfig.Task.NoCompression, addTaskConfig.Task.ExcludeRules); err != nil {
+		taskConfig := addTaskConfig.Task
+		task := globals.BackupTask{
+			TaskName:        taskConfig.Name,
+			TargetDirectory: taskConfig.Target,
+			BackupDirectory: taskConfig.Backup,
+			RetentionCount:  taskConfig.Retention.Count,
+			RetentionDays:   taskConfig.Retention.Days,
+			NoCompression:   taskConfig.NoCompression,
+			ExcludeRules:    taskConfig.ExcludeRules,
+			RetentionSize:   quota,
+			Schedule:        taskConfig.Schedule,
+			Tags:            taskConfig.Tags,
+			DependsOn:       taskConfig.DependsOn,
+			Replicas:        taskConfig.Replicas,
+			TaskType:        taskConfig.Type,
+			MirrorDelete:    taskConfig.MirrorDelete,
+			GFSRetention:    taskConfig.Retention.GFSRetention,
+			RetryPolicy:     retry,
+		}
+		if err := addTask(db, task, taskConfig.BackupDirName, taskConfig.Tier); err != nil {
 			return fmt.Errorf("添加任务失败: %w", err)
 		}
 
 		return nil
 	}
 
+	// 解析GFS保留策略
+	gfs, err := tools.ParseGFS(*addGFS)
+	if err != nil {
+		return fmt.Errorf("解析GFS保留策略失败: %w", err)
+	}
+
+	// 解析备份总大小上限
+	quota, err := tools.ParseQuota(*addQuota)
+	if err != nil {
+		return fmt.Errorf("解析备份总大小上限失败: %w", err)
+	}
+
+	// 解析失败重试和超时设置
+	retry, err := tools.ParseRetryPolicy(*addRetries, *addRetryBackoff, *addTimeout)
+	if err != nil {
+		return err
+	}
+
 	// 如果没有指定-f参数, 则执行普通添加任务模式
-	if err := addTask(db, *addName, *addTarget, *addBackup, *addBackupDirName, *addRetentionCount, *addRetentionDays, *addNoCompression, *addExcludeRules); err != nil {
+	task := globals.BackupTask{
+		TaskName:        *addName,
+		TargetDirectory: *addTarget,
+		BackupDirectory: *addBackup,
+		RetentionCount:  *addRetentionCount,
+		RetentionDays:   *addRetentionDays,
+		NoCompression:   *addNoCompression,
+		ExcludeRules:    *addExcludeRules,
+		RetentionSize:   quota,
+		Schedule:        *addSchedule,
+		Tags:            *addTags,
+		DependsOn:       *addDepends,
+		Replicas:        *addReplicas,
+		TaskType:        *addType,
+		MirrorDelete:    *addMirrorDelete,
+		GFSRetention:    gfs,
+		RetryPolicy:     retry,
+	}
+	if err := addTask(db, task, *addBackupDirName, *addTier); err != nil {
 		return fmt.Errorf("添加任务失败: %w", err)
 	}
 	return nil
@@ -51,28 +118,19 @@ func addCmdMain(db *sqlx.DB) error {
 // addTask 添加备份任务
 // 参数:
 // - db: 数据库连接
-// - taskName: 任务名
-// - targetDir: 目标目录
-// - backupDir: 备份目录
-// - retentionCount: 保留文件数量
-// - retentionDays: 保留天数
-// - noCompression: 是否禁用压缩(默认启用压缩, 0 表示启用压缩, 1 表示禁用压缩)
-// - excludeRules: 排除规则
+// - task: 任务设置, 其中备份目录是存放备份目录的父目录(为空时使用默认路径), 定时计划、标签、前置任务和副本为空字符串或 none 表示不启用
+// - backupDirName: 备份目录名, 为空时使用目标目录的basename
+// - tier: 分层存储规则, 格式为 <天数>d:<冷存储路径>, 空字符串或 none 表示不启用
 // 返回值:
 // - error: 错误信息
-func addTask(db *sqlx.DB, taskName string, targetDir string, backupDir string, backupDirName string, retentionCount int, retentionDays int, noCompression int, excludeRules string) error {
-	// 检查任务名是否为空
-	if taskName == "" {
-		return fmt.Errorf("任务名不能为空")
-	}
-
-	// 检查任务名是否非法字符
-	if tools.ContainsSpecialChars(taskName) {
-		return fmt.Errorf("任务名含非法字符, 请重试")
+func addTask(db *sqlx.DB, task globals.BackupTask, backupDirName string, tier string) error {
+	// 检查任务名是否为空、含非法字符或为纯数字
+	if err := checkTaskName(task.TaskName); err != nil {
+		return err
 	}
 
 	// 检查目标目录是否为空
-	if targetDir == "" {
+	if task.TargetDirectory == "" {
 		return fmt.Errorf("目标目录不能为空")
 	}
 
@@ -84,29 +142,70 @@ func addTask(db *sqlx.DB, taskName string, targetDir string, backupDir string, b
 	}
 
 	// 检查保留文件数量是否合法
-	if retentionCount <= 0 {
+	if task.RetentionCount <= 0 {
 		return fmt.Errorf("保留文件数量不能小于0")
 	}
 
 	// 检查保留天数是否合法
-	if retentionDays < 0 {
+	if task.RetentionDays < 0 {
 		return fmt.Errorf("保留天数不能小于0")
 	}
 
+	// 检查GFS保留策略是否合法
+	if err := tools.ValidateGFS(task.GFSRetention); err != nil {
+		return err
+	}
+
+	// 检查定时计划是否合法
+	var err error
+	if task.Schedule, err = tools.NormalizeSchedule(task.Schedule); err != nil {
+		return fmt.Errorf("定时计划无效: %w", err)
+	}
+
+	// 检查标签是否合法
+	if task.Tags, err = tools.NormalizeTags(task.Tags); err != nil {
+		return fmt.Errorf("标签无效: %w", err)
+	}
+
+	// 检查任务类型是否合法
+	if task.TaskType == "" {
+		task.TaskType = globals.TaskTypeArchive
+	}
+	if task.TaskType != globals.TaskTypeArchive && task.TaskType != globals.TaskTypeMirror && task.TaskType != globals.TaskTypeSnapshot {
+		return fmt.Errorf("任务类型不合法: %s, 可选: %s, %s, %s", task.TaskType, globals.TaskTypeArchive, globals.TaskTypeMirror, globals.TaskTypeSnapshot)
+	}
+	if task.MirrorDelete != 0 && task.MirrorDelete != 1 {
+		return fmt.Errorf("-mirror-delete 参数不合法, 只能是 0(不删除) 或 1(删除)")
+	}
+	if task.MirrorDelete == 1 && task.TaskType != globals.TaskTypeMirror {
+		return fmt.Errorf("-mirror-delete 只适用于镜像任务(-type %s)", globals.TaskTypeMirror)
+	}
+	if task.TaskType == globals.TaskTypeMirror && tools.IsRemoteLocation(task.BackupDirectory) {
+		return fmt.Errorf("镜像任务的备份存放路径必须是本地目录: %s", task.BackupDirectory)
+	}
+	if task.TaskType == globals.TaskTypeSnapshot && tools.IsRemoteLocation(task.BackupDirectory) {
+		return fmt.Errorf("快照任务的备份存放路径必须是本地目录, 硬链接只能在同一文件系统中创建: %s", task.BackupDirectory)
+	}
+
+	// 检查前置任务是否存在
+	if task.DependsOn, err = parseDepends(db, task.DependsOn, 0); err != nil {
+		return fmt.Errorf("前置任务无效: %w", err)
+	}
+
 	// 检查目标目录或文件是否存在
-	if _, err := tools.CheckPath(targetDir); err != nil {
+	if _, err := tools.CheckPath(task.TargetDirectory); err != nil {
 		return fmt.Errorf("目标目录或文件不存在: %w", err)
 	}
 
 	// 如果指定了禁用压缩, 则检查是否合法
-	if *addNoCompression != 1 && *addNoCompression != 0 {
+	if task.NoCompression != 1 && task.NoCompression != 0 {
 		return fmt.Errorf("-nc 参数不合法, 只能是 0(启用压缩) 或 1(禁用压缩)")
 	}
 
 	// 在数据库检查是否存在同名任务
 	checkSql := "select count(*) from backup_tasks where task_name = ?"
 	var count int
-	if err := db.Get(&count, checkSql, taskName); err != nil {
+	if err := db.Get(&count, checkSql, task.TaskName); err != nil {
 		return fmt.Errorf("检查同名任务失败: %w", err)
 	}
 	if count > 0 {
@@ -114,7 +213,7 @@ func addTask(db *sqlx.DB, taskName string, targetDir string, backupDir string, b
 	}
 
 	// 扩展目标目录为绝对路径
-	absTargetDir, err := filepath.Abs(filepath.Clean(targetDir))
+	absTargetDir, err := filepath.Abs(filepath.Clean(task.TargetDirectory))
 	if err != nil {
 		return fmt.Errorf("获取目标目录绝对路径失败: %w", err)
 	}
@@ -124,9 +223,29 @@ func addTask(db *sqlx.DB, taskName string, targetDir string, backupDir string, b
 		backupDirName = filepath.Base(absTargetDir)
 	}
 
+	// 镜像和快照任务的备份目录与目标目录不能相互包含, 在创建备份目录之前检查
+	if task.TaskType == globals.TaskTypeMirror || task.TaskType == globals.TaskTypeSnapshot {
+		parentDir := task.BackupDirectory
+		if parentDir == "" {
+			tempHome, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("获取用户主目录失败: %w", err)
+			}
+			parentDir = filepath.Join(tempHome, globals.CbkHomeDir, globals.CbkDataDir)
+		}
+		absParentDir, err := filepath.Abs(parentDir)
+		if err != nil {
+			return fmt.Errorf("获取备份目录绝对路径失败: %w", err)
+		}
+		mirrorDir := filepath.Join(absParentDir, backupDirName)
+		if tools.IsInDir(absTargetDir, mirrorDir) || tools.IsInDir(mirrorDir, absTargetDir) {
+			return fmt.Errorf("%s任务的备份目录 %s 与目标目录 %s 不能相互包含", taskTypeName(task.TaskType), mirrorDir, absTargetDir)
+		}
+	}
+
 	// 如果备份目录为空, 则使用默认值路径，格式为: /home/username/.cbk/data/xxx
 	var absBackupDir string // 定义备份目录的绝对路径
-	if backupDir == "" {
+	if task.BackupDirectory == "" {
 		// 获取用户主目录
 		tempHome, err := os.UserHomeDir()
 		if err != nil {
@@ -139,23 +258,28 @@ func addTask(db *sqlx.DB, taskName string, targetDir string, backupDir string, b
 		if err := tools.EnsureDirExists(absBackupDir); err != nil {
 			return fmt.Errorf("备份目录创建失败: %w", err)
 		}
+	} else if tools.IsRemoteLocation(task.BackupDirectory) {
+		// 远程存储只检查地址格式, 在运行任务时才连接存储
+		if err := tools.CheckLocation(task.BackupDirectory); err != nil {
+			return fmt.Errorf("备份存储地址无效: %w", err)
+		}
+		absBackupDir = tools.JoinLocation(task.BackupDirectory, backupDirName)
 	} else {
 		// 检查指定的备份目录是否存在并创建
-		if err := tools.EnsureDirExists(backupDir); err != nil {
+		if err := tools.EnsureDirExists(task.BackupDirectory); err != nil {
 			return fmt.Errorf("备份目录创建失败: %w", err)
 		}
 
 		// 检查备份目录是否为绝对路径, 如果不是, 则转换为绝对路径
-		if !filepath.IsAbs(backupDir) {
-			var err error
-			backupDir, err = filepath.Abs(backupDir)
+		if !filepath.IsAbs(task.BackupDirectory) {
+			task.BackupDirectory, err = filepath.Abs(task.BackupDirectory)
 			if err != nil {
 				return fmt.Errorf("获取备份目录绝对路径失败: %w", err)
 			}
 		}
 
 		// 构建自定义备份目录的绝对路径, 格式为: /path/to/backupDirName
-		absBackupDir = filepath.Join(backupDir, backupDirName)
+		absBackupDir = filepath.Join(task.BackupDirectory, backupDirName)
 
 		// 检查备份目录是否存在并创建
 		if err := tools.EnsureDirExists(absBackupDir); err != nil {
@@ -163,13 +287,28 @@ func addTask(db *sqlx.DB, taskName string, targetDir string, backupDir string, b
 		}
 	}
 
+	// 检查副本存放路径, 每个副本中使用与备份目录相同的目录名
+	if task.Replicas, err = tools.NormalizeReplicas(task.Replicas, backupDirName, absBackupDir); err != nil {
+		return fmt.Errorf("副本存放路径无效: %w", err)
+	}
+
+	// 检查分层存储规则, 冷存储路径中使用与备份目录相同的目录名
+	if task.TierRule, err = tools.ParseTier(tier, backupDirName, absBackupDir); err != nil {
+		return fmt.Errorf("分层存储规则无效: %w", err)
+	}
+
+	// 镜像任务没有备份版本, 快照任务的版本是目录, 都不支持副本和分层存储
+	if task.TaskType != globals.TaskTypeArchive && (task.Replicas != "" || task.TierDays > 0) {
+		return fmt.Errorf("%s任务不支持副本(-replicas)和分层存储(-tier)", taskTypeName(task.TaskType))
+	}
+
 	// 插入新任务到数据库
-	insertSql := "insert into backup_tasks(task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules) values(?, ?, ?, ?, ?, ?, ?)"
-	if _, err := db.Exec(insertSql, taskName, absTargetDir, absBackupDir, retentionCount, retentionDays, noCompression, excludeRules); err != nil {
+	insertSql := "insert into backup_tasks(task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly, schedule, tags, depends_on, retries, retry_backoff, timeout, replicas, tier_days, tier_location, task_type, mirror_delete) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if _, err := db.Exec(insertSql, task.TaskName, absTargetDir, absBackupDir, task.RetentionCount, task.RetentionDays, task.NoCompression, task.ExcludeRules, task.RetentionSize, task.Hourly, task.Daily, task.Weekly, task.Monthly, task.Yearly, task.Schedule, task.Tags, task.DependsOn, task.Retries, task.RetryBackoff, task.Timeout, task.Replicas, task.TierDays, task.TierLocation, task.TaskType, task.MirrorDelete); err != nil {
 		return fmt.Errorf("插入任务失败: %w", err)
 	}
 
 	// 打印成功信息
-	CL.PrintOkf("任务添加成功: %s", taskName)
+	CL.PrintOkf("任务添加成功: %s", task.TaskName)
 	return nil
 }
@@ -15,7 +15,7 @@ _cbk() {
     prev="${COMP_WORDS[COMP_CWORD - 1]}"
 
     # 定义所有可用的子命令和选项
-    opts="list run add delete edit log show unpack zip unzip uz clear init export version help --help -h -v -vv"
+    opts="list run add delete edit log show unpack ls cat diff prune pin unpin usage daemon db zip unzip uz clear init export version help --help -h -v -vv"
 
     # 根据前一个单词(prev)来决定补全的内容
     case "${prev}" in
@@ -26,49 +26,49 @@ _cbk() {
         ;;
     add)
         # 如果前一个单词是 add, 补全 add 命令的选项
-        sub_opts="-n -t -b -c -d -bn -h -nc -f -ex"
+        sub_opts="-n -t -b -c -d -gfs -quota -schedule -tag -dep -retries -backoff -timeout -replicas -tier -type -mirror-delete -bn -h -nc -f -ex"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     a)
         # 如果前一个单词是 a, 补全 a 命令的选项
-        sub_opts="-n -t -b -c -d -bn -h -nc -f -ex"
+        sub_opts="-n -t -b -c -d -gfs -quota -schedule -tag -dep -retries -backoff -timeout -replicas -tier -type -mirror-delete -bn -h -nc -f -ex"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     delete)
         # 如果前一个单词是 delete, 补全 delete 命令的选项
-        sub_opts="-id -n -d -v -h"
+        sub_opts="-id -ids -tag -all -n -d -v -force -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     d)
         # 如果前一个单词是 d, 补全 d 命令的选项
-        sub_opts="-id -n -d -v -h"
+        sub_opts="-id -ids -tag -all -n -d -v -force -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     edit)
         # 如果前一个单词是 edit, 补全 edit 命令的选项
-        sub_opts="-id -ids -n -c -d -bn -h -nc -ex"
+        sub_opts="-id -ids -n -c -d -gfs -quota -schedule -tag -dep -retries -backoff -timeout -replicas -tier -mirror-delete -bn -h -nc -ex"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     e)
         # 如果前一个单词是 e, 补全 e 命令的选项
-        sub_opts="-id -ids -n -c -d -bn -h -nc -ex"
+        sub_opts="-id -ids -n -c -d -gfs -quota -schedule -tag -dep -retries -backoff -timeout -replicas -tier -mirror-delete -bn -h -nc -ex"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     list)
         # 如果前一个单词是 list, 补全 list 命令的选项
-        sub_opts="-ts -no-table -nt -h"
+        sub_opts="-tag -ts -no-table -nt -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     l)
         # 如果前一个单词是 l, 补全 l 命令的选项
-        sub_opts="-ts -no-table -nt -h"
+        sub_opts="-tag -ts -no-table -nt -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
@@ -80,25 +80,25 @@ _cbk() {
         ;;
     run)
         # 如果前一个单词是 run, 补全 run 命令的选项
-        sub_opts="-id -h -ids"
+        sub_opts="-id -h -ids -tag -all -m -label -pin -j -no-dep"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     r)
         # 如果前一个单词是 r, 补全 r 命令的选项
-        sub_opts="-id -h -ids"
+        sub_opts="-id -h -ids -tag -all -m -label -pin -j -no-dep"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     show)
         # 如果前一个单词是 show, 补全 show 命令的选项
-        sub_opts="-id -v -ts -no-table -nt -h"
+        sub_opts="-id -tag -all -v -ver -explain -ts -no-table -nt -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     s)
         # 如果前一个单词是 s, 补全 s 命令的选项
-        sub_opts="-id -v -ts -no-table -nt -h"
+        sub_opts="-id -tag -all -v -ver -explain -ts -no-table -nt -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
@@ -114,6 +114,66 @@ _cbk() {
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
+    ls)
+        # 如果前一个单词是 ls, 补全 ls 命令的选项
+        sub_opts="-id -v -f -r -l -table -ts -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    cat)
+        # 如果前一个单词是 cat, 补全 cat 命令的选项
+        sub_opts="-id -v -f -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    diff)
+        # 如果前一个单词是 diff, 补全 diff 命令的选项
+        sub_opts="-id -from -to -u -json -live -v -checksum -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    prune)
+        # 如果前一个单词是 prune, 补全 prune 命令的选项
+        sub_opts="-id -tag -all -dry-run -ts -no-table -nt -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    pin)
+        # 如果前一个单词是 pin, 补全 pin 命令的选项
+        sub_opts="-id -v -label -m -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    unpin)
+        # 如果前一个单词是 unpin, 补全 unpin 命令的选项
+        sub_opts="-id -v -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    usage)
+        # 如果前一个单词是 usage, 补全 usage 命令的选项
+        sub_opts="-budget -ts -no-table -nt -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    daemon)
+        # 如果前一个单词是 daemon, 补全 daemon 命令的选项
+        sub_opts="-catchup -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    db)
+        # 如果前一个单词是 db, 补全 db 命令的子命令
+        sub_opts="migrate -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
+    migrate)
+        # 如果前一个单词是 migrate, 补全 db migrate 命令的选项
+        sub_opts="-status -ts -no-table -nt -h"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+        ;;
     zip)
         # 如果前一个单词是 zip, 补全 zip 命令的选项
         sub_opts="-o -t -h -nc -ex"
@@ -140,19 +200,19 @@ _cbk() {
         ;;
     clear)
         # 如果前一个单词是 clear, 补全 clear 命令的选项
-        sub_opts="-confirm -h"
+        sub_opts="-confirm -force -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     init)
         # 如果前一个单词是 init, 补全 init 命令的选项
-        sub_opts="-type -h"
+        sub_opts="-type -id -all -o -h"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
     export)
         # 如果前一个单词是 export, 补全 export 命令的选项
-        sub_opts="-id -h -all"
+        sub_opts="-id -tag -h -all"
         COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
         return 0
         ;;
@@ -177,6 +237,13 @@ _cbk() {
         return 0
     fi
 
+    # 如果前一个单词是 -ver、-from 或 -to, 补全版本选择器关键字
+    if [[ ${prev} == "-ver" ]] || [[ ${prev} == "-from" ]] || [[ ${prev} == "-to" ]]; then
+        local selectors="latest latest~1 latest-success"
+        COMPREPLY=($(compgen -W "${selectors}" -- ${cur}))
+        return 0
+    fi
+
     # 如果前一个单词是 -ts, 补全表格样式
     if [[ ${prev} == "-ts" ]]; then
         # 定义所有可用的表格样式
@@ -188,7 +255,7 @@ _cbk() {
     # 如果前一个单词是 -type, 补全类型
     if [[ ${prev} == "-type" ]] || [[ ${prev} == "--type" ]]; then
         # 定义所有可用的类型
-        local completion_types="bash addtask"
+        local completion_types="bash addtask systemd cron"
         COMPREPLY=($(compgen -W "${completion_types}" -- ${cur}))
         return 0
     fi
@@ -249,6 +316,34 @@ _cbk() {
         return 0
     fi
 
+    # 如果前一个单词是-gfs, 则提示常见的GFS保留策略
+    if [[ ${prev} == "-gfs" ]]; then
+        sub_opts="24h,7d,4w,12m,3y 7d,4w,12m 7d,4w none"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+    fi
+
+    # 如果前一个单词是-quota或-budget, 则提示常见的大小
+    if [[ ${prev} == "-quota" || ${prev} == "-budget" ]]; then
+        sub_opts="500MB 1GB 5GB 10GB 50GB none"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+    fi
+
+    # 如果前一个单词是-schedule, 则提示定时计划的快捷写法
+    if [[ ${prev} == "-schedule" ]]; then
+        sub_opts="@hourly @daily @weekly @monthly @yearly none"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+    fi
+
+    # 如果前一个单词是-catchup, 则提示补跑策略
+    if [[ ${prev} == "-catchup" ]]; then
+        sub_opts="once skip"
+        COMPREPLY=($(compgen -W "${sub_opts}" -- ${cur}))
+        return 0
+    fi
+
     # 如果前一个单词是-ex, 则提示常见的排除规则
     if [[ ${prev} == "-ex" ]]; then
         sub_opts="*.log *.txt logs log"
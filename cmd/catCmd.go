@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bufio"
+	"cbk/pkg/tools"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// catCmdMain 将备份版本或ZIP文件中的单个文件输出到标准输出, 不解压到磁盘
+func catCmdMain(db *sqlx.DB) error {
+	// 检查是否指定了要读取的路径
+	if catCmd.NArg() != 1 {
+		return fmt.Errorf("必须且只能指定一个要读取的文件路径, 例如: cbk cat -id 3 -v latest etc/nginx/nginx.conf")
+	}
+	entryPath := catCmd.Arg(0)
+
+	// 打开版本读取器
+	taskID, err := catID.Resolve(db)
+	if err != nil {
+		return err
+	}
+	reader, err := openArchiveReader(db, taskID, *catVersionID, *catFile)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 查找指定的条目
+	entry, ok := tools.FindEntry(reader.Entries(), entryPath)
+	if !ok {
+		return fmt.Errorf("路径在备份中不存在: %s", entryPath)
+	}
+	if entry.IsDir {
+		return fmt.Errorf("%s 是一个目录, 请使用 'cbk ls' 查看目录内容", entryPath)
+	}
+	if !entry.Mode.IsRegular() {
+		return fmt.Errorf("%s 不是普通文件(%s), 无法输出内容", entryPath, entry.Mode.String())
+	}
+
+	// 将条目内容写入标准输出
+	writer := bufio.NewWriterSize(os.Stdout, 64*1024)
+	if _, err := tools.CopyEntry(writer, reader, entry); err != nil {
+		writer.Flush()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("写入标准输出失败: %w", err)
+	}
+
+	return nil
+}
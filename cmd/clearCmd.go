@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,36 +20,40 @@ func clearCmdMain(db *sqlx.DB) error {
 		return fmt.Errorf("请使用 -confirm 参数确认清除操作")
 	}
 
+	// 查询固定的版本, 未指定 -force 时保留这些版本
+	var pinned globals.BackupRecords
+	if !*clearForce {
+		pinnedSql := "SELECT version_id, task_id, backup_file_name, backup_path FROM backup_records WHERE pinned = 1 AND " + tools.SuccessStatusSql
+		if err := db.Select(&pinned, pinnedSql); err != nil {
+			return fmt.Errorf("查询固定的版本失败: %w", err)
+		}
+		if len(pinned) > 0 {
+			return clearKeepPinned(db, pinned)
+		}
+	}
+
 	CL.PrintWarn("即将清空整个数据库和备份存放目录，这将删除所有备份任务和相关数据, 撤回可在三秒内按Ctrl+C退出")
 	time.Sleep(3 * time.Second) // 等待3秒
 
-	// 构建查询备份任务的SQL语句
-	querySql := "SELECT backup_directory FROM backup_tasks;"
-
-	// 定义存储查询结果的结构体
-	var tasks globals.BackupTasks
-
-	// 执行查询备份任务的SQL语句
-	if err := db.Select(&tasks, querySql); err != nil {
-		return fmt.Errorf("查询备份任务失败: %w", err)
+	// 查询备份存放目录、副本存放目录和冷存储目录
+	dirs, err := queryBackupDirs(db)
+	if err != nil {
+		return err
 	}
 
-	// 检查是否存在备份任务, 如果存在则清理备份存放目录
-	if len(tasks) > 0 {
-		// 遍历清理备份存放目录
-		for _, task := range tasks {
-			if err := os.RemoveAll(task.BackupDirectory); err != nil {
-				CL.PrintErrorf("清理备份存放目录失败: %s", task.BackupDirectory)
-				CL.PrintWarnf("请手动删除备份存放目录: %s", task.BackupDirectory)
-				continue
-			}
-			CL.PrintOkf("清理备份存放目录成功: %s", task.BackupDirectory)
+	// 遍历清理备份存放目录
+	for _, dir := range dirs {
+		if err := removeBackupDir(dir); err != nil {
+			CL.PrintErrorf("清理备份存放目录失败: %s", dir)
+			CL.PrintWarnf("请手动删除备份存放目录: %s", dir)
+			continue
 		}
+		CL.PrintOkf("清理备份存放目录成功: %s", dir)
 	}
 
 	// 构建数据库文件路径
 	var useHomeDir string
-	useHomeDir, err := os.UserHomeDir()
+	useHomeDir, err = os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("获取用户主目录失败: %w", err)
 	}
@@ -67,3 +73,154 @@ func clearCmdMain(db *sqlx.DB) error {
 
 	return nil
 }
+
+// clearKeepPinned 清除除固定版本以外的所有数据
+// 删除备份存放目录中除固定版本以外的文件, 以及未固定的备份记录和不再包含任何版本的任务
+// 参数:
+// - db: 数据库连接
+// - pinned: 固定的版本
+// 返回值:
+// - error: 错误信息
+func clearKeepPinned(db *sqlx.DB, pinned globals.BackupRecords) error {
+	CL.PrintWarnf("即将清除除 %d 个固定版本以外的所有备份任务和相关数据, 如需全部清除请使用 -force, 撤回可在三秒内按Ctrl+C退出", len(pinned))
+	time.Sleep(3 * time.Second) // 等待3秒
+
+	// 查询备份存放目录、副本存放目录和冷存储目录
+	dirs, err := queryBackupDirs(db)
+	if err != nil {
+		return err
+	}
+
+	// 查询固定版本的副本, 副本文件同样需要保留
+	var replicas []globals.ReplicaRecord
+	if err := db.Select(&replicas, "SELECT version_id, location FROM backup_replicas WHERE version_id IN (SELECT version_id FROM backup_records WHERE pinned = 1)"); err != nil {
+		return fmt.Errorf("查询固定版本的副本失败: %w", err)
+	}
+
+	// 在事务中删除未固定的备份记录和不再包含任何版本的任务
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	clearSqls := []string{
+		"DELETE FROM backup_records WHERE pinned = 0 OR pinned IS NULL",
+		"DELETE FROM backup_replicas WHERE version_id NOT IN (SELECT version_id FROM backup_records)",
+		"DELETE FROM backup_tasks WHERE task_id NOT IN (SELECT task_id FROM backup_records)",
+		"DELETE FROM settings",
+	}
+	for _, clearSql := range clearSqls {
+		if _, err := tx.Exec(clearSql); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("清除数据库记录失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	// 记录需要保留的备份文件
+	keep := make(map[string]bool)
+	fileNames := make(map[string]string) // 版本ID到备份文件名的映射
+	for _, record := range pinned {
+		keep[tools.JoinLocation(record.BackupPath, record.BackupFileName)] = true
+		fileNames[record.VersionID] = record.BackupFileName
+	}
+	for _, replica := range replicas {
+		if name, ok := fileNames[replica.VersionID]; ok {
+			keep[tools.JoinLocation(replica.Location, name)] = true
+		}
+	}
+
+	// 清理备份存放目录中未固定的文件
+	for _, dir := range dirs {
+		if err := removeExcept(dir, keep); err != nil {
+			CL.PrintErrorf("清理备份存放目录失败: %s", dir)
+			CL.PrintWarnf("请手动清理备份存放目录: %s", dir)
+			continue
+		}
+		CL.PrintOkf("清理备份存放目录成功: %s", dir)
+	}
+
+	CL.PrintOkf("已保留 %d 个固定的版本及其所属任务", len(pinned))
+	return nil
+}
+
+// queryBackupDirs 查询所有任务的备份存放目录、副本存放目录和冷存储目录
+// 参数:
+// - db: 数据库连接
+// 返回值:
+// - []string: 备份存放目录、副本存放目录和冷存储目录
+// - error: 错误信息
+func queryBackupDirs(db *sqlx.DB) ([]string, error) {
+	var tasks globals.BackupTasks
+	if err := db.Select(&tasks, "SELECT backup_directory, replicas, tier_location FROM backup_tasks;"); err != nil {
+		return nil, fmt.Errorf("查询备份任务失败: %w", err)
+	}
+
+	var dirs []string
+	for _, task := range tasks {
+		dirs = append(dirs, task.BackupDirectory)
+		dirs = append(dirs, tools.SplitReplicas(task.Replicas)...)
+		if task.TierLocation != "" {
+			dirs = append(dirs, task.TierLocation)
+		}
+	}
+	return dirs, nil
+}
+
+// removeBackupDir 删除备份存放目录, 远程存储删除其中的所有文件
+// 参数:
+// - dir: 备份存放目录或远程存储地址
+// 返回值:
+// - error: 错误信息
+func removeBackupDir(dir string) error {
+	if tools.IsRemoteLocation(dir) {
+		_, err := tools.ClearRemoteLocation(context.Background(), dir, nil)
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// removeExcept 删除目录中除指定文件以外的所有文件, 并删除清理后为空的子目录
+// 参数:
+// - dir: 要清理的目录或远程存储地址
+// - keep: 需要保留的文件或快照目录路径
+// 返回值:
+// - error: 错误信息
+func removeExcept(dir string, keep map[string]bool) error {
+	if tools.IsRemoteLocation(dir) {
+		_, err := tools.ClearRemoteLocation(context.Background(), dir, keep)
+		return err
+	}
+
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if keep[path] {
+			// 固定的快照版本整个目录都需要保留
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 从最深的目录开始删除空目录, 非空目录会删除失败并被忽略
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+	return nil
+}
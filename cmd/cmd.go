@@ -3,6 +3,8 @@ package cmd
 
 import (
 	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"context"
 	_ "embed"
 	"flag"
 	"fmt"
@@ -86,8 +88,29 @@ var AddTaskTemplate string // 定义添加任务的模板文件
 //go:embed help/help_export.txt
 var HelpExportText string // 定义子命令: export的帮助文本
 
-//go:embed sql/init.sql
-var initSql string // 初始化SQL语句
+//go:embed help/help_ls.txt
+var HelpLsText string // 定义子命令: ls的帮助文本
+
+//go:embed help/help_cat.txt
+var HelpCatText string // 定义子命令: cat的帮助文本
+
+//go:embed help/help_diff.txt
+var HelpDiffText string // 定义子命令: diff的帮助文本
+
+//go:embed help/help_pin.txt
+var HelpPinText string // 定义子命令: pin和unpin的帮助文本
+
+//go:embed help/help_prune.txt
+var HelpPruneText string // 定义子命令: prune的帮助文本
+
+//go:embed help/help_usage.txt
+var HelpUsageText string // 定义子命令: usage的帮助文本
+
+//go:embed help/help_daemon.txt
+var HelpDaemonText string // 定义子命令: daemon的帮助文本
+
+//go:embed help/help_db.txt
+var HelpDbText string // 定义子命令: db的帮助文本
 
 // 定义子命令及其参数
 var (
@@ -96,11 +119,19 @@ var (
 	listTableStyle   = listCmd.String("ts", "default", "表格样式(default, bold, colorbright, colordark, double, light, rounded, bd, cb, cd, de, lt, ro)")
 	listNoTable      = listCmd.Bool("no-table", false, "是否禁用表格输出")
 	listNoTableShort = listCmd.Bool("nt", false, "是否禁用表格输出")
+	listTag          = listCmd.String("tag", "", "仅列出包含任意一个指定标签的任务, 多个标签用逗号分隔")
 
 	// 子命令: run
-	runCmd = flag.NewFlagSet("run", flag.ExitOnError)
-	runID  = runCmd.Int("id", 0, "任务ID")
-	runIDS = runCmd.String("ids", "", "任务ID列表, 多个ID用逗号分隔")
+	runCmd   = flag.NewFlagSet("run", flag.ExitOnError)
+	runID    = taskRefVar(runCmd, "id", "任务ID或任务名")
+	runIDS   = runCmd.String("ids", "", "任务ID或任务名列表, 多个任务用逗号分隔")
+	runTag   = runCmd.String("tag", "", "运行包含任意一个指定标签的任务, 多个标签用逗号分隔")
+	runAll   = runCmd.Bool("all", false, "运行所有任务")
+	runNote  = runCmd.String("m", "", "为本次备份的版本添加备注")
+	runLabel = runCmd.String("label", "", "为本次备份的版本设置标签, 例如: pre-upgrade")
+	runPin   = runCmd.Bool("pin", false, "是否固定本次备份的版本, 固定的版本不会被保留策略清理")
+	runJobs  = runCmd.Int("j", 1, "同时运行的任务数")
+	runNoDep = runCmd.Bool("no-dep", false, "不运行任务的前置任务")
 
 	// 子命令: add
 	addCmd            = flag.NewFlagSet("add", flag.ExitOnError)
@@ -113,25 +144,51 @@ var (
 	addNoCompression  = addCmd.Int("nc", 0, "是否禁用压缩(0: 启用压缩, 1: 禁用压缩)")
 	addConfig         = addCmd.String("f", "", "指定YAML格式的配置文件路径, 用于批量添加任务(格式参考: add_task.yaml)")
 	addExcludeRules   = addCmd.String("ex", "none", "指定要排除的目录名、文件名、扩展名, 用于排除备份文件, 支持通配符模式(默认为none, 不排除任何文件)")
+	addGFS            = addCmd.String("gfs", "none", "GFS保留策略, 格式如 24h,7d,4w,12m,3y, 分别表示保留的小时、天、周、月、年版本数(默认为none, 不启用)")
+	addQuota          = addCmd.String("quota", "none", "备份总大小上限, 如 500MB、10GB, 超出时从最旧的版本开始清理(默认为none, 不限制)")
+	addSchedule       = addCmd.String("schedule", "none", "定时计划, 支持cron表达式(如 \"30 2 * * *\")和 @daily、@hourly、@every 6h 等快捷写法, 由 daemon 命令按计划运行(默认为none, 不定时运行)")
+	addDepends        = addCmd.String("dep", "none", "前置任务ID或任务名, 多个任务用逗号分隔, 运行该任务前先运行前置任务(默认为none, 没有前置任务)")
+	addTags           = addCmd.String("tag", "none", "标签, 多个标签用逗号分隔, 例如 db,prod, 可用于按标签选择任务(默认为none, 没有标签)")
+	addRetries        = addCmd.Int("retries", 0, "运行失败后的重试次数(默认为0, 不重试)")
+	addRetryBackoff   = addCmd.String("backoff", "30s", "第一次重试前的等待时间, 如 30s、5m, 之后每次重试翻倍")
+	addTimeout        = addCmd.String("timeout", "none", "每次运行的超时时间, 如 30m、2h, 超时后取消运行并删除未完成的备份文件(默认为none, 不限制)")
+	addReplicas       = addCmd.String("replicas", "none", "副本存放路径, 多个路径用逗号分隔, 可以是本地目录或远程存储地址, 每次备份成功后复制到每个副本并校验哈希值(默认为none, 不复制)")
+	addType           = addCmd.String("type", globals.TaskTypeArchive, "任务类型, archive: 将目标目录打包为备份文件, mirror: 将备份目录同步为目标目录的镜像, 只复制变化的文件")
+	addMirrorDelete   = addCmd.Int("mirror-delete", 0, "镜像任务是否删除镜像中目标目录已不存在的文件(0: 不删除, 1: 删除)")
+	addTier           = addCmd.String("tier", "none", "分层存储规则, 格式为 <天数>d:<冷存储路径>, 如 14d:/mnt/archive, 超过指定天数的版本在保留策略清理后移动到冷存储(默认为none, 不启用)")
 
 	// 子命令: delete
 	deleteCmd       = flag.NewFlagSet("delete", flag.ExitOnError)
-	deleteID        = deleteCmd.Int("id", 0, "任务ID")
-	deleteIDS       = deleteCmd.String("ids", "", "任务ID列表, 多个ID用逗号分隔")
+	deleteID        = taskRefVar(deleteCmd, "id", "任务ID或任务名")
+	deleteIDS       = deleteCmd.String("ids", "", "任务ID或任务名列表, 多个任务用逗号分隔")
+	deleteTag       = deleteCmd.String("tag", "", "删除包含任意一个指定标签的任务, 多个标签用逗号分隔")
+	deleteAll       = deleteCmd.Bool("all", false, "删除所有任务")
 	deleteName      = deleteCmd.String("n", "", "任务名")
 	deleteDirF      = deleteCmd.Bool("d", false, "在删除任务时，是否同时删除备份文件。若启用此选项，备份文件将被一同删除")
-	deleteVersionID = deleteCmd.String("v", "", "指定要删除的备份版本ID")
+	deleteVersionID = deleteCmd.String("v", "", "指定要删除的备份版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间)")
+	deleteForce     = deleteCmd.Bool("force", false, "是否强制删除已固定的版本或包含固定版本的任务")
 
 	// 子命令: edit
 	editCmd            = flag.NewFlagSet("edit", flag.ExitOnError)
-	editID             = editCmd.Int("id", -1, "指定要编辑的备份任务ID")
-	editIDS            = editCmd.String("ids", "", "指定要编辑的备份任务ID列表, 多个ID用逗号分隔")
+	editID             = taskRefVar(editCmd, "id", "指定要编辑的备份任务ID或任务名")
+	editIDS            = editCmd.String("ids", "", "指定要编辑的备份任务ID或任务名列表, 多个任务用逗号分隔")
 	editName           = editCmd.String("n", "", "指定新的任务名。如果未指定，则任务名保持不变")
 	editRetentionCount = editCmd.Int("c", -1, "指定备份文件的保留数量。如果未指定，则保留数量保持不变")
 	editRetentionDays  = editCmd.Int("d", -1, "指定备份文件的保留天数。如果未指定，则保留天数保持不变")
 	editNewDirName     = editCmd.String("bn", "", "指定新的备份目录名。如果未指定，则备份目录名保持不变")
 	editNoCompression  = editCmd.Int("nc", -1, "是否禁用压缩(0: 启用压缩, 1: 禁用压缩, -1: 不修改)")
 	editExcludeRules   = editCmd.String("ex", "", "指定要排除的目录名、文件名、扩展名, 用于排除备份文件, 支持通配符模式")
+	editGFS            = editCmd.String("gfs", "", "指定GFS保留策略, 格式如 24h,7d,4w,12m,3y, 配置为none表示不启用。如果未指定，则GFS保留策略保持不变")
+	editQuota          = editCmd.String("quota", "", "指定备份总大小上限, 如 500MB、10GB, 配置为none表示不限制。如果未指定，则大小上限保持不变")
+	editSchedule       = editCmd.String("schedule", "", "指定定时计划, 支持cron表达式和 @daily 等快捷写法, 配置为none表示不定时运行。如果未指定，则定时计划保持不变")
+	editDepends        = editCmd.String("dep", "", "指定前置任务ID或任务名, 多个任务用逗号分隔, 配置为none表示清除前置任务。如果未指定，则前置任务保持不变")
+	editTags           = editCmd.String("tag", "", "指定标签, 多个标签用逗号分隔, 配置为none表示清除标签。如果未指定，则标签保持不变")
+	editRetries        = editCmd.Int("retries", -1, "指定运行失败后的重试次数, 0表示不重试。如果未指定，则重试次数保持不变")
+	editRetryBackoff   = editCmd.String("backoff", "", "指定第一次重试前的等待时间, 如 30s、5m。如果未指定，则等待时间保持不变")
+	editTimeout        = editCmd.String("timeout", "", "指定每次运行的超时时间, 如 30m、2h, 配置为none表示不限制。如果未指定，则超时时间保持不变")
+	editReplicas       = editCmd.String("replicas", "", "指定副本存放路径, 多个路径用逗号分隔, 配置为none表示不复制。如果未指定，则副本保持不变")
+	editMirrorDelete   = editCmd.Int("mirror-delete", -1, "镜像任务是否删除镜像中目标目录已不存在的文件(0: 不删除, 1: 删除, -1: 不修改)")
+	editTier           = editCmd.String("tier", "", "指定分层存储规则, 格式为 <天数>d:<冷存储路径>, 配置为none表示不启用。如果未指定，则分层存储规则保持不变")
 
 	// 子命令: log
 	logCmd          = flag.NewFlagSet("log", flag.ExitOnError)
@@ -143,16 +200,20 @@ var (
 
 	// 子命令: show
 	showCmd          = flag.NewFlagSet("show", flag.ExitOnError)
-	showID           = showCmd.Int("id", 0, "任务ID")
+	showID           = taskRefVar(showCmd, "id", "任务ID或任务名")
+	showTag          = showCmd.String("tag", "", "显示包含任意一个指定标签的任务, 多个标签用逗号分隔")
+	showAll          = showCmd.Bool("all", false, "显示所有任务")
 	showView         = showCmd.Bool("v", false, "是否显示详细信息")
 	showTableStyle   = showCmd.String("ts", "default", "表格样式(default, bold, colorbright, colordark, double, light, rounded, bd, cb, cd, de, lt, ro)")
 	showNoTable      = showCmd.Bool("no-table", false, "是否禁用表格输出")
 	showNoTableShort = showCmd.Bool("nt", false, "是否禁用表格输出")
+	showVersion      = showCmd.String("ver", "", "仅显示指定的备份版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间)")
+	showExplain      = showCmd.Bool("explain", false, "是否显示保留策略对每个版本的判定结果及原因")
 
 	// 子命令: unpack
 	unpackCmd       = flag.NewFlagSet("unpack", flag.ExitOnError)
-	unpackID        = unpackCmd.Int("id", 0, "任务ID")
-	unpackVersionID = unpackCmd.String("v", "", "指定解压的版本ID")
+	unpackID        = taskRefVar(unpackCmd, "id", "任务ID或任务名")
+	unpackVersionID = unpackCmd.String("v", "", "指定解压的版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间, 默认: latest-success)")
 	unpackOutput    = unpackCmd.String("o", ".", "指定输出的路径(默认当前目录)")
 
 	// 子命令: zip
@@ -176,15 +237,87 @@ var (
 	// 子命令: clear
 	clearCmd     = flag.NewFlagSet("clear", flag.ExitOnError)
 	clearConfirm = clearCmd.Bool("confirm", false, "确认是否执行清空数据操作")
+	clearForce   = clearCmd.Bool("force", false, "是否同时清除已固定的版本")
 
 	// 子命令: init
-	initCmd  = flag.NewFlagSet("complete", flag.ExitOnError)
-	initType = initCmd.String("type", "", "指定要生成的配置类型, 可选值: bash, addtask")
+	initCmd    = flag.NewFlagSet("complete", flag.ExitOnError)
+	initType   = initCmd.String("type", "", "指定要生成的配置类型, 可选值: bash, addtask, systemd, cron")
+	initID     = taskRefVar(initCmd, "id", "生成systemd单元或crontab条目时, 指定任务ID或任务名")
+	initAll    = initCmd.Bool("all", false, "生成systemd单元或crontab条目时, 为所有设置了定时计划的任务生成")
+	initOutput = initCmd.String("o", "", "生成systemd单元时, 将单元文件写入指定目录(默认输出到控制台)")
 
 	// 子命令: export
 	exportCmd = flag.NewFlagSet("export", flag.ExitOnError)
-	exportID  = exportCmd.Int("id", 0, "指定要导出的任务ID")
+	exportID  = taskRefVar(exportCmd, "id", "指定要导出的任务ID或任务名")
+	exportTag = exportCmd.String("tag", "", "导出包含任意一个指定标签的任务, 多个标签用逗号分隔")
 	exportAll = exportCmd.Bool("all", false, "导出所有任务")
+
+	// 子命令: ls
+	lsCmd        = flag.NewFlagSet("ls", flag.ExitOnError)
+	lsID         = taskRefVar(lsCmd, "id", "任务ID或任务名")
+	lsVersionID  = lsCmd.String("v", "", "指定要查看的版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间, 默认: latest-success)")
+	lsFile       = lsCmd.String("f", "", "指定要查看的ZIP文件路径(不依赖备份任务)")
+	lsRecursive  = lsCmd.Bool("r", false, "是否递归列出所有子条目")
+	lsLong       = lsCmd.Bool("l", false, "是否以长格式显示(权限、大小、压缩率、修改时间)")
+	lsTable      = lsCmd.Bool("table", false, "是否以表格形式显示")
+	lsTableStyle = lsCmd.String("ts", "default", "表格样式(default, bold, colorbright, colordark, double, light, rounded, bd, cb, cd, de, lt, ro)")
+
+	// 子命令: cat
+	catCmd       = flag.NewFlagSet("cat", flag.ExitOnError)
+	catID        = taskRefVar(catCmd, "id", "任务ID或任务名")
+	catVersionID = catCmd.String("v", "", "指定要读取的版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间, 默认: latest-success)")
+	catFile      = catCmd.String("f", "", "指定要读取的ZIP文件路径(不依赖备份任务)")
+
+	// 子命令: diff
+	diffCmd       = flag.NewFlagSet("diff", flag.ExitOnError)
+	diffID        = taskRefVar(diffCmd, "id", "任务ID或任务名")
+	diffFrom      = diffCmd.String("from", "", "指定要比较的旧版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间)")
+	diffTo        = diffCmd.String("to", "", "指定要比较的新版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间, 默认: latest-success)")
+	diffUnified   = diffCmd.Bool("u", false, "是否显示修改过的文本文件的统一格式差异")
+	diffJSON      = diffCmd.Bool("json", false, "是否以JSON格式输出比较结果")
+	diffLive      = diffCmd.Bool("live", false, "是否将备份版本与任务目标目录的当前内容进行比较")
+	diffVersionID = diffCmd.String("v", "", "-live 模式下要比较的版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间, 默认: latest-success)")
+	diffChecksum  = diffCmd.Bool("checksum", false, "-live 模式下是否读取所有文件计算校验值(默认仅对大小或修改时间变化的文件计算)")
+
+	// 子命令: pin
+	pinCmd       = flag.NewFlagSet("pin", flag.ExitOnError)
+	pinID        = taskRefVar(pinCmd, "id", "任务ID或任务名")
+	pinVersionID = pinCmd.String("v", "", "指定要固定的版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间, 默认: latest-success)")
+	pinLabel     = pinCmd.String("label", "", "为版本设置标签, 例如: pre-upgrade")
+	pinNote      = pinCmd.String("m", "", "为版本设置备注")
+
+	// 子命令: unpin
+	unpinCmd       = flag.NewFlagSet("unpin", flag.ExitOnError)
+	unpinID        = taskRefVar(unpinCmd, "id", "任务ID或任务名")
+	unpinVersionID = unpinCmd.String("v", "", "指定要取消固定的版本(版本ID、ID前缀、latest、latest~N、latest-success或日期时间)")
+
+	// 子命令: prune
+	pruneCmd          = flag.NewFlagSet("prune", flag.ExitOnError)
+	pruneID           = taskRefVar(pruneCmd, "id", "任务ID或任务名")
+	pruneTag          = pruneCmd.String("tag", "", "清理包含任意一个指定标签的任务, 多个标签用逗号分隔")
+	pruneAll          = pruneCmd.Bool("all", false, "清理所有任务")
+	pruneDryRun       = pruneCmd.Bool("dry-run", false, "仅预览需要清理的版本, 不删除任何文件")
+	pruneTableStyle   = pruneCmd.String("ts", "default", "表格样式(default, bold, colorbright, colordark, double, light, rounded, bd, cb, cd, de, lt, ro)")
+	pruneNoTable      = pruneCmd.Bool("no-table", false, "是否禁用表格输出")
+	pruneNoTableShort = pruneCmd.Bool("nt", false, "是否禁用表格输出")
+
+	// 子命令: usage
+	usageCmd          = flag.NewFlagSet("usage", flag.ExitOnError)
+	usageBudget       = usageCmd.String("budget", "", "设置数据目录的全局磁盘预算, 如 50GB, 配置为none表示清除预算")
+	usageTableStyle   = usageCmd.String("ts", "default", "表格样式(default, bold, colorbright, colordark, double, light, rounded, bd, cb, cd, de, lt, ro)")
+	usageNoTable      = usageCmd.Bool("no-table", false, "是否禁用表格输出")
+	usageNoTableShort = usageCmd.Bool("nt", false, "是否禁用表格输出")
+
+	// 子命令: daemon
+	daemonCmd     = flag.NewFlagSet("daemon", flag.ExitOnError)
+	daemonCatchup = daemonCmd.String("catchup", "once", "错过运行时间后的补跑策略(once: 启动时补跑一次, skip: 跳过错过的运行)")
+
+	// 子命令: db migrate
+	dbMigrateCmd          = flag.NewFlagSet("db migrate", flag.ExitOnError)
+	dbMigrateStatus       = dbMigrateCmd.Bool("status", false, "仅显示每个迁移的应用状态, 不应用迁移")
+	dbMigrateTableStyle   = dbMigrateCmd.String("ts", "default", "表格样式(default, bold, colorbright, colordark, double, light, rounded, bd, cb, cd, de, lt, ro)")
+	dbMigrateNoTable      = dbMigrateCmd.Bool("no-table", false, "是否禁用表格输出")
+	dbMigrateNoTableShort = dbMigrateCmd.Bool("nt", false, "是否禁用表格输出")
 )
 
 // 初始化子命令的帮助信息
@@ -253,12 +386,64 @@ func init() {
 	exportCmd.Usage = func() {
 		fmt.Println(HelpExportText)
 	}
+
+	// 初始化ls命令的帮助信息
+	lsCmd.Usage = func() {
+		fmt.Println(HelpLsText)
+	}
+
+	// 初始化cat命令的帮助信息
+	catCmd.Usage = func() {
+		fmt.Println(HelpCatText)
+	}
+
+	// 初始化diff命令的帮助信息
+	diffCmd.Usage = func() {
+		fmt.Println(HelpDiffText)
+	}
+
+	// 初始化pin和unpin命令的帮助信息
+	pinCmd.Usage = func() {
+		fmt.Println(HelpPinText)
+	}
+	unpinCmd.Usage = func() {
+		fmt.Println(HelpPinText)
+	}
+
+	// 初始化prune命令的帮助信息
+	pruneCmd.Usage = func() {
+		fmt.Println(HelpPruneText)
+	}
+
+	// 初始化usage命令的帮助信息
+	usageCmd.Usage = func() {
+		fmt.Println(HelpUsageText)
+	}
+
+	// 初始化daemon命令的帮助信息
+	daemonCmd.Usage = func() {
+		fmt.Println(HelpDaemonText)
+	}
+
+	// 初始化db命令的帮助信息
+	dbMigrateCmd.Usage = func() {
+		fmt.Println(HelpDbText)
+	}
 }
 
 // 程序运行入口
 func AppRun() error {
-	// 初始化数据库
-	db, initDBErr := initDB()
+	// 主标志
+	vFlag := flag.Bool("v", false, "显示版本信息")
+	vvFlag := flag.Bool("vv", false, "显示更详细的版本信息")
+	hFlag := flag.Bool("h", false, "显示帮助信息")
+	helpFlag := flag.Bool("help", false, "显示帮助信息")
+
+	// 解析主标志
+	flag.Parse()
+
+	// 初始化数据库, db命令自行决定是否应用迁移, 以便升级前查看待应用的迁移
+	db, initDBErr := initDB(flag.Arg(0) != "db")
 	if initDBErr != nil {
 		return fmt.Errorf("初始化数据库失败: %w", initDBErr)
 	}
@@ -278,15 +463,6 @@ func AppRun() error {
 		return fmt.Errorf("初始化数据目录失败: %w", initDataDirErr)
 	}
 
-	// 主标志
-	vFlag := flag.Bool("v", false, "显示版本信息")
-	vvFlag := flag.Bool("vv", false, "显示更详细的版本信息")
-	hFlag := flag.Bool("h", false, "显示帮助信息")
-	helpFlag := flag.Bool("help", false, "显示帮助信息")
-
-	// 解析主标志
-	flag.Parse()
-
 	// 打印版本信息
 	if *vFlag {
 		v := verman.Get()
@@ -333,10 +509,12 @@ func AppRun() error {
 }
 
 // 初始化数据库
+// 参数:
+// autoMigrate: 是否应用尚未应用的迁移
 // 返回值:
 // *sqlx.DB: 数据库连接
 // error: 错误信息
-func initDB() (*sqlx.DB, error) {
+func initDB(autoMigrate bool) (*sqlx.DB, error) {
 	// 获取用户主目录
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -358,46 +536,87 @@ func initDB() (*sqlx.DB, error) {
 	// 构造数据库文件路径
 	dbPath := filepath.Join(dbDir, globals.CbkDBFile)
 
-	// 检查数据库文件是否存在, 如果不存在, 则创建并初始化
-	if _, statErr := os.Stat(dbPath); os.IsNotExist(statErr) {
-		// 连接数据库
-		db, connectErr := sqlx.Connect("sqlite3", dbPath)
-		if connectErr != nil {
-			return nil, fmt.Errorf("连接数据库失败: %w", connectErr)
-		}
-
-		// 执行初始化SQL语句
-		if _, execErr := db.Exec(initSql); execErr != nil {
-			return nil, fmt.Errorf("执行初始化SQL语句失败: %w", execErr)
-		}
+	// 连接数据库, 数据库文件不存在时会自动创建
+	db, connectErr := sqlx.Connect("sqlite3", dbDSN(dbPath))
+	if connectErr != nil {
+		return nil, fmt.Errorf("连接数据库失败: %w", connectErr)
+	}
 
-		// 直接返回连接
+	// 应用尚未应用的迁移, 新建的数据库从第一个迁移开始创建表结构
+	if !autoMigrate {
 		return db, nil
-	} else if statErr != nil {
-		return nil, fmt.Errorf("连接到数据库文件失败: %w", statErr)
 	}
-
-	// 存在数据库文件, 直接连接
-	db, connectErr := sqlx.Connect("sqlite3", dbPath)
-	if connectErr != nil {
-		return nil, fmt.Errorf("连接数据库失败: %w", connectErr)
+	if _, migrateErr := migrateDB(db, dbPath); migrateErr != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("升级数据库失败: %w", migrateErr)
 	}
 
 	return db, nil
 }
 
-// 初始化数据目录
+// 等待其他连接释放数据库锁的最长时间(毫秒)
+const dbBusyTimeout = 30000
+
+// dbDSN 返回数据库的连接字符串
+// 使用WAL模式以便读写互不阻塞, 设置忙等待超时以便命令行、守护进程和并发运行的任务同时写入时等待而不是报错,
+// 事务在开始时即获取写锁, 避免读事务升级为写事务时因死锁直接失败
+func dbDSN(dbPath string) string {
+	return fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", dbPath, dbBusyTimeout)
+}
+
+// 获取数据目录路径
 // 返回值:
+// string: 数据目录路径(用户主目录/.cbk/data)
 // error: 错误信息
-func initDataDir() error {
+func getDataDir() (string, error) {
 	// 获取用户主目录
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("获取用户主目录失败: %w", err)
+		return "", fmt.Errorf("获取用户主目录失败: %w", err)
+	}
+
+	return filepath.Join(homeDir, globals.CbkHomeDir, globals.CbkDataDir), nil
+}
+
+// 获取暂存目录路径, 备份到远程存储时先在暂存目录中生成备份文件
+// 返回值:
+// string: 暂存目录路径(用户主目录/.cbk/staging)
+// error: 错误信息
+func getStageDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户主目录失败: %w", err)
+	}
+
+	return filepath.Join(homeDir, globals.CbkHomeDir, globals.CbkStageDir), nil
+}
+
+// lockTask 获取任务的运行锁, 同一任务同时只能有一个进程运行或清理
+// 参数:
+// id: 任务ID
+// name: 任务名
+// 返回值:
+// *tools.FileLock: 获取到的锁
+// error: 锁被其他进程持有时返回 *tools.LockedError
+func lockTask(id int, name string) (*tools.FileLock, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("获取用户主目录失败: %w", err)
 	}
 
-	// 构造数据目录路径
-	dataDir := filepath.Join(homeDir, globals.CbkHomeDir, globals.CbkDataDir)
+	path := filepath.Join(homeDir, globals.CbkHomeDir, globals.CbkLockDir, fmt.Sprintf("task-%d.lock", id))
+	return tools.AcquireLock(path, fmt.Sprintf("任务 [%s]", name))
+}
+
+// 初始化数据目录
+// 返回值:
+// error: 错误信息
+func initDataDir() error {
+	// 获取数据目录路径
+	dataDir, err := getDataDir()
+	if err != nil {
+		return err
+	}
 
 	// 检查数据目录是否存在, 如果不存在, 则创建
 	if _, statErr := os.Stat(dataDir); os.IsNotExist(statErr) {
@@ -653,7 +872,7 @@ func executeCommands(db *sqlx.DB, args []string) error {
 		}
 
 		// 执行init命令的逻辑
-		if err := initCmdMain(*initType); err != nil {
+		if err := initCmdMain(db, *initType); err != nil {
 			return fmt.Errorf("生成文件失败: %v", err)
 		}
 		return nil
@@ -667,8 +886,177 @@ func executeCommands(db *sqlx.DB, args []string) error {
 			return fmt.Errorf("导出数据库失败: %v", err)
 		}
 		return nil
+	case "ls":
+		// 解析ls命令的参数
+		if err := lsCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析ls命令参数失败: %v", err)
+		}
+		// 执行ls命令的逻辑
+		if err := lsCmdMain(db); err != nil {
+			return fmt.Errorf("列出备份内容失败: %v", err)
+		}
+		return nil
+	case "cat":
+		// 解析cat命令的参数
+		if err := catCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析cat命令参数失败: %v", err)
+		}
+		// 执行cat命令的逻辑
+		if err := catCmdMain(db); err != nil {
+			return fmt.Errorf("读取备份文件失败: %v", err)
+		}
+		return nil
+	case "diff":
+		// 解析diff命令的参数
+		if err := diffCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析diff命令参数失败: %v", err)
+		}
+		// 执行diff命令的逻辑
+		if err := diffCmdMain(db); err != nil {
+			return fmt.Errorf("比较备份版本失败: %v", err)
+		}
+		return nil
+	case "pin":
+		// 解析pin命令的参数
+		if err := pinCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析pin命令参数失败: %v", err)
+		}
+		// 执行pin命令的逻辑
+		if err := pinCmdMain(db); err != nil {
+			return fmt.Errorf("固定版本失败: %v", err)
+		}
+		return nil
+	case "unpin":
+		// 解析unpin命令的参数
+		if err := unpinCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析unpin命令参数失败: %v", err)
+		}
+		// 执行unpin命令的逻辑
+		if err := unpinCmdMain(db); err != nil {
+			return fmt.Errorf("取消固定版本失败: %v", err)
+		}
+		return nil
+	case "prune":
+		// 解析prune命令的参数
+		if err := pruneCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析prune命令参数失败: %v", err)
+		}
+		// 执行prune命令的逻辑
+		if err := pruneCmdMain(db); err != nil {
+			return fmt.Errorf("清理备份版本失败: %v", err)
+		}
+		return nil
+	case "usage":
+		// 解析usage命令的参数
+		if err := usageCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析usage命令参数失败: %v", err)
+		}
+		// 执行usage命令的逻辑
+		if err := usageCmdMain(db); err != nil {
+			return fmt.Errorf("统计空间占用失败: %v", err)
+		}
+		return nil
+	case "daemon":
+		// 解析daemon命令的参数
+		if err := daemonCmd.Parse(args[1:]); err != nil {
+			return fmt.Errorf("解析daemon命令参数失败: %v", err)
+		}
+		// 执行daemon命令的逻辑
+		if err := daemonCmdMain(db); err != nil {
+			return fmt.Errorf("定时调度失败: %v", err)
+		}
+		return nil
+	case "db":
+		// db命令目前只有migrate子命令
+		if len(args) >= 2 && (args[1] == "-h" || args[1] == "-help" || args[1] == "--help") {
+			dbMigrateCmd.Usage()
+			return nil
+		}
+		if len(args) < 2 || args[1] != "migrate" {
+			dbMigrateCmd.Usage()
+			return fmt.Errorf("未知的db子命令, 可选: migrate")
+		}
+		// 解析db migrate命令的参数
+		if err := dbMigrateCmd.Parse(args[2:]); err != nil {
+			return fmt.Errorf("解析db migrate命令参数失败: %v", err)
+		}
+		// 执行db migrate命令的逻辑
+		if err := dbMigrateCmdMain(db); err != nil {
+			return fmt.Errorf("数据库迁移失败: %v", err)
+		}
+		return nil
 	// 未知命令
 	default:
 		return fmt.Errorf("未知命令: %s", args[0])
 	}
 }
+
+// openVersionReader 根据任务ID和版本选择器打开备份版本的读取器
+// 参数:
+// - db: 数据库连接
+// - taskID: 任务ID
+// - selector: 版本选择器
+// 返回值:
+// - tools.VersionReader: 版本读取器, 使用完毕后需要关闭
+// - globals.BackupRecord: 解析到的备份记录
+// - error: 错误信息
+func openVersionReader(db *sqlx.DB, taskID int, selector string) (tools.VersionReader, globals.BackupRecord, error) {
+	// 根据版本选择器解析备份记录
+	record, err := tools.ResolveVersion(db, taskID, selector)
+	if err != nil {
+		return nil, record, fmt.Errorf("解析版本失败: %w", err)
+	}
+
+	// 检查该版本是否为成功的备份
+	if !tools.IsSuccessRecord(record) {
+		return nil, record, fmt.Errorf("版本 %s 是一次失败的备份, 没有可读取的备份文件", record.VersionID)
+	}
+
+	// 打开备份文件
+	reader, err := tools.OpenVersion(context.Background(), record)
+	if err != nil {
+		return nil, record, fmt.Errorf("读取版本 %s 失败: %w", record.VersionID, err)
+	}
+
+	return reader, record, nil
+}
+
+// openArchiveReader 根据命令行参数打开备份版本或ZIP文件的读取器
+// 参数:
+// - db: 数据库连接
+// - taskID: 任务ID, 为0时表示未指定
+// - selector: 版本选择器, 为空时默认为 latest-success
+// - zipFile: ZIP文件路径, 为空时表示未指定
+// 返回值:
+// - tools.VersionReader: 版本读取器, 使用完毕后需要关闭
+// - error: 错误信息
+func openArchiveReader(db *sqlx.DB, taskID int, selector, zipFile string) (tools.VersionReader, error) {
+	// 检查是否同时指定了任务ID和ZIP文件
+	if taskID != 0 && zipFile != "" {
+		return nil, fmt.Errorf("不能同时使用 -id 和 -f 参数, 请选择其中一种方式指定要读取的备份")
+	}
+
+	// 读取任意ZIP文件
+	if zipFile != "" {
+		// 对指定的ZIP文件路径进行清理和获取绝对路径
+		if err := tools.SanitizePath(&zipFile); err != nil {
+			return nil, fmt.Errorf("获取ZIP文件绝对路径失败: %w", err)
+		}
+		if _, err := tools.CheckPath(zipFile); err != nil {
+			return nil, fmt.Errorf("指定的ZIP文件路径不存在: %s", zipFile)
+		}
+		return tools.OpenZipReader(zipFile)
+	}
+
+	// 读取备份任务的指定版本
+	if taskID != 0 {
+		// 未指定版本时默认读取最新的成功版本
+		if selector == "" {
+			selector = tools.SelectorLatestSuccess
+		}
+		reader, _, err := openVersionReader(db, taskID, selector)
+		return reader, err
+	}
+
+	return nil, fmt.Errorf("必须使用 -id 指定任务ID或使用 -f 指定ZIP文件")
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"cbk/pkg/tools"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 守护进程重新加载定时计划的间隔
+const daemonReloadInterval = 30 * time.Second
+
+// 补跑策略
+const (
+	catchupOnce = "once" // 启动或加载任务时, 如果错过了运行时间则补跑一次
+	catchupSkip = "skip" // 跳过错过的运行, 等待下一次运行时间
+)
+
+// scheduledTask 表示守护进程中的一个定时任务
+type scheduledTask struct {
+	id       int            // 任务ID
+	name     string         // 任务名
+	spec     string         // 定时计划
+	schedule tools.Schedule // 解析后的定时计划, 定时计划无效时为nil
+	next     time.Time      // 下一次运行时间
+}
+
+// daemonCmdMain 常驻运行, 按定时计划执行备份任务
+// 收到 SIGINT 或 SIGTERM 信号时等待正在运行的任务完成后退出, 再次收到信号时立即中止并删除未完成的备份文件
+func daemonCmdMain(db *sqlx.DB) error {
+	// 检查补跑策略是否合法
+	if *daemonCatchup != catchupOnce && *daemonCatchup != catchupSkip {
+		return fmt.Errorf("无效的补跑策略: %s, 可选: %s, %s", *daemonCatchup, catchupOnce, catchupSkip)
+	}
+
+	// 监听退出信号
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	// 加载定时任务
+	tasks := make(map[int]*scheduledTask)
+	if err := reloadSchedules(db, tasks, time.Now()); err != nil {
+		return err
+	}
+	daemonLogf("守护进程已启动, 共 %d 个定时任务, 补跑策略: %s", len(tasks), *daemonCatchup)
+
+	lastReload := time.Now()
+	for {
+		// 定期重新加载定时计划, 以便应用新增、修改或删除的任务
+		if time.Since(lastReload) >= daemonReloadInterval {
+			if err := reloadSchedules(db, tasks, time.Now()); err != nil {
+				CL.PrintErrf("重新加载定时计划失败: %v", err)
+			}
+			lastReload = time.Now()
+		}
+
+		// 依次运行所有到期的任务
+		now := time.Now()
+		for _, task := range sortedSchedules(tasks) {
+			if task.schedule == nil || task.next.IsZero() || task.next.After(now) {
+				continue
+			}
+
+			// 运行下一个任务前检查是否已收到退出信号
+			select {
+			case sig := <-sigCh:
+				daemonLogf("收到 %s 信号, 守护进程退出", sig)
+				return nil
+			default:
+			}
+
+			daemonLogf("开始运行任务 [%s] (ID: %d)", task.name, task.id)
+			if stopped, err := runScheduledTask(db, task.id, sigCh); err != nil {
+				return err
+			} else if stopped {
+				daemonLogf("任务 [%s] 已完成, 守护进程退出", task.name)
+				return nil
+			}
+
+			// 从运行结束的时间开始计算下一次运行时间, 运行期间错过的时间不再补跑
+			task.next = task.schedule.Next(time.Now())
+			daemonLogf("任务 [%s] 运行结束, 下次运行时间: %s", task.name, formatNextRun(task.next))
+		}
+
+		// 等待下一个任务到期、重新加载或退出信号
+		wait := daemonReloadInterval - time.Since(lastReload)
+		for _, task := range tasks {
+			if task.schedule != nil && !task.next.IsZero() {
+				if d := time.Until(task.next); d < wait {
+					wait = d
+				}
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case sig := <-sigCh:
+			timer.Stop()
+			daemonLogf("收到 %s 信号, 守护进程退出", sig)
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// runScheduledTask 在后台运行备份任务, 并在运行期间处理退出信号
+// 第二次收到退出信号时取消任务的上下文, 等待任务中止并写入 cancelled 记录后返回
+// 返回值:
+// - bool: 运行期间是否收到了退出信号
+// - error: 收到第二次退出信号并中止任务时返回错误
+func runScheduledTask(db *sqlx.DB, id int, sigCh <-chan os.Signal) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runTask(ctx, db, []int{id})
+	}()
+
+	stopped := false
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				CL.PrintErrf("运行任务失败: %v", err)
+			}
+			return stopped, nil
+		case sig := <-sigCh:
+			if !stopped {
+				stopped = true
+				daemonLogf("收到 %s 信号, 等待当前任务完成后退出, 再次发送信号将立即中止", sig)
+				continue
+			}
+
+			// 再次收到信号时中止任务, 等待任务删除未完成的备份文件并释放任务锁
+			daemonLogf("收到 %s 信号, 正在中止当前任务", sig)
+			cancel()
+			if err := <-done; err != nil {
+				CL.PrintErrf("运行任务失败: %v", err)
+			}
+
+			// 任务结束后仍未清理的备份文件
+			for _, path := range tools.RemovePartialArchives() {
+				daemonLogf("已删除未完成的备份文件: %s", path)
+			}
+			return true, fmt.Errorf("收到 %s 信号, 已中止正在运行的任务", sig)
+		}
+	}
+}
+
+// reloadSchedules 从数据库加载定时任务
+// 定时计划未变化的任务保持原有的下一次运行时间, 新增或修改的任务根据补跑策略计算下一次运行时间
+// 参数:
+// - db: 数据库连接
+// - tasks: 当前的定时任务, 以任务ID为键
+// - now: 当前时间
+// 返回值:
+// - error: 错误信息
+func reloadSchedules(db *sqlx.DB, tasks map[int]*scheduledTask, now time.Time) error {
+	var rows []struct {
+		TaskID   int    `db:"task_id"`
+		TaskName string `db:"task_name"`
+		Schedule string `db:"schedule"`
+	}
+	if err := db.Select(&rows, "SELECT task_id, task_name, schedule FROM backup_tasks WHERE schedule != '' ORDER BY task_id"); err != nil {
+		return fmt.Errorf("查询定时任务失败: %w", err)
+	}
+
+	seen := make(map[int]bool)
+	for _, row := range rows {
+		seen[row.TaskID] = true
+
+		// 定时计划未变化时只更新任务名
+		if task, ok := tasks[row.TaskID]; ok && task.spec == row.Schedule {
+			task.name = row.TaskName
+			continue
+		}
+
+		_, existed := tasks[row.TaskID]
+		task := &scheduledTask{id: row.TaskID, name: row.TaskName, spec: row.Schedule}
+		tasks[row.TaskID] = task
+
+		schedule, err := tools.ParseSchedule(row.Schedule)
+		if err != nil {
+			CL.PrintErrf("任务 [%s] (ID: %d) 的定时计划无效, 已跳过: %v", row.TaskName, row.TaskID, err)
+			continue
+		}
+		task.schedule = schedule
+
+		next, err := firstRun(db, task, now)
+		if err != nil {
+			return err
+		}
+		task.next = next
+
+		if existed {
+			daemonLogf("任务 [%s] 的定时计划已更新为 %s, 下次运行时间: %s", task.name, task.spec, formatNextRun(task.next))
+		} else {
+			daemonLogf("已加载任务 [%s] 的定时计划 %s, 下次运行时间: %s", task.name, task.spec, formatNextRun(task.next))
+		}
+	}
+
+	// 移除已删除或取消定时计划的任务
+	for id, task := range tasks {
+		if !seen[id] {
+			delete(tasks, id)
+			daemonLogf("任务 [%s] 的定时计划已移除", task.name)
+		}
+	}
+
+	return nil
+}
+
+// firstRun 计算新加载的任务的下一次运行时间
+// 补跑策略为 once 时, 如果上一次运行后错过了运行时间, 则立即运行一次
+func firstRun(db *sqlx.DB, task *scheduledTask, now time.Time) (time.Time, error) {
+	if *daemonCatchup == catchupSkip {
+		return task.schedule.Next(now), nil
+	}
+
+	// 查询上一次运行的时间, 从未运行过的任务等待下一次运行时间
+	var last sql.NullString
+	if err := db.Get(&last, "SELECT max(timestamp) FROM backup_records WHERE task_id = ?", task.id); err != nil {
+		return time.Time{}, fmt.Errorf("查询任务 [%s] 上一次运行的时间失败: %w", task.name, err)
+	}
+	if !last.Valid {
+		return task.schedule.Next(now), nil
+	}
+	lastRun, err := tools.ParseRecordTime(last.String)
+	if err != nil {
+		return task.schedule.Next(now), nil
+	}
+
+	// 上一次运行后的下一次运行时间已经过去, 说明错过了运行
+	if next := task.schedule.Next(lastRun); !next.IsZero() && !next.After(now) {
+		daemonLogf("任务 [%s] 错过了 %s 的运行, 将立即补跑", task.name, next.Format("2006-01-02 15:04"))
+		return now, nil
+	}
+	return task.schedule.Next(now), nil
+}
+
+// sortedSchedules 返回按下一次运行时间排序的定时任务, 时间相同时按任务ID排序
+func sortedSchedules(tasks map[int]*scheduledTask) []*scheduledTask {
+	list := make([]*scheduledTask, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, task)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].next.Equal(list[j].next) {
+			return list[i].next.Before(list[j].next)
+		}
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+// formatNextRun 返回下一次运行时间的显示文本
+func formatNextRun(next time.Time) string {
+	if next.IsZero() {
+		return "无"
+	}
+	return next.Format("2006-01-02 15:04:05")
+}
+
+// daemonLogf 打印带时间前缀的守护进程日志
+func daemonLogf(format string, a ...any) {
+	CL.PrintOkf("[%s] %s", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dbMigrateCmdMain 应用尚未应用的数据库迁移, 或显示每个迁移的应用状态
+// 其他命令启动时会自动应用迁移, db命令打开数据库时不应用, 以便在升级前用 -status 查看待应用的迁移
+// 参数:
+// - db: 数据库连接
+// 返回值:
+// - error: 错误信息
+func dbMigrateCmdMain(db *sqlx.DB) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("获取用户主目录失败: %w", err)
+	}
+	dbPath := filepath.Join(homeDir, globals.CbkDbPath)
+
+	// 如果未指定-status参数, 则应用尚未应用的迁移
+	if !*dbMigrateStatus {
+		migrated, err := migrateDB(db, dbPath)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrated {
+			CL.PrintOkf("已应用迁移: %04d_%s", m.Version, m.Name)
+		}
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := loadAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	appliedAt := make(map[int]string)
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt
+		if t, err := tools.ParseRecordTime(m.AppliedAt); err == nil {
+			appliedAt[m.Version] = t.Format("2006-01-02 15:04:05")
+		}
+	}
+	current := schemaVersion(applied)
+
+	if !*dbMigrateStatus {
+		CL.PrintOkf("数据库已是最新版本: %d", current)
+		return nil
+	}
+
+	// 禁用表格的输出
+	if *dbMigrateNoTable || *dbMigrateNoTableShort {
+		fmt.Printf("%-10s%-40s%-10s%s\n", "版本", "名称", "状态", "应用时间")
+		for _, m := range migrations {
+			fmt.Printf("%-10d%-40s%-10s%s\n", m.Version, m.Name, migrationState(appliedAt, m.Version), appliedAt[m.Version])
+		}
+	} else {
+		// 创建表格
+		t := table.NewWriter()
+
+		// 设置表格输出到标准输出
+		t.SetOutputMirror(os.Stdout)
+
+		// 设置表格样式
+		if style, ok := TableStyle[*dbMigrateTableStyle]; ok {
+			t.SetStyle(style)
+		} else {
+			// 定义样式列表
+			var styleList []string
+			for k := range TableStyle {
+				styleList = append(styleList, k)
+			}
+			return fmt.Errorf("表格样式不存在: %s, 可选样式: %v", *dbMigrateTableStyle, styleList)
+		}
+
+		// 添加表头
+		t.AppendHeader(table.Row{"版本", "名称", "状态", "应用时间"})
+
+		// 将每个迁移的状态添加到表格
+		for _, m := range migrations {
+			t.AppendRow(table.Row{m.Version, m.Name, migrationState(appliedAt, m.Version), appliedAt[m.Version]})
+		}
+
+		// 设置列配置
+		t.SetColumnConfigs([]table.ColumnConfig{
+			{Name: "版本", Align: text.AlignCenter},
+			{Name: "名称", Align: text.AlignLeft},
+			{Name: "状态", Align: text.AlignCenter},
+			{Name: "应用时间", Align: text.AlignCenter},
+		})
+
+		// 输出表格
+		t.Render()
+	}
+
+	// 打印数据库的版本和备份目录
+	fmt.Printf("数据库文件: %s\n", dbPath)
+	fmt.Printf("当前版本: %d, 最新版本: %d\n", current, len(migrations))
+	if current < len(migrations) {
+		fmt.Printf("待应用的迁移: %d 个, 运行 cbk db migrate 升级数据库\n", len(migrations)-current)
+	}
+	fmt.Printf("升级前的数据库备份目录: %s\n", filepath.Join(filepath.Dir(dbPath), globals.CbkDBBackupDir))
+	return nil
+}
+
+// migrationState 返回迁移的应用状态
+func migrationState(appliedAt map[int]string, version int) string {
+	if _, ok := appliedAt[version]; ok {
+		return "已应用"
+	}
+	return "待应用"
+}
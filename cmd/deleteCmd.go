@@ -1,46 +1,33 @@
 package cmd
 
 import (
+	"cbk/pkg/globals"
 	"cbk/pkg/tools"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
 
 	"github.com/jmoiron/sqlx"
 )
 
 // delete命令的执行逻辑
 func deleteCmdMain(db *sqlx.DB) error {
-	// 存储任务ID的切片
-	var ids []int
-
-	// 如果指定了多个任务ID, 则执行多任务模式
-	if *deleteIDS != "" {
-		// 解析多个任务ID
-		for _, idStr := range strings.Split(*deleteIDS, ",") {
-			// 检查解析的任务ID是否为空
-			if idStr == "" {
-				CL.PrintErr("任务ID不能为空")
-				continue
-			}
-
-			// 检查解析的任务ID是否包含特殊字符
-			if tools.ContainsSpecialChars(idStr) {
-				CL.PrintErrf("任务ID包含危险字符: %s", idStr)
-				continue
-			}
+	selector := taskSelector{id: deleteID, ids: deleteIDS, tag: deleteTag, all: deleteAll}
 
-			// 将字符串转换为整数
-			id, err := strconv.Atoi(idStr)
-			if err != nil {
-				CL.PrintErrf("无效的任务ID: %s", idStr)
-				continue
-			}
+	// 如果指定了多个任务, 则执行多任务模式
+	if selector.multi() {
+		// 检查是否同时指定了任务名
+		if *deleteName != "" {
+			return fmt.Errorf("不能同时使用-n和-ids、-tag、-all参数, 请选择其中一种方式指定任务")
+		}
 
-			// 添加任务ID到切片中
-			ids = append(ids, id)
+		// 解析要删除的任务
+		ids, err := selector.selectIDs(db)
+		if err != nil {
+			return err
 		}
 
 		// 执行任务
@@ -52,7 +39,7 @@ func deleteCmdMain(db *sqlx.DB) error {
 	}
 
 	// 如果指定了单个任务ID, 则执行单任务模式(单任务模式支持：删除任务，删除指定版本的备份)
-	if *deleteID != 0 || *deleteName != "" {
+	if deleteID.IsSet() || *deleteName != "" {
 		// 执行任务
 		if err := deleteTask(db); err != nil {
 			return fmt.Errorf("删除任务失败: %w", err)
@@ -61,31 +48,45 @@ func deleteCmdMain(db *sqlx.DB) error {
 		return nil
 	}
 
-	// 检查必要的参数是否指定
-	if *deleteID == 0 && *deleteIDS == "" && *deleteName == "" {
-		return fmt.Errorf("删除备份任务时, 必须指定任务ID或者任务名, 使用-id指定任务ID或-n指定任务名称或用-ids指定多个任务ID, 例如: -ids '1,2,3'")
-	}
-
-	return nil
+	return fmt.Errorf("删除备份任务时, 必须指定要删除的任务, 使用-id指定任务ID或任务名、-n指定任务名、-ids指定多个任务、-tag按标签指定任务或-all指定所有任务, 例如: -ids '1,2,3'")
 }
 
 // 单ID模式删除任务
 func deleteTask(db *sqlx.DB) error {
 	// 检查是否指定任务ID和任务名
-	if *deleteName == "" && *deleteID == 0 {
+	if *deleteName == "" && !deleteID.IsSet() {
 		return fmt.Errorf("必须指定要删除的任务, 请使用-id指定任务ID或-n指定任务名称")
 	}
 
 	// 如果版本ID不为空, 但是则检查是否指定了任务ID或任务名
-	if *deleteVersionID != "" && (*deleteID == 0 && *deleteName == "") {
+	if *deleteVersionID != "" && (!deleteID.IsSet() && *deleteName == "") {
 		return fmt.Errorf("删除指定版本的备份时, 必须指定任务ID或任务名, 使用-id指定任务ID或-n指定任务名称")
 	}
 
 	// 检查是否同时指定了任务ID和任务名
-	if *deleteID != 0 && *deleteName != "" {
+	if deleteID.IsSet() && *deleteName != "" {
 		return fmt.Errorf("不能同时使用-id和-n参数, 请选择其中一种方式指定任务")
 	}
 
+	// 解析任务ID或任务名
+	id, err := deleteID.Resolve(db)
+	if err != nil {
+		return err
+	}
+
+	// 删除前获取任务的运行锁, 任务正在运行或清理时不删除, 避免删除其正在读写的文件
+	lockID := id
+	if *deleteName != "" {
+		if lockID, err = resolveTask(db, *deleteName); err != nil {
+			return err
+		}
+	}
+	locks, err := lockDeleteTask(db, lockID)
+	if err != nil {
+		return err
+	}
+	defer releaseDeleteLocks(locks)
+
 	// 根据任务名删除任务
 	if *deleteName != "" && *deleteVersionID == "" {
 		var backupDir string
@@ -96,11 +97,32 @@ func deleteTask(db *sqlx.DB) error {
 			return fmt.Errorf("获取备份存放目录失败: %w", err)
 		}
 
+		// 检查任务是否包含固定的版本
+		if err := checkPinnedVersions(db, "task_name = ?", *deleteName); err != nil {
+			return err
+		}
+
 		// 删除备份目录
 		if err := deleteBackupDir(backupDir); err != nil {
 			return err
 		}
 
+		// 删除任务前获取任务ID, 用于从其他任务的前置任务中移除
+		taskID, err := resolveTask(db, *deleteName)
+		if err != nil {
+			return err
+		}
+
+		// 删除副本目录和副本记录
+		if err := deleteTaskReplicas(db, taskID); err != nil {
+			return err
+		}
+
+		// 删除冷存储目录
+		if err := deleteTaskTier(db, taskID); err != nil {
+			return err
+		}
+
 		// 删除任务和备份记录
 		deleteSql := "DELETE FROM backup_tasks WHERE task_name = ?"
 		if _, err := db.Exec(deleteSql, *deleteName); err != nil {
@@ -110,76 +132,122 @@ func deleteTask(db *sqlx.DB) error {
 		if _, err := db.Exec(deleteBackupSql, *deleteName); err != nil {
 			return fmt.Errorf("删除备份记录失败: %w", err)
 		}
+		if err := removeDependency(db, taskID); err != nil {
+			return err
+		}
 
 		CL.PrintOkf("任务删除成功: %s", *deleteName)
 		return nil
 	}
 
 	// 根据任务ID删除任务
-	if *deleteID != 0 && *deleteVersionID == "" {
+	if deleteID.IsSet() && *deleteVersionID == "" {
 		var backupDir string
 		backupDirSql := "SELECT backup_directory FROM backup_tasks WHERE task_id = ?"
-		if err := db.Get(&backupDir, backupDirSql, *deleteID); err == sql.ErrNoRows {
-			return fmt.Errorf("任务ID不存在: %d", *deleteID)
+		if err := db.Get(&backupDir, backupDirSql, id); err == sql.ErrNoRows {
+			return fmt.Errorf("任务ID不存在: %d", id)
 		} else if err != nil {
 			return fmt.Errorf("获取备份存放目录失败: %w", err)
 		}
 
+		// 检查任务是否包含固定的版本
+		if err := checkPinnedVersions(db, "task_id = ?", id); err != nil {
+			return err
+		}
+
 		// 删除备份目录
 		if err := deleteBackupDir(backupDir); err != nil {
 			return err
 		}
 
+		// 删除副本目录和副本记录
+		if err := deleteTaskReplicas(db, id); err != nil {
+			return err
+		}
+
+		// 删除冷存储目录
+		if err := deleteTaskTier(db, id); err != nil {
+			return err
+		}
+
 		// 删除任务和备份记录
 		deleteSql := "DELETE FROM backup_tasks WHERE task_id = ?"
-		if _, err := db.Exec(deleteSql, *deleteID); err != nil {
+		if _, err := db.Exec(deleteSql, id); err != nil {
 			return fmt.Errorf("删除任务失败: %w", err)
 		}
 		deleteBackupSql := "DELETE FROM backup_records WHERE task_id = ?"
-		if _, err := db.Exec(deleteBackupSql, *deleteID); err != nil {
+		if _, err := db.Exec(deleteBackupSql, id); err != nil {
 			return fmt.Errorf("删除备份记录失败: %w", err)
 		}
+		if err := removeDependency(db, id); err != nil {
+			return err
+		}
 
-		CL.PrintOkf("任务ID删除成功: %d", *deleteID)
+		CL.PrintOkf("任务ID删除成功: %d", id)
 		return nil
 	}
 
-	// 根据任务ID和版本ID删除备份记录
-	if *deleteID != 0 && *deleteVersionID != "" {
-		// 获取根据任务ID和版本ID查询备份记录
-		var backupRecord struct {
-			BackupPath string `db:"backup_path"`      // 备份目录
-			BackupFile string `db:"backup_file_name"` // 备份文件
+	// 根据任务ID或任务名和版本选择器删除备份记录
+	if *deleteVersionID != "" {
+		// 如果指定的是任务名, 则先获取任务ID
+		taskID := id
+		if *deleteName != "" {
+			if err := db.Get(&taskID, "SELECT task_id FROM backup_tasks WHERE task_name = ?", *deleteName); err == sql.ErrNoRows {
+				return fmt.Errorf("任务名不存在: %s", *deleteName)
+			} else if err != nil {
+				return fmt.Errorf("获取任务ID失败: %w", err)
+			}
 		}
-		backupRecordSql := "select backup_path, backup_file_name from backup_records where task_id =? and version_id =?"
-		if err := db.Get(&backupRecord, backupRecordSql, *deleteID, *deleteVersionID); err == sql.ErrNoRows {
-			return fmt.Errorf("任务ID或版本ID不存在")
-		} else if err != nil {
-			return fmt.Errorf("查询备份记录失败: %w", err)
+
+		// 根据版本选择器解析备份记录
+		record, err := tools.ResolveVersion(db, taskID, *deleteVersionID)
+		if err != nil {
+			return fmt.Errorf("解析版本失败: %w", err)
 		}
 
-		// 切换到备份目录
-		if err := os.Chdir(backupRecord.BackupPath); err != nil {
-			return fmt.Errorf("切换到备份目录失败: %w", err)
+		// 固定的版本需要强制删除
+		if record.Pinned && !*deleteForce {
+			return fmt.Errorf("版本 %s 已固定, 请先使用 cbk unpin 取消固定, 或使用 -force 强制删除", record.VersionID)
 		}
 
-		// 删除备份文件
-		if _, err := tools.CheckPath(backupRecord.BackupFile); err == nil {
-			if err := os.Remove(backupRecord.BackupFile); err != nil {
-				return fmt.Errorf("删除备份文件失败: %w", err)
+		// 删除备份文件, 镜像任务的同步记录没有备份文件, 快照版本删除整个快照目录
+		if tools.IsSuccessRecord(record) && tools.IsSnapshotRecord(record) {
+			snapshotDir := filepath.Join(record.BackupPath, record.BackupFileName)
+			if _, err := os.Stat(snapshotDir); os.IsNotExist(err) {
+				CL.PrintWarnf("快照目录不存在: %s", snapshotDir)
+			} else if err := os.RemoveAll(snapshotDir); err != nil {
+				return fmt.Errorf("删除快照目录失败: %w", err)
+			}
+		} else if tools.IsSuccessRecord(record) && !tools.IsMirrorRecord(record) {
+			store, err := tools.OpenStorage(record.BackupPath)
+			if err != nil {
+				return fmt.Errorf("打开备份存储失败: %w", err)
+			}
+			defer store.Close()
+			if _, err := store.Size(context.Background(), record.BackupFileName); err == nil {
+				if err := store.Remove(context.Background(), record.BackupFileName); err != nil {
+					return fmt.Errorf("删除备份文件失败: %w", err)
+				}
+			} else if errors.Is(err, os.ErrNotExist) {
+				CL.PrintWarnf("备份文件不存在: %s", record.BackupFileName)
+			} else {
+				return fmt.Errorf("获取备份文件信息失败: %w", err)
 			}
-		} else {
-			CL.PrintWarnf("备份文件不存在: %s", backupRecord.BackupFile)
+		}
+
+		// 删除副本文件和副本记录
+		if err := tools.RemoveReplicas(db, globals.BackupRecords{record}); err != nil {
+			return err
 		}
 
 		// 删除备份记录
 		deleteBackupSql := "delete from backup_records where task_id = ? and version_id = ?"
-		if _, err := db.Exec(deleteBackupSql, *deleteID, *deleteVersionID); err != nil {
+		if _, err := db.Exec(deleteBackupSql, taskID, record.VersionID); err != nil {
 			return fmt.Errorf("删除备份记录失败: %w", err)
 		}
 
 		// 打印成功信息
-		CL.PrintOkf("任务ID: %d, 版本ID: %s 删除成功", *deleteID, *deleteVersionID)
+		CL.PrintOkf("任务ID: %d, 版本ID: %s 删除成功", taskID, record.VersionID)
 
 		return nil
 	}
@@ -189,54 +257,89 @@ func deleteTask(db *sqlx.DB) error {
 
 // 多ID模式删除任务
 func deleteTasks(db *sqlx.DB, ids []int) error {
-	// 如果版本ID不为空, 同时任务ID列表也不为空, 则返回错误
-	if *deleteVersionID != "" && *deleteIDS != "" {
-		return fmt.Errorf("-ids 不支持删除指定版本的备份, 请使用 -id 指定任务ID和版本ID")
+	// 如果版本ID不为空, 则返回错误
+	if *deleteVersionID != "" {
+		return fmt.Errorf("-ids、-tag 和 -all 不支持删除指定版本的备份, 请使用 -id 指定任务和版本ID")
 	}
 
-	// 检查是否没有指定任务ID列表
-	if *deleteIDS == "" {
-		return fmt.Errorf("必须指定要删除的任务, 请使用-ids指定任务ID列表, 例如: -ids '1,2,3'")
+	// 检查是否没有匹配的任务
+	if len(ids) == 0 {
+		return fmt.Errorf("没有要删除的任务")
 	}
 
 	// 根据任务ID删除任务
-	if *deleteIDS != "" && *deleteVersionID == "" {
-		var backupDir string // 备份目录
-		// 构建查询备份目录的SQL语句
-		backupDirSql := "SELECT backup_directory FROM backup_tasks WHERE task_id = ?"
+	var backupDir string // 备份目录
+	// 构建查询备份目录的SQL语句
+	backupDirSql := "SELECT backup_directory FROM backup_tasks WHERE task_id = ?"
+
+	for _, id := range ids {
+		if err := db.Get(&backupDir, backupDirSql, id); err == sql.ErrNoRows {
+			CL.PrintErrf("任务ID不存在: %d", id)
+			continue
+		} else if err != nil {
+			CL.PrintErrf("获取备份存放目录失败: %v", err)
+			continue
+		}
+		deleteLockedTask(db, id, backupDir)
+	}
 
-		for _, id := range ids {
-			if err := db.Get(&backupDir, backupDirSql, id); err == sql.ErrNoRows {
-				CL.PrintErrf("任务ID不存在: %d", id)
-				continue
-			} else if err != nil {
-				CL.PrintErrf("获取备份存放目录失败: %v", err)
-				continue
-			}
+	return nil
+}
 
-			// 删除备份目录
-			if err := deleteBackupDir(backupDir); err != nil {
-				CL.PrintErrf("删除备份存放目录失败: %v", err)
-				continue
-			}
+// deleteLockedTask 持有任务的运行锁删除任务, 任务正在运行或清理时跳过
+// 参数:
+// - db: 数据库连接
+// - id: 任务ID
+// - backupDir: 备份目录
+func deleteLockedTask(db *sqlx.DB, id int, backupDir string) {
+	locks, err := lockDeleteTask(db, id)
+	if err != nil {
+		CL.PrintWarnf("跳过任务ID %d: %v", id, err)
+		return
+	}
+	defer releaseDeleteLocks(locks)
 
-			// 删除任务和备份记录
-			deleteSql := "DELETE FROM backup_tasks WHERE task_id = ?"
-			if _, err := db.Exec(deleteSql, id); err != nil {
-				CL.PrintErrf("删除任务失败: %v", err)
-				continue
-			}
-			deleteBackupSql := "DELETE FROM backup_records WHERE task_id = ?"
-			if _, err := db.Exec(deleteBackupSql, id); err != nil {
-				CL.PrintErrf("删除备份记录失败: %v", err)
-				continue
-			}
+	// 检查任务是否包含固定的版本
+	if err := checkPinnedVersions(db, "task_id = ?", id); err != nil {
+		CL.PrintErrf("任务ID %d: %v", id, err)
+		return
+	}
 
-			CL.PrintOkf("任务ID删除成功: %d", id)
-		}
+	// 删除备份目录
+	if err := deleteBackupDir(backupDir); err != nil {
+		CL.PrintErrf("删除备份存放目录失败: %v", err)
+		return
 	}
 
-	return nil
+	// 删除副本目录和副本记录
+	if err := deleteTaskReplicas(db, id); err != nil {
+		CL.PrintErrf("%v", err)
+		return
+	}
+
+	// 删除冷存储目录
+	if err := deleteTaskTier(db, id); err != nil {
+		CL.PrintErrf("%v", err)
+		return
+	}
+
+	// 删除任务和备份记录
+	deleteSql := "DELETE FROM backup_tasks WHERE task_id = ?"
+	if _, err := db.Exec(deleteSql, id); err != nil {
+		CL.PrintErrf("删除任务失败: %v", err)
+		return
+	}
+	deleteBackupSql := "DELETE FROM backup_records WHERE task_id = ?"
+	if _, err := db.Exec(deleteBackupSql, id); err != nil {
+		CL.PrintErrf("删除备份记录失败: %v", err)
+		return
+	}
+	if err := removeDependency(db, id); err != nil {
+		CL.PrintErrf("%v", err)
+		return
+	}
+
+	CL.PrintOkf("任务ID删除成功: %d", id)
 }
 
 // deleteBackupDir 删除备份目录
@@ -247,6 +350,16 @@ func deleteTasks(db *sqlx.DB, ids []int) error {
 func deleteBackupDir(backupDir string) error {
 	// 检查是否设置了删除目录标志(*deleteDirF)
 	if *deleteDirF {
+		// 远程存储删除其中的所有备份文件
+		if tools.IsRemoteLocation(backupDir) {
+			removed, err := tools.ClearRemoteLocation(context.Background(), backupDir, nil)
+			if err != nil {
+				return fmt.Errorf("删除备份存放目录失败: %w", err)
+			}
+			CL.PrintOkf("备份存放目录删除成功: %s, 共删除 %d 个文件", backupDir, removed)
+			return nil
+		}
+
 		// 检查备份目录是否存在
 		if _, err := tools.CheckPath(backupDir); err == nil {
 			// 如果存在则删除整个目录
@@ -262,3 +375,130 @@ func deleteBackupDir(backupDir string) error {
 	}
 	return nil
 }
+
+// deleteTaskReplicas 按 -d 参数删除任务的副本目录, 并删除任务所有版本的副本记录
+// 参数:
+// - db: 数据库连接
+// - id: 任务ID
+// 返回值:
+// - error: 错误信息
+func deleteTaskReplicas(db *sqlx.DB, id int) error {
+	var replicas string
+	if err := db.Get(&replicas, "SELECT replicas FROM backup_tasks WHERE task_id = ?", id); err != nil {
+		return fmt.Errorf("获取副本存放目录失败: %w", err)
+	}
+	for _, location := range tools.SplitReplicas(replicas) {
+		if err := deleteBackupDir(location); err != nil {
+			return fmt.Errorf("删除副本存放目录失败: %w", err)
+		}
+	}
+
+	deleteSql := "DELETE FROM backup_replicas WHERE version_id IN (SELECT version_id FROM backup_records WHERE task_id = ?)"
+	if _, err := db.Exec(deleteSql, id); err != nil {
+		return fmt.Errorf("删除副本记录失败: %w", err)
+	}
+	return nil
+}
+
+// checkPinnedVersions 检查要删除的任务是否包含固定的版本, 未指定 -force 时拒绝删除
+// 参数:
+// - db: 数据库连接
+// - condition: 匹配任务的查询条件, 例如: task_id = ?
+// - arg: 查询条件的参数
+// 返回值:
+// - error: 包含固定的版本或查询失败时返回错误
+func checkPinnedVersions(db *sqlx.DB, condition string, arg any) error {
+	if *deleteForce {
+		return nil
+	}
+
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM backup_records WHERE pinned = 1 AND "+condition, arg); err != nil {
+		return fmt.Errorf("查询固定的版本失败: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("该任务包含 %d 个固定的版本, 请先使用 cbk unpin 取消固定, 或使用 -force 强制删除", count)
+	}
+	return nil
+}
+
+// deleteTaskTier 按 -d 参数删除任务的冷存储目录
+// 参数:
+// - db: 数据库连接
+// - id: 任务ID
+// 返回值:
+// - error: 错误信息
+func deleteTaskTier(db *sqlx.DB, id int) error {
+	var location string
+	if err := db.Get(&location, "SELECT tier_location FROM backup_tasks WHERE task_id = ?", id); err != nil {
+		return fmt.Errorf("获取冷存储目录失败: %w", err)
+	}
+	if location == "" {
+		return nil
+	}
+	if err := deleteBackupDir(location); err != nil {
+		return fmt.Errorf("删除冷存储目录失败: %w", err)
+	}
+	return nil
+}
+
+// lockDeleteTask 获取要删除的任务的运行锁
+// 使用 -d 删除备份目录时, 同时获取备份目录与之重叠的其他任务的运行锁, 避免删除这些任务正在读写的文件
+// 参数:
+// - db: 数据库连接
+// - id: 任务ID
+// 返回值:
+// - []*tools.FileLock: 获取到的锁
+// - error: 任务不存在或锁被其他进程持有时返回错误
+func lockDeleteTask(db *sqlx.DB, id int) ([]*tools.FileLock, error) {
+	var tasks globals.BackupTasks
+	if err := db.Select(&tasks, "SELECT task_id, task_name, backup_directory FROM backup_tasks"); err != nil {
+		return nil, fmt.Errorf("获取任务信息失败: %w", err)
+	}
+	var target *globals.BackupTask
+	for i := range tasks {
+		if tasks[i].TaskID == id {
+			target = &tasks[i]
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("任务ID不存在: %d", id)
+	}
+
+	locked := []globals.BackupTask{*target}
+	if *deleteDirF {
+		for _, task := range tasks {
+			if task.TaskID != id && sharesBackupDir(task.BackupDirectory, target.BackupDirectory) {
+				locked = append(locked, task)
+			}
+		}
+	}
+
+	var locks []*tools.FileLock
+	for _, task := range locked {
+		lock, err := lockTask(task.TaskID, task.TaskName)
+		if err != nil {
+			releaseDeleteLocks(locks)
+			return nil, fmt.Errorf("%w, 任务正在运行或清理, 请稍后再删除", err)
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// sharesBackupDir 判断两个备份目录是否相同或其中一个位于另一个之下
+func sharesBackupDir(a, b string) bool {
+	if tools.IsRemoteLocation(a) || tools.IsRemoteLocation(b) {
+		return a == b
+	}
+	return tools.IsInDir(a, b) || tools.IsInDir(b, a)
+}
+
+// releaseDeleteLocks 释放删除任务时获取的运行锁
+func releaseDeleteLocks(locks []*tools.FileLock) {
+	for _, lock := range locks {
+		if err := lock.Release(); err != nil {
+			CL.PrintErrf("释放任务锁失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// openHomeDB 将主目录设置为临时目录, 并在其中创建最新版本的数据库
+func openHomeDB(t *testing.T) (*sqlx.DB, string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	db, dbPath := openTestDB(t, globals.CbkDBFile)
+	if _, err := migrateDB(db, dbPath); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	return db, home
+}
+
+// addTestTask 写入一个只包含任务名和备份目录的任务
+func addTestTask(t *testing.T, db *sqlx.DB, id int, name, backupDir string) {
+	t.Helper()
+	if _, err := db.Exec("INSERT INTO backup_tasks (task_id, task_name, target_directory, backup_directory) VALUES (?, ?, ?, ?)", id, name, "/src", backupDir); err != nil {
+		t.Fatalf("写入任务失败: %v", err)
+	}
+}
+
+func TestLockDeleteTask(t *testing.T) {
+	db, home := openHomeDB(t)
+	shared := filepath.Join(home, "backups")
+	addTestTask(t, db, 1, "a", shared)
+	addTestTask(t, db, 2, "b", filepath.Join(shared, "b"))
+	addTestTask(t, db, 3, "c", filepath.Join(home, "other"))
+
+	// 任务 b 正在运行
+	running, err := lockTask(2, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = running.Release() }()
+
+	defer func(dir bool) { *deleteDirF = dir }(*deleteDirF)
+	tests := []struct {
+		name    string
+		id      int
+		dir     bool
+		wantErr bool
+	}{
+		{name: "正在运行的任务", id: 2, wantErr: true},
+		{name: "不删除备份目录", id: 1},
+		{name: "备份目录包含正在运行的任务", id: 1, dir: true, wantErr: true},
+		{name: "备份目录不重叠", id: 3, dir: true},
+		{name: "任务不存在", id: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*deleteDirF = tt.dir
+			locks, err := lockDeleteTask(db, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lockDeleteTask(%d) 错误 = %v, 期望错误 %v", tt.id, err, tt.wantErr)
+			}
+			releaseDeleteLocks(locks)
+		})
+	}
+}
+
+func TestSharesBackupDir(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/srv/backup", "/srv/backup", true},
+		{"/srv/backup", "/srv/backup/docs", true},
+		{"/srv/backup/docs", "/srv/backup", true},
+		{"/srv/backup", "/srv/backup2", false},
+		{"s3://bucket/cbk", "s3://bucket/cbk", true},
+		{"s3://bucket/cbk", "/srv/backup", false},
+	}
+	for _, tt := range tests {
+		if got := sharesBackupDir(filepath.FromSlash(tt.a), filepath.FromSlash(tt.b)); got != tt.want {
+			t.Errorf("sharesBackupDir(%q, %q) = %v, 期望 %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"cbk/pkg/tools"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// loadDependencies 查询所有任务的依赖关系和任务名
+// 返回值:
+//   - map[int][]int: 依赖关系, 键为任务ID, 值为该任务的前置任务ID列表
+//   - map[int]string: 任务ID到任务名的映射
+//   - error: 查询失败时返回错误
+func loadDependencies(db *sqlx.DB) (map[int][]int, map[int]string, error) {
+	var rows []struct {
+		TaskID    int    `db:"task_id"`
+		TaskName  string `db:"task_name"`
+		DependsOn string `db:"depends_on"`
+	}
+	if err := db.Select(&rows, "SELECT task_id, task_name, depends_on FROM backup_tasks"); err != nil {
+		return nil, nil, fmt.Errorf("查询任务的依赖关系失败: %w", err)
+	}
+
+	deps := make(map[int][]int, len(rows))
+	names := make(map[int]string, len(rows))
+	for _, row := range rows {
+		names[row.TaskID] = row.TaskName
+		if ids := tools.SplitDepends(row.DependsOn); len(ids) > 0 {
+			deps[row.TaskID] = ids
+		}
+	}
+	return deps, names, nil
+}
+
+// parseDepends 解析逗号分隔的前置任务ID或任务名, 返回以逗号分隔的前置任务ID列表
+// 配置为空或 none 时返回空字符串, 表示没有前置任务
+// 参数:
+//   - db: 数据库连接
+//   - spec: 前置任务ID或任务名列表
+//   - self: 当前任务的ID, 添加任务时为0
+//
+// 返回值:
+//   - string: 前置任务ID列表, 以逗号分隔
+//   - error: 前置任务不存在、依赖自身或形成循环时返回错误
+func parseDepends(db *sqlx.DB, spec string, self int) (string, error) {
+	if spec = strings.TrimSpace(spec); spec == "" || strings.EqualFold(spec, "none") {
+		return "", nil
+	}
+
+	deps, names, err := loadDependencies(db)
+	if err != nil {
+		return "", err
+	}
+
+	var ids []int
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		id, err := resolveTask(db, item)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := names[id]; !ok {
+			return "", fmt.Errorf("前置任务不存在: %s", item)
+		}
+		if id == self {
+			return "", fmt.Errorf("任务不能依赖自身")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	// 新增的任务还没有被其他任务依赖, 不会形成循环
+	if self != 0 {
+		deps[self] = ids
+		if cycle := tools.FindCycle(deps, self); cycle != nil {
+			return "", fmt.Errorf("任务的依赖关系存在循环: %s", formatDependPath(cycle, names))
+		}
+	}
+
+	return tools.JoinDepends(ids), nil
+}
+
+// formatDepends 返回前置任务的显示文本, 以任务名表示, 没有前置任务时返回 none
+func formatDepends(depends string, names map[int]string) string {
+	ids := tools.SplitDepends(depends)
+	if len(ids) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := names[id]; ok {
+			parts = append(parts, name)
+		} else {
+			parts = append(parts, strconv.Itoa(id))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatDependPath 返回依赖循环的显示文本, 例如: a -> b -> a
+func formatDependPath(path []int, names map[int]string) string {
+	parts := make([]string, 0, len(path))
+	for _, id := range path {
+		if name, ok := names[id]; ok {
+			parts = append(parts, name)
+		} else {
+			parts = append(parts, strconv.Itoa(id))
+		}
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// dependencyOrder 返回要运行的任务及其所有前置任务, 前置任务排在前面
+// 返回值:
+//   - []int: 按依赖顺序排列的任务ID列表
+//   - map[int][]int: 依赖关系
+//   - error: 依赖关系中存在循环时返回错误
+func dependencyOrder(db *sqlx.DB, ids []int) ([]int, map[int][]int, error) {
+	deps, names, err := loadDependencies(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, err := tools.DependencyOrder(deps, ids)
+	var cycle *tools.CycleError
+	if errors.As(err, &cycle) {
+		return nil, nil, fmt.Errorf("任务的依赖关系存在循环: %s", formatDependPath(cycle.Path, names))
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return order, deps, nil
+}
+
+// removeDependency 删除任务后, 从其他任务的前置任务中移除该任务
+func removeDependency(db *sqlx.DB, id int) error {
+	deps, _, err := loadDependencies(db)
+	if err != nil {
+		return err
+	}
+	for taskID, ids := range deps {
+		kept := ids[:0]
+		for _, dep := range ids {
+			if dep != id {
+				kept = append(kept, dep)
+			}
+		}
+		if len(kept) == len(ids) {
+			continue
+		}
+		if _, err := db.Exec("UPDATE backup_tasks SET depends_on = ? WHERE task_id = ?", tools.JoinDepends(kept), taskID); err != nil {
+			return fmt.Errorf("更新任务ID %d 的前置任务失败: %w", taskID, err)
+		}
+	}
+	return nil
+}
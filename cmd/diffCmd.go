@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"bytes"
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 生成文本差异时单个文件的最大大小, 超过该大小的文件不显示文本差异
+const maxTextDiffSize = 1 << 20
+
+// diffVersionInfo 表示参与比较的一个版本
+type diffVersionInfo struct {
+	VersionID string `json:"version_id"` // 版本ID
+	Timestamp string `json:"timestamp"`  // 备份时间戳
+}
+
+// diffEstimate 表示根据目标目录当前内容估算的下次备份大小
+type diffEstimate struct {
+	Size           int64 `json:"size"`            // 文件总大小
+	CompressedSize int64 `json:"compressed_size"` // 按所比较版本的压缩率估算的压缩后大小
+}
+
+// diffLiveInfo 表示与备份版本比较的目标目录
+type diffLiveInfo struct {
+	TargetDirectory string       `json:"target_directory"` // 目标目录
+	NextBackup      diffEstimate `json:"next_backup"`      // 下次备份的大小估算
+}
+
+// diffReport 表示 diff 命令的JSON输出
+type diffReport struct {
+	TaskID  int                 `json:"task_id"`        // 任务ID
+	From    diffVersionInfo     `json:"from"`           // 旧版本
+	To      *diffVersionInfo    `json:"to,omitempty"`   // 新版本, 与目标目录比较时为空
+	Live    *diffLiveInfo       `json:"live,omitempty"` // 目标目录, 比较两个版本时为空
+	Changes []tools.EntryChange `json:"changes"`        // 变更列表
+	Summary tools.DiffSummary   `json:"summary"`        // 变更汇总
+}
+
+// diffCmdMain 比较同一任务的两个备份版本, 或比较备份版本与目标目录的当前内容
+func diffCmdMain(db *sqlx.DB) error {
+	// 检查参数
+	if !diffID.IsSet() {
+		return fmt.Errorf("必须使用 -id 指定任务ID或任务名")
+	}
+	taskID, err := diffID.Resolve(db)
+	if err != nil {
+		return err
+	}
+
+	// 与目标目录的当前内容比较
+	if *diffLive {
+		return diffLiveMain(db, taskID)
+	}
+
+	if *diffVersionID != "" {
+		return fmt.Errorf("-v 参数仅用于 -live 模式, 比较两个版本请使用 -from 和 -to 参数")
+	}
+	if *diffFrom == "" {
+		return fmt.Errorf("必须使用 -from 指定要比较的旧版本")
+	}
+	toSelector := *diffTo
+	if toSelector == "" {
+		toSelector = tools.SelectorLatestSuccess
+	}
+
+	// 打开两个版本的读取器
+	fromReader, fromRecord, err := openVersionReader(db, taskID, *diffFrom)
+	if err != nil {
+		return err
+	}
+	defer fromReader.Close()
+
+	toReader, toRecord, err := openVersionReader(db, taskID, toSelector)
+	if err != nil {
+		return err
+	}
+	defer toReader.Close()
+
+	// 比较两个版本的条目
+	changes, summary := tools.DiffEntries(fromReader.Entries(), toReader.Entries())
+
+	report := diffReport{
+		TaskID:  taskID,
+		From:    diffVersionInfo{VersionID: fromRecord.VersionID, Timestamp: fromRecord.Timestamp},
+		To:      &diffVersionInfo{VersionID: toRecord.VersionID, Timestamp: toRecord.Timestamp},
+		Changes: changes,
+		Summary: summary,
+	}
+
+	// 以JSON格式输出
+	if *diffJSON {
+		return printDiffJSON(report)
+	}
+
+	// 打印比较结果
+	fmt.Printf("比较任务ID %d: 版本 %s (%s) -> 版本 %s (%s)\n", taskID, fromRecord.VersionID, formatRecordTime(fromRecord), toRecord.VersionID, formatRecordTime(toRecord))
+	if len(changes) == 0 {
+		CL.Green("两个版本的内容完全相同")
+		return nil
+	}
+	return printDiffResult(report, fromReader, toReader)
+}
+
+// diffLiveMain 比较备份版本与任务目标目录的当前内容
+func diffLiveMain(db *sqlx.DB, taskID int) error {
+	if *diffFrom != "" || *diffTo != "" {
+		return fmt.Errorf("-live 模式下请使用 -v 指定要比较的版本, 不能使用 -from 和 -to 参数")
+	}
+	selector := *diffVersionID
+	if selector == "" {
+		selector = tools.SelectorLatestSuccess
+	}
+
+	// 查询任务的目标目录和排除规则
+	var task globals.BackupTask
+	if err := db.Get(&task, "select task_name, target_directory, exclude_rules from backup_tasks where task_id = ?", taskID); err == sql.ErrNoRows {
+		return fmt.Errorf("任务ID不存在: %d", taskID)
+	} else if err != nil {
+		return fmt.Errorf("获取任务信息失败: %w", err)
+	}
+
+	// 检查目标目录是否存在
+	if _, err := tools.CheckPath(task.TargetDirectory); err != nil {
+		return fmt.Errorf("目标目录或文件不存在: %w", err)
+	}
+
+	// 获取排除函数
+	excludeFunc, err := tools.ParseExclude(task.ExcludeRules)
+	if err != nil {
+		return fmt.Errorf("解析任务ID %d 的排除规则失败: %w", taskID, err)
+	}
+
+	// 打开备份版本的读取器
+	versionReader, record, err := openVersionReader(db, taskID, selector)
+	if err != nil {
+		return err
+	}
+	defer versionReader.Close()
+
+	// 按备份规则遍历目标目录
+	liveReader, err := tools.OpenDirReader(task.TargetDirectory, excludeFunc)
+	if err != nil {
+		return fmt.Errorf("遍历目标目录失败: %w", err)
+	}
+	defer liveReader.Close()
+
+	// 计算目标目录中文件的校验值
+	if err := tools.FillChecksums(liveReader, versionReader.Entries(), *diffChecksum); err != nil {
+		return fmt.Errorf("计算文件校验值失败: %w", err)
+	}
+
+	// 比较备份版本与目标目录
+	changes, summary := tools.DiffEntries(versionReader.Entries(), liveReader.Entries())
+
+	report := diffReport{
+		TaskID: taskID,
+		From:   diffVersionInfo{VersionID: record.VersionID, Timestamp: record.Timestamp},
+		Live: &diffLiveInfo{
+			TargetDirectory: task.TargetDirectory,
+			NextBackup:      estimateNextBackup(versionReader.Entries(), liveReader.Entries()),
+		},
+		Changes: changes,
+		Summary: summary,
+	}
+
+	// 以JSON格式输出
+	if *diffJSON {
+		return printDiffJSON(report)
+	}
+
+	// 打印比较结果
+	fmt.Printf("比较任务ID %d: 版本 %s (%s) -> 目标目录 %s (当前)\n", taskID, record.VersionID, formatRecordTime(record), task.TargetDirectory)
+	if len(changes) == 0 {
+		CL.Green("目标目录自该版本以来没有变化")
+	} else if err := printDiffResult(report, versionReader, liveReader); err != nil {
+		return err
+	}
+
+	// 打印下次备份的大小估算
+	estimate := report.Live.NextBackup
+	fmt.Printf("预计下次备份: 原始大小 %s, 压缩后约 %s\n", tools.FormatSize(estimate.Size), tools.FormatSize(estimate.CompressedSize))
+
+	return nil
+}
+
+// printDiffJSON 以JSON格式输出比较结果
+func printDiffJSON(report diffReport) error {
+	if report.Changes == nil {
+		report.Changes = []tools.EntryChange{}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("输出JSON失败: %w", err)
+	}
+	return nil
+}
+
+// printDiffResult 打印变更列表、汇总信息以及可选的文本差异
+func printDiffResult(report diffReport, fromReader, toReader tools.VersionReader) error {
+	// 打印变更列表
+	printChanges(report.Changes)
+
+	// 打印汇总信息
+	printDiffSummary(report.Summary)
+
+	// 打印文本文件的差异
+	if *diffUnified {
+		for _, change := range report.Changes {
+			if change.Kind != tools.ChangeModified || !change.Old.Mode.IsRegular() || !change.New.Mode.IsRegular() {
+				continue
+			}
+			if err := printTextDiff(fromReader, toReader, change); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// estimateNextBackup 根据目标目录的当前内容和备份版本的压缩率估算下次备份的大小
+func estimateNextBackup(versionEntries, liveEntries []tools.ArchiveEntry) diffEstimate {
+	var estimate diffEstimate
+	for _, entry := range liveEntries {
+		if !entry.IsDir {
+			estimate.Size += entry.Size
+		}
+	}
+
+	// 使用备份版本的整体压缩比例估算压缩后的大小
+	var size, compressed int64
+	for _, entry := range versionEntries {
+		if !entry.IsDir {
+			size += entry.Size
+			compressed += entry.CompressedSize
+		}
+	}
+	if size > 0 {
+		estimate.CompressedSize = int64(float64(estimate.Size) * float64(compressed) / float64(size))
+	} else {
+		estimate.CompressedSize = estimate.Size
+	}
+
+	return estimate
+}
+
+// printChanges 打印变更列表, 每行以 + - M P 标识变更类型
+func printChanges(changes []tools.EntryChange) {
+	for _, change := range changes {
+		name := change.Name
+		if change.IsDir {
+			name += "/"
+		}
+
+		switch change.Kind {
+		case tools.ChangeAdded:
+			CL.Greenf("+ %s (%s)", name, changeSize(change.IsDir, change.NewSize))
+		case tools.ChangeRemoved:
+			CL.Redf("- %s (%s)", name, changeSize(change.IsDir, change.OldSize))
+		case tools.ChangeModified:
+			// 列出变更的属性
+			var fields []string
+			if change.SizeChanged {
+				fields = append(fields, "大小")
+			}
+			if change.TimeChanged {
+				fields = append(fields, "修改时间")
+			}
+			if change.HashChanged {
+				fields = append(fields, "哈希")
+			}
+			if change.ModeChanged {
+				fields = append(fields, "权限")
+			}
+			CL.Yellowf("M %s (%s -> %s, %s) [%s]", name, changeSize(change.Old.IsDir, change.OldSize), changeSize(change.IsDir, change.NewSize), formatSizeDelta(change.SizeDelta()), strings.Join(fields, " "))
+		case tools.ChangePermission:
+			CL.Bluef("P %s (%s -> %s)", name, change.OldMode, change.NewMode)
+		}
+	}
+}
+
+// printDiffSummary 打印变更汇总信息
+func printDiffSummary(summary tools.DiffSummary) {
+	fmt.Printf("\n新增 %d 个(%s), 删除 %d 个(%s), 修改 %d 个(%s), 权限变更 %d 个, 总大小变化 %s\n",
+		summary.Added, formatSizeDelta(summary.AddedBytes),
+		summary.Removed, formatSizeDelta(-summary.RemovedBytes),
+		summary.Modified, formatSizeDelta(summary.ModifiedDelta),
+		summary.Permission, formatSizeDelta(summary.TotalDelta))
+}
+
+// printTextDiff 打印一个修改过的文本文件在两个版本之间的统一格式差异
+func printTextDiff(fromReader, toReader tools.VersionReader, change tools.EntryChange) error {
+	// 跳过过大的文件
+	if change.OldSize > maxTextDiffSize || change.NewSize > maxTextDiffSize {
+		fmt.Printf("\n文件 %s 超过 %s, 跳过文本差异\n", change.Name, tools.FormatSize(maxTextDiffSize))
+		return nil
+	}
+
+	// 读取两个版本的文件内容
+	var oldBuf, newBuf bytes.Buffer
+	if _, err := tools.CopyEntry(&oldBuf, fromReader, *change.Old); err != nil {
+		return err
+	}
+	if _, err := tools.CopyEntry(&newBuf, toReader, *change.New); err != nil {
+		return err
+	}
+
+	// 跳过二进制文件
+	if !tools.IsText(oldBuf.Bytes()) || !tools.IsText(newBuf.Bytes()) {
+		fmt.Printf("\n二进制文件 %s 不同\n", change.Name)
+		return nil
+	}
+
+	// 内容相同(仅修改时间变化)时不输出
+	text := tools.UnifiedDiff("a/"+change.Name, "b/"+change.Name, oldBuf.String(), newBuf.String(), 3)
+	if text == "" {
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Print(text)
+	return nil
+}
+
+// changeSize 格式化变更条目的大小, 目录显示为 -
+func changeSize(isDir bool, size int64) string {
+	if isDir {
+		return "-"
+	}
+	return tools.FormatSize(size)
+}
+
+// formatSizeDelta 格式化带符号的大小变化量
+func formatSizeDelta(delta int64) string {
+	switch {
+	case delta > 0:
+		return "+" + tools.FormatSize(delta)
+	case delta < 0:
+		return "-" + tools.FormatSize(-delta)
+	default:
+		return tools.FormatSize(0)
+	}
+}
+
+// formatRecordTime 格式化备份记录的时间, 解析失败时返回原始时间戳
+func formatRecordTime(record globals.BackupRecord) string {
+	recordTime, err := tools.ParseRecordTime(record.Timestamp)
+	if err != nil {
+		return record.Timestamp
+	}
+	return recordTime.Format("2006-01-02 15:04:05")
+}
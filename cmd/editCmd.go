@@ -6,8 +6,6 @@ import (
 	"database/sql"
 	"fmt"
 	"path/filepath"
-	"strconv"
-	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -15,60 +13,16 @@ import (
 
 // editCmdMain 编辑任务
 func editCmdMain(db *sqlx.DB) error {
-	// 存储任务ID的切片
-	var ids []int
-
-	// 如果指定了多个任务ID, 则执行多任务模式
-	if *editIDS != "" {
-		// 解析多个任务ID
-		for _, idStr := range strings.Split(*editIDS, ",") {
-			// 检查解析的任务ID是否为空
-			if idStr == "" {
-				CL.PrintErr("任务ID不能为空")
-				continue
-			}
-
-			// 检查解析的任务ID是否包含特殊字符
-			if tools.ContainsSpecialChars(idStr) {
-				CL.PrintErrf("任务ID包含危险字符: %s", idStr)
-				continue
-			}
-
-			// 将字符串转换为整数
-			id, err := strconv.Atoi(idStr)
-			if err != nil {
-				CL.PrintErrf("无效的任务ID: %s", idStr)
-				continue
-			}
-
-			// 添加任务ID到切片中
-			ids = append(ids, id)
-		}
-
-		// 编辑任务
-		if err := editTask(db, ids); err != nil {
-			return fmt.Errorf("编辑任务失败: %w", err)
-		}
-
-		return nil
-	}
-
-	// 如果指定了单个任务ID, 则执行单任务模式
-	if *editID != -1 {
-		// 添加单个任务ID到切片中
-		ids = append(ids, *editID)
-
-		// 执行任务
-		if err := editTask(db, ids); err != nil {
-			return fmt.Errorf("编辑任务失败: %w", err)
-		}
-
-		return nil
+	// 根据 -id 或 -ids 选择要编辑的任务
+	selector := taskSelector{id: editID, ids: editIDS}
+	ids, err := selector.selectIDs(db)
+	if err != nil {
+		return err
 	}
 
-	// 检查任务ID是否指定
-	if *editID == -1 || *editIDS == "" {
-		return fmt.Errorf("编辑备份任务时, 必须指定任务ID或任务ID列表, 使用 -id 或 -ids 指定, 例如: -id 1 或 -ids '1,2,3'")
+	// 编辑任务
+	if err := editTask(db, ids); err != nil {
+		return fmt.Errorf("编辑任务失败: %w", err)
 	}
 
 	return nil
@@ -85,14 +39,21 @@ func editTask(db *sqlx.DB, ids []int) error {
 	var task globals.BackupTask
 
 	// 查询任务信息
-	editSql := "select task_name, retention_count, retention_days, backup_directory, no_compression, exclude_rules from backup_tasks where task_id =?"
+	editSql := "select task_name, retention_count, retention_days, backup_directory, no_compression, exclude_rules, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly, schedule, tags, depends_on, retries, retry_backoff, timeout, replicas, tier_days, tier_location, task_type, mirror_delete from backup_tasks where task_id =?"
 
 	// 更新任务
-	updateSql := "update backup_tasks set task_name = ?, retention_count = ? , retention_days = ?, backup_directory = ?, no_compression = ?, exclude_rules = ? where task_id = ?"
+	updateSql := "update backup_tasks set task_name = ?, retention_count = ? , retention_days = ?, backup_directory = ?, no_compression = ?, exclude_rules = ?, retention_size = ?, keep_hourly = ?, keep_daily = ?, keep_weekly = ?, keep_monthly = ?, keep_yearly = ?, schedule = ?, tags = ?, depends_on = ?, retries = ?, retry_backoff = ?, timeout = ?, replicas = ?, tier_days = ?, tier_location = ?, mirror_delete = ? where task_id = ?"
+
+	// 检查新的任务名是否含非法字符或为纯数字
+	if *editName != "" {
+		if err := checkTaskName(*editName); err != nil {
+			return err
+		}
+	}
 
 	for _, id := range ids {
 		// 检查所有的参数是否都没指定
-		if *editName == "" && *editRetentionCount == -1 && *editRetentionDays == -1 && *editNoCompression == -1 && *editNewDirName == "" && *editExcludeRules == "" {
+		if *editName == "" && *editRetentionCount == -1 && *editRetentionDays == -1 && *editNoCompression == -1 && *editNewDirName == "" && *editExcludeRules == "" && *editGFS == "" && *editQuota == "" && *editSchedule == "" && *editTags == "" && *editDepends == "" && *editRetries == -1 && *editRetryBackoff == "" && *editTimeout == "" && *editReplicas == "" && *editTier == "" && *editMirrorDelete == -1 {
 			CL.PrintWarnf("在编辑 %d 时未指定任何参数, 该任务将不会被修改", id)
 			continue
 		}
@@ -144,6 +105,12 @@ func editTask(db *sqlx.DB, ids []int) error {
 				continue
 			}
 
+			// 远程存储中的文件不能整体重命名
+			if tools.IsRemoteLocation(task.BackupDirectory) {
+				CL.PrintErrf("任务ID %d 的备份目录位于远程存储, 不支持重命名: %s", id, task.BackupDirectory)
+				continue
+			}
+
 			rootPath = filepath.Dir(task.BackupDirectory)    // 获取备份目录的根路径
 			oldDirName = filepath.Base(task.BackupDirectory) // 获取备份目录的旧名称
 
@@ -162,8 +129,128 @@ func editTask(db *sqlx.DB, ids []int) error {
 			task.ExcludeRules = *editExcludeRules
 		}
 
+		// 如果指定了-gfs参数, 则更新GFS保留策略
+		if *editGFS != "" {
+			gfs, err := tools.ParseGFS(*editGFS)
+			if err != nil {
+				CL.PrintErrf("解析GFS保留策略失败: %v", err)
+				continue
+			}
+			task.GFSRetention = gfs
+		}
+
+		// 如果指定了-quota参数, 则更新备份总大小上限
+		if *editQuota != "" {
+			quota, err := tools.ParseQuota(*editQuota)
+			if err != nil {
+				CL.PrintErrf("解析备份总大小上限失败: %v", err)
+				continue
+			}
+			task.RetentionSize = quota
+		}
+
+		// 如果指定了-schedule参数, 则更新定时计划
+		if *editSchedule != "" {
+			schedule, err := tools.NormalizeSchedule(*editSchedule)
+			if err != nil {
+				CL.PrintErrf("定时计划无效: %v", err)
+				continue
+			}
+			task.Schedule = schedule
+		}
+
+		// 如果指定了-tag参数, 则更新标签
+		if *editTags != "" {
+			tags, err := tools.NormalizeTags(*editTags)
+			if err != nil {
+				CL.PrintErrf("标签无效: %v", err)
+				continue
+			}
+			task.Tags = tags
+		}
+
+		// 如果指定了-dep参数, 则更新前置任务
+		if *editDepends != "" {
+			depends, err := parseDepends(db, *editDepends, id)
+			if err != nil {
+				CL.PrintErrf("前置任务无效: %v", err)
+				continue
+			}
+			task.DependsOn = depends
+		}
+
+		// 如果指定了-retries参数, 则更新重试次数
+		if *editRetries != -1 {
+			if *editRetries < 0 {
+				CL.PrintErrf("重试次数不能小于0")
+				continue
+			}
+			task.Retries = *editRetries
+		}
+
+		// 如果指定了-backoff参数, 则更新重试等待时间
+		if *editRetryBackoff != "" {
+			backoff, err := tools.ParseSeconds(*editRetryBackoff)
+			if err != nil {
+				CL.PrintErrf("重试等待时间无效: %v", err)
+				continue
+			}
+			task.RetryBackoff = backoff
+		}
+
+		// 如果指定了-timeout参数, 则更新超时时间
+		if *editTimeout != "" {
+			timeout, err := tools.ParseSeconds(*editTimeout)
+			if err != nil {
+				CL.PrintErrf("超时时间无效: %v", err)
+				continue
+			}
+			task.Timeout = timeout
+		}
+
+		// 如果指定了-replicas参数, 则更新副本存放路径
+		if *editReplicas != "" {
+			_, dirName := tools.SplitLocation(task.BackupDirectory)
+			replicas, err := tools.NormalizeReplicas(*editReplicas, dirName, task.BackupDirectory)
+			if err != nil {
+				CL.PrintErrf("副本存放路径无效: %v", err)
+				continue
+			}
+			task.Replicas = replicas
+		}
+
+		// 如果指定了-tier参数, 则更新分层存储规则
+		if *editTier != "" {
+			_, dirName := tools.SplitLocation(task.BackupDirectory)
+			tierRule, err := tools.ParseTier(*editTier, dirName, task.BackupDirectory)
+			if err != nil {
+				CL.PrintErrf("分层存储规则无效: %v", err)
+				continue
+			}
+			task.TierRule = tierRule
+		}
+
+		// 如果指定了-mirror-delete参数, 则更新镜像任务是否删除多余的文件
+		if *editMirrorDelete != -1 {
+			if *editMirrorDelete != 0 && *editMirrorDelete != 1 {
+				CL.PrintErrf("-mirror-delete 参数不合法, 只能是 0(不删除) 或 1(删除)")
+				continue
+			}
+			if task.TaskType != globals.TaskTypeMirror {
+				CL.PrintErrf("任务ID %d 不是镜像任务, 不支持 -mirror-delete", id)
+				continue
+			}
+			task.MirrorDelete = *editMirrorDelete
+		}
+
+		// 镜像任务没有备份版本, 快照任务的版本是目录, 都不支持副本和分层存储
+		if task.TaskType != globals.TaskTypeArchive && (task.Replicas != "" || task.TierDays > 0) {
+			CL.PrintErrf("任务ID %d 是%s任务, 不支持副本(-replicas)和分层存储(-tier)", id, taskTypeName(task.TaskType))
+			continue
+		}
+
 		// 更新任务SQL
-		if _, err := db.Exec(updateSql, task.TaskName, task.RetentionCount, task.RetentionDays, task.BackupDirectory, task.NoCompression, task.ExcludeRules, id); err != nil {
+		if _, err := db.Exec(updateSql, task.TaskName, task.RetentionCount, task.RetentionDays, task.BackupDirectory, task.NoCompression, task.ExcludeRules, task.RetentionSize, task.Hourly, task.Daily, task.Weekly, task.Monthly, task.Yearly, task.Schedule, task.Tags, task.DependsOn, task.Retries, task.RetryBackoff, task.Timeout, task.Replicas, task.TierDays, task.TierLocation, task.MirrorDelete, id); err != nil {
 			// 更新任务失败
 			if *editNewDirName != "" {
 				// 为避免变量名冲突，将错误变量名改为 renameErr
@@ -201,6 +288,37 @@ func editTask(db *sqlx.DB, ids []int) error {
 		if *editExcludeRules != "" {
 			CL.PrintOkf("任务ID %d 的排除规则已更新为: %s", id, task.ExcludeRules)
 		}
+		if *editGFS != "" {
+			CL.PrintOkf("任务ID %d 的GFS保留策略已更新为: %s", id, tools.FormatGFS(task.GFSRetention))
+		}
+		if *editQuota != "" {
+			CL.PrintOkf("任务ID %d 的备份总大小上限已更新为: %s", id, tools.FormatQuota(task.RetentionSize))
+		}
+		if *editSchedule != "" {
+			CL.PrintOkf("任务ID %d 的定时计划已更新为: %s", id, tools.FormatSchedule(task.Schedule))
+		}
+		if *editTags != "" {
+			CL.PrintOkf("任务ID %d 的标签已更新为: %s", id, tools.FormatTags(task.Tags))
+		}
+		if *editDepends != "" {
+			_, names, _ := loadDependencies(db)
+			CL.PrintOkf("任务ID %d 的前置任务已更新为: %s", id, formatDepends(task.DependsOn, names))
+		}
+		if *editRetries != -1 || *editRetryBackoff != "" {
+			CL.PrintOkf("任务ID %d 的失败重试已更新为: %s", id, tools.FormatRetries(task.RetryPolicy))
+		}
+		if *editTimeout != "" {
+			CL.PrintOkf("任务ID %d 的超时时间已更新为: %s", id, tools.FormatSeconds(task.Timeout))
+		}
+		if *editReplicas != "" {
+			CL.PrintOkf("任务ID %d 的副本位置已更新为: %s", id, tools.FormatReplicas(task.Replicas))
+		}
+		if *editTier != "" {
+			CL.PrintOkf("任务ID %d 的分层存储规则已更新为: %s", id, tools.FormatTier(task.TierRule))
+		}
+		if *editMirrorDelete != -1 {
+			CL.PrintOkf("任务ID %d 的镜像同步已更新为: %s", id, formatTaskType(task))
+		}
 	}
 
 	return nil
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"database/sql"
 	"fmt"
-	"path/filepath"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -16,56 +18,96 @@ import (
 // 返回值:
 //   - error, 错误信息
 func exportCmdMain(db *sqlx.DB) error {
-	// 构建查询所有的备份任务的SQL语句
-	queryAllSql := "SELECT task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules FROM backup_tasks;"
-
-	// 构建查询单个备份任务的SQL语句
-	queryOneSql := "SELECT task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules FROM backup_tasks WHERE task_id = ?;"
-
-	// 定义存储查询结果的结构体切片
-	var tasks globals.BackupTasks
+	// 根据 -id、-tag 或 -all 选择要导出的任务
+	selector := taskSelector{id: exportID, tag: exportTag, all: exportAll}
+	ids, err := selector.selectIDs(db)
+	if err != nil {
+		return err
+	}
 
-	// 定义查询单个备份任务的结构体
-	var task globals.BackupTask
+	// 构建查询备份任务的SQL语句
+	querySql := "SELECT task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly, schedule, tags, depends_on, retries, retry_backoff, timeout, replicas, tier_days, tier_location, task_type, mirror_delete FROM backup_tasks WHERE task_id = ?;"
 
 	// 定义打印备份任务的cbk命令格式
-	printCmd := "cbk add -n %s -bn %s -t %s -b %s -c %d -d %d -nc %d -ex %s\n"
+	printCmd := "cbk add -n %s -bn %s -t %s -b %s -c %d -d %d -nc %d -ex %s -gfs %s -quota %s -schedule %q -tag %s -dep %s -retries %d -backoff %s -timeout %s -replicas %s -tier %s -type %s -mirror-delete %d\n"
 
-	// 导出所有任务
-	if *exportAll {
-		// 执行查询所有备份任务的SQL语句
-		if err := db.Select(&tasks, queryAllSql); err != nil {
-			return fmt.Errorf("查询所有备份任务失败: %w", err)
-		}
-
-		// 遍历打印所有备份任务的cbk命令格式
-		for _, task := range tasks {
-			// 获取备份目录的名称
-			bakDirName := filepath.Base(task.BackupDirectory)
+	// 查询任务名, 前置任务以任务名导出, 避免导入后任务ID变化
+	deps, names, err := loadDependencies(db)
+	if err != nil {
+		return err
+	}
 
-			// 获取备份目录的父级目录
-			parentDir := filepath.Dir(task.BackupDirectory)
+	// 前置任务排在依赖它的任务之前, 按顺序执行导出的命令时前置任务已存在
+	if order, err := tools.DependencyOrder(deps, ids); err == nil {
+		selected := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			selected[id] = true
+		}
+		ids = ids[:0]
+		for _, id := range order {
+			if selected[id] {
+				ids = append(ids, id)
+			}
+		}
+	}
 
-			fmt.Printf(printCmd, task.TaskName, bakDirName, task.TargetDirectory, parentDir, task.RetentionCount, task.RetentionDays, task.NoCompression, task.ExcludeRules)
+	// 遍历打印备份任务的cbk命令格式
+	for _, id := range ids {
+		var task globals.BackupTask
+		if err := db.Get(&task, querySql, id); err == sql.ErrNoRows {
+			return fmt.Errorf("任务ID不存在: %d", id)
+		} else if err != nil {
+			return fmt.Errorf("查询备份任务失败: %w", err)
 		}
 
-		return nil
+		parentDir, bakDirName := tools.SplitLocation(task.BackupDirectory) // 获取备份目录的父级目录和名称
+		if tools.IsRemoteLocation(parentDir) {
+			parentDir = "'" + parentDir + "'" // 远程存储地址可能包含 & 等字符, 需要加引号
+		}
+		fmt.Printf(printCmd, task.TaskName, bakDirName, task.TargetDirectory, parentDir, task.RetentionCount, task.RetentionDays, task.NoCompression, task.ExcludeRules, tools.FormatGFS(task.GFSRetention), tools.FormatQuota(task.RetentionSize), tools.FormatSchedule(task.Schedule), tools.FormatTags(task.Tags), formatDepends(task.DependsOn, names), task.Retries, tools.FormatSeconds(task.RetryBackoff), tools.FormatSeconds(task.Timeout), exportReplicas(task.Replicas), exportTier(task.TierRule), task.TaskType, task.MirrorDelete)
 	}
 
-	// 导出单个任务
-	if *exportID != 0 {
-		// 执行查询单个备份任务的SQL语句
-		if err := db.Get(&task, queryOneSql, *exportID); err != nil {
-			return fmt.Errorf("查询单个备份任务失败: %w", err)
-		}
+	return nil
+}
 
-		// 打印单个备份任务的cbk命令格式
-		bakDirName := filepath.Base(task.BackupDirectory) // 获取备份目录的名称
-		parentDir := filepath.Dir(task.BackupDirectory)   // 获取备份目录的父级目录
-		fmt.Printf(printCmd, task.TaskName, bakDirName, task.TargetDirectory, parentDir, task.RetentionCount, task.RetentionDays, task.NoCompression, task.ExcludeRules)
+// exportReplicas 返回导出命令中的副本存放路径, 即每个副本位置的上级位置
+// 参数:
+//   - replicas: 任务的副本位置列表
+//
+// 返回值:
+//   - string: 逗号分隔的副本存放路径, 包含远程存储地址时加引号, 未设置时返回 none
+func exportReplicas(replicas string) string {
+	locations := tools.SplitReplicas(replicas)
+	if len(locations) == 0 {
+		return "none"
+	}
 
-		return nil
+	quote := false
+	roots := make([]string, 0, len(locations))
+	for _, location := range locations {
+		root, _ := tools.SplitLocation(location)
+		quote = quote || tools.IsRemoteLocation(root)
+		roots = append(roots, root)
+	}
+	if quote {
+		return "'" + strings.Join(roots, ",") + "'" // 远程存储地址可能包含 & 等字符, 需要加引号
 	}
+	return strings.Join(roots, ",")
+}
 
-	return fmt.Errorf("请使用 -all 或 -id 参数指定导出的备份任务")
+// exportTier 返回导出命令中的分层存储规则, 冷存储路径为冷存储位置的上级位置
+// 参数:
+//   - rule: 任务的分层存储规则
+//
+// 返回值:
+//   - string: 形如 14d:/mnt/archive 的规则, 包含远程存储地址时加引号, 未启用时返回 none
+func exportTier(rule globals.TierRule) string {
+	if rule.TierDays <= 0 {
+		return "none"
+	}
+	root, _ := tools.SplitLocation(rule.TierLocation)
+	if tools.IsRemoteLocation(root) {
+		return fmt.Sprintf("'%dd:%s'", rule.TierDays, root) // 远程存储地址可能包含 & 等字符, 需要加引号
+	}
+	return fmt.Sprintf("%dd:%s", rule.TierDays, root)
 }
@@ -47,6 +47,30 @@ func helpCmdMain(cmd string) error {
 	case "export":
 		fmt.Println(HelpExportText)
 		return nil
+	case "ls":
+		fmt.Println(HelpLsText)
+		return nil
+	case "cat":
+		fmt.Println(HelpCatText)
+		return nil
+	case "diff":
+		fmt.Println(HelpDiffText)
+		return nil
+	case "pin", "unpin":
+		fmt.Println(HelpPinText)
+		return nil
+	case "prune":
+		fmt.Println(HelpPruneText)
+		return nil
+	case "usage":
+		fmt.Println(HelpUsageText)
+		return nil
+	case "daemon":
+		fmt.Println(HelpDaemonText)
+		return nil
+	case "db":
+		fmt.Println(HelpDbText)
+		return nil
 	default:
 		return fmt.Errorf("未知命令: %s", cmd)
 	}
@@ -5,13 +5,15 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+
+	"github.com/jmoiron/sqlx"
 )
 
 // initCmdMain 自动补全主逻辑
-func initCmdMain(t string) error {
+func initCmdMain(db *sqlx.DB, t string) error {
 	// 检查自动补全类型是否为空
 	if t == "" {
-		return fmt.Errorf("请指定生成的类型, 例如: 'cbk init -type [bash|addtask]'")
+		return fmt.Errorf("请指定生成的类型, 例如: 'cbk init -type [bash|addtask|systemd|cron]'")
 	}
 
 	switch t {
@@ -38,6 +40,12 @@ func initCmdMain(t string) error {
 		// 打印提示信息
 		CL.PrintOk("add_task.yaml配置文件已创建, 请根据需要修改后运行 'cbk add -f add_task.yaml' 命令添加备份任务")
 		return nil
+	case "systemd":
+		// 为任务生成systemd的service和timer单元
+		return initSystemd(db)
+	case "cron":
+		// 为任务生成crontab条目
+		return initCron(db)
 	default:
 		return fmt.Errorf("未知的类型: %s", t)
 	}
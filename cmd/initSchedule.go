@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// systemd单元文件的默认安装目录
+const systemdUnitDir = "/etc/systemd/system"
+
+// runIdentity 表示运行定时任务的用户信息
+type runIdentity struct {
+	User  string // 用户名
+	Group string // 用户组
+	Home  string // 用户主目录
+	Exec  string // cbk可执行文件的绝对路径
+}
+
+// currentIdentity 获取当前用户和cbk可执行文件的路径, 生成的单元和crontab条目以当前用户运行
+func currentIdentity() (runIdentity, error) {
+	var id runIdentity
+
+	u, err := user.Current()
+	if err != nil {
+		return id, fmt.Errorf("获取当前用户失败: %w", err)
+	}
+	id.User = u.Username
+	id.Group = u.Username
+	if g, err := user.LookupGroupId(u.Gid); err == nil {
+		id.Group = g.Name
+	}
+
+	// 数据库位于用户主目录下, 与当前命令使用的主目录保持一致
+	if id.Home, err = os.UserHomeDir(); err != nil {
+		return id, fmt.Errorf("获取用户主目录失败: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return id, fmt.Errorf("获取cbk可执行文件路径失败: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	id.Exec = exe
+
+	return id, nil
+}
+
+// scheduledTasksForInit 根据 -id 或 -all 参数查询要生成定时配置的任务
+// 指定 -id 时任务必须设置了定时计划, 指定 -all 时只返回设置了定时计划的任务
+func scheduledTasksForInit(db *sqlx.DB) (globals.BackupTasks, error) {
+	if !initID.IsSet() && !*initAll {
+		return nil, fmt.Errorf("请使用 -id 指定任务ID或使用 -all 为所有设置了定时计划的任务生成")
+	}
+	if initID.IsSet() && *initAll {
+		return nil, fmt.Errorf("不能同时使用 -id 和 -all 参数")
+	}
+
+	var tasks globals.BackupTasks
+	querySql := "SELECT task_id, task_name, target_directory, backup_directory, schedule, replicas, tier_location FROM backup_tasks"
+	if *initAll {
+		if err := db.Select(&tasks, querySql+" WHERE schedule != '' ORDER BY task_id"); err != nil {
+			return nil, fmt.Errorf("查询任务失败: %w", err)
+		}
+		if len(tasks) == 0 {
+			return nil, fmt.Errorf("没有设置定时计划的任务, 请先使用 'cbk edit -id <任务ID> -schedule <定时计划>' 设置")
+		}
+		return tasks, nil
+	}
+
+	taskID, err := initID.Resolve(db)
+	if err != nil {
+		return nil, err
+	}
+	var task globals.BackupTask
+	if err := db.Get(&task, querySql+" WHERE task_id = ?", taskID); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("任务ID不存在: %d", taskID)
+	} else if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	if task.Schedule == "" {
+		return nil, fmt.Errorf("任务 [%s] 未设置定时计划, 请先使用 'cbk edit -id %d -schedule <定时计划>' 设置", task.TaskName, task.TaskID)
+	}
+	return append(tasks, task), nil
+}
+
+// initSystemd 为任务生成systemd的service和timer单元
+func initSystemd(db *sqlx.DB) error {
+	tasks, err := scheduledTasksForInit(db)
+	if err != nil {
+		return err
+	}
+	id, err := currentIdentity()
+	if err != nil {
+		return err
+	}
+
+	// 生成每个任务的单元文件, 无法转换的任务跳过
+	type unitFile struct {
+		name    string
+		content string
+	}
+	var units []unitFile
+	var timers, skipped []string
+	for _, task := range tasks {
+		timer, err := systemdTimerUnit(task)
+		if err != nil {
+			if !*initAll {
+				return err
+			}
+			skipped = append(skipped, fmt.Sprintf("跳过任务 %s (ID: %d): %v", task.TaskName, task.TaskID, err))
+			continue
+		}
+		// 提前创建可写目录, 服务启动时不存在的目录在只读的文件系统中无法再创建
+		for _, dir := range writablePaths(task, id)[1:] {
+			if err := tools.EnsureDirExists(dir); err != nil {
+				skipped = append(skipped, fmt.Sprintf("任务 %s (ID: %d) 的目录 %s 创建失败, 请在首次运行前手动创建: %v", task.TaskName, task.TaskID, dir, err))
+			}
+		}
+		name := systemdUnitName(task)
+		units = append(units,
+			unitFile{name: name + ".service", content: systemdServiceUnit(task, id)},
+			unitFile{name: name + ".timer", content: timer},
+		)
+		timers = append(timers, name+".timer")
+	}
+	if len(units) == 0 {
+		return fmt.Errorf("没有可生成的systemd单元")
+	}
+
+	// 未指定输出目录时输出到控制台, 跳过的任务以注释的形式输出
+	if *initOutput == "" {
+		for _, msg := range skipped {
+			fmt.Printf("# %s\n\n", msg)
+		}
+		for i, unit := range units {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", filepath.Join(systemdUnitDir, unit.name), unit.content)
+		}
+		return nil
+	}
+
+	// 写入单元文件
+	for _, msg := range skipped {
+		CL.PrintWarn(msg)
+	}
+	if err := tools.EnsureDirExists(*initOutput); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	for _, unit := range units {
+		path := filepath.Join(*initOutput, unit.name)
+		if err := os.WriteFile(path, []byte(unit.content), 0644); err != nil {
+			return fmt.Errorf("写入单元文件失败: %w", err)
+		}
+		CL.PrintOkf("已生成: %s", path)
+	}
+	fmt.Printf("请将单元文件复制到 %s 后执行:\n", systemdUnitDir)
+	fmt.Printf("  sudo systemctl daemon-reload\n  sudo systemctl enable --now %s\n", strings.Join(timers, " "))
+	return nil
+}
+
+// systemdUnitName 返回任务对应的systemd单元名(不含后缀)
+func systemdUnitName(task globals.BackupTask) string {
+	return fmt.Sprintf("cbk-task-%d", task.TaskID)
+}
+
+// systemdServiceUnit 生成运行备份任务的service单元
+// 单元以一次性服务运行 "cbk run -id N", 除数据目录、备份目录、本地副本目录和本地冷存储目录外整个文件系统只读
+func systemdServiceUnit(task globals.BackupTask, id runIdentity) string {
+	// 备份目录等在首次运行前可能还不存在, 加上 - 前缀, 否则 systemd 无法建立命名空间, 服务直接失败
+	writable := writablePaths(task, id)
+	for i, path := range writable {
+		if i > 0 {
+			path = "-" + path
+		}
+		writable[i] = systemdQuote(path)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=cbk 备份任务 %s (ID: %d)\n", systemdEscape(task.TaskName), task.TaskID)
+	fmt.Fprintf(&b, "After=local-fs.target\n")
+	fmt.Fprintf(&b, "\n[Service]\n")
+	fmt.Fprintf(&b, "Type=oneshot\n")
+	fmt.Fprintf(&b, "User=%s\n", id.User)
+	fmt.Fprintf(&b, "Group=%s\n", id.Group)
+	fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("HOME="+id.Home))
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdEscape(id.Home))
+	fmt.Fprintf(&b, "ExecStart=%s run -id %d\n", strings.ReplaceAll(systemdQuote(id.Exec), "$", "$$"), task.TaskID)
+	fmt.Fprintf(&b, "Nice=10\n")
+	fmt.Fprintf(&b, "IOSchedulingClass=idle\n")
+	fmt.Fprintf(&b, "UMask=0077\n")
+	fmt.Fprintf(&b, "NoNewPrivileges=true\n")
+	fmt.Fprintf(&b, "PrivateTmp=true\n")
+	fmt.Fprintf(&b, "PrivateDevices=true\n")
+	fmt.Fprintf(&b, "ProtectSystem=strict\n")
+	fmt.Fprintf(&b, "ProtectHome=read-only\n")
+	fmt.Fprintf(&b, "ReadWritePaths=%s\n", strings.Join(writable, " "))
+	fmt.Fprintf(&b, "ProtectKernelTunables=true\n")
+	fmt.Fprintf(&b, "ProtectKernelModules=true\n")
+	fmt.Fprintf(&b, "ProtectControlGroups=true\n")
+	fmt.Fprintf(&b, "RestrictNamespaces=true\n")
+	fmt.Fprintf(&b, "RestrictRealtime=true\n")
+	fmt.Fprintf(&b, "RestrictSUIDSGID=true\n")
+	fmt.Fprintf(&b, "LockPersonality=true\n")
+	fmt.Fprintf(&b, "SystemCallArchitectures=native\n")
+	return b.String()
+}
+
+// writablePaths 返回任务运行时需要写入的目录: 数据库所在目录、备份目录、本地副本目录和本地冷存储目录
+// 第一个元素为数据库所在目录
+func writablePaths(task globals.BackupTask, id runIdentity) []string {
+	writable := []string{filepath.Join(id.Home, globals.CbkHomeDir)}
+	writable = addWritablePath(writable, task.BackupDirectory)
+	for _, location := range tools.SplitReplicas(task.Replicas) {
+		writable = addWritablePath(writable, location)
+	}
+	if task.TierLocation != "" {
+		writable = addWritablePath(writable, task.TierLocation)
+	}
+	return writable
+}
+
+// addWritablePath 将本地路径加入可写目录列表, 远程存储地址和已包含在列表中某个目录下的路径不重复加入
+func addWritablePath(writable []string, path string) []string {
+	if tools.IsRemoteLocation(path) {
+		return writable
+	}
+	for _, dir := range writable {
+		if tools.IsInDir(dir, path) {
+			return writable
+		}
+	}
+	return append(writable, path)
+}
+
+// systemdEscape 转义单元文件中的 % 说明符
+func systemdEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// systemdQuote 转义单元文件中的 % 说明符, 包含空白字符、引号或反斜杠时用双引号括起来,
+// 用于 ReadWritePaths、ExecStart 等以空白字符分隔多个值的配置项
+func systemdQuote(s string) string {
+	s = systemdEscape(s)
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// systemdTimerUnit 根据任务的定时计划生成timer单元
+// cron表达式转换为 OnCalendar 并启用 Persistent 以补跑关机期间错过的运行, @every 转换为 OnUnitActiveSec
+func systemdTimerUnit(task globals.BackupTask) (string, error) {
+	calendars, interval, err := tools.SystemdTimer(task.Schedule)
+	if err != nil {
+		return "", fmt.Errorf("定时计划无效: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=定时运行 cbk 备份任务 %s (ID: %d): %s\n", systemdEscape(task.TaskName), task.TaskID, systemdEscape(task.Schedule))
+	fmt.Fprintf(&b, "\n[Timer]\n")
+	if interval > 0 {
+		seconds := int64(interval.Seconds())
+		fmt.Fprintf(&b, "OnBootSec=%ds\n", seconds)
+		fmt.Fprintf(&b, "OnUnitActiveSec=%ds\n", seconds)
+	} else {
+		for _, calendar := range calendars {
+			fmt.Fprintf(&b, "OnCalendar=%s\n", calendar)
+		}
+		fmt.Fprintf(&b, "Persistent=true\n")
+	}
+	fmt.Fprintf(&b, "Unit=%s.service\n", systemdUnitName(task))
+	fmt.Fprintf(&b, "\n[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=timers.target\n")
+	return b.String(), nil
+}
+
+// initCron 为任务生成crontab条目并输出到控制台
+// 输出可以直接追加到当前用户的crontab, 无法转换的任务以注释的形式输出
+func initCron(db *sqlx.DB) error {
+	tasks, err := scheduledTasksForInit(db)
+	if err != nil {
+		return err
+	}
+	id, err := currentIdentity()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, task := range tasks {
+		expr, err := tools.CrontabExpr(task.Schedule)
+		if err != nil {
+			if !*initAll {
+				return fmt.Errorf("任务 [%s] 的定时计划无法转换: %w", task.TaskName, err)
+			}
+			lines = append(lines, fmt.Sprintf("# 跳过任务 %s (ID: %d): %v", task.TaskName, task.TaskID, err))
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf("# cbk 任务 %s (ID: %d), 定时计划: %s", task.TaskName, task.TaskID, task.Schedule),
+			crontabLine(expr, task, id),
+		)
+	}
+
+	fmt.Printf("# 以下条目需要以用户 %s 运行, 可执行 \"(crontab -l; cbk init -type cron -all) | crontab -\" 追加到当前用户的crontab\n", id.User)
+	fmt.Println(strings.Join(lines, "\n"))
+	return nil
+}
+
+// crontabLine 返回以指定的主目录运行任务的crontab条目
+// 主目录和可执行文件路径按shell规则加引号, cron 会把命令中的 % 转换为换行, 需要转义为 \%
+func crontabLine(expr string, task globals.BackupTask, id runIdentity) string {
+	command := fmt.Sprintf("HOME=%s %s run -id %d", shellQuote(id.Home), shellQuote(id.Exec), task.TaskID)
+	return expr + " " + strings.ReplaceAll(command, "%", `\%`)
+}
+
+// shellQuote 包含shell特殊字符的字符串用单引号括起来, 其中的单引号先结束引号再用反斜杠转义
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/._-+=:,@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"strings"
+	"testing"
+)
+
+// unitValue 返回单元文件中指定配置项的值
+func unitValue(t *testing.T, unit, key string) string {
+	t.Helper()
+	for _, line := range strings.Split(unit, "\n") {
+		if value, ok := strings.CutPrefix(line, key+"="); ok {
+			return value
+		}
+	}
+	t.Fatalf("单元文件中没有 %s:\n%s", key, unit)
+	return ""
+}
+
+func TestSystemdServiceUnitWritablePaths(t *testing.T) {
+	id := runIdentity{User: "backup", Group: "backup", Home: "/home/backup", Exec: "/usr/local/bin/cbk"}
+
+	tests := []struct {
+		name string
+		task globals.BackupTask
+		want string
+	}{
+		{
+			name: "数据目录下的备份目录",
+			task: globals.BackupTask{TaskID: 1, BackupDirectory: "/home/backup/.cbk/data/docs"},
+			want: "/home/backup/.cbk",
+		},
+		{
+			name: "本地副本目录",
+			task: globals.BackupTask{TaskID: 2, BackupDirectory: "/srv/backup/docs", Replicas: "/mnt/usb,s3://bucket/cbk,/mnt/nas,/srv/backup/copies"},
+			want: "/home/backup/.cbk -/srv/backup/docs -/mnt/usb -/mnt/nas -/srv/backup/copies",
+		},
+		{
+			name: "远程备份目录",
+			task: globals.BackupTask{TaskID: 3, BackupDirectory: "sftp://nas/backups", Replicas: "/home/backup/.cbk/replica"},
+			want: "/home/backup/.cbk",
+		},
+		{
+			name: "本地冷存储目录",
+			task: globals.BackupTask{TaskID: 4, BackupDirectory: "/srv/backup/docs", TierRule: globals.TierRule{TierDays: 30, TierLocation: "/mnt/archive"}},
+			want: "/home/backup/.cbk -/srv/backup/docs -/mnt/archive",
+		},
+		{
+			name: "包含空格的目录",
+			task: globals.BackupTask{TaskID: 5, BackupDirectory: "/srv/my backup", Replicas: "/mnt/usb disk", TierRule: globals.TierRule{TierLocation: "/mnt/100% \"cold\""}},
+			want: `/home/backup/.cbk "-/srv/my backup" "-/mnt/usb disk" "-/mnt/100%% \"cold\""`,
+		},
+	}
+
+	// 除数据目录外, 其他目录在首次运行前可能还不存在, 都需要加上 - 前缀
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unit := systemdServiceUnit(tt.task, id)
+			if got := unitValue(t, unit, "ReadWritePaths"); got != tt.want {
+				t.Errorf("ReadWritePaths = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemdServiceUnitQuoting(t *testing.T) {
+	id := runIdentity{User: "backup", Group: "backup", Home: "/home/back up", Exec: "/opt/my apps/cbk"}
+	unit := systemdServiceUnit(globals.BackupTask{TaskID: 7, TaskName: "50% docs", BackupDirectory: "/srv/backup"}, id)
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "Description", want: "cbk 备份任务 50%% docs (ID: 7)"},
+		{key: "Environment", want: `"HOME=/home/back up"`},
+		{key: "WorkingDirectory", want: "/home/back up"},
+		{key: "ExecStart", want: `"/opt/my apps/cbk" run -id 7`},
+	}
+	for _, tt := range tests {
+		if got := unitValue(t, unit, tt.key); got != tt.want {
+			t.Errorf("%s = %q, 期望 %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSystemdTimerUnitDescription(t *testing.T) {
+	unit, err := systemdTimerUnit(globals.BackupTask{TaskID: 8, TaskName: "50% docs", Schedule: "0 3 * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "定时运行 cbk 备份任务 50%% docs (ID: 8): 0 3 * * *"
+	if got := unitValue(t, unit, "Description"); got != want {
+		t.Errorf("Description = %q, 期望 %q", got, want)
+	}
+}
+
+func TestCrontabLine(t *testing.T) {
+	tests := []struct {
+		name string
+		id   runIdentity
+		want string
+	}{
+		{
+			name: "普通路径",
+			id:   runIdentity{Home: "/home/backup", Exec: "/usr/local/bin/cbk"},
+			want: "0 3 * * * HOME=/home/backup /usr/local/bin/cbk run -id 9",
+		},
+		{
+			name: "包含空格和百分号的路径",
+			id:   runIdentity{Home: "/home/back up", Exec: "/opt/100% apps/cbk"},
+			want: `0 3 * * * HOME='/home/back up' '/opt/100\% apps/cbk' run -id 9`,
+		},
+		{
+			name: "包含单引号的路径",
+			id:   runIdentity{Home: "/home/o'neil", Exec: "/usr/local/bin/cbk"},
+			want: `0 3 * * * HOME='/home/o'\''neil' /usr/local/bin/cbk run -id 9`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crontabLine("0 3 * * *", globals.BackupTask{TaskID: 9}, tt.id); got != tt.want {
+				t.Errorf("crontabLine() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"cbk/pkg/globals"
+	"cbk/pkg/tools"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
@@ -29,7 +31,7 @@ func listCmdMain(db *sqlx.DB) error {
 	}
 
 	// 查询所有任务
-	querySql := "SELECT task_id, task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules FROM backup_tasks;"
+	querySql := "SELECT task_id, task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly, schedule, tags, depends_on, retries, retry_backoff, timeout, replicas, tier_days, tier_location, task_type, mirror_delete FROM backup_tasks;"
 
 	// 定义存储查询结果的结构体
 	var tasks globals.BackupTasks
@@ -39,13 +41,26 @@ func listCmdMain(db *sqlx.DB) error {
 		return fmt.Errorf("查询任务失败: %w", err)
 	}
 
+	// 查询任务名, 用于显示前置任务
+	_, names, err := loadDependencies(db)
+	if err != nil {
+		return err
+	}
+
+	// 如果指定了-tag参数, 则仅列出包含指定标签的任务
+	if *listTag != "" {
+		if tasks, err = filterTasksByTag(tasks, *listTag); err != nil {
+			return err
+		}
+	}
+
 	// 禁用表格的输出
 	if *listNoTable || *listNoTableShort {
 		// 打印任务列表
-		fmt.Printf("%-30s %-10s %-15s %-15s %-30s %-30s %-20s %-30s\n",
-			"任务名", "任务ID", "保留数量", "保留天数", "目标目录", "备份目录", "是否禁用压缩", "排除规则")
+		fmt.Printf("%-30s %-10s %-15s %-15s %-15s %-20s %-15s %-20s %-20s %-20s %-15s %-10s %-30s %-30s %-30s %-30s %-20s %-30s\n",
+			"任务名", "任务ID", "类型", "保留数量", "保留天数", "GFS策略", "大小上限", "定时计划", "标签", "前置任务", "失败重试", "超时", "目标目录", "备份目录", "副本", "分层存储", "是否禁用压缩", "排除规则")
 		for _, task := range tasks {
-			fmt.Printf("%-30s %-10d %-15d %-15d %-30s %-30s %-10s %-30s\n", task.TaskName, task.TaskID, task.RetentionCount, task.RetentionDays, task.TargetDirectory, task.BackupDirectory, func() string {
+			fmt.Printf("%-30s %-10d %-15s %-15d %-15d %-20s %-15s %-20s %-20s %-20s %-15s %-10s %-30s %-30s %-30s %-30s %-10s %-30s\n", task.TaskName, task.TaskID, formatTaskType(task), task.RetentionCount, task.RetentionDays, tools.FormatGFS(task.GFSRetention), tools.FormatQuota(task.RetentionSize), tools.FormatSchedule(task.Schedule), tools.FormatTags(task.Tags), formatDepends(task.DependsOn, names), tools.FormatRetries(task.RetryPolicy), tools.FormatSeconds(task.Timeout), task.TargetDirectory, task.BackupDirectory, tools.FormatReplicas(task.Replicas), tools.FormatTier(task.TierRule), func() string {
 				if task.NoCompression == 0 {
 					return "false"
 				} else {
@@ -61,16 +76,26 @@ func listCmdMain(db *sqlx.DB) error {
 	t.SetOutputMirror(os.Stdout)
 
 	// 设置表头
-	t.AppendHeader(table.Row{"ID", "任务名", "保留数量", "保留天数", "目标目录", "备份目录", "是否禁用压缩", "排除规则"})
+	t.AppendHeader(table.Row{"ID", "任务名", "类型", "保留数量", "保留天数", "GFS策略", "大小上限", "定时计划", "标签", "前置任务", "失败重试", "超时", "目标目录", "备份目录", "副本", "分层存储", "是否禁用压缩", "排除规则"})
 
 	// 设置列配置
 	t.SetColumnConfigs([]table.ColumnConfig{
 		{Name: "ID", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
 		{Name: "任务名", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
+		{Name: "类型", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
 		{Name: "保留数量", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
 		{Name: "保留天数", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
+		{Name: "GFS策略", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
+		{Name: "大小上限", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
+		{Name: "定时计划", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
+		{Name: "标签", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
+		{Name: "前置任务", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
+		{Name: "失败重试", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
+		{Name: "超时", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
 		{Name: "目标目录", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
 		{Name: "备份目录", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
+		{Name: "副本", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
+		{Name: "分层存储", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
 		{Name: "是否禁用压缩", Align: text.AlignCenter, WidthMaxEnforcer: text.WrapHard},
 		{Name: "排除规则", Align: text.AlignLeft, WidthMaxEnforcer: text.WrapHard},
 	})
@@ -80,10 +105,20 @@ func listCmdMain(db *sqlx.DB) error {
 		t.AppendRow(table.Row{
 			task.TaskID,
 			task.TaskName,
+			formatTaskType(task),
 			task.RetentionCount,
 			task.RetentionDays,
+			tools.FormatGFS(task.GFSRetention),
+			tools.FormatQuota(task.RetentionSize),
+			tools.FormatSchedule(task.Schedule),
+			tools.FormatTags(task.Tags),
+			formatDepends(task.DependsOn, names),
+			tools.FormatRetries(task.RetryPolicy),
+			tools.FormatSeconds(task.Timeout),
 			task.TargetDirectory,
 			task.BackupDirectory,
+			strings.ReplaceAll(tools.FormatReplicas(task.Replicas), ",", "\n"),
+			tools.FormatTier(task.TierRule),
 			func() string {
 				if task.NoCompression == 0 {
 					return "false"
@@ -100,3 +135,22 @@ func listCmdMain(db *sqlx.DB) error {
 
 	return nil
 }
+
+// taskTypeName 返回任务类型的中文名称, 用于提示信息
+func taskTypeName(taskType string) string {
+	switch taskType {
+	case globals.TaskTypeMirror:
+		return "镜像"
+	case globals.TaskTypeSnapshot:
+		return "快照"
+	}
+	return "归档"
+}
+
+// formatTaskType 返回任务类型的显示文本, 删除多余文件的镜像任务显示为 mirror+delete
+func formatTaskType(task globals.BackupTask) string {
+	if task.TaskType == globals.TaskTypeMirror && task.MirrorDelete == 1 {
+		return task.TaskType + "+delete"
+	}
+	return task.TaskType
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"cbk/pkg/globals"
+	"cbk/pkg/tools"
 	"database/sql"
 	"fmt"
 	"os"
@@ -37,7 +38,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 
 	// 定义查询语句
 	querySql := `
-		SELECT version_id, task_id, timestamp, task_name, backup_status, backup_file_name, backup_size, backup_path, version_hash
+		SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, label, note, attempt, error_message, files_copied, files_updated, files_deleted, files_linked, started_at, finished_at, duration_ms, size_bytes, file_count, dir_count, bytes_read, bytes_written, compression_ratio, run_status
 		FROM backup_records
 		ORDER BY timestamp DESC
 		LIMIT ? OFFSET ?;
@@ -58,7 +59,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 		// 禁用表格的输出
 		if *logNoTable || *logNoTableShort {
 			// 打印备份记录
-			fmt.Printf("%-25s%-18s%-15s%-20s%-10s%-40s%-30s%-25s%-10s\n", "备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录", "版本哈希")
+			fmt.Printf("%-25s%-18s%-15s%-20s%-10s%-40s%-30s%-25s%-15s%-8s%-20s%-30s%-6s%-22s%-12s%-8s%-8s%-12s%-12s%-8s%s\n", "备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录", "版本哈希", "固定", "标签", "备注", "尝试", "结束时间", "耗时", "文件数", "目录数", "读取", "写入", "压缩率", "错误信息")
 			for _, record := range records {
 				// 将时间戳转换为时间对象并格式化为易读格式
 				timestamp, err := time.Parse("20060102150405", record.Timestamp)
@@ -66,7 +67,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 					return fmt.Errorf("解析时间戳失败: %w", err)
 				}
 				formattedTimestamp := timestamp.Format("2006-01-02 15:04:05")
-				fmt.Printf("%-25s%-25s%-15d%-20s%-10s%-40s%-30s%-30s%-10s\n", formattedTimestamp, record.VersionID, record.TaskID, record.TaskName, record.BackupStatus, record.BackupFileName, record.BackupSize, record.BackupPath, record.VersionHash)
+				fmt.Printf("%-25s%-25s%-15d%-20s%-10s%-40s%-30s%-30s%-15s%-8s%-20s%-30s%-6d%-22s%-12s%-8d%-8d%-12s%-12s%-8s%s\n", formattedTimestamp, record.VersionID, record.TaskID, record.TaskName, formatRunStatus(record), recordFileName(record), formatRecordSize(record), record.BackupPath, record.VersionHash, pinnedText(record), record.Label, record.Note, record.Attempt, formatFinishedAt(record), formatDuration(record), record.FileCount, record.DirCount, tools.FormatSize(record.BytesRead), tools.FormatSize(record.BytesWritten), formatCompressionRatio(record), record.ErrorMessage)
 			}
 
 			return nil
@@ -91,7 +92,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 		}
 
 		// 添加表头
-		t.AppendHeader(table.Row{"备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录", "版本哈希"})
+		t.AppendHeader(table.Row{"备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录", "版本哈希", "固定", "标签", "备注", "尝试", "结束时间", "耗时", "文件数", "目录数", "读取", "写入", "压缩率", "错误信息"})
 
 		// 遍历查询结果，将数据添加到表格中
 		for _, record := range records {
@@ -108,11 +109,23 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 				record.VersionID,
 				record.TaskID,
 				record.TaskName,
-				record.BackupStatus,
-				record.BackupFileName,
-				record.BackupSize,
+				formatRunStatus(record),
+				recordFileName(record),
+				formatRecordSize(record),
 				record.BackupPath,
 				record.VersionHash,
+				pinnedText(record),
+				record.Label,
+				record.Note,
+				record.Attempt,
+				formatFinishedAt(record),
+				formatDuration(record),
+				record.FileCount,
+				record.DirCount,
+				tools.FormatSize(record.BytesRead),
+				tools.FormatSize(record.BytesWritten),
+				formatCompressionRatio(record),
+				record.ErrorMessage,
 			})
 		}
 
@@ -127,6 +140,8 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 			{Name: "备份文件大小", WidthMax: 10, WidthMaxEnforcer: text.WrapHard},
 			{Name: "备份存放目录", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
 			{Name: "版本哈希", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+			{Name: "标签", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+			{Name: "备注", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
 		})
 		t.SetColumnConfigs([]table.ColumnConfig{
 			{Name: "版本ID", Align: text.AlignCenter},
@@ -138,6 +153,18 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 			{Name: "备份文件大小", Align: text.AlignCenter},
 			{Name: "备份存放目录", Align: text.AlignLeft},
 			{Name: "版本哈希", Align: text.AlignCenter},
+			{Name: "固定", Align: text.AlignCenter},
+			{Name: "标签", Align: text.AlignLeft},
+			{Name: "备注", Align: text.AlignLeft},
+			{Name: "尝试", Align: text.AlignCenter},
+			{Name: "结束时间", Align: text.AlignLeft},
+			{Name: "耗时", Align: text.AlignRight},
+			{Name: "文件数", Align: text.AlignRight},
+			{Name: "目录数", Align: text.AlignRight},
+			{Name: "读取", Align: text.AlignRight},
+			{Name: "写入", Align: text.AlignRight},
+			{Name: "压缩率", Align: text.AlignRight},
+			{Name: "错误信息", Align: text.AlignLeft, WidthMax: 40, WidthMaxEnforcer: text.WrapSoft},
 		})
 
 		// 打印表格
@@ -149,7 +176,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 	// 禁用表格的输出
 	if *logNoTable || *logNoTableShort {
 		// 打印备份记录
-		fmt.Printf("%-25s%-20s%-10s%-40s%-30s%-25s\n", "备份时间", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录")
+		fmt.Printf("%-25s%-20s%-10s%-40s%-30s%-12s%-25s%-20s%-30s%s\n", "备份时间", "任务名", "备份状态", "备份文件名", "备份文件大小", "耗时", "备份存放目录", "标签", "备注", "错误信息")
 		for _, record := range records {
 			// 将时间戳转换为时间对象并格式化为易读格式
 			timestamp, err := time.Parse("20060102150405", record.Timestamp)
@@ -157,7 +184,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 				return fmt.Errorf("解析时间戳失败: %w", err)
 			}
 			formattedTimestamp := timestamp.Format("2006-01-02 15:04:05")
-			fmt.Printf("%-25s%-20s%-10s%-40s%-30s%-30s\n", formattedTimestamp, record.TaskName, record.BackupStatus, record.BackupFileName, record.BackupSize, record.BackupPath)
+			fmt.Printf("%-25s%-20s%-10s%-40s%-30s%-12s%-30s%-20s%-30s%s\n", formattedTimestamp, record.TaskName, formatRunStatus(record), recordFileName(record), formatRecordSize(record), formatDuration(record), record.BackupPath, formatLabel(record), record.Note, record.ErrorMessage)
 		}
 
 		return nil
@@ -183,7 +210,7 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 	}
 
 	// 添加表头
-	t.AppendHeader(table.Row{"备份时间", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录"})
+	t.AppendHeader(table.Row{"备份时间", "任务名", "备份状态", "备份文件名", "备份文件大小", "耗时", "备份存放目录", "标签", "备注", "错误信息"})
 
 	// 遍历查询结果，将数据添加到表格中
 	for _, record := range records {
@@ -198,10 +225,14 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 		t.AppendRow(table.Row{
 			formattedTimestamp, // 备份时间
 			record.TaskName,
-			record.BackupStatus,
-			record.BackupFileName,
-			record.BackupSize,
+			formatRunStatus(record),
+			recordFileName(record),
+			formatRecordSize(record),
+			formatDuration(record),
 			record.BackupPath,
+			formatLabel(record),
+			record.Note,
+			record.ErrorMessage,
 		})
 	}
 
@@ -213,6 +244,8 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 		{Name: "备份文件名", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
 		{Name: "备份文件大小", WidthMax: 10, WidthMaxEnforcer: text.WrapHard},
 		{Name: "备份存放目录", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
+		{Name: "标签", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+		{Name: "备注", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
 	})
 	t.SetColumnConfigs([]table.ColumnConfig{
 		{Name: "备份时间", Align: text.AlignLeft},
@@ -220,7 +253,11 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 		{Name: "备份状态", Align: text.AlignCenter},
 		{Name: "备份文件名", Align: text.AlignLeft},
 		{Name: "备份文件大小", Align: text.AlignCenter},
+		{Name: "耗时", Align: text.AlignRight},
 		{Name: "备份存放目录", Align: text.AlignLeft},
+		{Name: "标签", Align: text.AlignLeft},
+		{Name: "备注", Align: text.AlignLeft},
+		{Name: "错误信息", Align: text.AlignLeft, WidthMax: 40, WidthMaxEnforcer: text.WrapSoft},
 	})
 
 	// 打印表格
@@ -228,3 +265,71 @@ func logCmdMain(db *sqlx.DB, page, pageSize int) error {
 
 	return nil
 }
+
+// recordFileName 返回备份记录的备份文件名, 镜像任务的同步记录显示复制、更新和删除的文件数,
+// 快照版本显示快照目录名以及复制和硬链接的文件数
+func recordFileName(record globals.BackupRecord) string {
+	if tools.IsMirrorRecord(record) {
+		stats := tools.MirrorStats{Copied: record.FilesCopied, Updated: record.FilesUpdated, Deleted: record.FilesDeleted}
+		return "镜像: " + stats.String()
+	}
+	if tools.IsSnapshotRecord(record) {
+		stats := tools.SnapshotStats{Copied: record.FilesCopied, Linked: record.FilesLinked}
+		return fmt.Sprintf("快照: %s (%s)", record.BackupFileName, stats)
+	}
+	return record.BackupFileName
+}
+
+// 运行状态的显示文本
+var runStatusText = map[string]string{
+	globals.RunStatusSuccess:   "成功",
+	globals.RunStatusPartial:   "部分完成",
+	globals.RunStatusFailed:    "失败",
+	globals.RunStatusCancelled: "已取消",
+	globals.RunStatusUnchanged: "无变化",
+	globals.RunStatusSkipped:   "已跳过",
+}
+
+// formatRunStatus 返回备份记录运行状态的显示文本, 未知的运行状态原样显示
+func formatRunStatus(record globals.BackupRecord) string {
+	if text, ok := runStatusText[record.RunStatus]; ok {
+		return text
+	}
+	if record.RunStatus == "" {
+		return "-"
+	}
+	return record.RunStatus
+}
+
+// formatRecordSize 返回备份记录的大小, 没有备份文件的记录显示 -
+func formatRecordSize(record globals.BackupRecord) string {
+	if !tools.IsSuccessRecord(record) {
+		return "-"
+	}
+	return tools.FormatSize(record.SizeBytes)
+}
+
+// formatDuration 返回备份记录的运行耗时, 没有运行元数据的旧记录显示 -
+func formatDuration(record globals.BackupRecord) string {
+	if record.FinishedAt == "" {
+		return "-"
+	}
+	return (time.Duration(record.DurationMs) * time.Millisecond).String()
+}
+
+// formatFinishedAt 返回备份记录的结束时间, 没有运行元数据的旧记录显示 -
+func formatFinishedAt(record globals.BackupRecord) string {
+	finished, err := tools.ParseRecordTime(record.FinishedAt)
+	if err != nil {
+		return "-"
+	}
+	return finished.Format("2006-01-02 15:04:05")
+}
+
+// formatCompressionRatio 返回备份文件的压缩率, 快照、镜像和未压缩的备份显示 -
+func formatCompressionRatio(record globals.BackupRecord) string {
+	if record.CompressionRatio == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", record.CompressionRatio)
+}
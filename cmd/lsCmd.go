@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"cbk/pkg/tools"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// lsCmdMain 列出备份版本或ZIP文件中的内容, 不进行解压
+func lsCmdMain(db *sqlx.DB) error {
+	// 获取要列出的路径
+	var listPath string
+	if lsCmd.NArg() > 1 {
+		return fmt.Errorf("只能指定一个要列出的路径")
+	} else if lsCmd.NArg() == 1 {
+		listPath = lsCmd.Arg(0)
+	}
+
+	// 打开版本读取器
+	taskID, err := lsID.Resolve(db)
+	if err != nil {
+		return err
+	}
+	reader, err := openArchiveReader(db, taskID, *lsVersionID, *lsFile)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 获取要显示的条目
+	entries := reader.Entries()
+	var listed []tools.ArchiveEntry
+	if tools.CleanEntryPath(listPath) == "" {
+		listed = tools.ListEntries(entries, "", *lsRecursive)
+	} else if entry, ok := tools.FindEntry(entries, listPath); !ok {
+		return fmt.Errorf("路径在备份中不存在: %s", listPath)
+	} else if entry.IsDir {
+		listed = tools.ListEntries(entries, entry.Name, *lsRecursive)
+	} else {
+		listed = []tools.ArchiveEntry{entry}
+	}
+
+	// 显示名称相对于列出的目录
+	baseDir := tools.CleanEntryPath(listPath)
+	if entry, ok := tools.FindEntry(entries, baseDir); ok && !entry.IsDir {
+		baseDir = path.Dir(baseDir)
+	}
+	displayName := func(entry tools.ArchiveEntry) string {
+		name := entry.Name
+		if baseDir != "" && baseDir != "." {
+			name = strings.TrimPrefix(name, baseDir+"/")
+		}
+		if entry.IsDir {
+			name += "/"
+		}
+		return name
+	}
+
+	// 以表格形式显示
+	if *lsTable {
+		return printEntriesTable(listed, displayName)
+	}
+
+	// 以长格式显示
+	if *lsLong {
+		for _, entry := range listed {
+			fmt.Printf("%-12s %10s %10s %8s  %-19s  %s\n", entry.Mode.String(), entrySize(entry, entry.Size), entrySize(entry, entry.CompressedSize), entryRatio(entry), entryModTime(entry), displayName(entry))
+		}
+		printEntriesSummary(listed)
+		return nil
+	}
+
+	// 默认仅显示名称
+	for _, entry := range listed {
+		fmt.Println(displayName(entry))
+	}
+
+	return nil
+}
+
+// printEntriesTable 以表格形式打印条目列表
+func printEntriesTable(entries []tools.ArchiveEntry, displayName func(tools.ArchiveEntry) string) error {
+	// 创建表格
+	t := table.NewWriter()
+
+	// 设置表格输出到标准输出
+	t.SetOutputMirror(os.Stdout)
+
+	// 设置表格样式
+	if style, ok := TableStyle[*lsTableStyle]; ok {
+		t.SetStyle(style)
+	} else {
+		// 定义样式列表
+		var styleList []string
+		for k := range TableStyle {
+			styleList = append(styleList, k)
+		}
+		return fmt.Errorf("表格样式不存在: %s, 可选样式: %v", *lsTableStyle, styleList)
+	}
+
+	// 添加表头
+	t.AppendHeader(table.Row{"权限", "大小", "压缩后大小", "压缩率", "修改时间", "路径"})
+
+	// 将条目添加到表格
+	for _, entry := range entries {
+		t.AppendRow(table.Row{
+			entry.Mode.String(),
+			entrySize(entry, entry.Size),
+			entrySize(entry, entry.CompressedSize),
+			entryRatio(entry),
+			entryModTime(entry),
+			displayName(entry),
+		})
+	}
+
+	// 设置列配置
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "权限", Align: text.AlignLeft},
+		{Name: "大小", Align: text.AlignRight},
+		{Name: "压缩后大小", Align: text.AlignRight},
+		{Name: "压缩率", Align: text.AlignRight},
+		{Name: "修改时间", Align: text.AlignLeft},
+		{Name: "路径", Align: text.AlignLeft},
+	})
+
+	// 输出表格
+	t.Render()
+	printEntriesSummary(entries)
+
+	return nil
+}
+
+// printEntriesSummary 打印条目列表的汇总信息
+func printEntriesSummary(entries []tools.ArchiveEntry) {
+	stats := tools.CountEntries(entries)
+	fmt.Printf("共 %d 个条目, 其中文件 %d 个, 总大小 %s, 压缩后 %s\n", len(entries), stats.Files, tools.FormatSize(stats.Size), tools.FormatSize(stats.CompressedSize))
+}
+
+// entrySize 格式化条目大小, 目录显示为 -
+func entrySize(entry tools.ArchiveEntry, size int64) string {
+	if entry.IsDir {
+		return "-"
+	}
+	return tools.FormatSize(size)
+}
+
+// entryRatio 格式化条目的压缩率, 目录显示为 -
+func entryRatio(entry tools.ArchiveEntry) string {
+	if entry.IsDir {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", entry.Ratio())
+}
+
+// entryModTime 格式化条目的修改时间, 推断出的目录没有修改时间
+func entryModTime(entry tools.ArchiveEntry) string {
+	if entry.Implicit || entry.ModTime.IsZero() {
+		return "-"
+	}
+	return entry.ModTime.Local().Format("2006-01-02 15:04:05")
+}
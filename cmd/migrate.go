@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 数据库迁移文件, 文件名格式为 <版本号>_<名称>.sql, 例如 0002_add_run_metadata.sql
+// 版本号从1开始连续递增, 已发布的迁移文件不能再修改, 表结构的变化需要新增迁移文件
+//
+//go:embed sql/migrations/*.sql
+var migrationFS embed.FS
+
+// 记录已应用迁移的表
+const schemaVersionSql = `CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY, -- 迁移版本号
+    name TEXT, -- 迁移名称
+    applied_at TEXT -- 应用时间
+)`
+
+// migration 表示一个数据库迁移
+type migration struct {
+	Version int    // 版本号
+	Name    string // 名称
+	Sql     string // 迁移SQL语句
+}
+
+// appliedMigration 表示已应用的迁移
+type appliedMigration struct {
+	Version   int    `db:"version"`    // 版本号
+	Name      string `db:"name"`       // 名称
+	AppliedAt string `db:"applied_at"` // 应用时间
+}
+
+// loadMigrations 读取内置的迁移文件, 按版本号排序
+// 返回值:
+// - []migration: 迁移列表
+// - error: 文件名格式不正确或版本号不连续时返回错误
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationFS, "sql/migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移文件失败: %w", err)
+	}
+
+	var migrations []migration
+	for _, file := range files {
+		base := strings.TrimSuffix(filepath.Base(file), ".sql")
+		versionText, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("迁移文件名格式不正确: %s, 应为 <版本号>_<名称>.sql", file)
+		}
+		content, err := migrationFS.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移文件 %s 失败: %w", file, err)
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, Sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("迁移版本号不连续: 缺少版本 %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// loadAppliedMigrations 查询已应用的迁移, 按版本号排序
+// 没有 schema_version 表的数据库视为没有应用任何迁移, 查询时不修改数据库
+func loadAppliedMigrations(db *sqlx.DB) ([]appliedMigration, error) {
+	var tableCount int
+	if err := db.Get(&tableCount, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'"); err != nil {
+		return nil, fmt.Errorf("检查 schema_version 表失败: %w", err)
+	}
+	if tableCount == 0 {
+		return nil, nil
+	}
+	var applied []appliedMigration
+	if err := db.Select(&applied, "SELECT version, name, applied_at FROM schema_version ORDER BY version"); err != nil {
+		return nil, fmt.Errorf("查询已应用的迁移失败: %w", err)
+	}
+	return applied, nil
+}
+
+// schemaVersion 返回已应用迁移中的最高版本号, 没有应用任何迁移时返回0
+func schemaVersion(applied []appliedMigration) int {
+	if len(applied) == 0 {
+		return 0
+	}
+	return applied[len(applied)-1].Version
+}
+
+// migrateDB 将数据库升级到最新版本
+// 已有数据的数据库在应用迁移之前会先备份到 "用户主目录/.cbk/db_backups" 目录;
+// 引入版本化迁移之前创建的数据库没有 schema_version 表, 应用第一个迁移时同时补充缺失的列
+// 参数:
+// - db: 数据库连接
+// - dbPath: 数据库文件路径
+// 返回值:
+// - []migration: 本次应用的迁移
+// - error: 错误信息
+func migrateDB(db *sqlx.DB, dbPath string) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := loadAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	current := schemaVersion(applied)
+	if current > len(migrations) {
+		return nil, fmt.Errorf("数据库版本 %d 高于当前程序支持的版本 %d, 请升级 cbk 后再使用", current, len(migrations))
+	}
+	pending := migrations[current:]
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	if _, err := db.Exec(schemaVersionSql); err != nil {
+		return nil, fmt.Errorf("创建 schema_version 表失败: %w", err)
+	}
+
+	// 已有数据的数据库先备份, 新建的数据库没有需要备份的数据
+	var tableCount int
+	if err := db.Get(&tableCount, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'backup_tasks'"); err != nil {
+		return nil, fmt.Errorf("检查数据库表失败: %w", err)
+	}
+	legacy := tableCount > 0 && current == 0
+	if tableCount > 0 {
+		backupPath, err := backupDB(db, dbPath, current)
+		if err != nil {
+			return nil, err
+		}
+		CL.PrintOkf("数据库将从版本 %d 升级到版本 %d, 升级前的数据库已备份到: %s", current, len(migrations), backupPath)
+	}
+
+	for _, m := range pending {
+		if err := applyMigration(db, m, legacy && m.Version == 1); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// backupDB 将数据库备份到 "用户主目录/.cbk/db_backups" 目录, 文件名包含升级前的版本号和备份时间
+// 使用 VACUUM INTO 生成一致的副本, 不受 WAL 文件中尚未合并的数据影响
+func backupDB(db *sqlx.DB, dbPath string, version int) (string, error) {
+	backupDir := filepath.Join(filepath.Dir(dbPath), globals.CbkDBBackupDir)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", fmt.Errorf("创建数据库备份目录失败: %w", err)
+	}
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("cbk_v%d_%s.db", version, time.Now().Format(tools.TimestampLayout)))
+	if _, err := db.Exec("VACUUM INTO ?", backupPath); err != nil {
+		return "", fmt.Errorf("备份数据库失败: %w", err)
+	}
+	return backupPath, nil
+}
+
+// applyMigration 在事务中应用一个迁移并记录到 schema_version 表
+// 其他进程已应用该迁移时直接跳过
+// 参数:
+// - db: 数据库连接
+// - m: 迁移
+// - legacy: 是否为引入版本化迁移之前创建的数据库, 为 true 时同时补充缺失的列
+// 返回值:
+// - error: 错误信息
+func applyMigration(db *sqlx.DB, m migration, legacy bool) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var count int
+	if err := tx.Get(&count, "SELECT count(*) FROM schema_version WHERE version = ?", m.Version); err != nil {
+		return fmt.Errorf("查询迁移 %d 的状态失败: %w", m.Version, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(m.Sql); err != nil {
+		return fmt.Errorf("应用迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+	}
+	if legacy {
+		if err := addLegacyColumns(tx); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().Format(tools.TimestampLayout)); err != nil {
+		return fmt.Errorf("记录迁移 %d 失败: %w", m.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交迁移 %d 失败: %w", m.Version, err)
+	}
+	return nil
+}
+
+// 引入版本化迁移之前, 旧版本数据库中可能缺失的列
+// 该列表不再新增, 之后的表结构变化通过新的迁移文件完成
+var legacyColumns = []struct {
+	table      string // 表名
+	column     string // 列名
+	definition string // 列定义
+}{
+	{"backup_tasks", "retention_size", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "keep_hourly", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "keep_daily", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "keep_weekly", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "keep_monthly", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "keep_yearly", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "schedule", "TEXT DEFAULT ''"},
+	{"backup_tasks", "tags", "TEXT DEFAULT ''"},
+	{"backup_tasks", "depends_on", "TEXT DEFAULT ''"},
+	{"backup_tasks", "retries", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "retry_backoff", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "timeout", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "replicas", "TEXT DEFAULT ''"},
+	{"backup_tasks", "tier_days", "INTEGER DEFAULT 0"},
+	{"backup_tasks", "tier_location", "TEXT DEFAULT ''"},
+	{"backup_tasks", "task_type", "TEXT DEFAULT 'archive'"},
+	{"backup_tasks", "mirror_delete", "INTEGER DEFAULT 0"},
+	{"backup_records", "pinned", "INTEGER DEFAULT 0"},
+	{"backup_records", "label", "TEXT DEFAULT ''"},
+	{"backup_records", "note", "TEXT DEFAULT ''"},
+	{"backup_records", "attempt", "INTEGER DEFAULT 1"},
+	{"backup_records", "error_message", "TEXT DEFAULT ''"},
+	{"backup_records", "files_copied", "INTEGER DEFAULT 0"},
+	{"backup_records", "files_updated", "INTEGER DEFAULT 0"},
+	{"backup_records", "files_deleted", "INTEGER DEFAULT 0"},
+	{"backup_records", "files_linked", "INTEGER DEFAULT 0"},
+}
+
+// addLegacyColumns 为引入版本化迁移之前创建的数据库补充缺失的列
+func addLegacyColumns(tx *sqlx.Tx) error {
+	for _, c := range legacyColumns {
+		// 检查列是否已存在
+		var count int
+		if err := tx.Get(&count, "SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column); err != nil {
+			return fmt.Errorf("检查 %s 表的 %s 列失败: %w", c.table, c.column, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		// 添加缺失的列
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("为 %s 表添加 %s 列失败: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 最早发布的版本创建的表结构, 之后新增的列都需要在升级时补充
+const baselineSchemaSql = `
+CREATE TABLE IF NOT EXISTS backup_tasks (
+    task_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_name TEXT,
+    target_directory TEXT,
+    backup_directory TEXT,
+    retention_count INTEGER,
+    retention_days INTEGER,
+    no_compression INTEGER,
+    exclude_rules TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_backup_tasks_task_name ON backup_tasks (task_name);
+CREATE TABLE IF NOT EXISTS backup_records (
+    version_id TEXT PRIMARY KEY,
+    task_id INTEGER,
+    timestamp TEXT,
+    task_name TEXT,
+    backup_status TEXT,
+    backup_file_name TEXT,
+    backup_size TEXT,
+    backup_path TEXT,
+    version_hash TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_backup_records_timestamp ON backup_records (timestamp);
+CREATE INDEX IF NOT EXISTS idx_backup_records_task_id ON backup_records (task_id);
+`
+
+// openTestDB 在临时目录中创建数据库
+func openTestDB(t *testing.T, name string) (*sqlx.DB, string) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), name)
+	db, err := sqlx.Connect("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("连接数据库失败: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db, dbPath
+}
+
+// tableColumns 返回数据库中每个表的列名, 格式为 表名.列名
+func tableColumns(t *testing.T, db *sqlx.DB) []string {
+	t.Helper()
+	var columns []string
+	query := "SELECT m.name || '.' || p.name FROM sqlite_master m, pragma_table_info(m.name) p WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' ORDER BY 1"
+	if err := db.Select(&columns, query); err != nil {
+		t.Fatalf("查询表结构失败: %v", err)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func TestMigrateFreshDB(t *testing.T) {
+	db, dbPath := openTestDB(t, "cbk.db")
+	applied, err := migrateDB(db, dbPath)
+	if err != nil {
+		t.Fatalf("迁移新数据库失败: %v", err)
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("应用了 %d 个迁移, 期望 %d 个", len(applied), len(migrations))
+	}
+
+	// 新建的数据库没有需要备份的数据
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dbPath), "db_backups")); !os.IsNotExist(err) {
+		t.Errorf("新数据库不应生成备份")
+	}
+
+	// 再次运行时没有需要应用的迁移
+	if applied, err := migrateDB(db, dbPath); err != nil || len(applied) != 0 {
+		t.Errorf("重复迁移 = %d 个迁移, 错误 %v", len(applied), err)
+	}
+}
+
+func TestMigrateBaselineDB(t *testing.T) {
+	// 使用最早版本的表结构创建数据库, 并写入一个任务和一条备份记录
+	db, dbPath := openTestDB(t, "cbk.db")
+	if _, err := db.Exec(baselineSchemaSql); err != nil {
+		t.Fatalf("创建旧版本表结构失败: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO backup_tasks (task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules) VALUES ('docs', '/src', '/bk', 3, 0, 0, 'none')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO backup_records (version_id, task_id, timestamp, task_name, backup_status, backup_file_name, backup_size, backup_path, version_hash) VALUES
+		('v1', 1, '20240101120000', 'docs', 'true', 'docs_20240101120000.zip', '1.00KB', '/bk', 'abcd1234'),
+		('v2', 1, '20240102120000', 'docs', 'true', 'docs_20240102120000.zip', '1.50MB', '/bk', 'abcd5678'),
+		('v3', 1, '20240103120000', 'docs', 'false', '-', '-', '-', '-'),
+		('v4', 1, '20240104120000', 'docs', 'skipped', '-', '-', '-', '-')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrateDB(db, dbPath); err != nil {
+		t.Fatalf("升级旧版本数据库失败: %v", err)
+	}
+
+	// 升级后的表结构与新建的数据库相同
+	fresh, freshPath := openTestDB(t, "fresh.db")
+	if _, err := migrateDB(fresh, freshPath); err != nil {
+		t.Fatal(err)
+	}
+	got, want := tableColumns(t, db), tableColumns(t, fresh)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("升级后的列 = %v\n期望 %v", got, want)
+	}
+
+	// 升级前的数据被保留, 新增的列使用默认值
+	var record struct {
+		TaskName string `db:"task_name"`
+		Attempt  int    `db:"attempt"`
+		TaskType string `db:"task_type"`
+	}
+	if err := db.Get(&record, "SELECT r.task_name, r.attempt, t.task_type FROM backup_records r JOIN backup_tasks t ON t.task_id = r.task_id WHERE r.version_id = 'v1'"); err != nil {
+		t.Fatalf("查询升级后的记录失败: %v", err)
+	}
+	if record.TaskName != "docs" || record.Attempt != 1 || record.TaskType != "archive" {
+		t.Errorf("升级后的记录 = %+v", record)
+	}
+
+	// 已有记录的运行状态和字节数由备份状态和大小文本补充
+	backfill := []struct {
+		versionID string
+		runStatus string
+		sizeBytes int64
+	}{
+		{"v1", globals.RunStatusSuccess, 1024},
+		{"v2", globals.RunStatusSuccess, 1572864},
+		{"v3", globals.RunStatusFailed, 0},
+		{"v4", globals.RunStatusSkipped, 0},
+	}
+	for _, want := range backfill {
+		var got globals.BackupRecord
+		if err := db.Get(&got, "SELECT run_status, size_bytes, content_hash FROM backup_records WHERE version_id = ?", want.versionID); err != nil {
+			t.Fatalf("查询升级后的记录 %s 失败: %v", want.versionID, err)
+		}
+		if got.RunStatus != want.runStatus || got.SizeBytes != want.sizeBytes || got.ContentHash != "" {
+			t.Errorf("记录 %s 升级后 = %q, %d, %q, 期望 %q, %d, \"\"", want.versionID, got.RunStatus, got.SizeBytes, got.ContentHash, want.runStatus, want.sizeBytes)
+		}
+	}
+
+	// 升级前备份了数据库
+	backups, err := filepath.Glob(filepath.Join(filepath.Dir(dbPath), "db_backups", "cbk_v0_*.db"))
+	if err != nil || len(backups) != 1 {
+		t.Errorf("升级前的数据库备份 = %v, %v", backups, err)
+	}
+}
+
+func TestDbMigrateCmdStatus(t *testing.T) {
+	// 在临时主目录中创建旧版本的数据库
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	dbDir := filepath.Join(home, globals.CbkHomeDir)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(dbDir, globals.CbkDBFile)
+	db, err := sqlx.Connect("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("连接数据库失败: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec(baselineSchemaSql); err != nil {
+		t.Fatalf("创建旧版本表结构失败: %v", err)
+	}
+	backups := filepath.Join(dbDir, globals.CbkDBBackupDir, "cbk_v0_*.db")
+
+	defer func(status, noTable bool) { *dbMigrateStatus, *dbMigrateNoTable = status, noTable }(*dbMigrateStatus, *dbMigrateNoTable)
+	*dbMigrateNoTable = true
+
+	// -status 只显示待应用的迁移, 不修改数据库
+	*dbMigrateStatus = true
+	if err := dbMigrateCmdMain(db); err != nil {
+		t.Fatalf("查看迁移状态失败: %v", err)
+	}
+	applied, err := loadAppliedMigrations(db)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("查看状态后已应用的迁移 = %v, %v, 期望没有", applied, err)
+	}
+	var tableCount int
+	if err := db.Get(&tableCount, "SELECT count(*) FROM sqlite_master WHERE name = 'schema_version'"); err != nil || tableCount != 0 {
+		t.Errorf("查看状态时不应创建 schema_version 表")
+	}
+	if files, _ := filepath.Glob(backups); len(files) != 0 {
+		t.Errorf("查看状态时不应备份数据库: %v", files)
+	}
+
+	// 不带 -status 时备份数据库并应用全部迁移
+	*dbMigrateStatus = false
+	if err := dbMigrateCmdMain(db); err != nil {
+		t.Fatalf("升级数据库失败: %v", err)
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := loadAppliedMigrations(db); err != nil || schemaVersion(applied) != len(migrations) {
+		t.Errorf("升级后的版本 = %d, %v, 期望 %d", schemaVersion(applied), err, len(migrations))
+	}
+	if files, _ := filepath.Glob(backups); len(files) != 1 {
+		t.Errorf("升级前的数据库备份 = %v, 期望1个", files)
+	}
+}
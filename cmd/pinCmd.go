@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 标签的最大长度(字符数)
+const maxLabelLength = 64
+
+// pinCmdMain 固定指定的备份版本, 并可同时设置标签和备注
+func pinCmdMain(db *sqlx.DB) error {
+	// 检查任务ID是否指定
+	if !pinID.IsSet() {
+		return fmt.Errorf("固定版本时, 必须指定任务ID或任务名")
+	}
+	taskID, err := pinID.Resolve(db)
+	if err != nil {
+		return err
+	}
+
+	// 检查标签是否合法
+	label := strings.TrimSpace(*pinLabel)
+	if err := checkLabel(label); err != nil {
+		return err
+	}
+
+	// 默认固定最新的成功版本
+	selector := *pinVersionID
+	if selector == "" {
+		selector = tools.SelectorLatestSuccess
+	}
+
+	// 根据版本选择器解析备份记录
+	record, err := tools.ResolveVersion(db, taskID, selector)
+	if err != nil {
+		return fmt.Errorf("解析版本失败: %w", err)
+	}
+	if !tools.IsSuccessRecord(record) {
+		return fmt.Errorf("版本 %s 是一次失败的备份, 没有可固定的备份文件", record.VersionID)
+	}
+
+	// 未指定的标签和备注保持不变
+	if label != "" {
+		record.Label = label
+	}
+	if *pinNote != "" {
+		record.Note = *pinNote
+	}
+
+	// 更新备份记录
+	updateSql := "UPDATE backup_records SET pinned = 1, label = ?, note = ? WHERE version_id = ?"
+	if _, err := db.Exec(updateSql, record.Label, record.Note, record.VersionID); err != nil {
+		return fmt.Errorf("更新备份记录失败: %w", err)
+	}
+
+	CL.PrintOkf("已固定任务ID %d 的版本 %s (%s), 该版本不会被保留策略清理", taskID, record.VersionID, formatRecordTime(record))
+	if record.Label != "" {
+		CL.PrintOkf("标签: %s", record.Label)
+	}
+	if record.Note != "" {
+		CL.PrintOkf("备注: %s", record.Note)
+	}
+	return nil
+}
+
+// unpinCmdMain 取消固定指定的备份版本, 标签和备注保持不变
+func unpinCmdMain(db *sqlx.DB) error {
+	// 检查参数是否指定
+	if !unpinID.IsSet() {
+		return fmt.Errorf("取消固定版本时, 必须指定任务ID或任务名")
+	}
+	if *unpinVersionID == "" {
+		return fmt.Errorf("取消固定版本时, 必须使用 -v 指定版本")
+	}
+	taskID, err := unpinID.Resolve(db)
+	if err != nil {
+		return err
+	}
+
+	// 根据版本选择器解析备份记录
+	record, err := tools.ResolveVersion(db, taskID, *unpinVersionID)
+	if err != nil {
+		return fmt.Errorf("解析版本失败: %w", err)
+	}
+	if !record.Pinned {
+		CL.PrintWarnf("版本 %s 未被固定", record.VersionID)
+		return nil
+	}
+
+	// 更新备份记录
+	if _, err := db.Exec("UPDATE backup_records SET pinned = 0 WHERE version_id = ?", record.VersionID); err != nil {
+		return fmt.Errorf("更新备份记录失败: %w", err)
+	}
+
+	CL.PrintOkf("已取消固定任务ID %d 的版本 %s (%s), 该版本将在下次执行保留策略时参与清理", taskID, record.VersionID, formatRecordTime(record))
+	return nil
+}
+
+// checkLabel 检查版本标签是否合法
+func checkLabel(label string) error {
+	if len([]rune(label)) > maxLabelLength {
+		return fmt.Errorf("标签长度不能超过 %d 个字符", maxLabelLength)
+	}
+	for _, r := range label {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			return fmt.Errorf("标签不能包含空白字符或控制字符: %q", label)
+		}
+	}
+	return nil
+}
+
+// pinnedText 返回版本是否固定的显示文本
+func pinnedText(record globals.BackupRecord) string {
+	if record.Pinned {
+		return "是"
+	}
+	return ""
+}
+
+// formatLabel 返回版本标签的显示文本, 固定的版本带有 [固定] 标记
+func formatLabel(record globals.BackupRecord) string {
+	if record.Pinned {
+		return strings.TrimSpace("[固定] " + record.Label)
+	}
+	return record.Label
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// pruneCmdMain 按保留策略清理指定任务或所有任务的多余版本
+func pruneCmdMain(db *sqlx.DB) error {
+	// 根据 -id、-tag 或 -all 选择要清理的任务
+	selector := taskSelector{id: pruneID, tag: pruneTag, all: pruneAll}
+	ids, err := selector.selectIDs(db)
+	if err != nil {
+		return err
+	}
+
+	// 查询要清理的任务
+	var tasks globals.BackupTasks
+	querySql := "SELECT task_id, task_name, retention_count, retention_days, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly FROM backup_tasks WHERE task_id = ?"
+	for _, id := range ids {
+		var task globals.BackupTask
+		if err := db.Get(&task, querySql, id); err == sql.ErrNoRows {
+			return fmt.Errorf("任务ID不存在: %d", id)
+		} else if err != nil {
+			return fmt.Errorf("查询任务失败: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	// 计算每个任务的保留计划
+	now := time.Now()
+	var plans []tools.RetentionPlan
+	for _, task := range tasks {
+		plan, err := tools.PlanRetention(db, task.TaskID, tools.NewRetentionPolicy(task), now)
+		if err != nil {
+			return fmt.Errorf("计算任务 [%s] 的保留计划失败: %w", task.TaskName, err)
+		}
+		plans = append(plans, plan)
+	}
+
+	// 打印需要清理的版本
+	count, size, err := printPrunePlan(tasks, plans)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		CL.PrintOk("没有需要清理的版本")
+		return nil
+	}
+
+	// 预览模式不删除任何文件
+	if *pruneDryRun {
+		fmt.Printf("预计清理 %d 个版本, 释放 %s (预览模式, 未删除任何文件)\n", count, tools.FormatSize(size))
+		return nil
+	}
+
+	// 删除备份文件及其记录
+	var removedCount int
+	var removedSize int64
+	for i, plan := range plans {
+		records := plan.Remove()
+		if len(records) == 0 {
+			continue
+		}
+
+		// 任务正在运行时跳过, 避免与运行中的任务同时清理同一目录
+		lock, err := lockTask(tasks[i].TaskID, tasks[i].TaskName)
+		if err != nil {
+			CL.PrintErrf("跳过任务 [%s]: %v", tasks[i].TaskName, err)
+			continue
+		}
+		removed, err := tools.RemoveVersions(db, records)
+		if releaseErr := lock.Release(); releaseErr != nil {
+			CL.PrintErrf("释放任务锁失败: %v", releaseErr)
+		}
+		if err != nil {
+			CL.PrintErrf("清理任务 [%s] 的版本失败: %v", tasks[i].TaskName, err)
+			continue
+		}
+
+		// 统计实际释放的空间
+		sizes := make(map[string]int64)
+		for _, decision := range plan.Decisions {
+			sizes[decision.ID] = decision.Size
+		}
+		for _, record := range removed {
+			removedSize += sizes[record.VersionID]
+		}
+		removedCount += len(removed)
+	}
+
+	CL.PrintOkf("已清理 %d 个版本, 释放 %s", removedCount, tools.FormatSize(removedSize))
+	return nil
+}
+
+// printPrunePlan 打印保留计划中需要清理的版本
+// 参数:
+// - tasks: 任务列表
+// - plans: 与任务列表一一对应的保留计划
+// 返回值:
+// - int: 需要清理的版本数
+// - int64: 需要清理的版本总大小(字节)
+// - error: 错误信息
+func printPrunePlan(tasks globals.BackupTasks, plans []tools.RetentionPlan) (int, int64, error) {
+	// 收集需要清理的版本, 每个任务内按备份时间从旧到新排列
+	type pruneRow struct {
+		task     globals.BackupTask
+		decision tools.RetentionDecision
+	}
+	var rows []pruneRow
+	var size int64
+	for i, plan := range plans {
+		for j := len(plan.Decisions) - 1; j >= 0; j-- {
+			if decision := plan.Decisions[j]; !decision.Keep {
+				rows = append(rows, pruneRow{task: tasks[i], decision: decision})
+				size += decision.Size
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return 0, 0, nil
+	}
+
+	// 禁用表格的输出
+	if *pruneNoTable || *pruneNoTableShort {
+		fmt.Printf("%-10s%-20s%-25s%-20s%-15s%s\n", "任务ID", "任务名", "备份时间", "版本ID", "大小", "原因")
+		for _, row := range rows {
+			fmt.Printf("%-10d%-20s%-25s%-20s%-15s%s\n", row.task.TaskID, row.task.TaskName, row.decision.Time.Format("2006-01-02 15:04:05"), row.decision.ID, tools.FormatSize(row.decision.Size), strings.Join(row.decision.Reasons, "; "))
+		}
+		return len(rows), size, nil
+	}
+
+	// 创建表格
+	t := table.NewWriter()
+
+	// 设置表格输出到标准输出
+	t.SetOutputMirror(os.Stdout)
+
+	// 设置表格样式
+	if style, ok := TableStyle[*pruneTableStyle]; ok {
+		t.SetStyle(style)
+	} else {
+		// 定义样式列表
+		var styleList []string
+		for k := range TableStyle {
+			styleList = append(styleList, k)
+		}
+		return 0, 0, fmt.Errorf("表格样式不存在: %s, 可选样式: %v", *pruneTableStyle, styleList)
+	}
+
+	// 添加表头
+	t.AppendHeader(table.Row{"任务ID", "任务名", "备份时间", "版本ID", "大小", "原因"})
+
+	// 将需要清理的版本添加到表格
+	for _, row := range rows {
+		t.AppendRow(table.Row{
+			row.task.TaskID,
+			row.task.TaskName,
+			row.decision.Time.Format("2006-01-02 15:04:05"),
+			row.decision.ID,
+			tools.FormatSize(row.decision.Size),
+			strings.Join(row.decision.Reasons, "\n"),
+		})
+	}
+
+	// 设置列配置
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "任务ID", Align: text.AlignCenter},
+		{Name: "任务名", Align: text.AlignLeft},
+		{Name: "备份时间", Align: text.AlignLeft},
+		{Name: "版本ID", Align: text.AlignCenter},
+		{Name: "大小", Align: text.AlignRight},
+		{Name: "原因", Align: text.AlignLeft},
+	})
+
+	// 输出表格
+	t.Render()
+
+	return len(rows), size, nil
+}
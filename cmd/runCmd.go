@@ -3,207 +3,1074 @@ package cmd
 import (
 	"cbk/pkg/globals"
 	"cbk/pkg/tools"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // runCmdMain 运行备份任务
 func runCmdMain(db *sqlx.DB) error {
-	// 存储任务ID的切片
-	var ids []int
-
-	// 如果指定了多个任务ID, 则执行多任务模式
-	if *runIDS != "" {
-		// 解析多个任务ID
-		for _, idStr := range strings.Split(*runIDS, ",") {
-			// 检查解析的任务ID是否为空
-			if idStr == "" {
-				CL.PrintErr("任务ID不能为空")
+	// 根据 -id、-ids、-tag 或 -all 选择要运行的任务
+	selector := taskSelector{id: runID, ids: runIDS, tag: runTag, all: runAll}
+	ids, err := selector.selectIDs(db)
+	if err != nil {
+		return err
+	}
+
+	// 执行任务
+	return runAndSummarize(db, ids)
+}
+
+// runAndSummarize 按 -j 指定的并发数运行任务及其前置任务, 运行多个任务时打印汇总信息
+func runAndSummarize(db *sqlx.DB, ids []int) error {
+	// 检查并发数是否合法
+	if *runJobs < 1 {
+		return fmt.Errorf("并发数必须大于0: %d", *runJobs)
+	}
+
+	start := time.Now()
+	results, err := runTasks(context.Background(), db, ids, *runJobs, !*runNoDep)
+	if err != nil {
+		return fmt.Errorf("运行任务失败: %w", err)
+	}
+	if len(results) > 1 {
+		printRunSummary(results, time.Since(start))
+	}
+	return nil
+}
+
+// printRunSummary 打印多个任务的运行汇总
+func printRunSummary(results []taskResult, elapsed time.Duration) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleDefault)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"任务ID", "任务名", "状态", "版本ID", "大小", "耗时", "失败原因"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 7, Align: text.AlignLeft, WidthMax: 60, WidthMaxEnforcer: text.WrapSoft},
+	})
+
+	failed, skipped := 0, 0
+	for _, r := range results {
+		status := "成功"
+		switch {
+		case r.Skipped:
+			status = "跳过"
+			skipped++
+		case !r.OK:
+			status = "失败"
+			failed++
+		}
+		name := r.Name
+		if name == "" {
+			name = "-"
+		}
+		t.AppendRow(table.Row{r.ID, name, status, orDash(r.VersionID), orDash(r.Size), r.Duration.Round(time.Millisecond), orDash(r.Err)})
+	}
+
+	fmt.Println()
+	t.Render()
+	if failed > 0 || skipped > 0 {
+		CL.PrintErrf("共 %d 个任务, 成功 %d 个, 失败 %d 个, 跳过 %d 个, 总耗时 %s", len(results), len(results)-failed-skipped, failed, skipped, elapsed.Round(time.Millisecond))
+		return
+	}
+	CL.PrintOkf("共 %d 个任务, 全部成功, 总耗时 %s", len(results), elapsed.Round(time.Millisecond))
+}
+
+// orDash 空字符串显示为 "-"
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// runTask 按顺序执行备份任务, 前置任务先于依赖它的任务运行
+// 参数:
+// - ctx: 上下文, 取消后中止正在运行的任务并删除未完成的备份文件
+// - db: 数据库连接
+// - ids: 任务ID切片
+// 返回值:
+// - error: 错误信息
+func runTask(ctx context.Context, db *sqlx.DB, ids []int) error {
+	_, err := runTasks(ctx, db, ids, 1, true)
+	return err
+}
+
+// taskResult 表示单个备份任务的运行结果
+type taskResult struct {
+	ID        int           // 任务ID
+	Name      string        // 任务名, 任务不存在时为空
+	OK        bool          // 是否备份成功
+	Skipped   bool          // 是否因前置任务未成功而跳过
+	VersionID string        // 备份版本ID
+	Size      string        // 备份文件大小
+	Duration  time.Duration // 运行耗时
+	Err       string        // 失败原因
+}
+
+// taskRunner 保存运行备份任务所需的共享状态
+type taskRunner struct {
+	ctx     context.Context // 取消后中止正在运行的任务, 不再启动新的任务
+	db      *sqlx.DB
+	label   string     // 版本标签
+	budget  int64      // 全局磁盘预算(字节)
+	dataDir string     // 数据目录
+	prefix  bool       // 是否在输出前加上任务名, 并发运行时启用
+	mu      sync.Mutex // 串行化数据库的写入和版本清理, 压缩和校验可以并发进行
+}
+
+// runTasks 使用指定数量的工作协程执行备份任务
+// 任务只有在其前置任务都运行结束后才会启动, 前置任务未成功时跳过该任务并记录到备份记录中
+// 参数:
+// - ctx: 上下文, 取消后中止正在运行的任务, 尚未启动的任务不再运行
+// - db: 数据库连接
+// - ids: 任务ID切片
+// - jobs: 同时运行的任务数, 大于1时隐藏进度条并在每行输出前加上任务名
+// - withDeps: 是否同时运行任务的前置任务
+// 返回值:
+// - []taskResult: 按运行顺序排列的运行结果, 包括前置任务
+// - error: 错误信息
+func runTasks(ctx context.Context, db *sqlx.DB, ids []int, jobs int, withDeps bool) ([]taskResult, error) {
+	// 检查版本标签是否合法
+	label := strings.TrimSpace(*runLabel)
+	if err := checkLabel(label); err != nil {
+		return nil, err
+	}
+
+	// 获取全局磁盘预算和数据目录
+	budget, err := tools.GetBudget(db)
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := getDataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// 加入前置任务, 并按依赖顺序排列
+	var deps map[int][]int
+	if withDeps {
+		if ids, deps, err = dependencyOrder(db, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	runner := &taskRunner{ctx: ctx, db: db, label: label, budget: budget, dataDir: dataDir}
+	results := make([]taskResult, len(ids))
+
+	// 并发运行时隐藏进度条, 避免多个进度条的输出交错
+	if jobs > 1 && len(ids) > 1 {
+		runner.prefix = true
+		tools.SetProgressSilent(true)
+		defer tools.SetProgressSilent(false)
+	}
+
+	// 记录任务在运行列表中的位置, 只等待本次运行的前置任务
+	index := make(map[int]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	started := make([]bool, len(ids))
+	done := make([]bool, len(ids))
+	finished := make(chan int)
+	running, remaining := 0, len(ids)
+
+	for remaining > 0 && ctx.Err() == nil {
+		// 按顺序启动前置任务都已结束的任务, 列表已按依赖顺序排列, 一次遍历即可处理连续的跳过
+		for i, id := range ids {
+			if started[i] {
 				continue
 			}
-
-			// 检查解析的任务ID是否包含特殊字符
-			if tools.ContainsSpecialChars(idStr) {
-				CL.PrintErrf("任务ID包含危险字符: %s", idStr)
+			ready, blocker := true, -1
+			for _, dep := range deps[id] {
+				j, ok := index[dep]
+				if !ok {
+					continue
+				}
+				if !done[j] {
+					ready = false
+					break
+				}
+				if !results[j].OK && blocker < 0 {
+					blocker = j
+				}
+			}
+			if !ready {
 				continue
 			}
 
-			// 将字符串转换为整数
-			id, err := strconv.Atoi(idStr)
-			if err != nil {
-				CL.PrintErrf("无效的任务ID: %s", idStr)
+			// 前置任务未成功时跳过, 不占用工作协程
+			if blocker >= 0 {
+				started[i], done[i] = true, true
+				results[i] = runner.skip(id, results[blocker])
+				remaining--
 				continue
 			}
 
-			// 添加任务ID到切片中
-			ids = append(ids, id)
+			if running >= jobs {
+				continue
+			}
+			started[i] = true
+			running++
+			go func(i int) {
+				results[i] = runner.run(ids[i])
+				finished <- i
+			}(i)
 		}
 
-		// 执行任务
-		if err := runTask(db, ids); err != nil {
-			return fmt.Errorf("运行任务失败: %w", err)
+		if running == 0 {
+			break
 		}
+		i := <-finished
+		done[i] = true
+		running--
+		remaining--
+	}
 
-		return nil
+	// 取消后不再启动新的任务, 等待正在运行的任务中止
+	for ; running > 0; running-- {
+		<-finished
+	}
+
+	return results, nil
+}
+
+// skip 跳过前置任务未成功的任务, 并插入一条状态为 skipped 的备份记录
+// 参数:
+// - id: 任务ID
+// - prereq: 未成功的前置任务的运行结果
+// 返回值:
+// - taskResult: 运行结果
+func (r *taskRunner) skip(id int, prereq taskResult) taskResult {
+	result := taskResult{ID: id, Skipped: true}
+	prereqName := prereq.Name
+	if prereqName == "" {
+		prereqName = strconv.Itoa(prereq.ID)
+	}
+	result.Err = fmt.Sprintf("前置任务 [%s] 未成功, 已跳过", prereqName)
+
+	var taskName string
+	if err := r.db.Get(&taskName, "select task_name from backup_tasks where task_id = ?", id); err != nil {
+		r.logf(CL.PrintErrf, strconv.Itoa(id), "获取任务信息失败: %v", err)
+		return result
+	}
+	result.Name = taskName
+	r.logf(CL.PrintWarnf, taskName, "备份任务 [%s] %s", taskName, result.Err)
+
+	// 插入跳过记录, 便于在备份记录中查看任务未运行的原因
+	record := r.newRecord(id, taskName, tools.GenerateID(6), 1, time.Now())
+	record.BackupStatus = "skipped"
+	record.BackupFileName, record.BackupSize, record.BackupPath, record.VersionHash = "-", "-", "-", "-"
+	record.ErrorMessage = result.Err
+	record.RunStatus = globals.RunStatusSkipped
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.insertRecord(record); err != nil {
+		r.logf(CL.PrintErrf, taskName, "插入备份记录失败: %v", err)
 	}
+	return result
+}
+
+// 写入备份记录的SQL语句
+const recordSql = `insert into backup_records (version_id, task_id, timestamp, task_name, backup_status, backup_file_name, backup_size, backup_path, version_hash, pinned, label, note, attempt, error_message, files_copied, files_updated, files_deleted, files_linked, started_at, finished_at, duration_ms, size_bytes, file_count, dir_count, bytes_read, bytes_written, compression_ratio, run_status, content_hash) values (:version_id, :task_id, :timestamp, :task_name, :backup_status, :backup_file_name, :backup_size, :backup_path, :version_hash, :pinned, :label, :note, :attempt, :error_message, :files_copied, :files_updated, :files_deleted, :files_linked, :started_at, :finished_at, :duration_ms, :size_bytes, :file_count, :dir_count, :bytes_read, :bytes_written, :compression_ratio, :run_status, :content_hash)`
 
-	// 如果指定了单个任务ID, 则执行单任务模式
-	if *runID != 0 {
-		// 添加单个任务ID到切片中
-		ids = append(ids, *runID)
+// newRecord 返回一条填写了任务信息和运行时间的备份记录, 结束时间为当前时间
+// 参数:
+// - id: 任务ID
+// - taskName: 任务名
+// - versionID: 版本ID
+// - attempt: 第几次尝试运行
+// - started: 开始运行的时间, 同时作为备份记录的时间戳
+// 返回值:
+// - globals.BackupRecord: 备份记录
+func (r *taskRunner) newRecord(id int, taskName, versionID string, attempt int, started time.Time) globals.BackupRecord {
+	finished := time.Now()
+	return globals.BackupRecord{
+		VersionID:  versionID,
+		TaskID:     id,
+		Timestamp:  started.Format(tools.TimestampLayout),
+		TaskName:   taskName,
+		Label:      r.label,
+		Note:       *runNote,
+		Attempt:    attempt,
+		StartedAt:  started.Format(tools.TimestampLayout),
+		FinishedAt: finished.Format(tools.TimestampLayout),
+		DurationMs: finished.Sub(started).Milliseconds(),
+	}
+}
+
+// insertRecord 写入一条备份记录, 调用方需要持有 r.mu
+func (r *taskRunner) insertRecord(record globals.BackupRecord) error {
+	_, err := r.db.NamedExec(recordSql, record)
+	return err
+}
 
-		// 执行任务
-		if err := runTask(db, ids); err != nil {
-			return fmt.Errorf("运行任务失败: %w", err)
+// insertFailure 插入一条失败记录, 记录本次尝试的失败原因, 备份文件名、大小、路径和哈希记为 -
+// 运行状态为空时, 超时取消的记为 cancelled, 其他记为 failed
+func (r *taskRunner) insertFailure(record globals.BackupRecord, err error) {
+	record.BackupStatus = "false"
+	record.BackupFileName, record.BackupSize, record.BackupPath, record.VersionHash = "-", "-", "-", "-"
+	record.ErrorMessage = err.Error()
+	if record.RunStatus == "" {
+		record.RunStatus = globals.RunStatusFailed
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			record.RunStatus = globals.RunStatusCancelled
 		}
+	}
 
-		return nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if execErr := r.insertRecord(record); execErr != nil {
+		r.logf(CL.PrintErrf, record.TaskName, "插入备份记录失败: %v", execErr)
 	}
+}
 
-	// 检查任务ID是否指定
-	if *runID == 0 || *runIDS == "" {
-		return fmt.Errorf("运行备份任务时, 必须指定任务ID或任务ID列表, 使用 -id 或 -ids 指定, 例如: -id 1 或 -ids '1,2,3'")
+// lastContentHash 返回任务最近一个成功版本完整的哈希值, 没有成功的版本时返回空字符串, 调用方需要持有 r.mu
+// 升级前的旧版本没有记录完整的哈希值, 同样返回空字符串
+func (r *taskRunner) lastContentHash(id int) (string, error) {
+	var hash string
+	err := r.db.Get(&hash, "select content_hash from backup_records where task_id = ? and "+tools.SuccessStatusSql+" order by timestamp desc, rowid desc limit 1", id)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
+	return hash, err
+}
 
-	return nil
+// timeoutError 表示运行超时被取消, 错误信息中说明超时时间
+type timeoutError struct {
+	msg string
+}
+
+func (e timeoutError) Error() string { return e.msg }
+
+// Unwrap 使超时错误可以通过 errors.Is 识别为 context.DeadlineExceeded
+func (e timeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// abortError 表示运行被中止, 如守护进程再次收到退出信号
+type abortError struct {
+	msg string
 }
 
-// runTask 执行备份任务
+func (e abortError) Error() string { return e.msg }
+
+// Unwrap 使中止错误可以通过 errors.Is 识别为 context.Canceled
+func (e abortError) Unwrap() error { return context.Canceled }
+
+// wait 等待重试的间隔, 等待期间运行被中止时返回错误
+func (r *taskRunner) wait(delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-r.ctx.Done():
+		return abortError{"运行已中止, 不再重试"}
+	case <-timer.C:
+		return nil
+	}
+}
+
+// logf 打印任务的输出, 并发运行时在每行前加上任务名以区分不同任务的输出
+func (r *taskRunner) logf(print func(format string, a ...any), name, format string, a ...any) {
+	if r.prefix {
+		print("[%s] %s", name, fmt.Sprintf(format, a...))
+		return
+	}
+	print(format, a...)
+}
+
+// run 执行单个备份任务, 失败时按任务的重试设置重新运行
 // 参数:
-// - db: 数据库连接
-// - ids: 任务ID切片
+// - id: 任务ID
 // 返回值:
-// - error: 错误信息
-func runTask(db *sqlx.DB, ids []int) error {
-	// 构建存储查询任务信息的结构体
-	var task globals.BackupTask
+// - taskResult: 运行结果
+func (r *taskRunner) run(id int) taskResult {
+	start := time.Now()
+	result := taskResult{ID: id}
+	name := strconv.Itoa(id)
+
+	// 记录失败原因并打印错误信息
+	fail := func(format string, a ...any) taskResult {
+		result.Err = fmt.Sprintf(format, a...)
+		result.Duration = time.Since(start)
+		r.logf(CL.PrintErrf, name, "%s", result.Err)
+		return result
+	}
 
 	// 构建查询任务信息的SQL语句
-	querySql := "select task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules from backup_tasks where task_id =?"
+	querySql := "select task_name, target_directory, backup_directory, retention_count, retention_days, no_compression, exclude_rules, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly, retries, retry_backoff, timeout, replicas, tier_days, tier_location, task_type, mirror_delete from backup_tasks where task_id =?"
 
-	// 构建失败记录的SQL语句
-	errorSql := "insert into backup_records (version_id, task_id, timestamp, task_name, backup_status, backup_file_name, backup_size, backup_path, version_hash) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	// 查询任务信息
+	var task globals.BackupTask
+	if err := r.db.Get(&task, querySql, id); err == sql.ErrNoRows {
+		return fail("任务ID不存在 %d", id)
+	} else if err != nil {
+		return fail("获取任务信息失败: %v", err)
+	}
+	result.Name = task.TaskName
+	name = task.TaskName
 
-	// 构建插入备份记录的SQL语句
-	insertSql := "insert into backup_records (version_id, task_id, timestamp, task_name, backup_status, backup_file_name, backup_size, backup_path, version_hash) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	// 获取任务的运行锁, 防止同一任务同时被多个进程运行, 重试期间一直持有
+	lock, err := lockTask(id, task.TaskName)
+	if err != nil {
+		return fail("%v, 已跳过", err)
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			r.logf(CL.PrintErrf, name, "释放任务锁失败: %v", err)
+		}
+	}()
 
-	// 循环处理每个任务ID
-	for _, id := range ids {
-		// 查询任务信息
-		if err := db.Get(&task, querySql, id); err == sql.ErrNoRows {
-			CL.PrintErrf("任务ID不存在 %d", id)
-			continue
-		} else if err != nil {
-			CL.PrintErrf("获取任务信息失败: %v", err)
-			continue
+	// 获取排除函数, 排除规则无效时重试也不会成功, 不进行重试
+	var excludeFunc globals.ExcludeFunc
+	if task.ExcludeRules != "none" {
+		var err error
+		if excludeFunc, err = tools.ParseExclude(task.ExcludeRules); err != nil {
+			return fail("解析任务ID %d 的排除规则失败: %v", id, err)
 		}
+	} else {
+		excludeFunc = globals.NoExcludeFunc // 默认不进行过滤
+	}
+
+	// 检查本次备份后是否会接近或超出全局预算
+	if r.budget > 0 {
+		r.warnBudget(id, task)
+	}
+
+	// 打印提示信息
+	r.logf(CL.PrintOkf, name, "备份任务 [%s] 已启动，正在运行中……", task.TaskName)
+
+	// 镜像任务将备份目录同步为目标目录的镜像, 不生成备份文件
+	if task.TaskType == globals.TaskTypeMirror {
+		return r.runMirror(id, task, excludeFunc, result, start)
+	}
+
+	for attempt := 1; ; attempt++ {
+		// 获取versionID和备份时间, 每次尝试都会写入一条备份记录
+		versionID := tools.GenerateID(6)
+		started := time.Now()
+		backupTime := started.Format("20060102150405")
+
+		// 执行备份任务
+		backup, err := r.attempt(id, task, backupTime, excludeFunc)
+		if err != nil {
+			// 插入失败记录, 记录本次尝试的失败原因
+			r.insertFailure(r.newRecord(id, task.TaskName, versionID, attempt, started), err)
+
+			// 运行被中止时不再重试
+			if attempt > task.Retries || r.ctx.Err() != nil {
+				if attempt > 1 {
+					return fail("备份 %s 任务失败(共尝试 %d 次): %v", task.TaskName, attempt, err)
+				}
+				return fail("备份 %s 任务失败: %v", task.TaskName, err)
+			}
 
-		// 检查目标目录或文件是否存在
-		if _, err := tools.CheckPath(task.TargetDirectory); err != nil {
-			CL.PrintErrf("目标目录或文件不存在: %v", err)
+			// 等待一段时间后重试
+			delay := tools.RetryDelay(task.RetryPolicy, attempt)
+			r.logf(CL.PrintWarnf, name, "备份 %s 第 %d 次尝试失败: %v, %s 后进行第 %d 次尝试", task.TaskName, attempt, err, delay, attempt+1)
+			if err := r.wait(delay); err != nil {
+				return fail("备份 %s 任务失败: %v", task.TaskName, err)
+			}
 			continue
 		}
 
-		// 检查备份目录是否存在
-		if err := tools.EnsureDirExists(task.BackupDirectory); err != nil {
-			CL.PrintErrf("备份目录创建失败: %v", err)
-			continue
+		// 在写入备份记录之前, 备份文件仍视为未完成, 中止备份时会被删除
+		defer tools.UntrackPartial(backup.path)
+
+		record := r.newRecord(id, task.TaskName, versionID, attempt, started)
+		record.BackupStatus = "true"
+		record.BackupFileName = backup.name
+		record.BackupSize = backup.size
+		record.BackupPath = task.BackupDirectory
+		record.VersionHash = backup.hash
+		record.ContentHash = backup.digest
+		record.Pinned = *runPin
+		record.FilesCopied = backup.copied
+		record.FilesLinked = backup.linked
+		record.SizeBytes = backup.sizeBytes
+		record.FileCount = backup.files
+		record.DirCount = backup.dirs
+		record.BytesRead = backup.read
+		record.BytesWritten = backup.written
+		record.CompressionRatio = backup.ratio
+		record.RunStatus = globals.RunStatusSuccess
+
+		// 写入记录和清理版本会修改其他任务共享的数据, 需要串行执行
+		r.mu.Lock()
+
+		// 与上一个成功的版本完整的哈希值相同时, 运行状态记为 unchanged
+		if prevHash, err := r.lastContentHash(id); err != nil {
+			r.logf(CL.PrintErrf, name, "查询上一个版本失败: %v", err)
+		} else if prevHash != "" && prevHash == backup.digest {
+			record.RunStatus = globals.RunStatusUnchanged
 		}
 
-		// 打印提示信息
-		CL.PrintOkf("备份任务 [%s] 已启动，正在运行中……", task.TaskName)
+		// 插入备份记录
+		execErr := r.insertRecord(record)
+		tools.UntrackPartial(backup.path)
+		if execErr != nil {
+			r.mu.Unlock()
+			return fail("插入备份记录失败: %v", execErr)
+		}
+		result.OK = true
+		result.VersionID = versionID
+		result.Size = backup.size
 
-		// 构建备份文件名
-		backupTime := time.Now().Format("20060102150405")
-		backupFileNamePrefix := fmt.Sprintf("%s_%s", task.TaskName, backupTime)
+		// 按保留策略清理多余的备份版本
+		plan, err := tools.PlanRetention(r.db, id, tools.NewRetentionPolicy(task), time.Now())
+		if err != nil {
+			r.logf(CL.PrintErrf, name, "计算保留策略失败: %v", err)
+		} else if _, err := tools.RemoveVersions(r.db, plan.Remove()); err != nil {
+			r.logf(CL.PrintErrf, name, "删除多余的备份文件失败: %v", err)
+		}
 
-		// 获取排除函数
-		var excludeFunc globals.ExcludeFunc
-		if task.ExcludeRules != "none" {
-			var err error
-			if excludeFunc, err = tools.ParseExclude(task.ExcludeRules); err != nil {
-				CL.PrintErrf("解析任务ID %d 的排除规则失败: %v", id, err)
-				continue
+		// 超出全局预算时清理最旧的备份版本
+		if r.budget > 0 {
+			if err := enforceBudget(r.db, r.dataDir, r.budget, id); err != nil {
+				r.logf(CL.PrintErrf, name, "按全局预算清理备份版本失败: %v", err)
 			}
+		}
+		r.mu.Unlock()
+
+		// 打印成功信息
+		if attempt > 1 {
+			r.logf(CL.PrintOkf, name, `备份 %s 成功! (第 %d 次尝试)`, task.TaskName, attempt)
 		} else {
-			excludeFunc = globals.NoExcludeFunc // 默认不进行过滤
+			r.logf(CL.PrintOkf, name, `备份 %s 成功!`, task.TaskName)
+		}
+		if *runPin {
+			r.logf(CL.PrintOkf, name, "版本 %s 已固定, 不会被保留策略清理", versionID)
 		}
 
-		// 获取versionID
-		versionID := tools.GenerateID(6)
+		// 复制到副本位置, 并重试之前复制失败的副本
+		if task.Replicas != "" {
+			r.replicate(id, task, versionID)
+		}
 
-		// 运行备份任务
-		targetDir := filepath.Dir(task.TargetDirectory)                                 // 获取目标目录的目录部分
-		targetName := filepath.Base(task.TargetDirectory)                               // 获取目标目录的最后一个部分
-		backupFileNamePath := filepath.Join(task.BackupDirectory, backupFileNamePrefix) // 获取构建的备份文件路径
+		// 将超过指定天数的版本移动到冷存储位置
+		if task.TierDays > 0 {
+			r.tier(id, task)
+		}
+		result.Duration = time.Since(start)
+		return result
+	}
+}
 
-		// 执行备份任务
-		zipPath, err := tools.CreateZipFromOSPaths(db, targetDir, targetName, backupFileNamePath, task.NoCompression, excludeFunc)
+// runMirror 执行镜像任务, 失败时按任务的重试设置重新运行
+// 每次同步都会写入一条备份记录, 成功的记录中保存复制、更新和删除的文件数
+// 参数:
+// - id: 任务ID
+// - task: 任务信息
+// - excludeFunc: 排除函数
+// - result: 运行结果
+// - start: 任务开始运行的时间
+// 返回值:
+// - taskResult: 运行结果
+func (r *taskRunner) runMirror(id int, task globals.BackupTask, excludeFunc globals.ExcludeFunc, result taskResult, start time.Time) taskResult {
+	name := task.TaskName
+
+	for attempt := 1; ; attempt++ {
+		versionID := tools.GenerateID(6)
+		started := time.Now()
+
+		stats, err := r.attemptMirror(task, excludeFunc)
+		record := r.newRecord(id, task.TaskName, versionID, attempt, started)
+		record.FilesCopied = stats.Copied
+		record.FilesUpdated = stats.Updated
+		record.FilesDeleted = stats.Deleted
+		record.BytesRead = stats.Bytes
+		record.BytesWritten = stats.Bytes
+		changed := stats.Copied+stats.Updated+stats.Deleted > 0
 		if err != nil {
-			// 插入备份记录
-			if _, execErr := db.Exec(errorSql, versionID, id, backupTime, task.TaskName, "false", "-", "-", "-", "-"); execErr != nil {
-				CL.PrintErrf("插入备份记录失败: %v", execErr)
-				continue
+			// 同步中途失败时, 已同步的文件保留在镜像中, 运行状态记为 partial
+			if changed {
+				record.RunStatus = globals.RunStatusPartial
+			}
+			r.insertFailure(record, err)
+
+			if attempt > task.Retries || r.ctx.Err() != nil {
+				if attempt > 1 {
+					result.Err = fmt.Sprintf("同步 %s 任务失败(共尝试 %d 次): %v", task.TaskName, attempt, err)
+				} else {
+					result.Err = fmt.Sprintf("同步 %s 任务失败: %v", task.TaskName, err)
+				}
+				result.Duration = time.Since(start)
+				r.logf(CL.PrintErrf, name, "%s", result.Err)
+				return result
+			}
+
+			// 等待一段时间后重试
+			delay := tools.RetryDelay(task.RetryPolicy, attempt)
+			r.logf(CL.PrintWarnf, name, "同步 %s 第 %d 次尝试失败: %v, %s 后进行第 %d 次尝试", task.TaskName, attempt, err, delay, attempt+1)
+			if err := r.wait(delay); err != nil {
+				result.Err = fmt.Sprintf("同步 %s 任务失败: %v", task.TaskName, err)
+				result.Duration = time.Since(start)
+				r.logf(CL.PrintErrf, name, "%s", result.Err)
+				return result
 			}
-			CL.PrintErrf("备份 %s 任务失败: %v", task.TaskName, err)
 			continue
 		}
 
-		// 获取备份文件的后8位MD5哈希值
-		backupFileMD5, err := tools.GetFileMD5Last8(zipPath)
+		// 插入同步记录, 镜像没有备份文件, 备份文件名和版本哈希记为 -
+		size := tools.FormatSize(stats.Size)
+		record.BackupStatus = "true"
+		record.BackupFileName = tools.MirrorFileName
+		record.BackupSize = size
+		record.BackupPath = task.BackupDirectory
+		record.VersionHash = tools.MirrorFileName
+		record.SizeBytes = stats.Size
+		record.FileCount = stats.Files
+		record.DirCount = stats.Dirs
+		record.RunStatus = globals.RunStatusSuccess
+		if !changed {
+			record.RunStatus = globals.RunStatusUnchanged
+		}
+		r.mu.Lock()
+		execErr := r.insertRecord(record)
+		r.mu.Unlock()
+		if execErr != nil {
+			result.Err = fmt.Sprintf("插入备份记录失败: %v", execErr)
+			result.Duration = time.Since(start)
+			r.logf(CL.PrintErrf, name, "%s", result.Err)
+			return result
+		}
+		result.OK = true
+		result.VersionID = versionID
+		result.Size = size
+
+		r.logf(CL.PrintOkf, name, "同步 %s 成功! %s, 共传输 %s, 镜像大小 %s", task.TaskName, stats, tools.FormatSize(stats.Bytes), size)
+		result.Duration = time.Since(start)
+		return result
+	}
+}
+
+// attemptMirror 执行一次镜像同步
+// 任务设置了超时时间时, 超时或运行被中止后取消本次同步, 已同步的文件保留在镜像中
+// 参数:
+// - task: 任务信息
+// - excludeFunc: 排除函数
+// 返回值:
+// - tools.MirrorStats: 同步的统计信息
+// - error: 错误信息
+func (r *taskRunner) attemptMirror(task globals.BackupTask, excludeFunc globals.ExcludeFunc) (tools.MirrorStats, error) {
+	ctx := r.ctx
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(task.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	if tools.IsRemoteLocation(task.BackupDirectory) {
+		return tools.MirrorStats{}, fmt.Errorf("镜像任务的备份目录必须是本地目录: %s", task.BackupDirectory)
+	}
+
+	stats, err := tools.MirrorDirectory(ctx, task.TargetDirectory, task.BackupDirectory, excludeFunc, task.MirrorDelete == 1)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return stats, timeoutError{fmt.Sprintf("运行超时(超过 %s), 已取消同步", tools.FormatSeconds(task.Timeout))}
+	}
+	if errors.Is(err, context.Canceled) {
+		return stats, abortError{"运行已中止, 已取消同步"}
+	}
+	return stats, err
+}
+
+// replicate 将新的备份版本复制到任务的每个副本位置, 并重试之前复制失败的副本
+// 复制失败不影响备份结果, 失败的副本会在下次运行任务时重试
+// 参数:
+// - id: 任务ID
+// - task: 任务信息
+// - versionID: 新的备份版本ID
+func (r *taskRunner) replicate(id int, task globals.BackupTask, versionID string) {
+	stageDir, err := getStageDir()
+	if err != nil {
+		r.logf(CL.PrintErrf, task.TaskName, "复制副本失败: %v", err)
+		return
+	}
+
+	// 新版本复制到所有副本位置, 之前失败的副本按备份时间从旧到新重试
+	type job struct {
+		versionID string
+		location  string
+		retry     bool
+	}
+	var jobs []job
+	for _, location := range tools.SplitReplicas(task.Replicas) {
+		jobs = append(jobs, job{versionID: versionID, location: location})
+	}
+	r.mu.Lock()
+	failed, err := tools.FailedReplicas(r.db, id, task.Replicas)
+	r.mu.Unlock()
+	if err != nil {
+		r.logf(CL.PrintErrf, task.TaskName, "%v", err)
+	}
+	for _, replica := range failed {
+		if replica.VersionID != versionID {
+			jobs = append(jobs, job{versionID: replica.VersionID, location: replica.Location, retry: true})
+		}
+	}
+
+	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, size_bytes, run_status FROM backup_records WHERE version_id = ?"
+	for _, j := range jobs {
+		var record globals.BackupRecord
+		r.mu.Lock()
+		err := r.db.Get(&record, querySql, j.versionID)
+		r.mu.Unlock()
 		if err != nil {
-			// 插入备份记录
-			if _, execErr := db.Exec(errorSql, versionID, id, backupTime, task.TaskName, "false", "-", "-", "-", "-"); execErr != nil {
-				CL.PrintErrf("插入备份记录失败: %v", execErr)
-				continue
-			}
-			CL.PrintErrf("获取备份文件MD5失败: %v", err)
+			r.logf(CL.PrintErrf, task.TaskName, "查询版本 %s 的备份记录失败: %v", j.versionID, err)
 			continue
 		}
 
-		// 获取备份文件的大小
-		backupFileSize, err := tools.HumanReadableSize(zipPath)
+		if j.retry {
+			r.logf(CL.PrintWarnf, task.TaskName, "正在重试复制版本 %s 到副本: %s", j.versionID, j.location)
+		}
+		replicateErr := tools.ReplicateVersion(r.ctx, record, j.location, stageDir)
+
+		r.mu.Lock()
+		err = tools.RecordReplica(r.db, j.versionID, j.location, replicateErr)
+		r.mu.Unlock()
 		if err != nil {
-			// 插入备份记录
-			if _, execErr := db.Exec(errorSql, versionID, id, backupTime, task.TaskName, "false", "-", "-", "-", "-"); execErr != nil {
-				CL.PrintErrf("插入备份记录失败: %v", execErr)
-				continue
-			}
-			CL.PrintErrf("获取备份文件大小失败: %v", err)
+			r.logf(CL.PrintErrf, task.TaskName, "%v", err)
+		}
+
+		if replicateErr != nil {
+			r.logf(CL.PrintErrf, task.TaskName, "复制版本 %s 到副本 %s 失败, 下次运行时重试: %v", j.versionID, j.location, replicateErr)
 			continue
 		}
+		r.logf(CL.PrintOkf, task.TaskName, "版本 %s 已复制到副本: %s", j.versionID, j.location)
+	}
+}
 
-		// 插入备份记录
-		if _, execErr := db.Exec(insertSql, versionID, id, backupTime, task.TaskName, "true", filepath.Base(zipPath), backupFileSize, task.BackupDirectory, backupFileMD5); execErr != nil {
-			CL.PrintErrf("插入备份记录失败: %v", execErr)
+// tier 将任务中超过分层存储规则天数的版本移动到冷存储位置
+// 每个版本先复制到冷存储位置并校验哈希值, 再更新备份记录的 backup_path 并删除原位置的备份文件;
+// 移动失败的版本保留在原位置, 下次运行任务时重试
+// 参数:
+// - id: 任务ID
+// - task: 任务信息
+func (r *taskRunner) tier(id int, task globals.BackupTask) {
+	r.mu.Lock()
+	records, err := tools.PlanTiering(r.db, id, task.TierRule, time.Now())
+	r.mu.Unlock()
+	if err != nil {
+		r.logf(CL.PrintErrf, task.TaskName, "%v", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	stageDir, err := getStageDir()
+	if err != nil {
+		r.logf(CL.PrintErrf, task.TaskName, "移动版本到冷存储失败: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if err := tools.CopyToTier(r.ctx, record, task.TierLocation, stageDir); err != nil {
+			r.logf(CL.PrintErrf, task.TaskName, "移动版本 %s 到冷存储 %s 失败, 下次运行时重试: %v", record.VersionID, task.TierLocation, err)
 			continue
 		}
 
-		// 获取备份目录下的以指定扩展名的文件列表
-		zipFiles, err := tools.GetZipFiles(task.BackupDirectory, ".zip")
+		r.mu.Lock()
+		err := tools.CommitTier(r.db, record, task.TierLocation)
+		r.mu.Unlock()
 		if err != nil {
-			CL.PrintErrf("获取备份目录下的.zip文件失败: %v", err)
+			r.logf(CL.PrintErrf, task.TaskName, "%v", err)
 			continue
 		}
+		r.logf(CL.PrintOkf, task.TaskName, "版本 %s 已移动到冷存储: %s", record.VersionID, task.TierLocation)
+	}
+}
+
+// backupFile 表示一次成功生成的备份文件或快照目录
+type backupFile struct {
+	path      string  // 备份文件或快照目录的路径
+	name      string  // 备份记录中的备份文件名
+	hash      string  // 备份文件MD5哈希值的后8位
+	digest    string  // 备份文件或快照完整的MD5哈希值
+	size      string  // 备份文件大小
+	sizeBytes int64   // 备份文件或快照的大小(字节)
+	files     int     // 备份中的文件数
+	dirs      int     // 备份中的目录数
+	read      int64   // 从目标目录读取的字节数
+	written   int64   // 写入备份目录的字节数
+	ratio     float64 // 压缩率
+	copied    int     // 快照任务复制的文件数
+	linked    int     // 快照任务硬链接的文件数
+}
+
+// attempt 执行一次备份, 生成备份文件并计算哈希值和大小
+// 任务设置了超时时间时, 超时或运行被中止后取消本次备份并删除未完成的备份文件
+// 参数:
+// - id: 任务ID
+// - task: 任务信息
+// - backupTime: 备份时间, 用于构建备份文件名
+// - excludeFunc: 排除函数
+// 返回值:
+// - backupFile: 生成的备份文件
+// - error: 错误信息
+func (r *taskRunner) attempt(id int, task globals.BackupTask, backupTime string, excludeFunc globals.ExcludeFunc) (backupFile, error) {
+	var backup backupFile
+
+	ctx := r.ctx
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(task.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	// 超时的错误信息中说明超时时间
+	wrap := func(format string, err error) error {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return timeoutError{fmt.Sprintf("运行超时(超过 %s), 已取消并删除未完成的备份文件", tools.FormatSeconds(task.Timeout))}
+		}
+		if errors.Is(err, context.Canceled) {
+			return abortError{"运行已中止, 已删除未完成的备份文件"}
+		}
+		return fmt.Errorf(format, err)
+	}
+
+	// 检查目标目录或文件是否存在
+	if _, err := tools.CheckPath(task.TargetDirectory); err != nil {
+		return backup, fmt.Errorf("目标目录或文件不存在: %w", err)
+	}
+
+	// 快照任务在备份目录中生成快照目录
+	if task.TaskType == globals.TaskTypeSnapshot {
+		return r.attemptSnapshot(ctx, id, task, backupTime, excludeFunc, wrap)
+	}
+
+	// 备份到远程存储时, 先在暂存目录中生成备份文件, 上传完成后删除
+	var store tools.Storage
+	localDir := task.BackupDirectory
+	if tools.IsRemoteLocation(task.BackupDirectory) {
+		var err error
+		if store, err = tools.OpenStorage(task.BackupDirectory); err != nil {
+			return backup, fmt.Errorf("打开备份存储失败: %w", err)
+		}
+		defer store.Close()
+		if localDir, err = getStageDir(); err != nil {
+			return backup, err
+		}
+	}
+
+	// 检查备份目录是否存在
+	if err := tools.EnsureDirExists(localDir); err != nil {
+		return backup, fmt.Errorf("备份目录创建失败: %w", err)
+	}
+
+	// 运行备份任务
+	targetDir := filepath.Dir(task.TargetDirectory)                                                // 获取目标目录的目录部分
+	targetName := filepath.Base(task.TargetDirectory)                                              // 获取目标目录的最后一个部分
+	backupFileNamePath := filepath.Join(localDir, fmt.Sprintf("%s_%s", task.TaskName, backupTime)) // 获取构建的备份文件路径
+
+	zipPath, err := tools.CreateZipFromOSPaths(ctx, r.db, targetDir, targetName, backupFileNamePath, task.NoCompression, excludeFunc)
+	if err != nil {
+		return backup, wrap("%w", err)
+	}
+
+	// 在写入备份记录之前, 备份文件仍视为未完成, 中止备份时会被删除
+	// 计算哈希值或大小失败时直接删除, 避免留下没有备份记录的文件
+	tools.TrackPartial(zipPath)
+	discard := func() {
+		tools.UntrackPartial(zipPath)
+		if err := os.Remove(zipPath); err != nil && !os.IsNotExist(err) {
+			r.logf(CL.PrintErrf, task.TaskName, "删除未完成的备份文件失败: %v", err)
+		}
+	}
+
+	// 获取备份文件的MD5哈希值, 版本哈希取后8位
+	if backup.digest, err = tools.GetFileMD5Context(ctx, zipPath); err != nil {
+		discard()
+		return backup, wrap("获取备份文件MD5失败: %w", err)
+	}
+	backup.hash = backup.digest[len(backup.digest)-8:]
+
+	// 获取备份文件的大小
+	info, err := os.Stat(zipPath)
+	if err != nil {
+		discard()
+		return backup, fmt.Errorf("获取备份文件大小失败: %w", err)
+	}
+	backup.sizeBytes = info.Size()
+	backup.size = tools.FormatSize(info.Size())
+
+	// 从备份文件的中央目录统计文件数、目录数和压缩率
+	reader, err := tools.OpenZipReader(zipPath)
+	if err != nil {
+		discard()
+		return backup, fmt.Errorf("读取备份文件失败: %w", err)
+	}
+	stats := tools.CountEntries(reader.Entries())
+	_ = reader.Close()
+	backup.files = stats.Files
+	backup.dirs = stats.Dirs
+	backup.read = stats.Size
+	backup.written = backup.sizeBytes
+	backup.ratio = stats.Ratio()
+
+	// 上传到远程存储, 无论是否成功都删除暂存的备份文件
+	if store != nil {
+		err := store.Put(ctx, zipPath, filepath.Base(zipPath))
+		discard()
+		if err != nil {
+			return backup, wrap("上传备份文件失败: %w", err)
+		}
+	}
+
+	backup.path = zipPath
+	backup.name = filepath.Base(zipPath)
+	return backup, nil
+}
+
+// attemptSnapshot 执行一次快照, 在备份目录中生成以备份时间命名的快照目录
+// 未变化的文件硬链接到任务最新的快照, 快照目录的哈希值由目录结构和文件属性计算
+// 参数:
+// - ctx: 上下文, 超时或运行被中止后取消本次快照并删除未完成的快照目录
+// - id: 任务ID
+// - task: 任务信息
+// - backupTime: 备份时间, 用作快照目录名
+// - excludeFunc: 排除函数
+// - wrap: 包装错误信息, 超时时说明超时时间
+// 返回值:
+// - backupFile: 生成的快照目录
+// - error: 错误信息
+func (r *taskRunner) attemptSnapshot(ctx context.Context, id int, task globals.BackupTask, backupTime string, excludeFunc globals.ExcludeFunc, wrap func(string, error) error) (backupFile, error) {
+	var backup backupFile
+
+	if tools.IsRemoteLocation(task.BackupDirectory) {
+		return backup, fmt.Errorf("快照任务的备份目录必须是本地目录: %s", task.BackupDirectory)
+	}
+	if err := tools.EnsureDirExists(task.BackupDirectory); err != nil {
+		return backup, fmt.Errorf("备份目录创建失败: %w", err)
+	}
+
+	// 查询上一个快照, 没有快照时复制所有文件
+	r.mu.Lock()
+	prev, err := tools.LatestSnapshot(r.db, id)
+	r.mu.Unlock()
+	if err != nil {
+		return backup, err
+	}
+
+	dir := filepath.Join(task.BackupDirectory, backupTime)
+	stats, err := tools.CreateSnapshot(ctx, task.TargetDirectory, dir, prev, excludeFunc)
+	if err != nil {
+		return backup, wrap("创建快照失败: %w", err)
+	}
+
+	// 在写入备份记录之前, 快照目录仍视为未完成, 中止备份时会被删除
+	tools.TrackPartial(dir)
+	if backup.digest, err = tools.SnapshotDigest(dir); err != nil {
+		tools.UntrackPartial(dir)
+		if removeErr := os.RemoveAll(dir); removeErr != nil {
+			r.logf(CL.PrintErrf, task.TaskName, "删除未完成的快照目录失败: %v", removeErr)
+		}
+		return backup, fmt.Errorf("计算快照哈希值失败: %w", err)
+	}
+	backup.hash = backup.digest[len(backup.digest)-8:]
+
+	r.logf(CL.PrintOkf, task.TaskName, "快照 %s 已生成: %s, 共复制 %s", dir, stats, tools.FormatSize(stats.Bytes))
+	backup.path = dir
+	backup.name = tools.SnapshotName(backupTime)
+	backup.size = tools.FormatSize(stats.Size)
+	backup.sizeBytes = stats.Size
+	backup.files = stats.Files
+	backup.dirs = stats.Dirs
+	backup.read = stats.Bytes
+	backup.written = stats.Bytes
+	backup.copied = stats.Copied
+	backup.linked = stats.Linked
+	return backup, nil
+}
+
+// warnBudget 在运行任务前预测数据目录的占用, 接近或超出全局预算时打印警告
+// 参数:
+// - id: 任务ID
+// - task: 任务信息
+func (r *taskRunner) warnBudget(id int, task globals.BackupTask) {
+	r.mu.Lock()
+	usage, projected, err := tools.ProjectBudgetUsage(r.db, r.dataDir, id, task.BackupDirectory)
+	r.mu.Unlock()
+	if err != nil {
+		r.logf(CL.PrintWarnf, task.TaskName, "预测数据目录的占用失败: %v", err)
+		return
+	}
+
+	switch {
+	case projected > r.budget:
+		r.logf(CL.PrintWarnf, task.TaskName, "预计本次备份后数据目录占用 %s, 超出全局预算 %s, 备份完成后将自动清理最旧的版本", tools.FormatSize(projected), tools.FormatSize(r.budget))
+	case float64(projected) >= float64(r.budget)*tools.BudgetWarnRatio:
+		r.logf(CL.PrintWarnf, task.TaskName, "数据目录当前占用 %s, 预计本次备份后达到全局预算 %s 的 %.0f%%", tools.FormatSize(usage), tools.FormatSize(r.budget), float64(projected)*100/float64(r.budget))
+	}
+}
+
+// enforceBudget 数据目录超出全局预算时, 从最旧的版本开始清理直到满足预算
+// 清理其他任务的版本前先获取这些任务的运行锁, 正在运行或清理的任务本次跳过
+// 参数:
+// - db: 数据库连接
+// - dataDir: 数据目录
+// - budget: 全局预算(字节)
+// - heldID: 调用方已持有运行锁的任务ID
+// 返回值:
+// - error: 错误信息
+func enforceBudget(db *sqlx.DB, dataDir string, budget int64, heldID int) error {
+	plan, err := tools.PlanBudget(db, dataDir, budget)
+	if err != nil {
+		return err
+	}
+	if len(plan.Remove) == 0 {
+		if plan.Usage > budget {
+			CL.PrintWarnf("数据目录占用 %s 超出全局预算 %s, 但已没有可清理的旧版本", tools.FormatSize(plan.Usage), tools.FormatSize(budget))
+		}
+		return nil
+	}
 
-		// 删除多余的备份文件
-		if len(zipFiles) > task.RetentionCount {
-			if err := tools.RetainLatestFiles(db, zipFiles, task.RetentionCount, task.RetentionDays); err != nil {
-				CL.PrintErrf("删除多余的备份文件失败: %v", err)
+	// 获取要清理版本所属任务的运行锁, 函数返回时释放
+	locked := map[int]bool{heldID: true}
+	skipped := make(map[int]bool)
+	var records []globals.BackupRecord
+	var release int64
+	for _, record := range plan.Remove {
+		if !locked[record.TaskID] && !skipped[record.TaskID] {
+			lock, err := lockTask(record.TaskID, record.TaskName)
+			if err != nil {
+				CL.PrintWarnf("跳过任务 [%s] 的版本: %v", record.TaskName, err)
+				skipped[record.TaskID] = true
 				continue
 			}
+			defer func() {
+				if err := lock.Release(); err != nil {
+					CL.PrintErrf("释放任务锁失败: %v", err)
+				}
+			}()
+			locked[record.TaskID] = true
+		}
+		if skipped[record.TaskID] {
+			continue
 		}
+		records = append(records, record)
+		release += tools.VersionFileSize(record)
+	}
 
-		// 打印成功信息
-		CL.PrintOkf(`备份 %s 成功!`, task.TaskName)
+	removed, err := tools.RemoveVersions(db, records)
+	if err != nil {
+		return err
 	}
+	CL.PrintWarnf("数据目录占用 %s 超出全局预算 %s, 已清理 %d 个最旧的版本, 释放 %s", tools.FormatSize(plan.Usage), tools.FormatSize(budget), len(removed), tools.FormatSize(release))
 
+	if remaining := plan.Usage - release; remaining > budget {
+		CL.PrintWarnf("清理后数据目录占用 %s 仍超出全局预算, 固定的版本和每个任务最新的版本不会被清理", tools.FormatSize(remaining))
+	}
 	return nil
 }
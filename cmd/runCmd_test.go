@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnforceBudgetSkipsLockedTasks(t *testing.T) {
+	db, home := openHomeDB(t)
+	dataDir := filepath.Join(home, "data")
+	addTestTask(t, db, 1, "a", filepath.Join(dataDir, "a"))
+	addTestTask(t, db, 2, "b", filepath.Join(dataDir, "b"))
+
+	// 每个任务两个100字节的版本, 最旧的版本属于正在运行的任务 b
+	versions := []struct {
+		id     string
+		taskID int
+		name   string
+		time   string
+	}{
+		{"b1", 2, "b", "20250101000000"},
+		{"a1", 1, "a", "20250102000000"},
+		{"a2", 1, "a", "20250103000000"},
+		{"b2", 2, "b", "20250104000000"},
+	}
+	for _, v := range versions {
+		dir := filepath.Join(dataDir, v.name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, v.id+".zip"), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO backup_records (version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, size_bytes, run_status) VALUES (?, ?, ?, ?, ?, ?, '-', 100, ?)",
+			v.id, v.taskID, v.time, v.name, v.id+".zip", dir, globals.RunStatusSuccess); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	running, err := lockTask(2, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = running.Release() }()
+
+	// 任务 a 运行结束后按预算清理, 跳过正在运行的任务 b, 只清理任务 a 的旧版本
+	if err := enforceBudget(db, dataDir, 250, 1); err != nil {
+		t.Fatalf("enforceBudget() 返回错误: %v", err)
+	}
+	var remaining []string
+	if err := db.Select(&remaining, "SELECT version_id FROM backup_records ORDER BY timestamp"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(remaining, ","); got != "b1,a2,b2" {
+		t.Errorf("剩余的版本 = %v, 期望 [b1 a2 b2]", remaining)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "b", "b1.zip")); err != nil {
+		t.Errorf("正在运行的任务的备份文件不应被删除: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"cbk/pkg/globals"
+	"cbk/pkg/tools"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// taskRef 表示通过任务ID或任务名指定的任务, 用作 -id 参数的值
+type taskRef string
+
+// taskRefVar 在命令中注册接受任务ID或任务名的参数
+func taskRefVar(fs *flag.FlagSet, name, usage string) *taskRef {
+	r := new(taskRef)
+	fs.Var(r, name, usage)
+	return r
+}
+
+func (r *taskRef) String() string {
+	return string(*r)
+}
+
+func (r *taskRef) Set(s string) error {
+	if s = strings.TrimSpace(s); s == "" {
+		return fmt.Errorf("任务ID或任务名不能为空")
+	}
+	*r = taskRef(s)
+	return nil
+}
+
+// IsSet 判断是否指定了任务
+func (r *taskRef) IsSet() bool {
+	return *r != ""
+}
+
+// Resolve 返回指定的任务ID, 未指定时返回0
+func (r *taskRef) Resolve(db *sqlx.DB) (int, error) {
+	if !r.IsSet() {
+		return 0, nil
+	}
+	return resolveTask(db, string(*r))
+}
+
+// resolveTask 将任务ID或任务名解析为任务ID
+// 纯数字按任务ID处理, 不检查任务是否存在, 由调用方在查询任务时检查; 其他按任务名查找
+func resolveTask(db *sqlx.DB, s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+
+	var id int
+	if err := db.Get(&id, "SELECT task_id FROM backup_tasks WHERE task_name = ?", s); err == sql.ErrNoRows {
+		return 0, fmt.Errorf("任务名不存在: %s", s)
+	} else if err != nil {
+		return 0, fmt.Errorf("查询任务失败: %w", err)
+	}
+	return id, nil
+}
+
+// checkTaskName 检查任务名是否可用
+// 纯数字会被 -id、-ids 和前置任务解析为任务ID, 不能用作任务名
+func checkTaskName(name string) error {
+	if name == "" {
+		return fmt.Errorf("任务名不能为空")
+	}
+	if tools.ContainsSpecialChars(name) {
+		return fmt.Errorf("任务名含非法字符, 请重试")
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("任务名不能是纯数字: %s, 纯数字会被当作任务ID", name)
+	}
+	return nil
+}
+
+// taskSelector 表示选择多个任务的参数, 命令不支持的参数为nil
+type taskSelector struct {
+	id  *taskRef // -id: 单个任务ID或任务名
+	ids *string  // -ids: 逗号分隔的任务ID或任务名
+	tag *string  // -tag: 逗号分隔的标签, 选择包含任意一个标签的任务
+	all *bool    // -all: 所有任务
+}
+
+// flags 返回命令支持的选择参数, 用于错误提示
+func (s taskSelector) flags() string {
+	var names []string
+	if s.id != nil {
+		names = append(names, "-id")
+	}
+	if s.ids != nil {
+		names = append(names, "-ids")
+	}
+	if s.tag != nil {
+		names = append(names, "-tag")
+	}
+	if s.all != nil {
+		names = append(names, "-all")
+	}
+	return strings.Join(names, "、")
+}
+
+// count 返回指定的选择参数的个数
+func (s taskSelector) count() int {
+	n := 0
+	if s.id != nil && s.id.IsSet() {
+		n++
+	}
+	if s.ids != nil && *s.ids != "" {
+		n++
+	}
+	if s.tag != nil && *s.tag != "" {
+		n++
+	}
+	if s.all != nil && *s.all {
+		n++
+	}
+	return n
+}
+
+// multi 判断是否使用了可以选择多个任务的参数
+func (s taskSelector) multi() bool {
+	return (s.ids != nil && *s.ids != "") || (s.tag != nil && *s.tag != "") || (s.all != nil && *s.all)
+}
+
+// selectIDs 根据选择参数返回任务ID列表
+// -id 和 -ids 按指定的顺序返回, -tag 和 -all 按任务ID排序
+// 参数:
+//   - db: 数据库连接
+//
+// 返回值:
+//   - []int: 任务ID列表
+//   - error: 未指定或同时指定了多个选择参数, 以及没有匹配的任务时返回错误
+func (s taskSelector) selectIDs(db *sqlx.DB) ([]int, error) {
+	switch s.count() {
+	case 0:
+		return nil, fmt.Errorf("请使用 %s 参数指定任务", s.flags())
+	case 1:
+	default:
+		return nil, fmt.Errorf("只能使用 %s 参数中的一个", s.flags())
+	}
+
+	switch {
+	case s.id != nil && s.id.IsSet():
+		id, err := s.id.Resolve(db)
+		if err != nil {
+			return nil, err
+		}
+		return []int{id}, nil
+	case s.ids != nil && *s.ids != "":
+		return parseTaskList(db, *s.ids)
+	}
+
+	// 按标签或全部选择任务
+	var tasks globals.BackupTasks
+	if err := db.Select(&tasks, "SELECT task_id, task_name, tags FROM backup_tasks ORDER BY task_id"); err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	if s.tag != nil && *s.tag != "" {
+		var err error
+		if tasks, err = filterTasksByTag(tasks, *s.tag); err != nil {
+			return nil, err
+		}
+		if len(tasks) == 0 {
+			return nil, fmt.Errorf("没有标签为 %s 的任务", *s.tag)
+		}
+	} else if len(tasks) == 0 {
+		return nil, fmt.Errorf("没有任何备份任务")
+	}
+
+	ids := make([]int, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.TaskID)
+	}
+	return ids, nil
+}
+
+// parseTaskList 解析逗号分隔的任务ID或任务名列表, 无效的项打印错误后跳过
+func parseTaskList(db *sqlx.DB, list string) ([]int, error) {
+	var ids []int
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+
+		// 检查解析的任务ID是否为空
+		if item == "" {
+			CL.PrintErr("任务ID不能为空")
+			continue
+		}
+
+		// 检查解析的任务ID是否包含特殊字符
+		if tools.ContainsSpecialChars(item) {
+			CL.PrintErrf("任务ID包含危险字符: %s", item)
+			continue
+		}
+
+		id, err := resolveTask(db, item)
+		if err != nil {
+			CL.PrintErrf("%v", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// filterTasksByTag 返回包含任意一个指定标签的任务
+func filterTasksByTag(tasks globals.BackupTasks, spec string) (globals.BackupTasks, error) {
+	tags, err := tools.NormalizeTags(spec)
+	if err != nil {
+		return nil, err
+	}
+	want := tools.SplitTags(tags)
+	if len(want) == 0 {
+		return nil, fmt.Errorf("标签不能为空")
+	}
+
+	var matched globals.BackupTasks
+	for _, task := range tasks {
+		if tools.HasAnyTag(task.Tags, want) {
+			matched = append(matched, task)
+		}
+	}
+	return matched, nil
+}
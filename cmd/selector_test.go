@@ -0,0 +1,23 @@
+package cmd
+
+import "testing"
+
+func TestCheckTaskName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"docs", false},
+		{"备份2024", false},
+		{"2024docs", false},
+		{"", true},
+		{"2024", true},
+		{"007", true},
+		{"a;b", true},
+	}
+	for _, tt := range tests {
+		if err := checkTaskName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("checkTaskName(%q) 错误 = %v, 期望错误 %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"cbk/pkg/globals"
+	"cbk/pkg/tools"
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -15,22 +17,60 @@ import (
 
 // showCmdMain 查询指定任务ID的备份记录并以表格形式输出
 func showCmdMain(db *sqlx.DB) error {
-	// 检查任务ID是否指定
-	if *showID == 0 {
-		return fmt.Errorf("查询指定备份任务时, 必须指定任务ID")
+	// 根据 -id、-tag 或 -all 选择要显示的任务
+	selector := taskSelector{id: showID, tag: showTag, all: showAll}
+	ids, err := selector.selectIDs(db)
+	if err != nil {
+		return err
+	}
+
+	// 显示保留策略的判定结果
+	if *showExplain {
+		for i, id := range ids {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := showRetentionExplain(db, id); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	// 构建查询sql语句
-	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_status, backup_file_name, backup_size, backup_path, version_hash FROM backup_records WHERE task_id = ? ORDER BY timestamp DESC"
+	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, label, note, attempt, error_message, files_copied, files_updated, files_deleted, files_linked, started_at, finished_at, duration_ms, size_bytes, file_count, dir_count, bytes_read, bytes_written, compression_ratio, run_status FROM backup_records WHERE task_id = ? ORDER BY timestamp DESC"
 
 	// 定义存储查询结果的结构体
 	var records globals.BackupRecords
 
-	// 执行查询
-	if err := db.Select(&records, querySql, *showID); err == sql.ErrNoRows {
-		return fmt.Errorf("未找到指定任务ID %d 的备份记录", *showID)
-	} else if err != nil {
-		return fmt.Errorf("查询备份记录失败: %w", err)
+	// 执行查询, 多个任务的备份记录按任务依次显示
+	replicas := make(map[string][]globals.ReplicaRecord) // 版本ID到副本状态的映射
+	for _, id := range ids {
+		var taskRecords globals.BackupRecords
+		if err := db.Select(&taskRecords, querySql, id); err != nil {
+			return fmt.Errorf("查询备份记录失败: %w", err)
+		}
+		records = append(records, taskRecords...)
+
+		taskReplicas, err := tools.LoadReplicas(db, id)
+		if err != nil {
+			return err
+		}
+		for versionID, replica := range taskReplicas {
+			replicas[versionID] = replica
+		}
+	}
+
+	// 如果指定了版本选择器, 则仅显示匹配的版本
+	if *showVersion != "" {
+		if len(ids) != 1 {
+			return fmt.Errorf("-ver 参数只能与 -id 一起使用")
+		}
+		record, err := tools.ResolveVersion(db, ids[0], *showVersion)
+		if err != nil {
+			return fmt.Errorf("解析版本失败: %w", err)
+		}
+		records = globals.BackupRecords{record}
 	}
 
 	// 检查是否需要选择完整格式
@@ -38,7 +78,7 @@ func showCmdMain(db *sqlx.DB) error {
 		// 禁用表格的输出
 		if *showNoTable || *showNoTableShort {
 			// 打印备份记录
-			fmt.Printf("%-25s%-18s%-15s%-20s%-10s%-40s%-30s%-25s%-10s\n", "备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录", "版本哈希")
+			fmt.Printf("%-25s%-18s%-15s%-20s%-10s%-40s%-30s%-25s%-15s%-8s%-20s%-30s%-6s%-22s%-12s%-8s%-8s%-12s%-12s%-8s%-30s%s\n", "备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份存放目录", "版本哈希", "固定", "标签", "备注", "尝试", "结束时间", "耗时", "文件数", "目录数", "读取", "写入", "压缩率", "错误信息", "副本")
 			for _, record := range records {
 				// 将时间戳转换为时间对象并格式化为易读格式
 				timestamp, err := time.Parse("20060102150405", record.Timestamp)
@@ -46,7 +86,8 @@ func showCmdMain(db *sqlx.DB) error {
 					return fmt.Errorf("解析时间戳失败: %w", err)
 				}
 				formattedTimestamp := timestamp.Format("2006-01-02 15:04:05")
-				fmt.Printf("%-25s%-25s%-15d%-20s%-10s%-40s%-30s%-30s%-10s\n", formattedTimestamp, record.VersionID, record.TaskID, record.TaskName, record.BackupStatus, record.BackupFileName, record.BackupSize, record.BackupPath, record.VersionHash)
+				replicaText := strings.ReplaceAll(tools.FormatReplicaStatus(replicas[record.VersionID]), "\n", "; ")
+				fmt.Printf("%-25s%-25s%-15d%-20s%-10s%-40s%-30s%-30s%-15s%-8s%-20s%-30s%-6d%-22s%-12s%-8d%-8d%-12s%-12s%-8s%-30s%s\n", formattedTimestamp, record.VersionID, record.TaskID, record.TaskName, formatRunStatus(record), recordFileName(record), formatRecordSize(record), record.BackupPath, record.VersionHash, pinnedText(record), record.Label, record.Note, record.Attempt, formatFinishedAt(record), formatDuration(record), record.FileCount, record.DirCount, tools.FormatSize(record.BytesRead), tools.FormatSize(record.BytesWritten), formatCompressionRatio(record), record.ErrorMessage, replicaText)
 			}
 
 			return nil
@@ -71,7 +112,7 @@ func showCmdMain(db *sqlx.DB) error {
 		}
 
 		// 添加表头
-		t.AppendHeader(table.Row{"备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份文件路径", "版本哈希"})
+		t.AppendHeader(table.Row{"备份时间", "版本ID", "任务ID", "任务名", "备份状态", "备份文件名", "备份文件大小", "备份文件路径", "版本哈希", "固定", "标签", "备注", "尝试", "结束时间", "耗时", "文件数", "目录数", "读取", "写入", "压缩率", "错误信息", "副本"})
 
 		// 将查询结果添加到表格
 		for _, record := range records {
@@ -88,11 +129,24 @@ func showCmdMain(db *sqlx.DB) error {
 				record.VersionID,
 				record.TaskID,
 				record.TaskName,
-				record.BackupStatus,
-				record.BackupFileName,
-				record.BackupSize,
+				formatRunStatus(record),
+				recordFileName(record),
+				formatRecordSize(record),
 				record.BackupPath,
 				record.VersionHash,
+				pinnedText(record),
+				record.Label,
+				record.Note,
+				record.Attempt,
+				formatFinishedAt(record),
+				formatDuration(record),
+				record.FileCount,
+				record.DirCount,
+				tools.FormatSize(record.BytesRead),
+				tools.FormatSize(record.BytesWritten),
+				formatCompressionRatio(record),
+				record.ErrorMessage,
+				tools.FormatReplicaStatus(replicas[record.VersionID]),
 			})
 		}
 
@@ -107,6 +161,8 @@ func showCmdMain(db *sqlx.DB) error {
 			{Name: "备份文件大小", WidthMax: 10, WidthMaxEnforcer: text.WrapHard},
 			{Name: "备份存放目录", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
 			{Name: "版本哈希", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+			{Name: "标签", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+			{Name: "备注", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
 		})
 		t.SetColumnConfigs([]table.ColumnConfig{
 			{Name: "版本ID", Align: text.AlignCenter},
@@ -118,6 +174,19 @@ func showCmdMain(db *sqlx.DB) error {
 			{Name: "备份文件大小", Align: text.AlignCenter},
 			{Name: "备份存放目录", Align: text.AlignLeft},
 			{Name: "版本哈希", Align: text.AlignCenter},
+			{Name: "固定", Align: text.AlignCenter},
+			{Name: "标签", Align: text.AlignLeft},
+			{Name: "备注", Align: text.AlignLeft},
+			{Name: "尝试", Align: text.AlignCenter},
+			{Name: "结束时间", Align: text.AlignLeft},
+			{Name: "耗时", Align: text.AlignRight},
+			{Name: "文件数", Align: text.AlignRight},
+			{Name: "目录数", Align: text.AlignRight},
+			{Name: "读取", Align: text.AlignRight},
+			{Name: "写入", Align: text.AlignRight},
+			{Name: "压缩率", Align: text.AlignRight},
+			{Name: "错误信息", Align: text.AlignLeft, WidthMax: 40, WidthMaxEnforcer: text.WrapSoft},
+			{Name: "副本", Align: text.AlignLeft, WidthMax: 50, WidthMaxEnforcer: text.WrapText},
 		})
 
 		// 输出表格
@@ -129,7 +198,7 @@ func showCmdMain(db *sqlx.DB) error {
 	// 禁用表格的输出
 	if *showNoTable || *showNoTableShort {
 		// 打印备份记录
-		fmt.Printf("%-25s%-18s%-15s%-20s\n", "备份时间", "版本ID", "任务ID", "任务名")
+		fmt.Printf("%-25s%-18s%-15s%-20s%-10s%-15s%-12s%-8s%-20s%s\n", "备份时间", "版本ID", "任务ID", "任务名", "状态", "大小", "耗时", "固定", "标签", "备注")
 		for _, record := range records {
 			// 将时间戳转换为时间对象并格式化为易读格式
 			timestamp, err := time.Parse("20060102150405", record.Timestamp)
@@ -137,7 +206,7 @@ func showCmdMain(db *sqlx.DB) error {
 				return fmt.Errorf("解析时间戳失败: %w", err)
 			}
 			formattedTimestamp := timestamp.Format("2006-01-02 15:04:05")
-			fmt.Printf("%-25s%-25s%-15d%-20s\n", formattedTimestamp, record.VersionID, record.TaskID, record.TaskName)
+			fmt.Printf("%-25s%-25s%-15d%-20s%-10s%-15s%-12s%-8s%-20s%s\n", formattedTimestamp, record.VersionID, record.TaskID, record.TaskName, formatRunStatus(record), formatRecordSize(record), formatDuration(record), pinnedText(record), record.Label, record.Note)
 		}
 
 		return nil
@@ -161,7 +230,7 @@ func showCmdMain(db *sqlx.DB) error {
 		return fmt.Errorf("表格样式不存在: %s, 可选样式: %v", *showTableStyle, styleList)
 	}
 	// 添加表头
-	t.AppendHeader(table.Row{"备份时间", "版本ID", "任务ID", "任务名"})
+	t.AppendHeader(table.Row{"备份时间", "版本ID", "任务ID", "任务名", "状态", "大小", "耗时", "固定", "标签", "备注"})
 
 	// 将查询结果添加到表格
 	for _, record := range records {
@@ -178,6 +247,12 @@ func showCmdMain(db *sqlx.DB) error {
 			record.VersionID,
 			record.TaskID,
 			record.TaskName,
+			formatRunStatus(record),
+			formatRecordSize(record),
+			formatDuration(record),
+			pinnedText(record),
+			record.Label,
+			record.Note,
 		})
 	}
 
@@ -187,16 +262,122 @@ func showCmdMain(db *sqlx.DB) error {
 		{Name: "任务ID", WidthMax: 10, WidthMaxEnforcer: text.WrapHard},
 		{Name: "备份时间", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
 		{Name: "任务名", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+		{Name: "标签", WidthMax: 20, WidthMaxEnforcer: text.WrapHard},
+		{Name: "备注", WidthMax: 30, WidthMaxEnforcer: text.WrapHard},
 	})
 	t.SetColumnConfigs([]table.ColumnConfig{
 		{Name: "版本ID", Align: text.AlignCenter},
 		{Name: "任务ID", Align: text.AlignCenter},
 		{Name: "备份时间", Align: text.AlignLeft},
 		{Name: "任务名", Align: text.AlignLeft},
+		{Name: "状态", Align: text.AlignCenter},
+		{Name: "大小", Align: text.AlignCenter},
+		{Name: "耗时", Align: text.AlignRight},
+		{Name: "固定", Align: text.AlignCenter},
+		{Name: "标签", Align: text.AlignLeft},
+		{Name: "备注", Align: text.AlignLeft},
+	})
+
+	// 输出表格
+	t.Render()
+
+	return nil
+}
+
+// showRetentionExplain 显示保留策略对指定任务每个成功版本的判定结果及原因
+// 参数:
+// - db: 数据库连接
+// - taskID: 任务ID
+// 返回值:
+// - error: 错误信息
+func showRetentionExplain(db *sqlx.DB, taskID int) error {
+	// 查询任务的保留策略
+	var task globals.BackupTask
+	querySql := "SELECT task_name, retention_count, retention_days, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly FROM backup_tasks WHERE task_id = ?"
+	if err := db.Get(&task, querySql, taskID); err == sql.ErrNoRows {
+		return fmt.Errorf("任务ID不存在: %d", taskID)
+	} else if err != nil {
+		return fmt.Errorf("查询任务信息失败: %w", err)
+	}
+
+	// 根据备份记录计算保留计划
+	plan, err := tools.PlanRetention(db, taskID, tools.NewRetentionPolicy(task), time.Now())
+	if err != nil {
+		return err
+	}
+	decisions := plan.Decisions
+
+	fmt.Printf("任务 [%s] 的保留策略: %s\n", task.TaskName, plan.Policy)
+
+	// 统计保留和清理的数量
+	var keepCount int
+	for _, decision := range decisions {
+		if decision.Keep {
+			keepCount++
+		}
+	}
+	summary := fmt.Sprintf("共 %d 个版本, 保留 %d 个, 清理 %d 个", len(decisions), keepCount, len(decisions)-keepCount)
+
+	// 禁用表格的输出
+	if *showNoTable || *showNoTableShort {
+		fmt.Printf("%-8s%-25s%-25s%s\n", "判定", "备份时间", "版本ID", "原因")
+		for _, decision := range decisions {
+			fmt.Printf("%-8s%-25s%-25s%s\n", explainAction(decision), decision.Time.Format("2006-01-02 15:04:05"), decision.ID, strings.Join(decision.Reasons, "; "))
+		}
+		fmt.Println(summary)
+		return nil
+	}
+
+	// 创建表格
+	t := table.NewWriter()
+
+	// 设置表格输出到标准输出
+	t.SetOutputMirror(os.Stdout)
+
+	// 设置表格样式
+	if style, ok := TableStyle[*showTableStyle]; ok {
+		t.SetStyle(style)
+	} else {
+		// 定义样式列表
+		var styleList []string
+		for k := range TableStyle {
+			styleList = append(styleList, k)
+		}
+		return fmt.Errorf("表格样式不存在: %s, 可选样式: %v", *showTableStyle, styleList)
+	}
+
+	// 添加表头
+	t.AppendHeader(table.Row{"判定", "备份时间", "版本ID", "原因"})
+
+	// 将判定结果添加到表格
+	for _, decision := range decisions {
+		t.AppendRow(table.Row{
+			explainAction(decision),
+			decision.Time.Format("2006-01-02 15:04:05"),
+			decision.ID,
+			strings.Join(decision.Reasons, "\n"),
+		})
+	}
+
+	// 设置列配置
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "判定", Align: text.AlignCenter},
+		{Name: "备份时间", Align: text.AlignLeft},
+		{Name: "版本ID", Align: text.AlignCenter},
+		{Name: "原因", Align: text.AlignLeft},
 	})
 
 	// 输出表格
 	t.Render()
+	fmt.Println(summary)
 
 	return nil
 }
+
+// explainAction 返回保留策略判定结果的显示文本
+func explainAction(decision tools.RetentionDecision) string {
+	if decision.Keep {
+		return "保留"
+	}
+	return "清理"
+}
@@ -0,0 +1,76 @@
+-- 创建备份任务表，用于定义备份任务的基本信息
+CREATE TABLE IF NOT EXISTS backup_tasks (
+    task_id INTEGER PRIMARY KEY AUTOINCREMENT, -- 唯一标识备份任务的 ID （自动递增）
+    task_name TEXT, -- 备份任务的名称
+    target_directory TEXT, -- 需要备份的目标目录
+    backup_directory TEXT, -- 备份文件存放的目标目录
+    retention_count INTEGER, -- 保留数量
+    retention_days INTEGER, -- 保留天数
+    no_compression INTEGER,  -- 是否禁用压缩（默认启用压缩，设置为 0 表示启用压缩, 1 表示禁用压缩）
+    exclude_rules TEXT, -- 用于存储排除规则 （例如: *.txt, *.jpg）"none" 表示不排除任何文件
+    retention_size INTEGER DEFAULT 0, -- 保留的备份总大小上限（字节），0 表示不限制
+    keep_hourly INTEGER DEFAULT 0, -- GFS保留策略: 保留最近N个小时中每小时的最新版本
+    keep_daily INTEGER DEFAULT 0, -- GFS保留策略: 保留最近N天中每天的最新版本
+    keep_weekly INTEGER DEFAULT 0, -- GFS保留策略: 保留最近N周中每周的最新版本
+    keep_monthly INTEGER DEFAULT 0, -- GFS保留策略: 保留最近N个月中每月的最新版本
+    keep_yearly INTEGER DEFAULT 0, -- GFS保留策略: 保留最近N年中每年的最新版本
+    schedule TEXT DEFAULT '', -- 定时计划（cron 表达式或 @daily 等快捷写法），空字符串表示不定时运行
+    tags TEXT DEFAULT '', -- 标签，多个标签用逗号分隔，空字符串表示没有标签
+    depends_on TEXT DEFAULT '', -- 前置任务 ID，多个 ID 用逗号分隔，运行任务前先运行前置任务
+    retries INTEGER DEFAULT 0, -- 失败后的重试次数，0 表示不重试
+    retry_backoff INTEGER DEFAULT 0, -- 第一次重试前的等待时间（秒），之后每次重试翻倍
+    timeout INTEGER DEFAULT 0, -- 每次运行的超时时间（秒），0 表示不限制
+    replicas TEXT DEFAULT '', -- 副本存放位置（本地目录或远程存储地址），多个位置用逗号分隔，空字符串表示不复制
+    tier_days INTEGER DEFAULT 0, -- 分层存储: 版本超过 N 天后移动到冷存储位置，0 表示不启用
+    tier_location TEXT DEFAULT '', -- 分层存储: 冷存储位置（本地目录或远程存储地址）
+    task_type TEXT DEFAULT 'archive', -- 任务类型（archive 表示打包为备份文件，mirror 表示将备份目录同步为目标目录的镜像，snapshot 表示生成硬链接快照目录）
+    mirror_delete INTEGER DEFAULT 0 -- 镜像任务是否删除镜像中目标目录已不存在的文件（1 表示删除）
+);
+
+-- 添加索引，用于提高查询效率
+CREATE INDEX IF NOT EXISTS idx_backup_tasks_task_name ON backup_tasks (task_name);
+
+-- 创建备份记录表，用于存储每次备份任务的详细记录
+CREATE TABLE IF NOT EXISTS backup_records (
+    version_id TEXT PRIMARY KEY, -- 唯一标识每次备份的版本号
+    task_id INTEGER, -- 关联的备份任务 ID
+    timestamp TEXT, -- 备份任务的时间戳
+    task_name TEXT, -- 备份任务的名称
+    backup_status TEXT, -- 备份任务的状态（例如: true 表示成功 false 表示失败 skipped 表示因前置任务未成功而跳过）
+    backup_file_name TEXT, -- 生成的备份文件名称
+    backup_size TEXT, -- 备份文件的大小
+    backup_path TEXT, -- 备份文件的存储路径
+    version_hash TEXT, -- 备份版本的哈希值，用于校验
+    pinned INTEGER DEFAULT 0, -- 是否固定该版本（1 表示固定，固定的版本不会被保留策略清理）
+    label TEXT DEFAULT '', -- 版本标签（例如: pre-upgrade）
+    note TEXT DEFAULT '', -- 版本备注
+    attempt INTEGER DEFAULT 1, -- 第几次尝试运行（失败重试时递增）
+    error_message TEXT DEFAULT '', -- 失败或跳过的原因
+    files_copied INTEGER DEFAULT 0, -- 镜像和快照任务: 新复制的文件数
+    files_updated INTEGER DEFAULT 0, -- 镜像任务: 变化后重新同步的文件数
+    files_deleted INTEGER DEFAULT 0, -- 镜像任务: 删除的多余文件数
+    files_linked INTEGER DEFAULT 0 -- 快照任务: 硬链接到上一个快照的文件数
+);
+
+-- 给备份记录表添加索引，用于提高查询效率 
+CREATE INDEX IF NOT EXISTS idx_backup_records_timestamp ON backup_records (timestamp);
+
+-- 给备份记录表添加索引，用于提高查询效率
+CREATE INDEX IF NOT EXISTS idx_backup_records_task_id ON backup_records (task_id);
+
+-- 创建副本表，用于记录每个备份版本复制到各个副本位置的状态
+CREATE TABLE IF NOT EXISTS backup_replicas (
+    version_id TEXT, -- 关联的备份版本号
+    location TEXT, -- 副本存放位置
+    status TEXT, -- 复制状态（success 表示复制并校验成功，failed 表示失败，下次运行任务时重试）
+    attempts INTEGER DEFAULT 0, -- 已尝试复制的次数
+    timestamp TEXT, -- 最后一次复制的时间戳
+    error_message TEXT DEFAULT '', -- 最后一次复制失败的原因
+    PRIMARY KEY (version_id, location)
+);
+
+-- 创建设置表，用于存储全局设置（例如: 全局磁盘预算）
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY, -- 设置项名称
+    value TEXT -- 设置项的值
+);
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- 为备份记录添加运行的元数据
+ALTER TABLE backup_records ADD COLUMN started_at TEXT DEFAULT ''; -- 开始运行的时间
+ALTER TABLE backup_records ADD COLUMN finished_at TEXT DEFAULT ''; -- 结束运行的时间
+ALTER TABLE backup_records ADD COLUMN duration_ms INTEGER DEFAULT 0; -- 运行耗时（毫秒）
+ALTER TABLE backup_records ADD COLUMN size_bytes INTEGER DEFAULT 0; -- 备份文件、快照或镜像的大小（字节）
+ALTER TABLE backup_records ADD COLUMN file_count INTEGER DEFAULT 0; -- 备份中的文件数
+ALTER TABLE backup_records ADD COLUMN dir_count INTEGER DEFAULT 0; -- 备份中的目录数
+ALTER TABLE backup_records ADD COLUMN bytes_read INTEGER DEFAULT 0; -- 从目标目录读取的字节数
+ALTER TABLE backup_records ADD COLUMN bytes_written INTEGER DEFAULT 0; -- 写入备份目录的字节数
+ALTER TABLE backup_records ADD COLUMN compression_ratio REAL DEFAULT 0; -- 压缩率（节省的空间占原始大小的百分比）
+ALTER TABLE backup_records ADD COLUMN run_status TEXT DEFAULT ''; -- 运行状态（success 成功，partial 部分完成，failed 失败，cancelled 超时取消，unchanged 无变化，skipped 已跳过）
+ALTER TABLE backup_records ADD COLUMN content_hash TEXT DEFAULT ''; -- 备份文件或快照完整的MD5哈希值，用于判断版本是否有变化
+
+-- 根据备份状态补充已有记录的运行状态
+UPDATE backup_records SET run_status = CASE backup_status
+    WHEN 'true' THEN 'success'
+    WHEN 'skipped' THEN 'skipped'
+    ELSE 'failed'
+END;
+
+-- 根据备份文件大小的文本补充已有记录的字节数，大小文本由 FormatSize 生成，格式为 12.50MB，没有备份文件的记录为 -
+UPDATE backup_records SET size_bytes = CAST(ROUND(CASE
+    WHEN backup_size LIKE '%GB' THEN CAST(substr(backup_size, 1, length(backup_size) - 2) AS REAL) * 1073741824
+    WHEN backup_size LIKE '%MB' THEN CAST(substr(backup_size, 1, length(backup_size) - 2) AS REAL) * 1048576
+    WHEN backup_size LIKE '%KB' THEN CAST(substr(backup_size, 1, length(backup_size) - 2) AS REAL) * 1024
+    WHEN backup_size LIKE '%B' THEN CAST(substr(backup_size, 1, length(backup_size) - 1) AS REAL)
+    ELSE 0
+END) AS INTEGER);
+
+-- 副本的复制状态由 true/false 改为 success/failed，与运行状态保持一致
+UPDATE backup_replicas SET status = CASE status WHEN 'true' THEN 'success' WHEN 'success' THEN 'success' ELSE 'failed' END;
\ No newline at end of file
@@ -1,11 +1,11 @@
 package cmd
 
 import (
-	"cbk/pkg/globals"
 	"cbk/pkg/tools"
+	"context"
 	"database/sql"
 	"fmt"
-	"path/filepath"
+	"io"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -14,71 +14,75 @@ import (
 // unpackCmdMain 解压指定备份任务
 func unpackCmdMain(db *sqlx.DB) error {
 	// 检查任务ID是否指定
-	if *unpackID == 0 {
-		return fmt.Errorf("解压指定备份任务时, 必须指定任务ID")
+	if !unpackID.IsSet() {
+		return fmt.Errorf("解压指定备份任务时, 必须指定任务ID或任务名")
+	}
+	taskID, err := unpackID.Resolve(db)
+	if err != nil {
+		return err
 	}
 
-	// 检查versionID是否指定
+	// 未指定版本时默认解压最新的成功版本
 	if *unpackVersionID == "" {
-		return fmt.Errorf("解压指定备份任务时, 必须指定版本ID")
+		*unpackVersionID = tools.SelectorLatestSuccess
 	}
 
 	// 打印提示信息
 	CL.PrintOk("正在启动解压任务...")
 
-	// 检查*unpackID是否是已存在的
+	// 检查任务是否存在备份记录
 	var taskCount int
-	if err := db.Get(&taskCount, "SELECT COUNT(*) FROM backup_records WHERE task_id = ?;", *unpackID); err == sql.ErrNoRows {
-		return fmt.Errorf("未找到指定任务ID %d 的备份记录", *unpackID)
+	if err := db.Get(&taskCount, "SELECT COUNT(*) FROM backup_records WHERE task_id = ?;", taskID); err == sql.ErrNoRows {
+		return fmt.Errorf("未找到指定任务ID %d 的备份记录", taskID)
 	} else if err != nil {
 		return fmt.Errorf("查询备份记录失败: %w", err)
 	} else if taskCount == 0 {
-		return fmt.Errorf("未找到指定任务ID %d 的备份记录", *unpackID)
+		return fmt.Errorf("未找到指定任务ID %d 的备份记录", taskID)
 	}
 
-	// 检查versionID是否是已存在的
-	var versionCount int
-	if err := db.Get(&versionCount, "SELECT COUNT(*) FROM backup_records WHERE version_id = ?;", *unpackVersionID); err == sql.ErrNoRows {
-		return fmt.Errorf("未找到指定版本ID %s 的备份记录", *unpackVersionID)
-	} else if err != nil {
-		return fmt.Errorf("查询备份记录失败: %w", err)
-	} else if versionCount == 0 {
-		return fmt.Errorf("未找到指定版本ID %s 的备份记录", *unpackVersionID)
+	// 根据版本选择器解析备份记录
+	record, err := tools.ResolveVersion(db, taskID, *unpackVersionID)
+	if err != nil {
+		return fmt.Errorf("解析版本失败: %w", err)
 	}
 
-	// 构建查询sql语句
-	querySql := "SELECT version_id, task_id, backup_file_name, backup_path, version_hash FROM backup_records WHERE task_id =? AND version_id =?;"
-
-	// 定义存储查询结果的结构体
-	var record globals.BackupRecord
-
-	// 执行查询
-	if err := db.Get(&record, querySql, *unpackID, *unpackVersionID); err == sql.ErrNoRows {
-		return fmt.Errorf("未找到指定任务ID %d 和版本ID %s 的备份记录", *unpackID, *unpackVersionID)
-	} else if err != nil {
-		return fmt.Errorf("查询备份记录失败: %w", err)
+	// 检查该版本是否为成功的备份
+	if !tools.IsSuccessRecord(record) {
+		return fmt.Errorf("版本 %s 是一次失败的备份, 没有可解压的备份文件", record.VersionID)
 	}
 
-	// 构建备份文件路径
-	backupFilePath := filepath.Join(record.BackupPath, record.BackupFileName)
+	// 快照版本校验快照目录后直接复制到输出路径
+	if tools.IsSnapshotRecord(record) {
+		if err := tools.VerifySnapshot(record); err != nil {
+			return fmt.Errorf("%w。请尝试选择其他版本重试", err)
+		}
+		unpackPath, err := tools.RestoreSnapshot(context.Background(), record, *unpackOutput)
+		if err != nil {
+			return fmt.Errorf("恢复快照失败: %w", err)
+		}
+		CL.PrintOkf("解压任务完成, 输出路径: %s", unpackPath)
+		return nil
+	}
 
-	// 检查备份文件是否存在
-	if _, err := tools.CheckPath(backupFilePath); err != nil {
-		return fmt.Errorf("备份文件不存在: %w", err)
+	// 打开备份文件, 支持随机读取的远程存储直接从远程读取, 其他远程存储会先下载到临时目录
+	backupFile, backupSize, err := tools.OpenVersionFile(context.Background(), record)
+	if err != nil {
+		return err
 	}
+	defer backupFile.Close()
 
 	// 获取备份文件的后8位哈希值
-	if backupFileHash, err := tools.GetFileMD5Last8(backupFilePath); err != nil {
+	if backupFileHash, err := tools.ReaderMD5Last8(context.Background(), io.NewSectionReader(backupFile, 0, backupSize), backupSize); err != nil {
 		return fmt.Errorf("获取备份文件哈希失败: %w", err)
 	} else {
 		// 比较哈希值是否一致
 		if backupFileHash != record.VersionHash {
-			return fmt.Errorf("备份文件 %s 的版本 %s 的哈希值与记录不匹配，文件可能已损坏或被篡改。请尝试选择其他版本的备份文件重试", backupFilePath, record.VersionID)
+			return fmt.Errorf("备份文件 %s 的版本 %s 的哈希值与记录不匹配，文件可能已损坏或被篡改。请尝试选择其他版本的备份文件重试", tools.JoinLocation(record.BackupPath, record.BackupFileName), record.VersionID)
 		}
 	}
 
 	// 执行解压操作
-	if unZipPath, err := tools.UncompressFilesByOS(record.BackupPath, record.BackupFileName, *unpackOutput); err != nil {
+	if unZipPath, err := tools.UncompressReaderAt(backupFile, backupSize, record.BackupFileName, *unpackOutput); err != nil {
 		return fmt.Errorf("解压备份文件失败: %w", err)
 	} else {
 		// 打印提示信息
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"cbk/pkg/tools"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// usageCmdMain 统计备份空间占用, 或设置全局磁盘预算
+// 参数:
+// - db: 数据库连接
+// 返回值:
+// - error: 错误信息
+func usageCmdMain(db *sqlx.DB) error {
+	// 如果指定了-budget参数, 则设置全局磁盘预算
+	if *usageBudget != "" {
+		budget, err := tools.ParseQuota(*usageBudget)
+		if err != nil {
+			return fmt.Errorf("解析全局预算失败: %w", err)
+		}
+		if err := tools.SetBudget(db, budget); err != nil {
+			return err
+		}
+		if budget > 0 {
+			CL.PrintOkf("全局磁盘预算已设置为: %s", tools.FormatSize(budget))
+		} else {
+			CL.PrintOk("全局磁盘预算已清除")
+		}
+		return nil
+	}
+
+	// 获取数据目录和全局预算
+	dataDir, err := getDataDir()
+	if err != nil {
+		return err
+	}
+	budget, err := tools.GetBudget(db)
+	if err != nil {
+		return err
+	}
+
+	// 统计每个任务的空间占用
+	usages, err := tools.CollectUsage(db, dataDir, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// 汇总数据目录的占用
+	var totalSize, totalProjected, dataSize, dataProjected int64
+	for _, usage := range usages {
+		totalSize += usage.Size
+		totalProjected += usage.Projected
+		if usage.InDataDir {
+			dataSize += usage.Size
+			dataProjected += usage.Projected
+		}
+	}
+
+	// 禁用表格的输出
+	if *usageNoTable || *usageNoTableShort {
+		fmt.Printf("%-10s%-30s%-10s%-15s%-15s%-15s%-15s%s\n", "任务ID", "任务名", "版本数", "当前占用", "最新版本", "大小上限", "预计占用", "计入预算")
+		for _, usage := range usages {
+			fmt.Printf("%-10d%-30s%-10d%-15s%-15s%-15s%-15s%s\n", usage.TaskID, usage.TaskName, usage.Versions, tools.FormatSize(usage.Size), tools.FormatSize(usage.LatestSize), tools.FormatQuota(usage.Policy.Size), tools.FormatSize(usage.Projected), usageInBudget(usage))
+		}
+	} else {
+		// 创建表格
+		t := table.NewWriter()
+
+		// 设置表格输出到标准输出
+		t.SetOutputMirror(os.Stdout)
+
+		// 设置表格样式
+		if style, ok := TableStyle[*usageTableStyle]; ok {
+			t.SetStyle(style)
+		} else {
+			// 定义样式列表
+			var styleList []string
+			for k := range TableStyle {
+				styleList = append(styleList, k)
+			}
+			return fmt.Errorf("表格样式不存在: %s, 可选样式: %v", *usageTableStyle, styleList)
+		}
+
+		// 添加表头
+		t.AppendHeader(table.Row{"任务ID", "任务名", "版本数", "当前占用", "最新版本", "大小上限", "预计占用", "计入预算"})
+
+		// 将每个任务的空间占用添加到表格
+		for _, usage := range usages {
+			t.AppendRow(table.Row{
+				usage.TaskID,
+				usage.TaskName,
+				usage.Versions,
+				tools.FormatSize(usage.Size),
+				tools.FormatSize(usage.LatestSize),
+				tools.FormatQuota(usage.Policy.Size),
+				tools.FormatSize(usage.Projected),
+				usageInBudget(usage),
+			})
+		}
+		t.AppendFooter(table.Row{"", "合计", "", tools.FormatSize(totalSize), "", "", tools.FormatSize(totalProjected), ""})
+
+		// 设置列配置
+		t.SetColumnConfigs([]table.ColumnConfig{
+			{Name: "任务ID", Align: text.AlignCenter},
+			{Name: "任务名", Align: text.AlignLeft},
+			{Name: "版本数", Align: text.AlignCenter},
+			{Name: "当前占用", Align: text.AlignRight},
+			{Name: "最新版本", Align: text.AlignRight},
+			{Name: "大小上限", Align: text.AlignCenter},
+			{Name: "预计占用", Align: text.AlignRight},
+			{Name: "计入预算", Align: text.AlignCenter},
+		})
+
+		// 输出表格
+		t.Render()
+	}
+
+	// 打印数据目录的占用与全局预算
+	fmt.Printf("数据目录: %s\n", dataDir)
+	if budget <= 0 {
+		fmt.Printf("当前占用: %s, 预计下次备份后占用: %s, 未设置全局预算\n", tools.FormatSize(dataSize), tools.FormatSize(dataProjected))
+		return nil
+	}
+	fmt.Printf("当前占用: %s / %s (%.1f%%), 预计下次备份后占用: %s (%.1f%%)\n",
+		tools.FormatSize(dataSize), tools.FormatSize(budget), float64(dataSize)*100/float64(budget),
+		tools.FormatSize(dataProjected), float64(dataProjected)*100/float64(budget))
+
+	switch {
+	case dataSize > budget:
+		CL.PrintWarn("当前占用已超出全局预算, 下次运行备份任务时将自动清理最旧的版本")
+	case dataProjected > budget:
+		CL.PrintWarn("预计下次备份后将超出全局预算, 届时将自动清理最旧的版本")
+	case float64(dataSize) >= float64(budget)*tools.BudgetWarnRatio:
+		CL.PrintWarnf("当前占用已达到全局预算的 %.0f%%", tools.BudgetWarnRatio*100)
+	}
+
+	return nil
+}
+
+// usageInBudget 返回任务是否计入全局预算的显示文本
+func usageInBudget(usage tools.TaskUsage) string {
+	if usage.InDataDir {
+		return "是"
+	}
+	return "否"
+}
@@ -6,9 +6,35 @@ import (
 )
 
 const (
-	CbkHomeDir = ".cbk"   // 数据目录
-	CbkDBFile  = "cbk.db" // 数据库文件
-	CbkDataDir = "data"   // 数据目录
+	CbkHomeDir     = ".cbk"       // 数据目录
+	CbkDBFile      = "cbk.db"     // 数据库文件
+	CbkDataDir     = "data"       // 数据目录
+	CbkLockDir     = "locks"      // 锁文件目录
+	CbkStageDir    = "staging"    // 上传到远程存储前暂存备份文件的目录
+	CbkDBBackupDir = "db_backups" // 升级数据库前备份数据库文件的目录
+)
+
+// 任务类型
+const (
+	TaskTypeArchive  = "archive"  // 将目标目录打包为备份文件
+	TaskTypeMirror   = "mirror"   // 将备份目录同步为目标目录的镜像
+	TaskTypeSnapshot = "snapshot" // 每次运行在备份目录中生成一个完整的快照目录, 未变化的文件以硬链接共享
+)
+
+// 运行状态
+const (
+	RunStatusSuccess   = "success"   // 运行成功
+	RunStatusPartial   = "partial"   // 运行失败, 但镜像中已有部分文件完成同步
+	RunStatusFailed    = "failed"    // 运行失败
+	RunStatusCancelled = "cancelled" // 运行超时被取消
+	RunStatusUnchanged = "unchanged" // 运行成功, 与上一个成功的版本相比没有变化
+	RunStatusSkipped   = "skipped"   // 前置任务未成功, 未运行
+)
+
+// 副本的复制状态
+const (
+	ReplicaStatusSuccess = "success" // 复制并校验成功
+	ReplicaStatusFailed  = "failed"  // 复制失败, 下次运行任务时重试
 )
 
 // 数据库文件路径
@@ -24,6 +50,16 @@ type BackupTask struct {
 	RetentionDays   int    `db:"retention_days"`   // 保留天数
 	NoCompression   int    `db:"no_compression"`   // 是否禁用压缩(默认启用压缩, 0 表示启用压缩, 1 表示禁用压缩)
 	ExcludeRules    string `db:"exclude_rules"`    // 排除规则
+	RetentionSize   int64  `db:"retention_size"`   // 保留的备份总大小上限(字节), 0 表示不限制
+	Schedule        string `db:"schedule"`         // 定时计划(cron表达式或 @daily 等快捷写法), 空字符串表示不定时运行
+	Tags            string `db:"tags"`             // 标签, 多个标签用逗号分隔, 空字符串表示没有标签
+	DependsOn       string `db:"depends_on"`       // 前置任务ID, 多个ID用逗号分隔, 运行任务前先运行前置任务
+	Replicas        string `db:"replicas"`         // 副本存放位置, 多个位置用逗号分隔, 空字符串表示不复制
+	TaskType        string `db:"task_type"`        // 任务类型(archive 表示打包, mirror 表示镜像同步)
+	MirrorDelete    int    `db:"mirror_delete"`    // 镜像任务是否删除镜像中目标目录已不存在的文件(1 表示删除)
+	GFSRetention           // GFS保留策略
+	RetryPolicy            // 失败重试和超时设置
+	TierRule               // 分层存储规则
 }
 
 // 定义任务表结构体切片
@@ -31,20 +67,50 @@ type BackupTasks []BackupTask
 
 // 定义备份记录表结构体
 type BackupRecord struct {
-	VersionID      string `db:"version_id"`       // 版本ID
-	TaskID         int    `db:"task_id"`          // 任务ID
-	Timestamp      string `db:"timestamp"`        // 时间戳
-	TaskName       string `db:"task_name"`        // 任务名
-	BackupStatus   string `db:"backup_status"`    // 备份状态
-	BackupFileName string `db:"backup_file_name"` // 备份文件名
-	BackupSize     string `db:"backup_size"`      // 备份文件大小
-	BackupPath     string `db:"backup_path"`      // 备份文件路径
-	VersionHash    string `db:"version_hash"`     // 版本哈希
+	VersionID        string  `db:"version_id"`        // 版本ID
+	TaskID           int     `db:"task_id"`           // 任务ID
+	Timestamp        string  `db:"timestamp"`         // 时间戳
+	TaskName         string  `db:"task_name"`         // 任务名
+	BackupStatus     string  `db:"backup_status"`     // 备份状态, 仅为兼容旧版本写入, 以运行状态为准
+	BackupFileName   string  `db:"backup_file_name"`  // 备份文件名
+	BackupSize       string  `db:"backup_size"`       // 备份文件大小, 仅为兼容旧版本写入, 以字节数为准
+	BackupPath       string  `db:"backup_path"`       // 备份文件路径
+	VersionHash      string  `db:"version_hash"`      // 版本哈希
+	Pinned           bool    `db:"pinned"`            // 是否固定, 固定的版本不会被保留策略清理
+	Label            string  `db:"label"`             // 版本标签
+	Note             string  `db:"note"`              // 版本备注
+	Attempt          int     `db:"attempt"`           // 第几次尝试运行
+	ErrorMessage     string  `db:"error_message"`     // 失败或跳过的原因
+	FilesCopied      int     `db:"files_copied"`      // 镜像和快照任务新复制的文件数
+	FilesUpdated     int     `db:"files_updated"`     // 镜像任务变化后重新同步的文件数
+	FilesDeleted     int     `db:"files_deleted"`     // 镜像任务删除的多余文件数
+	FilesLinked      int     `db:"files_linked"`      // 快照任务硬链接到上一个快照的文件数
+	StartedAt        string  `db:"started_at"`        // 开始运行的时间
+	FinishedAt       string  `db:"finished_at"`       // 结束运行的时间
+	DurationMs       int64   `db:"duration_ms"`       // 运行耗时(毫秒)
+	SizeBytes        int64   `db:"size_bytes"`        // 备份文件、快照或镜像的大小(字节)
+	FileCount        int     `db:"file_count"`        // 备份中的文件数
+	DirCount         int     `db:"dir_count"`         // 备份中的目录数
+	BytesRead        int64   `db:"bytes_read"`        // 从目标目录读取的字节数
+	BytesWritten     int64   `db:"bytes_written"`     // 写入备份目录的字节数
+	CompressionRatio float64 `db:"compression_ratio"` // 压缩率(节省的空间占原始大小的百分比)
+	RunStatus        string  `db:"run_status"`        // 运行状态(success/partial/failed/cancelled/unchanged/skipped)
+	ContentHash      string  `db:"content_hash"`      // 备份文件或快照完整的MD5哈希值, 用于判断版本是否有变化
 }
 
 // 定义备份记录表结构体切片
 type BackupRecords []BackupRecord
 
+// 定义副本表结构体
+type ReplicaRecord struct {
+	VersionID    string `db:"version_id"`    // 版本ID
+	Location     string `db:"location"`      // 副本存放位置
+	Status       string `db:"status"`        // 复制状态(success/failed)
+	Attempts     int    `db:"attempts"`      // 已尝试复制的次数
+	Timestamp    string `db:"timestamp"`     // 最后一次复制的时间戳
+	ErrorMessage string `db:"error_message"` // 最后一次复制失败的原因
+}
+
 // 定义任务配置的结构体
 type TaskConfig struct {
 	Task Task `yaml:"task"`
@@ -59,12 +125,51 @@ type Task struct {
 	BackupDirName string    `yaml:"backup_dir_name"` // 备份目录名
 	NoCompression int       `yaml:"no_compression"`  // 是否禁用压缩(默认启用压缩, 0 表示启用压缩, 1 表示禁用压缩)
 	ExcludeRules  string    `yaml:"exclude_rules"`   // 排除规则
+	Schedule      string    `yaml:"schedule"`        // 定时计划(cron表达式或 @daily 等快捷写法, 配置为空或 none 表示不定时运行)
+	Tags          string    `yaml:"tags"`            // 标签, 多个标签用逗号分隔, 例如 db,prod(配置为空或 none 表示没有标签)
+	DependsOn     string    `yaml:"depends_on"`      // 前置任务ID或任务名, 多个任务用逗号分隔(配置为空或 none 表示没有前置任务)
+	Replicas      string    `yaml:"replicas"`        // 副本存放路径, 多个路径用逗号分隔(配置为空或 none 表示不复制)
+	Tier          string    `yaml:"tier"`            // 分层存储规则, 例如 14d:/mnt/archive(配置为空或 none 表示不启用)
+	Type          string    `yaml:"type"`            // 任务类型, archive 或 mirror(配置为空表示 archive)
+	MirrorDelete  int       `yaml:"mirror_delete"`   // 镜像任务是否删除镜像中目标目录已不存在的文件(0: 不删除, 1: 删除)
+	Retry         Retry     `yaml:"retry"`           // 失败重试和超时设置
 }
 
 // 定义保留策略的结构体
 type Retention struct {
-	Count int `yaml:"count"` // 保留数量
-	Days  int `yaml:"days"`  // 保留天数(配置为 0 表示不限制天数)
+	Count        int              `yaml:"count"` // 保留数量
+	Days         int              `yaml:"days"`  // 保留天数(配置为 0 表示不限制天数)
+	Size         string           `yaml:"size"`  // 保留的备份总大小上限, 例如 10GB(配置为空或 none 表示不限制)
+	GFSRetention `yaml:",inline"` // GFS保留策略
+}
+
+// 定义失败重试和超时设置的结构体
+type Retry struct {
+	Retries int    `yaml:"retries"` // 运行失败后的重试次数(配置为 0 表示不重试)
+	Backoff string `yaml:"backoff"` // 第一次重试前的等待时间, 例如 30s, 之后每次重试翻倍
+	Timeout string `yaml:"timeout"` // 每次运行的超时时间, 例如 2h(配置为空或 none 表示不限制)
+}
+
+// 定义任务失败重试和超时设置的结构体, 时间以秒为单位, 0 表示不启用
+type RetryPolicy struct {
+	Retries      int `db:"retries"`       // 运行失败后的重试次数
+	RetryBackoff int `db:"retry_backoff"` // 第一次重试前的等待时间(秒), 之后每次重试翻倍
+	Timeout      int `db:"timeout"`       // 每次运行的超时时间(秒)
+}
+
+// 定义分层存储规则的结构体, 超过指定天数的版本移动到冷存储位置, Days 为 0 表示不启用
+type TierRule struct {
+	TierDays     int    `db:"tier_days"`     // 版本超过N天后移动到冷存储位置
+	TierLocation string `db:"tier_location"` // 冷存储位置, 本地目录或远程存储地址
+}
+
+// 定义GFS(祖父-父-子)保留策略的结构体, 各字段为 0 表示不启用对应的规则
+type GFSRetention struct {
+	Hourly  int `db:"keep_hourly" yaml:"hourly"`   // 保留最近N个小时中每小时的最新版本
+	Daily   int `db:"keep_daily" yaml:"daily"`     // 保留最近N天中每天的最新版本
+	Weekly  int `db:"keep_weekly" yaml:"weekly"`   // 保留最近N周中每周的最新版本
+	Monthly int `db:"keep_monthly" yaml:"monthly"` // 保留最近N个月中每月的最新版本
+	Yearly  int `db:"keep_yearly" yaml:"yearly"`   // 保留最近N年中每年的最新版本
 }
 
 // 定义排除函数的类型
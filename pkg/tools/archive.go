@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveEntry 表示备份版本中的一个条目
+type ArchiveEntry struct {
+	Name           string      // 条目路径(使用正斜杠分隔, 目录不含末尾斜杠)
+	Size           int64       // 原始大小(字节)
+	CompressedSize int64       // 压缩后大小(字节)
+	Mode           os.FileMode // 文件模式
+	ModTime        time.Time   // 修改时间
+	CRC32          uint32      // CRC32 校验值
+	IsDir          bool        // 是否为目录
+	Implicit       bool        // 是否为归档中未显式记录、由子条目推断出的目录
+}
+
+// Ratio 返回条目的压缩率(节省的空间占原始大小的百分比)
+func (e ArchiveEntry) Ratio() float64 {
+	if e.IsDir || e.Size == 0 {
+		return 0
+	}
+	return (1 - float64(e.CompressedSize)/float64(e.Size)) * 100
+}
+
+// VersionReader 用于在不解压的情况下读取一个备份版本的内容
+type VersionReader interface {
+	// Entries 返回按路径排序的所有条目
+	Entries() []ArchiveEntry
+	// Open 打开指定路径的文件条目
+	Open(name string) (io.ReadCloser, error)
+	// Close 释放读取器占用的资源
+	Close() error
+}
+
+// zipVersionReader 基于 ZIP 中央目录的版本读取器
+type zipVersionReader struct {
+	closer  io.Closer
+	entries []ArchiveEntry
+	files   map[string]*zip.File
+}
+
+// OpenZipReader 打开 ZIP 文件并读取其中央目录
+// 参数:
+//   - zipFilePath: ZIP 文件路径
+//
+// 返回值:
+//   - VersionReader: 版本读取器
+//   - error: 打开失败时返回错误
+func OpenZipReader(zipFilePath string) (VersionReader, error) {
+	reader, err := zip.OpenReader(zipFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开 ZIP 文件失败: %w", err)
+	}
+	return newZipVersionReader(&reader.Reader, reader), nil
+}
+
+// OpenZipReaderAt 从可随机读取的内容中读取 ZIP 中央目录, 例如远程存储中的备份文件
+// 参数:
+//   - r: ZIP内容, 关闭版本读取器时一并关闭
+//   - size: ZIP内容的大小
+//
+// 返回值:
+//   - VersionReader: 版本读取器
+//   - error: 读取失败时返回错误
+func OpenZipReaderAt(r ReaderAtCloser, size int64) (VersionReader, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("打开 ZIP 文件失败: %w", err)
+	}
+	return newZipVersionReader(reader, r), nil
+}
+
+// newZipVersionReader 根据 ZIP 中央目录构建版本读取器
+func newZipVersionReader(reader *zip.Reader, closer io.Closer) *zipVersionReader {
+	r := &zipVersionReader{
+		closer: closer,
+		files:  make(map[string]*zip.File),
+	}
+
+	// 记录显式条目
+	seen := make(map[string]bool)
+	for _, file := range reader.File {
+		name := CleanEntryPath(file.Name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		mode := file.Mode()
+		entry := ArchiveEntry{
+			Name:           name,
+			Size:           int64(file.UncompressedSize64),
+			CompressedSize: int64(file.CompressedSize64),
+			Mode:           mode,
+			ModTime:        file.Modified,
+			CRC32:          file.CRC32,
+			IsDir:          mode.IsDir() || strings.HasSuffix(file.Name, "/"),
+		}
+		r.entries = append(r.entries, entry)
+		if !entry.IsDir {
+			r.files[name] = file
+		}
+	}
+
+	// 补全未显式记录的父目录
+	for _, entry := range r.entries {
+		for dir := path.Dir(entry.Name); dir != "." && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			r.entries = append(r.entries, ArchiveEntry{Name: dir, Mode: os.ModeDir | 0755, IsDir: true, Implicit: true})
+		}
+	}
+
+	sort.Slice(r.entries, func(i, j int) bool {
+		return r.entries[i].Name < r.entries[j].Name
+	})
+
+	return r
+}
+
+// Entries 返回按路径排序的所有条目
+func (r *zipVersionReader) Entries() []ArchiveEntry {
+	return r.entries
+}
+
+// Open 打开指定路径的文件条目, 读取到末尾时会校验 CRC32
+func (r *zipVersionReader) Open(name string) (io.ReadCloser, error) {
+	file, ok := r.files[CleanEntryPath(name)]
+	if !ok {
+		return nil, fmt.Errorf("条目不存在: %s", name)
+	}
+	return file.Open()
+}
+
+// Close 关闭 ZIP 文件
+func (r *zipVersionReader) Close() error {
+	return r.closer.Close()
+}
+
+// CopyEntry 将文件条目的内容写入指定的写入器, 并校验 CRC32
+// 参数:
+//   - w: 目标写入器
+//   - reader: 版本读取器
+//   - entry: 要读取的文件条目
+//
+// 返回值:
+//   - int64: 写入的字节数
+//   - error: 读取失败或校验不通过时返回错误
+func CopyEntry(w io.Writer, reader VersionReader, entry ArchiveEntry) (int64, error) {
+	if entry.IsDir {
+		return 0, fmt.Errorf("%s 是一个目录", entry.Name)
+	}
+
+	rc, err := reader.Open(entry.Name)
+	if err != nil {
+		return 0, fmt.Errorf("打开条目失败: %w", err)
+	}
+	defer rc.Close()
+
+	// 同时写入目标和校验器
+	hash := crc32.NewIEEE()
+	n, err := io.CopyBuffer(io.MultiWriter(w, hash), rc, make([]byte, getBufferSize(entry.Size)))
+	if err != nil {
+		return n, fmt.Errorf("读取条目 %s 失败: %w", entry.Name, err)
+	}
+
+	// 校验大小和CRC32
+	if n != entry.Size {
+		return n, fmt.Errorf("条目 %s 的大小与记录不一致: 期望 %d 字节, 实际 %d 字节", entry.Name, entry.Size, n)
+	}
+	if sum := hash.Sum32(); sum != entry.CRC32 {
+		return n, fmt.Errorf("条目 %s 的CRC32校验失败: 期望 %08x, 实际 %08x, 备份可能已损坏", entry.Name, entry.CRC32, sum)
+	}
+
+	return n, nil
+}
+
+// CleanEntryPath 将用户输入或归档中的路径规范化为条目路径
+// 例如: "/etc/nginx/" 和 "./etc/nginx" 都会被规范化为 "etc/nginx", 根路径返回空字符串
+func CleanEntryPath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Clean("/" + name)
+	return strings.TrimPrefix(name, "/")
+}
+
+// FindEntry 在条目列表中查找指定路径的条目
+func FindEntry(entries []ArchiveEntry, name string) (ArchiveEntry, bool) {
+	name = CleanEntryPath(name)
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Name >= name })
+	if i < len(entries) && entries[i].Name == name {
+		return entries[i], true
+	}
+	return ArchiveEntry{}, false
+}
+
+// ListEntries 列出指定目录下的条目
+// 参数:
+//   - entries: 按路径排序的条目列表
+//   - dir: 要列出的目录, 空字符串表示根目录
+//   - recursive: 是否递归列出所有子条目
+//
+// 返回值:
+//   - []ArchiveEntry: 匹配的条目列表
+func ListEntries(entries []ArchiveEntry, dir string, recursive bool) []ArchiveEntry {
+	dir = CleanEntryPath(dir)
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	var result []ArchiveEntry
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name, prefix) || entry.Name == dir {
+			continue
+		}
+		if !recursive && strings.Contains(strings.TrimPrefix(entry.Name, prefix), "/") {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// ArchiveStats 表示备份文件中条目的统计信息
+type ArchiveStats struct {
+	Files          int   // 文件数, 包括软链接
+	Dirs           int   // 目录数
+	Size           int64 // 文件的原始总大小(字节)
+	CompressedSize int64 // 文件压缩后的总大小(字节)
+}
+
+// Ratio 返回备份文件的压缩率(节省的空间占原始大小的百分比)
+func (s ArchiveStats) Ratio() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	return (1 - float64(s.CompressedSize)/float64(s.Size)) * 100
+}
+
+// CountEntries 统计条目列表中的文件数、目录数以及原始和压缩后的总大小
+func CountEntries(entries []ArchiveEntry) ArchiveStats {
+	var stats ArchiveStats
+	for _, entry := range entries {
+		if entry.IsDir {
+			stats.Dirs++
+			continue
+		}
+		stats.Files++
+		stats.Size += entry.Size
+		stats.CompressedSize += entry.CompressedSize
+	}
+	return stats
+}
@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 全局磁盘预算在设置表中的键名
+const budgetSettingKey = "global_budget"
+
+// 数据目录占用达到全局预算的该比例时发出预警
+const BudgetWarnRatio = 0.9
+
+// GetBudget 获取全局磁盘预算
+// 返回值:
+//   - int64: 全局磁盘预算(字节), 未设置时返回0
+//   - error: 查询失败时返回错误
+func GetBudget(db *sqlx.DB) (int64, error) {
+	var value string
+	if err := db.Get(&value, "SELECT value FROM settings WHERE key = ?", budgetSettingKey); err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("查询全局预算失败: %w", err)
+	}
+
+	budget, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("全局预算的值无效: %s", value)
+	}
+	return budget, nil
+}
+
+// SetBudget 设置全局磁盘预算, budget 为0时清除预算
+func SetBudget(db *sqlx.DB, budget int64) error {
+	if budget <= 0 {
+		if _, err := db.Exec("DELETE FROM settings WHERE key = ?", budgetSettingKey); err != nil {
+			return fmt.Errorf("清除全局预算失败: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := db.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)", budgetSettingKey, strconv.FormatInt(budget, 10)); err != nil {
+		return fmt.Errorf("设置全局预算失败: %w", err)
+	}
+	return nil
+}
+
+// IsInDir 判断路径是否位于指定目录下(包括目录本身)
+func IsInDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// TaskUsage 表示一个任务的备份空间占用
+type TaskUsage struct {
+	TaskID     int             // 任务ID
+	TaskName   string          // 任务名
+	Policy     RetentionPolicy // 保留策略
+	InDataDir  bool            // 备份目录是否位于数据目录下, 仅此类任务计入全局预算
+	Versions   int             // 成功的版本数
+	Size       int64           // 当前占用(字节)
+	LatestSize int64           // 最新成功版本的大小(字节)
+	Projected  int64           // 预计下次备份并执行保留策略后的占用(字节)
+}
+
+// CollectUsage 统计所有任务的备份空间占用, 并按最新版本的大小预测下次备份后的占用
+// 参数:
+//   - db: 数据库连接
+//   - dataDir: 数据目录, 用于判断任务是否计入全局预算
+//   - now: 当前时间
+//
+// 返回值:
+//   - []TaskUsage: 按任务ID排列的空间占用
+//   - error: 查询失败时返回错误
+func CollectUsage(db *sqlx.DB, dataDir string, now time.Time) ([]TaskUsage, error) {
+	var tasks globals.BackupTasks
+	querySql := "SELECT task_id, task_name, backup_directory, retention_count, retention_days, retention_size, keep_hourly, keep_daily, keep_weekly, keep_monthly, keep_yearly FROM backup_tasks ORDER BY task_id"
+	if err := db.Select(&tasks, querySql); err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+
+	var usages []TaskUsage
+	for _, task := range tasks {
+		usage := TaskUsage{
+			TaskID:    task.TaskID,
+			TaskName:  task.TaskName,
+			Policy:    NewRetentionPolicy(task),
+			InDataDir: IsInDir(dataDir, task.BackupDirectory),
+		}
+
+		plan, err := PlanRetention(db, task.TaskID, usage.Policy, now)
+		if err != nil {
+			return nil, err
+		}
+
+		// 统计当前占用
+		items := make([]RetentionItem, 0, len(plan.Decisions)+1)
+		for _, decision := range plan.Decisions {
+			usage.Size += decision.Size
+			items = append(items, decision.RetentionItem)
+		}
+		usage.Versions = len(plan.Decisions)
+		if len(plan.Decisions) > 0 {
+			usage.LatestSize = plan.Decisions[0].Size
+		}
+
+		// 假设下次备份与最新版本大小相同, 计算执行保留策略后的占用
+		items = append(items, RetentionItem{Time: now, Size: usage.LatestSize})
+		for _, decision := range EvaluateRetention(items, usage.Policy, now) {
+			if decision.Keep {
+				usage.Projected += decision.Size
+			}
+		}
+
+		usages = append(usages, usage)
+	}
+
+	return usages, nil
+}
+
+// BudgetPlan 表示按全局预算清理版本的计划
+type BudgetPlan struct {
+	Budget  int64                  // 全局预算(字节)
+	Usage   int64                  // 当前数据目录的占用(字节)
+	Remove  []globals.BackupRecord // 需要清理的版本, 按备份时间从旧到新排列
+	Release int64                  // 清理后释放的空间(字节)
+}
+
+// PlanBudget 计算为满足全局预算需要清理的版本
+// 从所有位于数据目录下的成功版本中按备份时间从旧到新选择, 固定的版本和每个任务最新的成功版本不会被清理
+// 参数:
+//   - db: 数据库连接
+//   - dataDir: 数据目录
+//   - budget: 全局预算(字节)
+//
+// 返回值:
+//   - BudgetPlan: 清理计划, 未超出预算时不包含任何版本
+//   - error: 查询失败时返回错误
+func PlanBudget(db *sqlx.DB, dataDir string, budget int64) (BudgetPlan, error) {
+	plan := BudgetPlan{Budget: budget}
+
+	var records globals.BackupRecords
+	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, label, note, size_bytes, run_status FROM backup_records WHERE " + SuccessStatusSql + " AND backup_file_name != ? ORDER BY timestamp ASC, rowid ASC"
+	if err := db.Select(&records, querySql, MirrorFileName); err != nil {
+		return plan, fmt.Errorf("查询备份记录失败: %w", err)
+	}
+
+	// 统计数据目录的占用, 并记录每个任务最新的版本
+	type candidate struct {
+		record globals.BackupRecord
+		size   int64
+	}
+	var candidates []candidate
+	latest := make(map[int]string)
+	for _, record := range records {
+		if !IsInDir(dataDir, record.BackupPath) {
+			continue
+		}
+		size := VersionFileSize(record)
+		plan.Usage += size
+		candidates = append(candidates, candidate{record: record, size: size})
+		latest[record.TaskID] = record.VersionID
+	}
+
+	if budget <= 0 || plan.Usage <= budget {
+		return plan, nil
+	}
+
+	// 从最旧的版本开始清理, 直到满足预算
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].record.Timestamp < candidates[j].record.Timestamp
+	})
+	for _, c := range candidates {
+		if plan.Usage-plan.Release <= budget {
+			break
+		}
+		if c.record.Pinned || latest[c.record.TaskID] == c.record.VersionID {
+			continue
+		}
+		plan.Remove = append(plan.Remove, c.record)
+		plan.Release += c.size
+	}
+
+	return plan, nil
+}
+
+// ProjectBudgetUsage 预测运行指定任务后数据目录的占用
+// 假设本次备份与该任务最新的成功版本大小相同, 不考虑保留策略的清理
+// 参数:
+//   - db: 数据库连接
+//   - dataDir: 数据目录
+//   - taskID: 即将运行的任务ID
+//   - backupDir: 任务的备份目录
+//
+// 返回值:
+//   - int64: 当前数据目录的占用(字节)
+//   - int64: 预计本次备份后数据目录的占用(字节)
+//   - error: 查询失败时返回错误
+func ProjectBudgetUsage(db *sqlx.DB, dataDir string, taskID int, backupDir string) (int64, int64, error) {
+	plan, err := PlanBudget(db, dataDir, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 备份目录不在数据目录下时不影响全局预算
+	if !IsInDir(dataDir, backupDir) {
+		return plan.Usage, plan.Usage, nil
+	}
+
+	var latest globals.BackupRecord
+	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, label, note, size_bytes, run_status FROM backup_records WHERE task_id = ? AND " + SuccessStatusSql + " AND backup_file_name != ? ORDER BY timestamp DESC, rowid DESC LIMIT 1"
+	if err := db.Get(&latest, querySql, taskID, MirrorFileName); err == sql.ErrNoRows {
+		return plan.Usage, plan.Usage, nil
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("查询最新的备份记录失败: %w", err)
+	}
+
+	return plan.Usage, plan.Usage + VersionFileSize(latest), nil
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 测试使用的备份记录表, 只包含清理版本时查询的列
+const testRecordsSchema = `CREATE TABLE backup_records (
+    version_id TEXT PRIMARY KEY,
+    task_id INTEGER,
+    timestamp TEXT,
+    task_name TEXT,
+    backup_file_name TEXT,
+    backup_path TEXT,
+    version_hash TEXT,
+    pinned INTEGER DEFAULT 0,
+    label TEXT DEFAULT '',
+    note TEXT DEFAULT '',
+    size_bytes INTEGER DEFAULT 0,
+    run_status TEXT DEFAULT ''
+)`
+
+// newRecordsDB 在临时目录中创建只有备份记录表的数据库
+func newRecordsDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "cbk.db"))
+	if err != nil {
+		t.Fatalf("连接数据库失败: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec(testRecordsSchema); err != nil {
+		t.Fatalf("创建备份记录表失败: %v", err)
+	}
+	return db
+}
+
+// testVersion 表示测试中的一个备份版本
+type testVersion struct {
+	id     string
+	taskID int
+	time   string // 备份时间, 格式为 20060102150405
+	status string // 运行状态
+	dir    string // 备份目录
+	size   int    // 备份文件大小(字节), 小于0时不创建文件
+	pinned bool
+}
+
+// addVersions 写入备份记录并在备份目录中创建对应大小的备份文件
+func addVersions(t *testing.T, db *sqlx.DB, versions ...testVersion) {
+	t.Helper()
+	for _, v := range versions {
+		name := v.id + ".zip"
+		if v.size >= 0 {
+			if err := os.MkdirAll(v.dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(v.dir, name), make([]byte, v.size), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := db.Exec("INSERT INTO backup_records (version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, size_bytes, run_status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			v.id, v.taskID, v.time, "task", name, v.dir, "-", v.pinned, max(v.size, 0), v.status)
+		if err != nil {
+			t.Fatalf("写入备份记录失败: %v", err)
+		}
+	}
+}
+
+// removedIDs 返回清理计划中的版本ID
+func removedIDs(plan BudgetPlan) string {
+	var ids []string
+	for _, record := range plan.Remove {
+		ids = append(ids, record.VersionID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestPlanBudget(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	taskA := filepath.Join(dataDir, "a")
+	taskB := filepath.Join(dataDir, "b")
+	outside := filepath.Join(root, "outside")
+
+	db := newRecordsDB(t)
+	addVersions(t, db,
+		testVersion{id: "a1", taskID: 1, time: "20250101000000", status: globals.RunStatusSuccess, dir: taskA, size: 100},
+		testVersion{id: "a2", taskID: 1, time: "20250102000000", status: globals.RunStatusSuccess, dir: taskA, size: 100, pinned: true},
+		testVersion{id: "a3", taskID: 1, time: "20250103000000", status: globals.RunStatusSuccess, dir: taskA, size: 100},
+		testVersion{id: "a4", taskID: 1, time: "20250104000000", status: globals.RunStatusSuccess, dir: taskA, size: 100},
+		testVersion{id: "b1", taskID: 2, time: "20250101120000", status: globals.RunStatusSuccess, dir: taskB, size: 50},
+		testVersion{id: "b2", taskID: 2, time: "20250105000000", status: globals.RunStatusUnchanged, dir: taskB, size: 50},
+		testVersion{id: "af", taskID: 1, time: "20250106000000", status: globals.RunStatusFailed, dir: taskA, size: -1},
+		testVersion{id: "o1", taskID: 3, time: "20241201000000", status: globals.RunStatusSuccess, dir: outside, size: 1000},
+	)
+
+	tests := []struct {
+		name    string
+		budget  int64
+		usage   int64
+		remove  string
+		release int64
+	}{
+		// 数据目录外的版本和失败的记录不计入占用, 无变化的版本同样有备份文件, 计入占用
+		{name: "未设置预算", budget: 0, usage: 500},
+		{name: "未超出预算", budget: 500, usage: 500},
+		// 从最旧的版本开始清理, 直到满足预算
+		{name: "清理最旧的版本", budget: 450, usage: 500, remove: "a1", release: 100},
+		{name: "跨任务按时间清理", budget: 320, usage: 500, remove: "a1,b1,a3", release: 250},
+		// 固定的版本和每个任务最新的版本不会被清理, 无法满足预算时尽量清理
+		{name: "无法满足预算", budget: 10, usage: 500, remove: "a1,b1,a3", release: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanBudget(db, dataDir, tt.budget)
+			if err != nil {
+				t.Fatalf("PlanBudget() 返回错误: %v", err)
+			}
+			if plan.Usage != tt.usage {
+				t.Errorf("占用 = %d, 期望 %d", plan.Usage, tt.usage)
+			}
+			if got := removedIDs(plan); got != tt.remove {
+				t.Errorf("清理的版本 = %q, 期望 %q", got, tt.remove)
+			}
+			if plan.Release != tt.release {
+				t.Errorf("释放的空间 = %d, 期望 %d", plan.Release, tt.release)
+			}
+		})
+	}
+}
+
+func TestVersionFileSizeRemote(t *testing.T) {
+	// 远程存储的版本使用备份记录中的字节数
+	record := globals.BackupRecord{BackupFileName: "docs_1.zip", BackupPath: "s3://bucket/cbk", SizeBytes: 12345, RunStatus: globals.RunStatusSuccess}
+	if got := VersionFileSize(record); got != 12345 {
+		t.Errorf("VersionFileSize() = %d, 期望 12345", got)
+	}
+}
+
+func TestIsInDir(t *testing.T) {
+	dir := filepath.Join("/data", "cbk")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join("/data", "cbk"), true},
+		{filepath.Join("/data", "cbk", "docs"), true},
+		{filepath.Join("/data", "cbk", "..cache"), true},
+		{filepath.Join("/data", "cbk2"), false},
+		{filepath.Join("/data"), false},
+		{filepath.Join("/other"), false},
+	}
+	for _, tt := range tests {
+		if got := IsInDir(dir, tt.path); got != tt.want {
+			t.Errorf("IsInDir(%q, %q) = %v, 期望 %v", dir, tt.path, got, tt.want)
+		}
+	}
+}
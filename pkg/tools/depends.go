@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SplitDepends 将逗号分隔的前置任务ID列表拆分为切片, 无效的项会被忽略
+func SplitDepends(depends string) []int {
+	var ids []int
+	for _, item := range strings.Split(depends, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(item)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// JoinDepends 将前置任务ID列表拼接为逗号分隔的字符串
+func JoinDepends(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+// DependencyOrder 返回指定任务及其所有前置任务, 前置任务排在依赖它的任务之前
+// 没有依赖关系的任务保持指定的顺序, 重复的任务只返回一次
+// 参数:
+//   - deps: 依赖关系, 键为任务ID, 值为该任务的前置任务ID列表
+//   - roots: 要运行的任务ID列表
+//
+// 返回值:
+//   - []int: 按依赖顺序排列的任务ID列表
+//   - error: 依赖关系中存在循环时返回错误
+func DependencyOrder(deps map[int][]int, roots []int) ([]int, error) {
+	const (
+		visiting = 1 // 正在访问, 再次遇到说明存在循环
+		visited  = 2 // 已加入结果
+	)
+
+	state := make(map[int]int)
+	var order, path []int
+	var visit func(id int) error
+	visit = func(id int) error {
+		switch state[id] {
+		case visited:
+			return nil
+		case visiting:
+			return &CycleError{Path: cyclePath(path, id)}
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range deps[id] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		order = append(order, id)
+		return nil
+	}
+
+	for _, id := range roots {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// FindCycle 检查从指定任务出发的依赖关系中是否存在循环
+// 返回值:
+//   - []int: 构成循环的任务ID, 首尾相同, 不存在循环时返回nil
+func FindCycle(deps map[int][]int, start int) []int {
+	if _, err := DependencyOrder(deps, []int{start}); err != nil {
+		if cycle, ok := err.(*CycleError); ok {
+			return cycle.Path
+		}
+	}
+	return nil
+}
+
+// CycleError 表示任务的依赖关系中存在循环
+type CycleError struct {
+	Path []int // 构成循环的任务ID, 首尾相同
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("任务的依赖关系存在循环: %s", strings.ReplaceAll(JoinDepends(e.Path), ",", " -> "))
+}
+
+// cyclePath 从访问路径中截取构成循环的部分
+func cyclePath(path []int, id int) []int {
+	for i, p := range path {
+		if p == id {
+			cycle := append([]int{}, path[i:]...)
+			return append(cycle, id)
+		}
+	}
+	return []int{id, id}
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		deps  map[int][]int
+		roots []int
+		want  []int
+	}{
+		{"没有依赖", nil, []int{3, 1, 2}, []int{3, 1, 2}},
+		{"前置任务排在前面", map[int][]int{1: {2}, 2: {3}}, []int{1}, []int{3, 2, 1}},
+		{"多个前置任务保持顺序", map[int][]int{1: {3, 2}}, []int{1}, []int{3, 2, 1}},
+		{"共同的前置任务只返回一次", map[int][]int{1: {3}, 2: {3}}, []int{1, 2}, []int{3, 1, 2}},
+		{"菱形依赖", map[int][]int{1: {2, 3}, 2: {4}, 3: {4}}, []int{1}, []int{4, 2, 3, 1}},
+		{"指定的任务是其他任务的前置任务", map[int][]int{1: {2}}, []int{2, 1}, []int{2, 1}},
+		{"重复指定", nil, []int{1, 1}, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DependencyOrder(tt.deps, tt.roots)
+			if err != nil {
+				t.Fatalf("DependencyOrder 返回错误: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DependencyOrder = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependencyOrderCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		deps  map[int][]int
+		roots []int
+		want  []int // 构成循环的任务ID
+	}{
+		{"依赖自身", map[int][]int{1: {1}}, []int{1}, []int{1, 1}},
+		{"两个任务相互依赖", map[int][]int{1: {2}, 2: {1}}, []int{1}, []int{1, 2, 1}},
+		{"循环不包含指定的任务", map[int][]int{1: {2}, 2: {3}, 3: {4}, 4: {2}}, []int{1}, []int{2, 3, 4, 2}},
+		{"第二个任务存在循环", map[int][]int{2: {3}, 3: {2}}, []int{1, 2}, []int{2, 3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := DependencyOrder(tt.deps, tt.roots)
+			var cycle *CycleError
+			if !errors.As(err, &cycle) {
+				t.Fatalf("DependencyOrder = %v, %v, 期望返回 CycleError", order, err)
+			}
+			if !reflect.DeepEqual(cycle.Path, tt.want) {
+				t.Errorf("循环路径 = %v, 期望 %v", cycle.Path, tt.want)
+			}
+			if got := FindCycle(tt.deps, tt.roots[len(tt.roots)-1]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindCycle = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := FindCycle(map[int][]int{1: {2}, 2: {3}}, 1); got != nil {
+		t.Errorf("没有循环时 FindCycle = %v, 期望 nil", got)
+	}
+}
+
+func TestSplitDepends(t *testing.T) {
+	if got, want := SplitDepends(" 1, 2,x,,3 "), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitDepends = %v, 期望 %v", got, want)
+	}
+	if got := JoinDepends([]int{1, 2, 3}); got != "1,2,3" {
+		t.Errorf("JoinDepends = %q, 期望 %q", got, "1,2,3")
+	}
+}
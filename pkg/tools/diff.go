@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 条目变更类型
+const (
+	ChangeAdded      = "added"      // 新增
+	ChangeRemoved    = "removed"    // 删除
+	ChangeModified   = "modified"   // 内容或修改时间变更
+	ChangePermission = "permission" // 仅权限变更
+)
+
+// 比较修改时间时使用的精度, ZIP 中的修改时间精确到秒
+const timeGranularity = time.Second
+
+// EntryChange 表示两个版本之间一个条目的变更
+type EntryChange struct {
+	Name        string        `json:"name"`                   // 条目路径
+	Kind        string        `json:"kind"`                   // 变更类型
+	IsDir       bool          `json:"is_dir"`                 // 是否为目录
+	Old         *ArchiveEntry `json:"-"`                      // 旧版本中的条目
+	New         *ArchiveEntry `json:"-"`                      // 新版本中的条目
+	OldSize     int64         `json:"old_size"`               // 旧版本中的大小
+	NewSize     int64         `json:"new_size"`               // 新版本中的大小
+	OldMode     string        `json:"old_mode,omitempty"`     // 旧版本中的权限
+	NewMode     string        `json:"new_mode,omitempty"`     // 新版本中的权限
+	SizeChanged bool          `json:"size_changed,omitempty"` // 大小是否变更
+	TimeChanged bool          `json:"time_changed,omitempty"` // 修改时间是否变更
+	HashChanged bool          `json:"hash_changed,omitempty"` // 内容哈希是否变更
+	ModeChanged bool          `json:"mode_changed,omitempty"` // 权限是否变更
+}
+
+// SizeDelta 返回条目大小的变化量
+func (c EntryChange) SizeDelta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+// DiffSummary 汇总两个版本之间的变更
+type DiffSummary struct {
+	Added         int   `json:"added"`          // 新增条目数
+	Removed       int   `json:"removed"`        // 删除条目数
+	Modified      int   `json:"modified"`       // 修改条目数
+	Permission    int   `json:"permission"`     // 仅权限变更的条目数
+	AddedBytes    int64 `json:"added_bytes"`    // 新增文件的总大小
+	RemovedBytes  int64 `json:"removed_bytes"`  // 删除文件的总大小
+	ModifiedDelta int64 `json:"modified_delta"` // 修改文件的大小变化量
+	TotalDelta    int64 `json:"total_delta"`    // 总大小变化量
+}
+
+// DiffEntries 比较两个版本的条目列表
+// 参数:
+//   - oldEntries: 旧版本的条目列表(按路径排序)
+//   - newEntries: 新版本的条目列表(按路径排序)
+//
+// 返回值:
+//   - []EntryChange: 按路径排序的变更列表
+//   - DiffSummary: 变更汇总
+func DiffEntries(oldEntries, newEntries []ArchiveEntry) ([]EntryChange, DiffSummary) {
+	var changes []EntryChange
+	var summary DiffSummary
+
+	i, j := 0, 0
+	for i < len(oldEntries) || j < len(newEntries) {
+		switch {
+		case j >= len(newEntries) || (i < len(oldEntries) && oldEntries[i].Name < newEntries[j].Name):
+			// 仅存在于旧版本
+			old := oldEntries[i]
+			changes = append(changes, EntryChange{Name: old.Name, Kind: ChangeRemoved, IsDir: old.IsDir, Old: &old, OldSize: fileSize(old), OldMode: old.Mode.String()})
+			i++
+		case i >= len(oldEntries) || newEntries[j].Name < oldEntries[i].Name:
+			// 仅存在于新版本
+			cur := newEntries[j]
+			changes = append(changes, EntryChange{Name: cur.Name, Kind: ChangeAdded, IsDir: cur.IsDir, New: &cur, NewSize: fileSize(cur), NewMode: cur.Mode.String()})
+			j++
+		default:
+			// 两个版本中都存在
+			old, cur := oldEntries[i], newEntries[j]
+			if change, changed := compareEntry(old, cur); changed {
+				changes = append(changes, change)
+			}
+			i++
+			j++
+		}
+	}
+
+	// 汇总变更
+	for _, change := range changes {
+		switch change.Kind {
+		case ChangeAdded:
+			summary.Added++
+			summary.AddedBytes += change.NewSize
+		case ChangeRemoved:
+			summary.Removed++
+			summary.RemovedBytes += change.OldSize
+		case ChangeModified:
+			summary.Modified++
+			summary.ModifiedDelta += change.SizeDelta()
+		case ChangePermission:
+			summary.Permission++
+		}
+	}
+	summary.TotalDelta = summary.AddedBytes - summary.RemovedBytes + summary.ModifiedDelta
+
+	return changes, summary
+}
+
+// compareEntry 比较同一路径在两个版本中的条目
+func compareEntry(old, cur ArchiveEntry) (EntryChange, bool) {
+	change := EntryChange{
+		Name:    cur.Name,
+		IsDir:   cur.IsDir,
+		Old:     &old,
+		New:     &cur,
+		OldSize: fileSize(old),
+		NewSize: fileSize(cur),
+		OldMode: old.Mode.String(),
+		NewMode: cur.Mode.String(),
+	}
+
+	// 类型变化(文件与目录互换)视为修改
+	if old.IsDir != cur.IsDir {
+		change.Kind = ChangeModified
+		change.SizeChanged = change.OldSize != change.NewSize
+		change.ModeChanged = true
+		return change, true
+	}
+
+	// 推断出的目录没有权限信息, 不参与比较
+	if !old.Implicit && !cur.Implicit {
+		change.ModeChanged = old.Mode != cur.Mode
+	}
+
+	// 目录仅比较权限, 忽略修改时间
+	if !cur.IsDir {
+		change.SizeChanged = old.Size != cur.Size
+		change.HashChanged = old.CRC32 != cur.CRC32
+	}
+
+	// 软链接等特殊文件在备份中不记录修改时间, 仅比较普通文件的修改时间
+	if old.Mode.IsRegular() && cur.Mode.IsRegular() {
+		change.TimeChanged = !old.ModTime.Truncate(timeGranularity).Equal(cur.ModTime.Truncate(timeGranularity))
+	}
+
+	switch {
+	case change.SizeChanged || change.HashChanged || change.TimeChanged:
+		change.Kind = ChangeModified
+	case change.ModeChanged:
+		change.Kind = ChangePermission
+	default:
+		return change, false
+	}
+	return change, true
+}
+
+// fileSize 返回条目的文件大小, 目录视为0
+func fileSize(entry ArchiveEntry) int64 {
+	if entry.IsDir {
+		return 0
+	}
+	return entry.Size
+}
+
+// IsText 判断内容是否为文本(不含NUL字节且为合法的UTF-8)
+func IsText(data []byte) bool {
+	sample := data
+	if len(sample) > 8*1024 {
+		sample = sample[:8*1024]
+
+		// 截断处可能位于多字节字符中间, 去掉末尾不完整的字符
+		for k := len(sample) - 1; k >= 0 && k >= len(sample)-utf8.UTFMax; k-- {
+			if utf8.RuneStart(sample[k]) {
+				if !utf8.FullRune(sample[k:]) {
+					sample = sample[:k]
+				}
+				break
+			}
+		}
+	}
+	return bytes.IndexByte(sample, 0) < 0 && utf8.Valid(sample)
+}
+
+// diffOp 表示编辑脚本中的一步操作
+type diffOp struct {
+	kind byte // ' ' 表示相同, '-' 表示删除, '+' 表示新增
+	line string
+}
+
+// UnifiedDiff 生成两段文本的统一格式差异
+// 参数:
+//   - oldName: 旧文件名
+//   - newName: 新文件名
+//   - oldText: 旧文本
+//   - newText: 新文本
+//   - context: 上下文行数
+//
+// 返回值:
+//   - string: 统一格式的差异, 文本相同时返回空字符串
+func UnifiedDiff(oldName, newName, oldText, newText string, context int) string {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+	ops := myersDiff(oldLines, newLines)
+
+	// 找出所有变更的位置
+	var changed []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "--- %s\n+++ %s\n", oldName, newName)
+
+	// 按上下文合并相邻的变更为多个块
+	for start := 0; start < len(changed); {
+		end := start
+		for end+1 < len(changed) && changed[end+1]-changed[end] <= 2*context {
+			end++
+		}
+		from := max(changed[start]-context, 0)
+		to := min(changed[end]+context+1, len(ops))
+
+		// 计算块的起始行号和行数
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldStart++
+			}
+			if op.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+
+		fmt.Fprintf(&builder, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, op := range ops[from:to] {
+			builder.WriteByte(op.kind)
+			builder.WriteString(op.line)
+			builder.WriteByte('\n')
+		}
+
+		start = end + 1
+	}
+
+	return builder.String()
+}
+
+// splitLines 按行分割文本, 忽略末尾的换行符
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// 编辑距离超过该值时不再计算最短编辑脚本, 直接视为整体替换
+const maxDiffEdits = 4000
+
+// myersDiff 使用 Myers 算法计算两组行之间的最短编辑脚本
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] 保存第 d 步开始前对角线 -d..d 的状态, 用于回溯
+	var trace [][]int
+	found := false
+
+	// 前向搜索
+search:
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+
+	// 差异过大时整体替换
+	if !found {
+		ops := make([]diffOp, 0, n+m)
+		for _, line := range a {
+			ops = append(ops, diffOp{kind: '-', line: line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{kind: '+', line: line})
+		}
+		return ops
+	}
+
+	// 从终点回溯得到编辑脚本
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{kind: ' ', line: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{kind: '+', line: b[y-1]})
+			} else {
+				ops = append(ops, diffOp{kind: '-', line: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	// 反转为正序
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
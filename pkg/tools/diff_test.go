@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// applyOps 根据编辑脚本还原旧文本和新文本的行
+func applyOps(ops []diffOp) (oldLines, newLines []string) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldLines = append(oldLines, op.line)
+		}
+		if op.kind != '-' {
+			newLines = append(newLines, op.line)
+		}
+	}
+	return oldLines, newLines
+}
+
+// countEdits 统计编辑脚本中新增和删除的行数
+func countEdits(ops []diffOp) int {
+	edits := 0
+	for _, op := range ops {
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	return edits
+}
+
+// numberedLines 生成 prefix0, prefix1, ... 形式的行
+func numberedLines(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return lines
+}
+
+func TestMyersDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		edits int // 最短编辑脚本的新增和删除行数
+	}{
+		{"都为空", nil, nil, 0},
+		{"旧为空", nil, []string{"a", "b"}, 2},
+		{"新为空", []string{"a", "b"}, nil, 2},
+		{"相同", []string{"a", "b", "c"}, []string{"a", "b", "c"}, 0},
+		{"插入", []string{"a", "c"}, []string{"a", "b", "c"}, 1},
+		{"删除", []string{"a", "b", "c"}, []string{"a", "c"}, 1},
+		{"替换", []string{"a", "b", "c"}, []string{"a", "x", "c"}, 2},
+		{"开头和结尾", []string{"a", "b", "c"}, []string{"b", "c", "d"}, 2},
+		{"经典示例", strings.Split("ABCABBA", ""), strings.Split("CBABAC", ""), 5},
+		{"重复行", []string{"x", "x", "x"}, []string{"x", "x"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := myersDiff(tt.a, tt.b)
+			oldLines, newLines := applyOps(ops)
+			if strings.Join(oldLines, "\n") != strings.Join(tt.a, "\n") || len(oldLines) != len(tt.a) {
+				t.Errorf("还原的旧文本 = %q, 期望 %q", oldLines, tt.a)
+			}
+			if strings.Join(newLines, "\n") != strings.Join(tt.b, "\n") || len(newLines) != len(tt.b) {
+				t.Errorf("还原的新文本 = %q, 期望 %q", newLines, tt.b)
+			}
+			if got := countEdits(ops); got != tt.edits {
+				t.Errorf("编辑行数 = %d, 期望 %d", got, tt.edits)
+			}
+		})
+	}
+}
+
+func TestMyersDiffLimit(t *testing.T) {
+	// 行数之和超过上限但差异很小时, 仍然计算最短编辑脚本
+	a := numberedLines("line", 3000)
+	b := append([]string(nil), a...)
+	b[1500] = "changed"
+	ops := myersDiff(a, b)
+	if got := countEdits(ops); got != 2 {
+		t.Errorf("小差异的编辑行数 = %d, 期望 2", got)
+	}
+
+	// 编辑距离超过上限时整体替换: 先删除所有旧行, 再新增所有新行
+	a = numberedLines("old", maxDiffEdits/2+50)
+	b = numberedLines("new", maxDiffEdits/2+50)
+	ops = myersDiff(a, b)
+	if len(ops) != len(a)+len(b) {
+		t.Fatalf("整体替换的操作数 = %d, 期望 %d", len(ops), len(a)+len(b))
+	}
+	for i, op := range ops {
+		want := byte('-')
+		if i >= len(a) {
+			want = '+'
+		}
+		if op.kind != want {
+			t.Fatalf("第 %d 个操作为 %q, 期望 %q", i, op.kind, want)
+		}
+	}
+	oldLines, newLines := applyOps(ops)
+	if len(oldLines) != len(a) || len(newLines) != len(b) || oldLines[0] != a[0] || newLines[len(b)-1] != b[len(b)-1] {
+		t.Errorf("整体替换无法还原原始文本")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     string
+	}{
+		{
+			name: "相同",
+			old:  "a\nb\n", new: "a\nb\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name: "忽略末尾换行符",
+			old:  "a\nb", new: "a\nb\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name: "空文件新增内容",
+			old:  "", new: "a\nb\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "删除全部内容",
+			old:  "a\nb\n", new: "",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "修改一行",
+			old:  "a\nb\nc\n", new: "a\nx\nc\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "纯插入",
+			old:  "a\nc\n", new: "a\nb\nc\n",
+			context: 0,
+			want:    "--- old\n+++ new\n@@ -1,0 +2,1 @@\n+b\n",
+		},
+		{
+			name: "相距较远的变更分为两个块",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n", new: "x\n2\n3\n4\n5\n6\n7\ny\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("old", "new", tt.old, tt.new, tt.context); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\n期望\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	// 多字节字符跨越 8KB 采样边界时, 截断处不完整的字符不影响判断
+	boundary := strings.Repeat("a", 8*1024-1) + "中文"
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"空内容", nil, true},
+		{"ASCII", []byte("hello\nworld\n"), true},
+		{"UTF-8", []byte("你好, 世界"), true},
+		{"NUL字节", []byte("abc\x00def"), false},
+		{"非法UTF-8", []byte{0xff, 0xfe, 'a'}, false},
+		{"采样边界处的多字节字符", []byte(boundary), true},
+		{"采样范围之后的NUL字节", []byte(strings.Repeat("a", 9*1024) + "\x00"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsText(tt.data); got != tt.want {
+				t.Errorf("IsText() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package tools
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner 将文件的所有者设置为与源文件相同, 没有权限修改所有者时忽略
+func preserveOwner(path string, info os.FileInfo) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Lchown(path, int(stat.Uid), int(stat.Gid))
+	}
+}
+
+// sameOwner 判断两个文件的所有者是否相同
+func sameOwner(a, b os.FileInfo) bool {
+	sa, ok := a.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	sb, ok := b.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	return sa.Uid == sb.Uid && sa.Gid == sb.Gid
+}
+
+// linkCount 返回文件的硬链接数, 无法获取时返回1
+func linkCount(info os.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink > 0 {
+		return int64(stat.Nlink)
+	}
+	return 1
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package tools
+
+import "os"
+
+// preserveOwner Windows 上不同步文件的所有者
+func preserveOwner(string, os.FileInfo) {}
+
+// sameOwner Windows 上不比较文件的所有者
+func sameOwner(os.FileInfo, os.FileInfo) bool {
+	return true
+}
+
+// linkCount Windows 上不统计硬链接数, 总是返回1
+func linkCount(os.FileInfo) int64 {
+	return 1
+}
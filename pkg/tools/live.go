@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dirVersionReader 基于磁盘目录的版本读取器, 用于将当前目录内容与备份版本进行比较
+type dirVersionReader struct {
+	root    string            // 目标路径的父目录, 条目路径相对于该目录
+	entries []ArchiveEntry    // 按路径排序的条目列表
+	links   map[string]string // 软链接条目及其目标
+}
+
+// OpenDirReader 按照与备份相同的规则遍历目标路径, 生成与备份版本路径一致的条目列表
+// 参数:
+//   - sourceDir: 要遍历的目标路径(目录或文件)
+//   - excludeFunc: 排除函数, 为nil时不排除任何文件
+//
+// 返回值:
+//   - VersionReader: 版本读取器, 条目中的 CRC32 需要通过 FillChecksums 计算
+//   - error: 遍历失败时返回错误
+func OpenDirReader(sourceDir string, excludeFunc globals.ExcludeFunc) (VersionReader, error) {
+	absPath, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("获取目标路径的绝对路径失败: %w", err)
+	}
+	if excludeFunc == nil {
+		excludeFunc = globals.NoExcludeFunc
+	}
+
+	r := &dirVersionReader{
+		root:  filepath.Dir(absPath),
+		links: make(map[string]string),
+	}
+
+	// 遍历目标路径, 与 CreateZip 保持相同的排除和路径规则
+	err = filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("遍历目录时出错: %w", err)
+		}
+
+		// 检查是否需要跳过当前文件或目录
+		if excludeFunc(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 获取相对路径, 保留顶层目录
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return fmt.Errorf("获取相对路径失败: %w", err)
+		}
+		name := CleanEntryPath(filepath.ToSlash(rel))
+
+		entry := ArchiveEntry{
+			Name:    name,
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsRegular():
+			entry.Size = info.Size()
+		case mode&os.ModeSymlink != 0:
+			// 软链接在备份中以链接目标作为内容
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("读取软链接目标失败: %w", err)
+			}
+			r.links[name] = target
+			entry.Size = int64(len(target))
+			entry.CRC32 = crc32.ChecksumIEEE([]byte(target))
+		}
+
+		r.entries = append(r.entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(r.entries, func(i, j int) bool {
+		return r.entries[i].Name < r.entries[j].Name
+	})
+
+	return r, nil
+}
+
+// Entries 返回按路径排序的所有条目
+func (r *dirVersionReader) Entries() []ArchiveEntry {
+	return r.entries
+}
+
+// Open 打开指定路径的文件, 软链接返回其链接目标
+func (r *dirVersionReader) Open(name string) (io.ReadCloser, error) {
+	name = CleanEntryPath(name)
+	if target, ok := r.links[name]; ok {
+		return io.NopCloser(strings.NewReader(target)), nil
+	}
+	return os.Open(filepath.Join(r.root, filepath.FromSlash(name)))
+}
+
+// Close 目录读取器不持有资源
+func (r *dirVersionReader) Close() error {
+	return nil
+}
+
+// FillChecksums 计算目录读取器中普通文件的 CRC32
+// 参数:
+//   - reader: 由 OpenDirReader 打开的读取器
+//   - reference: 用于比较的备份版本条目列表(按路径排序)
+//   - full: 为 false 时, 大小和修改时间都与备份一致的文件直接沿用备份中的 CRC32, 不读取内容
+//
+// 返回值:
+//   - error: 读取文件失败时返回错误
+func FillChecksums(reader VersionReader, reference []ArchiveEntry, full bool) error {
+	entries := reader.Entries()
+	for i := range entries {
+		entry := &entries[i]
+		if !entry.Mode.IsRegular() {
+			continue
+		}
+
+		// 快速检查: 大小和修改时间相同时认为内容未变化
+		if !full {
+			if ref, ok := FindEntry(reference, entry.Name); ok && ref.Mode.IsRegular() && ref.Size == entry.Size &&
+				ref.ModTime.Truncate(timeGranularity).Equal(entry.ModTime.Truncate(timeGranularity)) {
+				entry.CRC32 = ref.CRC32
+				continue
+			}
+		}
+
+		// 读取文件内容计算 CRC32
+		rc, err := reader.Open(entry.Name)
+		if err != nil {
+			return fmt.Errorf("打开文件 %s 失败: %w", entry.Name, err)
+		}
+		hash := crc32.NewIEEE()
+		_, err = io.CopyBuffer(hash, rc, make([]byte, getBufferSize(entry.Size)))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("读取文件 %s 失败: %w", entry.Name, err)
+		}
+		entry.CRC32 = hash.Sum32()
+	}
+	return nil
+}
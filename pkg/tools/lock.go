@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 获取锁时锁文件被持有者删除后的最大重试次数
+const lockAttempts = 3
+
+// errLockBusy 表示锁文件已被其他进程锁定
+var errLockBusy = errors.New("锁文件已被其他进程锁定")
+
+// LockInfo 表示锁文件中记录的持有者信息
+type LockInfo struct {
+	PID     int    `json:"pid"`     // 持有锁的进程ID
+	Host    string `json:"host"`    // 持有锁的主机名
+	User    string `json:"user"`    // 持有锁的用户名
+	Command string `json:"command"` // 持有锁的命令行
+	Started string `json:"started"` // 获取锁的时间, 格式为 20060102150405
+}
+
+// String 返回持有者的描述
+func (i LockInfo) String() string {
+	started := i.Started
+	if t, err := ParseRecordTime(i.Started); err == nil {
+		started = t.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("进程 %d (用户: %s, 主机: %s, 启动于: %s, 命令: %s)", i.PID, i.User, i.Host, started, i.Command)
+}
+
+// LockedError 表示锁已被其他进程持有
+type LockedError struct {
+	Name   string   // 锁的名称
+	Path   string   // 锁文件路径
+	Holder LockInfo // 持有者信息, 锁文件无法解析时为空
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder.PID <= 0 {
+		return fmt.Sprintf("%s 已被锁定, 持有者信息正在写入, 请稍后重试", e.Name)
+	}
+	return fmt.Sprintf("%s 已被锁定, 持有者: %s", e.Name, e.Holder)
+}
+
+// FileLock 表示已获取的锁文件
+type FileLock struct {
+	path string
+	file *os.File // 持有系统文件锁的锁文件, 进程退出时由系统释放
+}
+
+// AcquireLock 打开锁文件并获取系统文件锁, 锁已被其他进程持有时返回 *LockedError
+// 系统文件锁在持有者进程退出后自动释放, 不会留下失效的锁; 锁文件的内容只用于显示持有者信息
+// 参数:
+//   - path: 锁文件路径
+//   - name: 锁的名称, 用于错误信息
+//
+// 返回值:
+//   - *FileLock: 获取到的锁, 使用完毕后需要调用 Release 释放
+//   - error: 获取失败时返回错误
+func AcquireLock(path, name string) (*FileLock, error) {
+	if err := EnsureDirExists(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("创建锁目录失败: %w", err)
+	}
+
+	data, err := json.Marshal(currentLockInfo())
+	if err != nil {
+		return nil, fmt.Errorf("序列化锁信息失败: %w", err)
+	}
+
+	for attempt := 0; attempt < lockAttempts; attempt++ {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("打开锁文件失败: %w", err)
+		}
+
+		if err := lockFile(f); err != nil {
+			_ = f.Close()
+			if !errors.Is(err, errLockBusy) {
+				return nil, fmt.Errorf("锁定锁文件失败: %w", err)
+			}
+			return nil, &LockedError{Name: name, Path: path, Holder: readLockInfo(path)}
+		}
+
+		// 打开锁文件后, 上一个持有者可能在释放锁时删除了该文件, 此时锁定的是已删除的文件, 需要重新打开
+		if !sameLockFile(f, path) {
+			_ = unlockFile(f)
+			_ = f.Close()
+			continue
+		}
+
+		// 写入持有者信息
+		if err := writeLockInfo(f, data); err != nil {
+			_ = unlockFile(f)
+			_ = f.Close()
+			return nil, fmt.Errorf("写入锁文件失败: %w", err)
+		}
+		return &FileLock{path: path, file: f}, nil
+	}
+
+	return nil, fmt.Errorf("获取 %s 的锁失败, 请稍后重试", name)
+}
+
+// Release 删除锁文件并释放系统文件锁
+func (l *FileLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := releaseLockFile(l.file, l.path)
+	l.file = nil
+	return err
+}
+
+// sameLockFile 判断已打开的锁文件是否仍是路径上的锁文件
+func sameLockFile(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// writeLockInfo 清空锁文件并写入持有者信息
+func writeLockInfo(f *os.File, data []byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt(data, 0)
+	return err
+}
+
+// readLockInfo 读取锁文件中的持有者信息, 锁文件正在写入或无法解析时返回空的持有者信息
+func readLockInfo(path string) LockInfo {
+	var holder LockInfo
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &holder)
+	}
+	return holder
+}
+
+// currentLockInfo 返回当前进程的持有者信息
+func currentLockInfo() LockInfo {
+	info := LockInfo{
+		PID:     os.Getpid(),
+		Command: strings.Join(os.Args, " "),
+		Started: time.Now().Format(TimestampLayout),
+	}
+	info.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		info.User = u.Username
+	}
+	return info
+}
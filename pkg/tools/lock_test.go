@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "task-1.lock")
+
+	lock, err := AcquireLock(path, "任务 [docs]")
+	if err != nil {
+		t.Fatalf("获取锁失败: %v", err)
+	}
+
+	// 锁被持有时再次获取返回持有者信息
+	_, err = AcquireLock(path, "任务 [docs]")
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("重复获取锁的错误 = %v, 期望 *LockedError", err)
+	}
+	if locked.Holder.PID != os.Getpid() || locked.Holder.Started == "" {
+		t.Errorf("持有者信息 = %+v", locked.Holder)
+	}
+
+	// 释放后删除锁文件, 可以再次获取
+	if err := lock.Release(); err != nil {
+		t.Fatalf("释放锁失败: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("释放后锁文件仍存在: %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("重复释放锁返回错误: %v", err)
+	}
+	lock, err = AcquireLock(path, "任务 [docs]")
+	if err != nil {
+		t.Fatalf("释放后再次获取锁失败: %v", err)
+	}
+	_ = lock.Release()
+}
+
+func TestAcquireLockLeftover(t *testing.T) {
+	// 持有者异常退出后留下的锁文件没有被锁定, 可以直接获取
+	path := filepath.Join(t.TempDir(), "task-1.lock")
+	if err := os.WriteFile(path, []byte(`{"pid":999999,"host":"other","started":"20240101000000"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := AcquireLock(path, "任务 [docs]")
+	if err != nil {
+		t.Fatalf("获取遗留的锁文件失败: %v", err)
+	}
+	defer lock.Release()
+
+	// 锁文件中的持有者信息更新为当前进程
+	if holder := readLockInfo(path); holder.PID != os.Getpid() {
+		t.Errorf("锁文件中的持有者 = %+v", holder)
+	}
+}
+
+func TestSameLockFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上无法删除已打开的文件")
+	}
+	path := filepath.Join(t.TempDir(), "task-1.lock")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !sameLockFile(f, path) {
+		t.Errorf("同一个锁文件判断为不同")
+	}
+
+	// 上一个持有者删除锁文件后, 其他进程重新创建了锁文件
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if sameLockFile(f, path) {
+		t.Errorf("已删除的锁文件判断为仍在使用")
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sameLockFile(f, path) {
+		t.Errorf("重新创建的锁文件判断为相同")
+	}
+}
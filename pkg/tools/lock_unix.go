@@ -0,0 +1,33 @@
+//go:build !windows
+
+package tools
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile 以非阻塞方式获取锁文件的排他锁, 已被其他进程锁定时返回 errLockBusy
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLockBusy
+	}
+	return err
+}
+
+// unlockFile 释放锁文件的排他锁
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// releaseLockFile 在持有锁时删除锁文件, 再关闭文件释放锁
+// 先删除再释放, 等待锁的进程获取锁后会发现文件已被删除并重新创建, 不会与下一个持有者同时持有锁
+func releaseLockFile(f *os.File, path string) error {
+	removeErr := os.Remove(path)
+	if os.IsNotExist(removeErr) {
+		removeErr = nil
+	}
+	return errors.Join(removeErr, f.Close())
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+package tools
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows 的文件锁是强制锁, 锁定的区域无法被其他进程读取, 因此锁定文件内容之外的一个字节,
+// 以便其他进程读取持有者信息
+const lockOffsetHigh = 0x7fffffff
+
+// lockFile 以非阻塞方式获取锁文件的排他锁, 已被其他进程锁定时返回 errLockBusy
+func lockFile(f *os.File) error {
+	ol := windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLockBusy
+	}
+	return err
+}
+
+// unlockFile 释放锁文件的排他锁
+func unlockFile(f *os.File) error {
+	ol := windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
+
+// releaseLockFile 关闭文件释放锁, 再删除锁文件
+// Windows 上无法删除已打开的文件, 删除前其他进程已获取锁时删除失败, 锁文件由新的持有者继续使用
+func releaseLockFile(f *os.File, path string) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	return nil
+}
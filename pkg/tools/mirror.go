@@ -0,0 +1,303 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MirrorFileName 镜像任务的运行记录没有备份文件, 备份文件名和版本哈希记为该值
+const MirrorFileName = "-"
+
+// IsMirrorRecord 判断备份记录是否为镜像任务成功同步的记录, 此类记录没有可以解压或清理的备份文件
+func IsMirrorRecord(record globals.BackupRecord) bool {
+	return IsSuccessRecord(record) && record.BackupFileName == MirrorFileName
+}
+
+// MirrorStats 表示一次镜像同步的统计信息
+type MirrorStats struct {
+	Copied  int   // 新复制的文件数
+	Updated int   // 内容或属性变化后重新同步的文件数
+	Deleted int   // 从镜像中删除的多余文件数
+	Files   int   // 目标目录中的文件数, 包括软链接
+	Dirs    int   // 目标目录中的目录数
+	Bytes   int64 // 本次复制的字节数
+	Size    int64 // 同步完成后镜像中文件的总大小(字节)
+}
+
+// String 返回统计信息的可读描述
+func (s MirrorStats) String() string {
+	return fmt.Sprintf("复制 %d, 更新 %d, 删除 %d", s.Copied, s.Updated, s.Deleted)
+}
+
+// MirrorDirectory 将目标目录同步为镜像, 只复制新增或变化的文件
+// 文件大小和修改时间都相同时视为未变化; 复制时保留权限、修改时间和所有者(权限不足时忽略所有者),
+// 软链接按原样重建, 被排除规则排除的文件既不会被复制, 也不会从镜像中删除
+// 参数:
+//   - ctx: 上下文, 取消后停止同步
+//   - source: 目标目录或文件
+//   - dest: 镜像目录
+//   - excludeFunc: 排除函数, 为nil时不排除任何文件
+//   - deleteExtra: 是否删除镜像中目标目录已不存在的文件
+//
+// 返回值:
+//   - MirrorStats: 同步的统计信息
+//   - error: 同步失败时返回错误
+func MirrorDirectory(ctx context.Context, source, dest string, excludeFunc globals.ExcludeFunc, deleteExtra bool) (MirrorStats, error) {
+	var stats MirrorStats
+	if excludeFunc == nil {
+		excludeFunc = globals.NoExcludeFunc
+	}
+
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return stats, fmt.Errorf("获取目标目录的绝对路径失败: %w", err)
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return stats, fmt.Errorf("获取镜像目录的绝对路径失败: %w", err)
+	}
+	if IsInDir(source, dest) || IsInDir(dest, source) {
+		return stats, fmt.Errorf("镜像目录 %s 与目标目录 %s 不能相互包含", dest, source)
+	}
+
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return stats, fmt.Errorf("目标目录或文件不存在: %w", err)
+	}
+	// 目标为单个文件时, 镜像目录中只保存该文件
+	root := source
+	if !sourceInfo.IsDir() {
+		root = filepath.Dir(source)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return stats, fmt.Errorf("创建镜像目录失败: %w", err)
+	}
+
+	keep := map[string]bool{".": true} // 目标目录中存在的相对路径
+	var dirs []string                  // 需要在同步完成后恢复属性的目录
+
+	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("遍历目录时出错: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("获取相对路径失败: %w", err)
+		}
+		if rel != "." && excludeFunc(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		target := filepath.Join(dest, rel)
+		existing, statErr := os.Lstat(target)
+		exists := statErr == nil
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			keep[rel] = true
+			stats.Dirs++
+			if exists && !existing.IsDir() {
+				if err := os.RemoveAll(target); err != nil {
+					return fmt.Errorf("删除镜像中的文件 %s 失败: %w", target, err)
+				}
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("创建目录 %s 失败: %w", target, err)
+			}
+			dirs = append(dirs, rel)
+
+		case mode.IsRegular():
+			keep[rel] = true
+			stats.Files++
+			stats.Size += info.Size()
+			if exists && existing.Mode().IsRegular() && existing.Size() == info.Size() && existing.ModTime().Equal(info.ModTime()) {
+				// 内容未变化时只同步权限
+				if existing.Mode().Perm() != mode.Perm() {
+					if err := os.Chmod(target, mode.Perm()); err != nil {
+						return fmt.Errorf("修改文件 %s 的权限失败: %w", target, err)
+					}
+					stats.Updated++
+				}
+				return nil
+			}
+			if err := mirrorFile(ctx, path, target, info); err != nil {
+				return err
+			}
+			stats.Bytes += info.Size()
+			if exists {
+				stats.Updated++
+			} else {
+				stats.Copied++
+			}
+
+		case mode&os.ModeSymlink != 0:
+			keep[rel] = true
+			stats.Files++
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("读取软链接 %s 失败: %w", path, err)
+			}
+			if exists && existing.Mode()&os.ModeSymlink != 0 {
+				if current, err := os.Readlink(target); err == nil && current == link {
+					return nil
+				}
+			}
+			if exists {
+				if err := os.RemoveAll(target); err != nil {
+					return fmt.Errorf("删除镜像中的文件 %s 失败: %w", target, err)
+				}
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return fmt.Errorf("创建软链接 %s 失败: %w", target, err)
+			}
+			preserveOwner(target, info)
+			if exists {
+				stats.Updated++
+			} else {
+				stats.Copied++
+			}
+
+		default:
+			// 设备文件、管道等特殊文件不同步
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if deleteExtra {
+		if stats.Deleted, err = removeExtraFiles(ctx, root, dest, keep, excludeFunc); err != nil {
+			return stats, err
+		}
+	}
+
+	// 目录中的文件同步完成后再恢复目录的属性
+	return stats, restoreDirs(root, dest, dirs)
+}
+
+// mirrorFile 复制单个文件到镜像中, 先写入同目录下的临时文件, 设置属性后再替换原文件
+func mirrorFile(ctx context.Context, path, target string, info os.FileInfo) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开文件 %s 失败: %w", path, err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*"+PartialSuffix)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	TrackPartial(tmpPath)
+	defer func() {
+		UntrackPartial(tmpPath)
+		_ = os.Remove(tmpPath)
+	}()
+
+	_, err = io.CopyBuffer(tmp, contextReader{ctx: ctx, r: src}, make([]byte, getBufferSize(info.Size())))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("复制文件 %s 失败: %w", path, err)
+	}
+
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("修改文件 %s 的权限失败: %w", target, err)
+	}
+	preserveOwner(tmpPath, info)
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("修改文件 %s 的时间失败: %w", target, err)
+	}
+
+	// 镜像中同名的是目录或软链接时先删除
+	if existing, err := os.Lstat(target); err == nil && !existing.Mode().IsRegular() {
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("删除镜像中的文件 %s 失败: %w", target, err)
+		}
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("替换文件 %s 失败: %w", target, err)
+	}
+	return nil
+}
+
+// restoreDirs 在目录中的文件同步完成后恢复目录的权限、所有者和修改时间
+// 从最深的目录开始, 避免修改时间被子项的变化覆盖
+func restoreDirs(root, dest string, dirs []string) error {
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, rel := range dirs {
+		info, err := os.Stat(filepath.Join(root, rel))
+		if err != nil {
+			continue
+		}
+		target := filepath.Join(dest, rel)
+		if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("修改目录 %s 的权限失败: %w", target, err)
+		}
+		preserveOwner(target, info)
+		if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("修改目录 %s 的时间失败: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// removeExtraFiles 删除镜像中目标目录已不存在的文件和目录, 被排除规则排除的路径不会被删除
+// 返回删除的文件数(不包括目录本身)
+func removeExtraFiles(ctx context.Context, root, dest string, keep map[string]bool, excludeFunc globals.ExcludeFunc) (int, error) {
+	var extras []string
+	err := filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("遍历镜像目录时出错: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dest, path)
+		if err != nil {
+			return fmt.Errorf("获取相对路径失败: %w", err)
+		}
+		if keep[rel] || excludeFunc(filepath.Join(root, rel), info) {
+			if info.IsDir() && !keep[rel] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		extras = append(extras, path)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, path := range extras {
+		_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				deleted++
+			}
+			return nil
+		})
+		if err := os.RemoveAll(path); err != nil {
+			return deleted, fmt.Errorf("删除镜像中的文件 %s 失败: %w", path, err)
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles 在目录下创建文件, 键为以 / 分隔的相对路径, 值为文件内容
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+	}
+}
+
+// readFiles 读取目录下的所有文件, 软链接的值为 "-> " 加链接目标
+func readFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			files[filepath.ToSlash(rel)] = "-> " + link
+			return err
+		}
+		content, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("读取目录 %s 失败: %v", root, err)
+	}
+	return files
+}
+
+// excludeLogs 排除 .log 文件和名为 cache 的目录
+func excludeLogs(path string, info os.FileInfo) bool {
+	return strings.HasSuffix(path, ".log") || (info.IsDir() && filepath.Base(path) == "cache")
+}
+
+func TestMirrorDirectory(t *testing.T) {
+	ctx := context.Background()
+	source := filepath.Join(t.TempDir(), "data")
+	dest := filepath.Join(t.TempDir(), "mirror")
+	writeFiles(t, source, map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "b",
+		"app.log":     "log",
+		"cache/c.txt": "c",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(source, "link")); err != nil {
+		t.Fatalf("创建软链接失败: %v", err)
+	}
+
+	stats, err := MirrorDirectory(ctx, source, dest, excludeLogs, true)
+	if err != nil {
+		t.Fatalf("第一次同步失败: %v", err)
+	}
+	want := map[string]string{"a.txt": "a", "sub/b.txt": "b", "link": "-> a.txt"}
+	if got := readFiles(t, dest); !reflect.DeepEqual(got, want) {
+		t.Fatalf("第一次同步后镜像中的文件 = %v, 期望 %v", got, want)
+	}
+	if stats.Copied != 3 || stats.Updated != 0 || stats.Deleted != 0 || stats.Files != 3 {
+		t.Errorf("第一次同步的统计 = %+v, 期望复制 3, 文件数 3", stats)
+	}
+	sourceInfo, _ := os.Stat(filepath.Join(source, "a.txt"))
+	destInfo, err := os.Stat(filepath.Join(dest, "a.txt"))
+	if err != nil || !destInfo.ModTime().Equal(sourceInfo.ModTime()) {
+		t.Errorf("镜像中文件的修改时间 = %v, 期望与目标目录相同 %v", destInfo.ModTime(), sourceInfo.ModTime())
+	}
+
+	// 镜像中多出的文件会被删除, 被排除的路径保留
+	writeFiles(t, dest, map[string]string{
+		"old.txt":       "old",
+		"olddir/x.txt":  "x",
+		"kept.log":      "kept",
+		"cache/y.txt":   "y",
+		"sub/extra.txt": "extra",
+	})
+	writeFiles(t, source, map[string]string{"sub/b.txt": "bb", "new.txt": "new"})
+
+	stats, err = MirrorDirectory(ctx, source, dest, excludeLogs, true)
+	if err != nil {
+		t.Fatalf("第二次同步失败: %v", err)
+	}
+	want = map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "bb",
+		"new.txt":     "new",
+		"link":        "-> a.txt",
+		"kept.log":    "kept",
+		"cache/y.txt": "y",
+	}
+	if got := readFiles(t, dest); !reflect.DeepEqual(got, want) {
+		t.Fatalf("第二次同步后镜像中的文件 = %v, 期望 %v", got, want)
+	}
+	if stats.Copied != 1 || stats.Updated != 1 || stats.Deleted != 3 {
+		t.Errorf("第二次同步的统计 = %+v, 期望复制 1, 更新 1, 删除 3", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "olddir")); !os.IsNotExist(err) {
+		t.Errorf("镜像中多出的目录没有被删除: %v", err)
+	}
+
+	// 不删除多余文件时保留镜像中多出的文件
+	writeFiles(t, dest, map[string]string{"extra.txt": "extra"})
+	if err := os.Remove(filepath.Join(source, "new.txt")); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	stats, err = MirrorDirectory(ctx, source, dest, excludeLogs, false)
+	if err != nil {
+		t.Fatalf("第三次同步失败: %v", err)
+	}
+	got := readFiles(t, dest)
+	if got["extra.txt"] != "extra" || got["new.txt"] != "new" {
+		t.Errorf("不删除多余文件时镜像中的文件 = %v, 期望保留 extra.txt 和 new.txt", got)
+	}
+	if stats.Copied != 0 || stats.Updated != 0 || stats.Deleted != 0 {
+		t.Errorf("第三次同步的统计 = %+v, 期望没有变化", stats)
+	}
+}
+
+func TestMirrorDirectoryNested(t *testing.T) {
+	source := t.TempDir()
+	for _, dest := range []string{filepath.Join(source, "mirror"), filepath.Dir(source)} {
+		if _, err := MirrorDirectory(context.Background(), source, dest, nil, true); err == nil {
+			t.Errorf("镜像目录 %s 与目标目录 %s 相互包含时应返回错误", dest, source)
+		}
+	}
+}
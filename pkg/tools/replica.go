@@ -0,0 +1,304 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NormalizeReplicas 解析逗号分隔的副本存放路径, 返回每个副本中存放该任务备份文件的完整位置
+// 本地路径转换为绝对路径, 远程存储只检查地址格式; 与备份目录相同或重复的位置会被拒绝
+// 配置为空或 none 时返回空字符串, 表示不复制
+// 参数:
+//   - spec: 副本存放路径列表, 例如 /mnt/usb,s3://bucket/cbk
+//   - dirName: 备份目录名, 每个副本中使用与备份目录相同的目录名
+//   - backupDir: 任务的备份目录
+//
+// 返回值:
+//   - string: 规范化后的副本位置列表, 以逗号分隔
+//   - error: 路径无效时返回错误
+func NormalizeReplicas(spec, dirName, backupDir string) (string, error) {
+	if spec = strings.TrimSpace(spec); spec == "" || strings.EqualFold(spec, "none") {
+		return "", nil
+	}
+
+	var locations []string
+	seen := map[string]bool{backupDir: true}
+	for _, root := range strings.Split(spec, ",") {
+		if root = strings.TrimSpace(root); root == "" {
+			continue
+		}
+
+		var location string
+		if IsRemoteLocation(root) {
+			if err := CheckLocation(root); err != nil {
+				return "", fmt.Errorf("副本存储地址无效: %w", err)
+			}
+			location = JoinLocation(root, dirName)
+		} else {
+			abs, err := filepath.Abs(filepath.Clean(root))
+			if err != nil {
+				return "", fmt.Errorf("获取副本路径 %s 的绝对路径失败: %w", root, err)
+			}
+			location = filepath.Join(abs, dirName)
+		}
+
+		if location == backupDir {
+			return "", fmt.Errorf("副本位置不能与备份目录相同: %s", location)
+		}
+		if seen[location] {
+			return "", fmt.Errorf("副本位置重复: %s", location)
+		}
+		seen[location] = true
+		locations = append(locations, location)
+	}
+	return strings.Join(locations, ","), nil
+}
+
+// SplitReplicas 将规范化后的副本位置列表拆分为切片
+func SplitReplicas(replicas string) []string {
+	if replicas == "" {
+		return nil
+	}
+	return strings.Split(replicas, ",")
+}
+
+// FormatReplicas 返回副本位置的显示文本, 未设置时返回 none
+func FormatReplicas(replicas string) string {
+	if replicas == "" {
+		return "none"
+	}
+	return replicas
+}
+
+// ReplicateVersion 将备份版本复制到副本位置, 并读取副本校验哈希值
+// 参数:
+//   - ctx: 上下文
+//   - record: 备份记录
+//   - location: 副本位置
+//   - stageDir: 暂存目录, 复制到远程存储时使用
+//
+// 返回值:
+//   - error: 复制或校验失败时返回错误
+func ReplicateVersion(ctx context.Context, record globals.BackupRecord, location, stageDir string) error {
+	return copyVersion(ctx, record, location, stageDir)
+}
+
+// copyVersion 将备份版本的备份文件复制到另一个存储位置, 并读取复制后的文件校验哈希值
+// 备份文件先复制为临时文件(本地位置的临时文件位于目标目录中, 远程位置的临时文件位于暂存目录中),
+// 复制时校验源文件的哈希值, 再保存到目标位置; 校验失败时删除目标位置中的文件
+func copyVersion(ctx context.Context, record globals.BackupRecord, location, stageDir string) error {
+	source, size, err := OpenVersionFile(ctx, record)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	store, err := OpenStorage(location)
+	if err != nil {
+		return fmt.Errorf("打开存储 %s 失败: %w", location, err)
+	}
+	defer store.Close()
+
+	// 本地位置直接在目标目录中生成临时文件, 避免跨磁盘移动时再复制一次
+	tmpDir := stageDir
+	if !IsRemoteLocation(location) {
+		tmpDir = location
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return fmt.Errorf("创建目录 %s 失败: %w", tmpDir, err)
+	}
+	tmp, err := os.CreateTemp(tmpDir, record.BackupFileName+".*"+PartialSuffix)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	TrackPartial(tmpPath)
+	_ = tmp.Chmod(0644) // 临时文件默认只有所有者可读写, 与其他备份文件保持一致
+	defer func() {
+		UntrackPartial(tmpPath)
+		_ = os.Remove(tmpPath)
+	}()
+
+	// 复制备份文件, 同时计算哈希值
+	hash := md5.New()
+	bar := newBytesBar(size, "正在复制")
+	_, err = io.Copy(io.MultiWriter(tmp, hash, bar), contextReader{ctx: ctx, r: io.NewSectionReader(source, 0, size)})
+	_ = bar.Finish()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("复制备份文件失败: %w", err)
+	}
+	if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum[len(sum)-8:] != record.VersionHash {
+		return fmt.Errorf("源备份文件的哈希值 %s 与记录的哈希值 %s 不一致, 备份文件可能已损坏", sum[len(sum)-8:], record.VersionHash)
+	}
+
+	if err := store.Put(ctx, tmpPath, record.BackupFileName); err != nil {
+		return fmt.Errorf("保存到 %s 失败: %w", location, err)
+	}
+
+	// 读取复制后的文件校验哈希值
+	copied := record
+	copied.BackupPath = location
+	if err := verifyCopy(ctx, copied); err != nil {
+		if removeErr := store.Remove(ctx, record.BackupFileName); removeErr != nil {
+			CL.PrintErrf("删除校验失败的文件 %s 失败: %v", JoinLocation(location, record.BackupFileName), removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// verifyCopy 读取复制后的备份文件并校验哈希值
+func verifyCopy(ctx context.Context, copied globals.BackupRecord) error {
+	file, size, err := OpenVersionFile(ctx, copied)
+	if err != nil {
+		return fmt.Errorf("读取复制后的文件失败: %w", err)
+	}
+	defer file.Close()
+
+	hash, err := ReaderMD5Last8(ctx, io.NewSectionReader(file, 0, size), size)
+	if err != nil {
+		return fmt.Errorf("校验复制后的文件失败: %w", err)
+	}
+	if hash != copied.VersionHash {
+		return fmt.Errorf("复制后的文件哈希值 %s 与记录的哈希值 %s 不一致", hash, copied.VersionHash)
+	}
+	return nil
+}
+
+// RecordReplica 记录备份版本复制到副本位置的结果
+// 参数:
+//   - db: 数据库连接
+//   - versionID: 版本ID
+//   - location: 副本位置
+//   - replicateErr: 复制失败的原因, 复制成功时为 nil
+//
+// 返回值:
+//   - error: 写入失败时返回错误
+func RecordReplica(db *sqlx.DB, versionID, location string, replicateErr error) error {
+	status, message := globals.ReplicaStatusSuccess, ""
+	if replicateErr != nil {
+		status, message = globals.ReplicaStatusFailed, replicateErr.Error()
+	}
+	upsertSql := `INSERT INTO backup_replicas (version_id, location, status, attempts, timestamp, error_message) VALUES (?, ?, ?, 1, ?, ?)
+		ON CONFLICT (version_id, location) DO UPDATE SET status = excluded.status, attempts = attempts + 1, timestamp = excluded.timestamp, error_message = excluded.error_message`
+	if _, err := db.Exec(upsertSql, versionID, location, status, time.Now().Format(TimestampLayout), message); err != nil {
+		return fmt.Errorf("写入副本记录失败: %w", err)
+	}
+	return nil
+}
+
+// FailedReplicas 返回任务中复制失败且需要重试的副本, 只包含仍存在的成功版本和任务当前的副本位置
+// 参数:
+//   - db: 数据库连接
+//   - taskID: 任务ID
+//   - replicas: 任务当前的副本位置列表
+//
+// 返回值:
+//   - []globals.ReplicaRecord: 需要重试的副本, 按备份时间从旧到新排列
+//   - error: 查询失败时返回错误
+func FailedReplicas(db *sqlx.DB, taskID int, replicas string) ([]globals.ReplicaRecord, error) {
+	current := make(map[string]bool)
+	for _, location := range SplitReplicas(replicas) {
+		current[location] = true
+	}
+
+	var failed []globals.ReplicaRecord
+	querySql := `SELECT r.version_id, r.location, r.status, r.attempts, r.timestamp, r.error_message FROM backup_replicas r
+		JOIN backup_records b ON b.version_id = r.version_id
+		WHERE b.task_id = ? AND b.run_status IN ('success', 'unchanged') AND r.status = ? ORDER BY b.timestamp`
+	if err := db.Select(&failed, querySql, taskID, globals.ReplicaStatusFailed); err != nil {
+		return nil, fmt.Errorf("查询复制失败的副本失败: %w", err)
+	}
+
+	pending := failed[:0]
+	for _, replica := range failed {
+		if current[replica.Location] {
+			pending = append(pending, replica)
+		}
+	}
+	return pending, nil
+}
+
+// LoadReplicas 查询任务所有版本的副本状态
+// 参数:
+//   - db: 数据库连接
+//   - taskID: 任务ID
+//
+// 返回值:
+//   - map[string][]globals.ReplicaRecord: 版本ID到副本状态的映射
+//   - error: 查询失败时返回错误
+func LoadReplicas(db *sqlx.DB, taskID int) (map[string][]globals.ReplicaRecord, error) {
+	var replicas []globals.ReplicaRecord
+	querySql := `SELECT version_id, location, status, attempts, timestamp, error_message FROM backup_replicas
+		WHERE version_id IN (SELECT version_id FROM backup_records WHERE task_id = ?) ORDER BY location`
+	if err := db.Select(&replicas, querySql, taskID); err != nil {
+		return nil, fmt.Errorf("查询副本状态失败: %w", err)
+	}
+
+	byVersion := make(map[string][]globals.ReplicaRecord)
+	for _, replica := range replicas {
+		byVersion[replica.VersionID] = append(byVersion[replica.VersionID], replica)
+	}
+	return byVersion, nil
+}
+
+// FormatReplicaStatus 返回副本状态的显示文本, 每个副本一行
+func FormatReplicaStatus(replicas []globals.ReplicaRecord) string {
+	if len(replicas) == 0 {
+		return "-"
+	}
+	lines := make([]string, 0, len(replicas))
+	for _, replica := range replicas {
+		if replica.Status == globals.ReplicaStatusSuccess {
+			lines = append(lines, fmt.Sprintf("成功 %s", replica.Location))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("失败(%d次) %s: %s", replica.Attempts, replica.Location, replica.ErrorMessage))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RemoveReplicas 删除备份版本在所有副本位置中的文件及其副本记录
+// 副本文件删除失败时只打印错误信息, 副本记录仍会被删除
+// 参数:
+//   - db: 数据库连接
+//   - records: 备份记录
+//
+// 返回值:
+//   - error: 删除副本记录失败时返回错误
+func RemoveReplicas(db *sqlx.DB, records []globals.BackupRecord) error {
+	stores := make(map[string]Storage) // 同一存储只连接一次
+	defer func() {
+		for _, store := range stores {
+			_ = store.Close()
+		}
+	}()
+
+	for _, record := range records {
+		var locations []string
+		if err := db.Select(&locations, "SELECT location FROM backup_replicas WHERE version_id = ?", record.VersionID); err != nil {
+			return fmt.Errorf("查询版本 %s 的副本失败: %w", record.VersionID, err)
+		}
+		for _, location := range locations {
+			if err := removeStoredFile(stores, location, record.BackupFileName); err != nil {
+				CL.PrintErrf("删除副本 %s 失败, 请稍后手动删除: %v", JoinLocation(location, record.BackupFileName), err)
+			}
+		}
+		if _, err := db.Exec("DELETE FROM backup_replicas WHERE version_id = ?", record.VersionID); err != nil {
+			return fmt.Errorf("删除版本 %s 的副本记录失败: %w", record.VersionID, err)
+		}
+	}
+	return nil
+}
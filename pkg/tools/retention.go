@@ -0,0 +1,532 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RetentionPolicy 表示一个任务的版本保留策略
+type RetentionPolicy struct {
+	Count                int   // 保留数量, 启用GFS策略时表示无条件保留的最新版本数
+	Days                 int   // 保留天数, 启用GFS策略时不生效
+	Size                 int64 // 保留的备份总大小上限(字节), 0 表示不限制
+	globals.GFSRetention       // GFS保留策略
+}
+
+// NewRetentionPolicy 根据任务配置构建保留策略
+func NewRetentionPolicy(task globals.BackupTask) RetentionPolicy {
+	return RetentionPolicy{
+		Count:        task.RetentionCount,
+		Days:         task.RetentionDays,
+		Size:         task.RetentionSize,
+		GFSRetention: task.GFSRetention,
+	}
+}
+
+// IsGFS 判断是否启用了GFS保留策略
+func (p RetentionPolicy) IsGFS() bool {
+	return p.Hourly > 0 || p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0 || p.Yearly > 0
+}
+
+// String 返回保留策略的可读描述
+func (p RetentionPolicy) String() string {
+	var desc string
+	switch {
+	case p.IsGFS():
+		desc = fmt.Sprintf("保留最新 %d 个, GFS: %s", p.Count, FormatGFS(p.GFSRetention))
+	case p.Days > 0:
+		desc = fmt.Sprintf("保留 %d 天内每天最新的 %d 个", p.Days, p.Count)
+	default:
+		desc = fmt.Sprintf("保留最新 %d 个", p.Count)
+	}
+	if p.Size > 0 {
+		desc += fmt.Sprintf(", 总大小不超过 %s", FormatSize(p.Size))
+	}
+	return desc
+}
+
+// gfsRule 表示GFS策略中的一条规则
+type gfsRule struct {
+	unit   byte                             // 规则在配置字符串中的单位
+	name   string                           // 规则名称
+	field  func(*globals.GFSRetention) *int // 对应的配置字段
+	bucket func(time.Time) string           // 计算版本所属的时间段
+}
+
+// GFS策略的规则列表, 按时间段从小到大排列
+var gfsRules = []gfsRule{
+	{'h', "每小时", func(g *globals.GFSRetention) *int { return &g.Hourly }, func(t time.Time) string { return t.Format("2006-01-02 15时") }},
+	{'d', "每天", func(g *globals.GFSRetention) *int { return &g.Daily }, func(t time.Time) string { return t.Format("2006-01-02") }},
+	{'w', "每周", func(g *globals.GFSRetention) *int { return &g.Weekly }, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d年第%02d周", year, week)
+	}},
+	{'m', "每月", func(g *globals.GFSRetention) *int { return &g.Monthly }, func(t time.Time) string { return t.Format("2006-01") }},
+	{'y', "每年", func(g *globals.GFSRetention) *int { return &g.Yearly }, func(t time.Time) string { return t.Format("2006") }},
+}
+
+// ParseGFS 解析GFS保留策略字符串
+// 参数:
+//   - spec: 形如 "24h,7d,4w,12m,3y" 的字符串, 分别表示小时、天、周、月、年, 可以只指定其中一部分; "none" 表示不启用
+//
+// 返回值:
+//   - globals.GFSRetention: 解析后的GFS保留策略
+//   - error: 格式不正确时返回错误
+func ParseGFS(spec string) (globals.GFSRetention, error) {
+	var gfs globals.GFSRetention
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return gfs, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) < 2 {
+			return gfs, fmt.Errorf("无效的GFS规则: '%s', 格式应为数字加单位(h/d/w/m/y), 例如 7d", part)
+		}
+
+		// 查找单位对应的规则
+		unit := part[len(part)-1]
+		var rule *gfsRule
+		for i := range gfsRules {
+			if gfsRules[i].unit == unit {
+				rule = &gfsRules[i]
+				break
+			}
+		}
+		if rule == nil {
+			return gfs, fmt.Errorf("无效的GFS规则单位: '%s', 可选单位: h(小时), d(天), w(周), m(月), y(年)", part)
+		}
+
+		count, err := strconv.Atoi(part[:len(part)-1])
+		if err != nil || count < 0 {
+			return gfs, fmt.Errorf("无效的GFS规则数量: '%s'", part)
+		}
+		*rule.field(&gfs) = count
+	}
+
+	return gfs, nil
+}
+
+// ParseQuota 解析备份总大小上限, 空字符串或 none 表示不限制
+func ParseQuota(spec string) (int64, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return 0, nil
+	}
+	return ParseSize(spec)
+}
+
+// FormatQuota 将备份总大小上限格式化为字符串, 未设置时返回 none
+func FormatQuota(size int64) string {
+	if size <= 0 {
+		return "none"
+	}
+	return FormatSize(size)
+}
+
+// FormatGFS 将GFS保留策略格式化为配置字符串, 未启用时返回 "none"
+func FormatGFS(gfs globals.GFSRetention) string {
+	var parts []string
+	for _, rule := range gfsRules {
+		if count := *rule.field(&gfs); count > 0 {
+			parts = append(parts, fmt.Sprintf("%d%c", count, rule.unit))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ",")
+}
+
+// ValidateGFS 检查GFS保留策略中是否存在负数
+func ValidateGFS(gfs globals.GFSRetention) error {
+	for _, rule := range gfsRules {
+		if *rule.field(&gfs) < 0 {
+			return fmt.Errorf("GFS保留策略中 %s 的数量不能小于0", rule.name)
+		}
+	}
+	return nil
+}
+
+// RetentionItem 表示参与保留策略计算的一个备份版本
+type RetentionItem struct {
+	ID     string    // 版本标识
+	Time   time.Time // 备份时间
+	Size   int64     // 备份文件大小(字节)
+	Pinned bool      // 是否固定, 固定的版本始终保留且不占用保留策略的名额
+}
+
+// RetentionDecision 表示保留策略对一个备份版本的判定结果
+type RetentionDecision struct {
+	RetentionItem
+	Keep    bool     // 是否保留
+	Reasons []string // 保留或清理的原因
+}
+
+// EvaluateRetention 根据保留策略判定每个备份版本是否保留
+// 固定的版本始终保留, 不计入保留数量和总大小上限
+// 参数:
+//   - items: 备份版本列表, 顺序不限
+//   - policy: 保留策略
+//   - now: 当前时间, 用于计算保留天数
+//
+// 返回值:
+//   - []RetentionDecision: 按备份时间从新到旧排列的判定结果
+func EvaluateRetention(items []RetentionItem, policy RetentionPolicy, now time.Time) []RetentionDecision {
+	// 固定的版本不参与保留策略的计算
+	var decisions, pinned []RetentionDecision
+	for _, item := range items {
+		if item.Pinned {
+			pinned = append(pinned, RetentionDecision{RetentionItem: item, Keep: true, Reasons: []string{"已固定"}})
+			continue
+		}
+		decisions = append(decisions, RetentionDecision{RetentionItem: item})
+	}
+	sortDecisions(decisions)
+
+	switch {
+	case policy.IsGFS():
+		evaluateGFS(decisions, policy)
+	case policy.Days > 0 && policy.Count > 0:
+		evaluateDaily(decisions, policy, now)
+	case policy.Count > 0:
+		evaluateCount(decisions, policy)
+	default:
+		for i := range decisions {
+			decisions[i].Keep = true
+			decisions[i].Reasons = []string{"未设置有效的保留策略"}
+		}
+	}
+
+	// 在保留的版本中按总大小上限进一步清理
+	if policy.Size > 0 {
+		evaluateSize(decisions, policy)
+	}
+
+	// 合并固定的版本
+	if len(pinned) > 0 {
+		decisions = append(decisions, pinned...)
+		sortDecisions(decisions)
+	}
+
+	return decisions
+}
+
+// sortDecisions 将判定结果按备份时间从新到旧排列
+func sortDecisions(decisions []RetentionDecision) {
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Time.After(decisions[j].Time)
+	})
+}
+
+// evaluateSize 从新到旧累加保留版本的大小, 超出总大小上限的旧版本被清理, 最新的版本始终保留
+func evaluateSize(decisions []RetentionDecision, policy RetentionPolicy) {
+	var total int64
+	kept := 0
+	for i := range decisions {
+		d := &decisions[i]
+		if !d.Keep {
+			continue
+		}
+
+		total += d.Size
+		kept++
+		if kept > 1 && total > policy.Size {
+			d.Keep = false
+			d.Reasons = []string{fmt.Sprintf("超出总大小上限 %s (累计 %s)", FormatSize(policy.Size), FormatSize(total))}
+			total -= d.Size
+			continue
+		}
+		if total > policy.Size {
+			d.Reasons = append(d.Reasons, fmt.Sprintf("最新版本始终保留, 已超出总大小上限 %s", FormatSize(policy.Size)))
+		}
+	}
+}
+
+// evaluateCount 仅保留最新的 Count 个版本
+func evaluateCount(decisions []RetentionDecision, policy RetentionPolicy) {
+	for i := range decisions {
+		if i < policy.Count {
+			decisions[i].Keep = true
+			decisions[i].Reasons = []string{fmt.Sprintf("最新的 %d 个版本之一 (#%d)", policy.Count, i+1)}
+		} else {
+			decisions[i].Reasons = []string{fmt.Sprintf("超出保留数量 %d", policy.Count)}
+		}
+	}
+}
+
+// evaluateDaily 在保留天数内每天保留最新的 Count 个版本, 早于保留天数的版本全部清理
+func evaluateDaily(decisions []RetentionDecision, policy RetentionPolicy, now time.Time) {
+	cutoff := now.AddDate(0, 0, -policy.Days)
+	perDay := make(map[string]int)
+	for i := range decisions {
+		d := &decisions[i]
+		if !d.Time.After(cutoff) {
+			d.Reasons = []string{fmt.Sprintf("早于保留天数 %d 天", policy.Days)}
+			continue
+		}
+
+		day := d.Time.Format("2006-01-02")
+		perDay[day]++
+		if perDay[day] <= policy.Count {
+			d.Keep = true
+			d.Reasons = []string{fmt.Sprintf("%s 当天最新的 %d 个版本之一 (#%d)", day, policy.Count, perDay[day])}
+		} else {
+			d.Reasons = []string{fmt.Sprintf("超出 %s 当天的保留数量 %d", day, policy.Count)}
+		}
+	}
+}
+
+// evaluateGFS 按GFS规则保留版本, 每条规则在各自的时间段内保留最新的版本, 一个版本可以被多条规则同时保留
+func evaluateGFS(decisions []RetentionDecision, policy RetentionPolicy) {
+	// 无条件保留最新的 Count 个版本
+	for i := 0; i < policy.Count && i < len(decisions); i++ {
+		decisions[i].Keep = true
+		decisions[i].Reasons = append(decisions[i].Reasons, fmt.Sprintf("最新 #%d", i+1))
+	}
+
+	// 依次应用每条规则
+	gfs := policy.GFSRetention
+	for _, rule := range gfsRules {
+		limit := *rule.field(&gfs)
+		if limit <= 0 {
+			continue
+		}
+
+		kept := 0
+		lastBucket := ""
+		for i := range decisions {
+			if kept >= limit {
+				break
+			}
+			bucket := rule.bucket(decisions[i].Time)
+			if bucket == lastBucket {
+				continue
+			}
+			lastBucket = bucket
+			kept++
+			decisions[i].Keep = true
+			decisions[i].Reasons = append(decisions[i].Reasons, fmt.Sprintf("%s #%d (%s)", rule.name, kept, bucket))
+		}
+	}
+
+	// 未被任何规则保留的版本
+	for i := range decisions {
+		if !decisions[i].Keep {
+			decisions[i].Reasons = []string{"不匹配任何保留规则"}
+		}
+	}
+}
+
+// VersionFileSize 返回备份版本在磁盘上的文件大小, 文件不存在时返回0
+// 远程存储的版本不逐个查询存储, 使用备份记录中的大小; 快照版本按 SnapshotSize 计算
+func VersionFileSize(record globals.BackupRecord) int64 {
+	if IsSnapshotRecord(record) {
+		return SnapshotSize(filepath.Join(record.BackupPath, record.BackupFileName))
+	}
+	if IsRemoteLocation(record.BackupPath) {
+		return record.SizeBytes
+	}
+	info, err := os.Stat(filepath.Join(record.BackupPath, record.BackupFileName))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// 清理版本时备份文件的临时后缀, 数据库记录删除成功后才会真正删除文件
+const removingSuffix = ".removing"
+
+// RetentionPlan 表示对一个任务执行保留策略的计划
+type RetentionPlan struct {
+	TaskID    int                             // 任务ID
+	Policy    RetentionPolicy                 // 保留策略
+	Decisions []RetentionDecision             // 按备份时间从新到旧排列的判定结果
+	Records   map[string]globals.BackupRecord // 版本ID到备份记录的映射
+}
+
+// Remove 返回计划中需要清理的备份记录, 按备份时间从旧到新排列
+func (p RetentionPlan) Remove() []globals.BackupRecord {
+	var records []globals.BackupRecord
+	for i := len(p.Decisions) - 1; i >= 0; i-- {
+		if !p.Decisions[i].Keep {
+			records = append(records, p.Records[p.Decisions[i].ID])
+		}
+	}
+	return records
+}
+
+// PlanRetention 根据备份记录计算任务中需要清理的版本
+// 参数:
+//   - db: 数据库连接
+//   - taskID: 任务ID
+//   - policy: 保留策略
+//   - now: 当前时间
+//
+// 返回值:
+//   - RetentionPlan: 保留计划, 仅包含成功的备份版本
+//   - error: 查询失败时返回错误
+func PlanRetention(db *sqlx.DB, taskID int, policy RetentionPolicy, now time.Time) (RetentionPlan, error) {
+	plan := RetentionPlan{TaskID: taskID, Policy: policy, Records: make(map[string]globals.BackupRecord)}
+
+	// 查询该任务成功的备份记录
+	var records globals.BackupRecords
+	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, label, note, size_bytes, run_status FROM backup_records WHERE task_id = ? AND " + SuccessStatusSql + " AND backup_file_name != ?"
+	if err := db.Select(&records, querySql, taskID, MirrorFileName); err != nil {
+		return plan, fmt.Errorf("查询备份记录失败: %w", err)
+	}
+
+	// 以记录的备份时间计算保留策略
+	var items []RetentionItem
+	for _, record := range records {
+		recordTime, err := ParseRecordTime(record.Timestamp)
+		if err != nil {
+			CL.PrintErrf("版本 %s 的时间戳无效, 不参与清理: %s", record.VersionID, record.Timestamp)
+			continue
+		}
+		items = append(items, RetentionItem{ID: record.VersionID, Time: recordTime, Size: VersionFileSize(record), Pinned: record.Pinned})
+		plan.Records[record.VersionID] = record
+	}
+	plan.Decisions = EvaluateRetention(items, policy, now)
+
+	return plan, nil
+}
+
+// RemoveVersions 删除备份版本的文件及其记录
+// 先将备份文件重命名为临时文件, 在同一事务中删除记录, 事务提交后再删除临时文件;
+// 事务失败时恢复文件名, 保证数据库记录与磁盘上的文件一致;
+// 远程存储无法重命名, 事务提交后再删除存储中的文件; 版本的副本文件同样在事务提交后删除;
+// 快照版本的快照目录与备份文件相同, 先重命名再整体删除
+// 参数:
+//   - db: 数据库连接
+//   - records: 要删除的备份记录
+//
+// 返回值:
+//   - []globals.BackupRecord: 成功删除的备份记录
+//   - error: 事务执行失败时返回错误
+func RemoveVersions(db *sqlx.DB, records []globals.BackupRecord) ([]globals.BackupRecord, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	// 将备份文件重命名为临时文件
+	type pending struct {
+		record  globals.BackupRecord
+		path    string // 原始文件路径
+		renamed bool   // 是否已重命名为临时文件
+		remote  bool   // 是否位于远程存储
+	}
+	var pendings []pending
+	for _, record := range records {
+		if IsRemoteLocation(record.BackupPath) {
+			pendings = append(pendings, pending{record: record, path: JoinLocation(record.BackupPath, record.BackupFileName), remote: true})
+			continue
+		}
+		path := filepath.Join(record.BackupPath, record.BackupFileName)
+		if err := os.Rename(path, path+removingSuffix); err == nil {
+			pendings = append(pendings, pending{record: record, path: path, renamed: true})
+		} else if os.IsNotExist(err) {
+			// 文件已经不存在, 仅删除记录
+			pendings = append(pendings, pending{record: record, path: path})
+		} else {
+			CL.PrintErrf("无法删除版本 %s 的备份文件, 已跳过: %v", record.VersionID, err)
+		}
+	}
+
+	// 恢复已重命名的文件
+	restore := func() {
+		for _, p := range pendings {
+			if p.renamed {
+				if err := os.Rename(p.path+removingSuffix, p.path); err != nil {
+					CL.PrintErrf("恢复备份文件 %s 失败: %v", p.path, err)
+				}
+			}
+		}
+	}
+
+	// 查询版本的副本位置, 事务提交后一并删除副本文件
+	replicas := make(map[string][]string)
+	for _, p := range pendings {
+		var locations []string
+		if err := db.Select(&locations, "SELECT location FROM backup_replicas WHERE version_id = ?", p.record.VersionID); err != nil {
+			restore()
+			return nil, fmt.Errorf("查询版本 %s 的副本失败: %w", p.record.VersionID, err)
+		}
+		replicas[p.record.VersionID] = locations
+	}
+
+	// 在事务中删除备份记录和副本记录
+	tx, err := db.Beginx()
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	for _, p := range pendings {
+		if _, err := tx.Exec("DELETE FROM backup_records WHERE version_id = ?", p.record.VersionID); err != nil {
+			_ = tx.Rollback()
+			restore()
+			return nil, fmt.Errorf("删除版本 %s 的备份记录失败: %w", p.record.VersionID, err)
+		}
+		if _, err := tx.Exec("DELETE FROM backup_replicas WHERE version_id = ?", p.record.VersionID); err != nil {
+			_ = tx.Rollback()
+			restore()
+			return nil, fmt.Errorf("删除版本 %s 的副本记录失败: %w", p.record.VersionID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		restore()
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	// 删除临时文件
+	var removed []globals.BackupRecord
+	stores := make(map[string]Storage) // 同一存储只连接一次
+	defer func() {
+		for _, store := range stores {
+			_ = store.Close()
+		}
+	}()
+	for _, p := range pendings {
+		if p.remote {
+			if err := removeStoredFile(stores, p.record.BackupPath, p.record.BackupFileName); err != nil {
+				CL.PrintErrf("删除备份文件 %s 失败, 请稍后手动删除: %v", p.path, err)
+			}
+		}
+		if p.renamed {
+			if err := os.RemoveAll(p.path + removingSuffix); err != nil {
+				CL.PrintErrf("删除备份文件 %s 失败, 请稍后手动删除: %v", p.path+removingSuffix, err)
+			}
+		}
+		for _, location := range replicas[p.record.VersionID] {
+			if err := removeStoredFile(stores, location, p.record.BackupFileName); err != nil {
+				CL.PrintErrf("删除副本 %s 失败, 请稍后手动删除: %v", JoinLocation(location, p.record.BackupFileName), err)
+			}
+		}
+		removed = append(removed, p.record)
+	}
+
+	return removed, nil
+}
+
+// removeStoredFile 删除存储位置中的文件, 打开的存储保存在 stores 中以便复用
+func removeStoredFile(stores map[string]Storage, location, name string) error {
+	store, ok := stores[location]
+	if !ok {
+		var err error
+		if store, err = OpenStorage(location); err != nil {
+			return err
+		}
+		stores[location] = store
+	}
+	return store.Remove(context.Background(), name)
+}
@@ -0,0 +1,305 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"strings"
+	"testing"
+	"time"
+)
+
+// at 返回 UTC 时区的时间, 便于构造跨越时间段边界的版本
+func at(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+// itemsAt 按给定时间构造备份版本, 版本标识为时间的字符串形式
+func itemsAt(times ...time.Time) []RetentionItem {
+	items := make([]RetentionItem, len(times))
+	for i, t := range times {
+		items[i] = RetentionItem{ID: t.Format("2006-01-02 15:04"), Time: t, Size: 1}
+	}
+	return items
+}
+
+// keptIDs 返回判定结果中保留的版本标识, 按备份时间从新到旧排列
+func keptIDs(decisions []RetentionDecision) []string {
+	var ids []string
+	for _, d := range decisions {
+		if d.Keep {
+			ids = append(ids, d.ID)
+		}
+	}
+	return ids
+}
+
+// findDecision 查找指定版本的判定结果
+func findDecision(t *testing.T, decisions []RetentionDecision, id string) RetentionDecision {
+	t.Helper()
+	for _, d := range decisions {
+		if d.ID == id {
+			return d
+		}
+	}
+	t.Fatalf("判定结果中没有版本 %s", id)
+	return RetentionDecision{}
+}
+
+func TestParseGFS(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    globals.GFSRetention
+		wantErr bool
+	}{
+		{spec: "", want: globals.GFSRetention{}},
+		{spec: "none", want: globals.GFSRetention{}},
+		{spec: "24h,7d,4w,12m,3y", want: globals.GFSRetention{Hourly: 24, Daily: 7, Weekly: 4, Monthly: 12, Yearly: 3}},
+		{spec: " 7d , 4w ", want: globals.GFSRetention{Daily: 7, Weekly: 4}},
+		{spec: "12m", want: globals.GFSRetention{Monthly: 12}},
+		{spec: "0d", want: globals.GFSRetention{}},
+		{spec: "7d,3d", want: globals.GFSRetention{Daily: 3}},
+		{spec: "7", wantErr: true},
+		{spec: "d", wantErr: true},
+		{spec: "7x", wantErr: true},
+		{spec: "-1d", wantErr: true},
+		{spec: "ad", wantErr: true},
+		{spec: "7d,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseGFS(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseGFS(%q) 未返回错误", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGFS(%q) 返回错误: %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseGFS(%q) = %+v, 期望 %+v", tt.spec, got, tt.want)
+			}
+			// 格式化后再次解析应得到相同的策略
+			if again, err := ParseGFS(FormatGFS(got)); err != nil || again != got {
+				t.Errorf("FormatGFS(%+v) = %q 无法还原", got, FormatGFS(got))
+			}
+		})
+	}
+}
+
+func TestEvaluateRetentionGFSBoundaries(t *testing.T) {
+	now := at(2025, 3, 1, 12, 0)
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		times  []time.Time
+		want   []string // 保留的版本, 从新到旧
+	}{
+		{
+			// 同一小时内只保留最新的版本
+			name:   "每小时",
+			policy: RetentionPolicy{GFSRetention: globals.GFSRetention{Hourly: 2}},
+			times:  []time.Time{at(2025, 3, 1, 11, 50), at(2025, 3, 1, 11, 10), at(2025, 3, 1, 10, 59), at(2025, 3, 1, 9, 0)},
+			want:   []string{"2025-03-01 11:50", "2025-03-01 10:59"},
+		},
+		{
+			// 跨越午夜的两个版本属于不同的天
+			name:   "每天",
+			policy: RetentionPolicy{GFSRetention: globals.GFSRetention{Daily: 2}},
+			times:  []time.Time{at(2025, 3, 1, 0, 1), at(2025, 2, 28, 23, 59), at(2025, 2, 28, 8, 0), at(2025, 2, 27, 8, 0)},
+			want:   []string{"2025-03-01 00:01", "2025-02-28 23:59"},
+		},
+		{
+			// ISO 周从周一开始, 2024-12-30(周一)属于 2025 年第 1 周, 2024-12-29(周日)属于 2024 年第 52 周
+			name:   "每周跨年",
+			policy: RetentionPolicy{GFSRetention: globals.GFSRetention{Weekly: 2}},
+			times:  []time.Time{at(2025, 1, 2, 8, 0), at(2024, 12, 30, 8, 0), at(2024, 12, 29, 8, 0), at(2024, 12, 23, 8, 0)},
+			want:   []string{"2025-01-02 08:00", "2024-12-29 08:00"},
+		},
+		{
+			// 闰年二月的最后一天与三月一日属于不同的月
+			name:   "每月",
+			policy: RetentionPolicy{GFSRetention: globals.GFSRetention{Monthly: 2}},
+			times:  []time.Time{at(2024, 3, 1, 0, 30), at(2024, 2, 29, 23, 30), at(2024, 2, 10, 8, 0), at(2024, 1, 31, 8, 0)},
+			want:   []string{"2024-03-01 00:30", "2024-02-29 23:30"},
+		},
+		{
+			name:   "每年",
+			policy: RetentionPolicy{GFSRetention: globals.GFSRetention{Yearly: 2}},
+			times:  []time.Time{at(2025, 1, 1, 0, 0), at(2024, 12, 31, 23, 59), at(2024, 6, 1, 8, 0), at(2023, 12, 31, 8, 0)},
+			want:   []string{"2025-01-01 00:00", "2024-12-31 23:59"},
+		},
+		{
+			// 版本的顺序不影响判定结果
+			name:   "乱序输入",
+			policy: RetentionPolicy{GFSRetention: globals.GFSRetention{Daily: 1}},
+			times:  []time.Time{at(2025, 2, 28, 8, 0), at(2025, 2, 28, 20, 0), at(2025, 2, 28, 12, 0)},
+			want:   []string{"2025-02-28 20:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := EvaluateRetention(itemsAt(tt.times...), tt.policy, now)
+			if got := keptIDs(decisions); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("保留的版本 = %v, 期望 %v", got, tt.want)
+			}
+			for _, d := range decisions {
+				if len(d.Reasons) == 0 {
+					t.Errorf("版本 %s 没有判定原因", d.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateRetentionGFSOverlap(t *testing.T) {
+	now := at(2025, 3, 1, 12, 0)
+
+	// 最近 40 天每天 08:00 和 20:00 各一个版本
+	var times []time.Time
+	for i := 0; i < 40; i++ {
+		day := at(2025, 3, 1, 0, 0).AddDate(0, 0, -i)
+		times = append(times, day.Add(20*time.Hour), day.Add(8*time.Hour))
+	}
+
+	// 启用GFS策略时保留天数不生效, 保留数量表示无条件保留的最新版本数
+	policy := RetentionPolicy{Count: 3, Days: 2, GFSRetention: globals.GFSRetention{Daily: 2, Monthly: 2}}
+	decisions := EvaluateRetention(itemsAt(times...), policy, now)
+
+	want := []string{
+		"2025-03-01 20:00", // 最新 #1, 每天 #1, 每月 #1
+		"2025-03-01 08:00", // 最新 #2
+		"2025-02-28 20:00", // 最新 #3, 每天 #2, 每月 #2
+	}
+	if got := keptIDs(decisions); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("保留的版本 = %v, 期望 %v", got, want)
+	}
+
+	// 同一个版本可以被多条规则同时保留
+	newest := findDecision(t, decisions, "2025-03-01 20:00")
+	if len(newest.Reasons) != 3 || newest.Reasons[0] != "最新 #1" || !strings.HasPrefix(newest.Reasons[1], "每天 #1") || !strings.HasPrefix(newest.Reasons[2], "每月 #1") {
+		t.Errorf("最新版本的原因 = %v", newest.Reasons)
+	}
+	second := findDecision(t, decisions, "2025-03-01 08:00")
+	if len(second.Reasons) != 1 || second.Reasons[0] != "最新 #2" {
+		t.Errorf("第二个版本的原因 = %v", second.Reasons)
+	}
+	removed := findDecision(t, decisions, "2025-02-27 20:00")
+	if removed.Keep || len(removed.Reasons) != 1 || removed.Reasons[0] != "不匹配任何保留规则" {
+		t.Errorf("未保留版本的判定 = %+v", removed)
+	}
+}
+
+func TestEvaluateRetentionCountAndDays(t *testing.T) {
+	now := at(2025, 3, 10, 12, 0)
+	times := []time.Time{
+		at(2025, 3, 10, 9, 0), at(2025, 3, 10, 8, 0), at(2025, 3, 10, 7, 0),
+		at(2025, 3, 9, 9, 0), at(2025, 3, 9, 8, 0),
+		at(2025, 3, 5, 9, 0),
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{
+			name:   "保留数量",
+			policy: RetentionPolicy{Count: 2},
+			want:   []string{"2025-03-10 09:00", "2025-03-10 08:00"},
+		},
+		{
+			// 保留天数内每天保留最新的 Count 个, 早于保留天数的全部清理
+			name:   "保留数量和天数",
+			policy: RetentionPolicy{Count: 2, Days: 3},
+			want:   []string{"2025-03-10 09:00", "2025-03-10 08:00", "2025-03-09 09:00", "2025-03-09 08:00"},
+		},
+		{
+			// 只设置天数时保留数量为0, 不是有效的保留策略
+			name:   "未设置有效策略",
+			policy: RetentionPolicy{Days: 3},
+			want:   []string{"2025-03-10 09:00", "2025-03-10 08:00", "2025-03-10 07:00", "2025-03-09 09:00", "2025-03-09 08:00", "2025-03-05 09:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := EvaluateRetention(itemsAt(times...), tt.policy, now)
+			if got := keptIDs(decisions); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("保留的版本 = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRetentionSize(t *testing.T) {
+	now := at(2025, 3, 10, 12, 0)
+	items := func(sizes ...int64) []RetentionItem {
+		var items []RetentionItem
+		for i, size := range sizes {
+			t := at(2025, 3, 10, 10, 0).Add(-time.Duration(i) * time.Hour)
+			items = append(items, RetentionItem{ID: t.Format("15:04"), Time: t, Size: size})
+		}
+		return items
+	}
+
+	tests := []struct {
+		name   string
+		items  []RetentionItem
+		policy RetentionPolicy
+		want   []string
+	}{
+		{
+			// 从新到旧累加, 超出上限的版本被清理后不计入累计大小
+			name:   "超出上限",
+			items:  items(4, 3, 3, 2, 1),
+			policy: RetentionPolicy{Count: 10, Size: 8},
+			want:   []string{"10:00", "09:00", "06:00"},
+		},
+		{
+			name:   "未超出上限",
+			items:  items(1, 2, 3),
+			policy: RetentionPolicy{Count: 10, Size: 6},
+			want:   []string{"10:00", "09:00", "08:00"},
+		},
+		{
+			// 最新的版本始终保留
+			name:   "最新版本超出上限",
+			items:  items(10, 1),
+			policy: RetentionPolicy{Count: 10, Size: 5},
+			want:   []string{"10:00"},
+		},
+		{
+			// 已被保留数量清理的版本不计入总大小
+			name:   "与保留数量组合",
+			items:  items(2, 2, 2, 2),
+			policy: RetentionPolicy{Count: 2, Size: 100},
+			want:   []string{"10:00", "09:00"},
+		},
+		{
+			// 固定的版本不计入总大小, 也不会被清理
+			name:   "固定的版本",
+			items:  append(items(3, 3), RetentionItem{ID: "pinned", Time: at(2025, 3, 1, 0, 0), Size: 100, Pinned: true}),
+			policy: RetentionPolicy{Count: 10, Size: 6},
+			want:   []string{"10:00", "09:00", "pinned"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := EvaluateRetention(tt.items, tt.policy, now)
+			if got := keptIDs(decisions); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("保留的版本 = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	// 最新版本超出上限时说明原因
+	decisions := EvaluateRetention(items(10), RetentionPolicy{Count: 1, Size: 5}, now)
+	if reasons := decisions[0].Reasons; len(reasons) != 2 || !strings.HasPrefix(reasons[1], "最新版本始终保留") {
+		t.Errorf("最新版本的原因 = %v", reasons)
+	}
+}
@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 重试等待时间的上限, 避免重试次数较多时等待时间过长
+const maxRetryDelay = time.Hour
+
+// ParseSeconds 解析以秒存储的时间间隔, 例如 30s、5m、1h30m, 空字符串、none 或 0 表示不设置
+// 参数:
+//   - spec: 时间间隔
+//
+// 返回值:
+//   - int: 时间间隔的秒数, 不设置时为 0
+//   - error: 格式不正确或小于1秒时返回错误
+func ParseSeconds(spec string) (int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" || strings.EqualFold(spec, "none") {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(spec)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间间隔: '%s', 示例: 30s、5m、1h30m", spec)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("时间间隔不能小于1秒: '%s'", spec)
+	}
+	return int(d / time.Second), nil
+}
+
+// FormatSeconds 将秒数格式化为时间间隔, 例如 90 返回 1m30s, 未设置时返回 none
+func FormatSeconds(seconds int) string {
+	if seconds <= 0 {
+		return "none"
+	}
+	s := (time.Duration(seconds) * time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// ParseRetryPolicy 解析失败重试和超时设置
+// 参数:
+//   - retries: 失败后的重试次数
+//   - backoff: 第一次重试前的等待时间, 例如 30s
+//   - timeout: 每次运行的超时时间, 例如 2h, none 表示不限制
+//
+// 返回值:
+//   - globals.RetryPolicy: 解析后的设置
+//   - error: 格式不正确时返回错误
+func ParseRetryPolicy(retries int, backoff, timeout string) (globals.RetryPolicy, error) {
+	var policy globals.RetryPolicy
+	if retries < 0 {
+		return policy, fmt.Errorf("重试次数不能小于0")
+	}
+	policy.Retries = retries
+
+	var err error
+	if policy.RetryBackoff, err = ParseSeconds(backoff); err != nil {
+		return policy, fmt.Errorf("重试等待时间无效: %w", err)
+	}
+	if policy.Timeout, err = ParseSeconds(timeout); err != nil {
+		return policy, fmt.Errorf("超时时间无效: %w", err)
+	}
+	return policy, nil
+}
+
+// FormatRetries 返回重试设置的显示文本, 例如 3次/30s, 不重试时返回 none
+func FormatRetries(policy globals.RetryPolicy) string {
+	if policy.Retries <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d次/%s", policy.Retries, FormatSeconds(policy.RetryBackoff))
+}
+
+// RetryDelay 返回第 attempt 次运行失败后, 下一次重试前的等待时间
+// 等待时间从 RetryBackoff 开始每次翻倍, 最长为1小时
+func RetryDelay(policy globals.RetryPolicy, attempt int) time.Duration {
+	delay := time.Duration(policy.RetryBackoff) * time.Second
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
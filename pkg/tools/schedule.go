@@ -0,0 +1,359 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 表示任务的定时计划
+type Schedule interface {
+	// Next 返回指定时间之后的下一次运行时间, 没有下一次运行时间时返回零值
+	Next(t time.Time) time.Time
+}
+
+// 定时计划的快捷写法
+var scheduleShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// 月份和星期的英文缩写
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dowNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// 计算下一次运行时间时最多向后查找的年数
+const maxScheduleYears = 5
+
+// ParseSchedule 解析定时计划
+// 参数:
+//   - spec: 定时计划, 支持以下形式:
+//     标准的5段cron表达式(分 时 日 月 星期), 支持 *、列表(1,2)、范围(1-5)、步长(*/15) 以及月份和星期的英文缩写;
+//     日期和星期字段都不以 * 开头时满足其一即运行, 否则需要同时满足
+//     快捷写法: @yearly、@annually、@monthly、@weekly、@daily、@midnight、@hourly
+//     固定间隔: @every 30m, 间隔不能小于1分钟
+//
+// 返回值:
+//   - Schedule: 解析后的定时计划
+//   - error: 格式不正确时返回错误
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("定时计划不能为空")
+	}
+
+	// 固定间隔
+	if rest, ok := strings.CutPrefix(spec, "@every"); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("无效的间隔: '%s', 示例: @every 30m", strings.TrimSpace(rest))
+		}
+		if interval < time.Minute {
+			return nil, fmt.Errorf("间隔不能小于1分钟: %s", interval)
+		}
+		return everySchedule(interval), nil
+	}
+
+	// 快捷写法
+	if strings.HasPrefix(spec, "@") {
+		expr, ok := scheduleShortcuts[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("未知的快捷写法: %s, 可选: @yearly, @monthly, @weekly, @daily, @hourly, @every <间隔>", spec)
+		}
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron表达式应包含5段(分 时 日 月 星期), 实际为 %d 段: %s", len(fields), spec)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("分钟字段无效: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("小时字段无效: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("日期字段无效: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("月份字段无效: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, dowNames); err != nil {
+		return nil, fmt.Errorf("星期字段无效: %w", err)
+	}
+
+	// 星期中的7等同于0(星期日)
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = isCronStar(fields[2])
+	s.dowAny = isCronStar(fields[4])
+
+	return s, nil
+}
+
+// NormalizeSchedule 检查定时计划是否合法并返回用于存储的文本
+// 空字符串和 none 表示不定时运行, 返回空字符串
+func NormalizeSchedule(spec string) (string, error) {
+	if spec = strings.TrimSpace(spec); spec == "" || spec == "none" {
+		return "", nil
+	}
+	if _, err := ParseSchedule(spec); err != nil {
+		return "", err
+	}
+	return spec, nil
+}
+
+// FormatSchedule 返回定时计划的显示文本, 未设置时返回 none
+func FormatSchedule(spec string) string {
+	if spec = strings.TrimSpace(spec); spec == "" {
+		return "none"
+	}
+	return spec
+}
+
+// parseCronField 解析cron表达式中的一段, 返回匹配值的位图
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		// 解析步长
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("无效的步长: '%s'", part)
+			}
+		}
+
+		// 解析范围
+		var lo, hi int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			lo, hi = min, max
+		case strings.Contains(rangePart, "-"):
+			loPart, hiPart, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseCronValue(loPart, names); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(hiPart, names); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if lo, err = parseCronValue(rangePart, names); err != nil {
+				return 0, err
+			}
+			// 单个值带步长时表示从该值到最大值
+			hi = lo
+			if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("'%s' 超出范围 %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// isCronStar 判断字段是否以 * 或 ? 开头, 与 Vixie cron 相同, */2 这样带步长的写法也视为未限制,
+// 此时日期和星期需要同时满足
+func isCronStar(field string) bool {
+	return strings.HasPrefix(field, "*") || strings.HasPrefix(field, "?")
+}
+
+// parseCronValue 解析cron表达式中的单个值, 支持英文缩写
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的值: '%s'", value)
+	}
+	return v, nil
+}
+
+// cronSchedule 基于cron表达式的定时计划
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // 各字段匹配值的位图
+	domAny, dowAny                bool   // 日期和星期字段是否以 * 开头
+}
+
+// Next 返回指定时间之后第一个匹配cron表达式的时间(精确到分钟)
+func (s cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = cronDate(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, loc)
+	limit := t.AddDate(maxScheduleYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = cronDate(t.Year(), t.Month()+1, 1, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = cronDate(t.Year(), t.Month(), t.Day()+1, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = cronDate(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = cronDate(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, loc)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// cronDate 与 time.Date 相同, 但夏令时开始时跳过的时间会调整到跳过的时段之后.
+// time.Date 会将其调整到之前(如 02:00 调整为 01:00), 导致 Next 无法继续向后查找
+func cronDate(year int, month time.Month, day, hour, min int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, 0, 0, loc)
+	want := time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	if !time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Equal(want) {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
+
+// dayMatches 判断日期是否匹配, 日期和星期字段都不以 * 开头时满足其一即可, 否则需要同时满足
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// everySchedule 固定间隔的定时计划
+type everySchedule time.Duration
+
+// Next 返回指定时间加上固定间隔后的时间
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// systemd日历表达式中星期的写法
+var systemdWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// SystemdTimer 将定时计划转换为systemd定时器的配置
+// 参数:
+//   - spec: 定时计划
+//
+// 返回值:
+//   - []string: OnCalendar 的值, cron表达式的日期和星期字段都不以 * 开头时返回两条, 满足其一即运行
+//   - time.Duration: 固定间隔, 仅 @every 写法返回, 用于 OnUnitActiveSec
+//   - error: 定时计划无效时返回错误
+func SystemdTimer(spec string) ([]string, time.Duration, error) {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s, ok := schedule.(cronSchedule)
+	if !ok {
+		return nil, time.Duration(schedule.(everySchedule)), nil
+	}
+
+	month := systemdField(s.month, 1, 12)
+	clock := fmt.Sprintf("%s:%s:00", systemdField(s.hour, 0, 23), systemdField(s.minute, 0, 59))
+
+	// 星期的限制写在日期之前
+	var weekdays []string
+	for d := 0; d <= 6; d++ {
+		if s.dow&(1<<uint(d)) != 0 {
+			weekdays = append(weekdays, systemdWeekdays[d])
+		}
+	}
+	dom := systemdField(s.dom, 1, 31)
+
+	// 日期和星期需要同时满足时合并为一条, systemd 要求星期和日期同时匹配
+	if s.domAny || s.dowAny {
+		if len(weekdays) == len(systemdWeekdays) {
+			return []string{fmt.Sprintf("*-%s-%s %s", month, dom, clock)}, 0, nil
+		}
+		return []string{fmt.Sprintf("%s *-%s-%s %s", strings.Join(weekdays, ","), month, dom, clock)}, 0, nil
+	}
+	withDow := fmt.Sprintf("%s *-%s-* %s", strings.Join(weekdays, ","), month, clock)
+	withDom := fmt.Sprintf("*-%s-%s %s", month, dom, clock)
+	return []string{withDom, withDow}, 0, nil
+}
+
+// systemdField 将位图转换为systemd日历表达式中的一段, 全部匹配时返回 *
+func systemdField(bits uint64, min, max int) string {
+	var values []string
+	for v := min; v <= max; v++ {
+		if bits&(1<<uint(v)) != 0 {
+			values = append(values, fmt.Sprintf("%02d", v))
+		}
+	}
+	if len(values) == max-min+1 {
+		return "*"
+	}
+	return strings.Join(values, ",")
+}
+
+// CrontabExpr 将定时计划转换为crontab中的时间表达式
+// @every 写法只有在间隔能整除1小时或1天时才能转换, 转换后按整点对齐运行
+func CrontabExpr(spec string) (string, error) {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return "", err
+	}
+
+	if every, ok := schedule.(everySchedule); ok {
+		interval := time.Duration(every)
+		minutes := int(interval / time.Minute)
+		switch {
+		case interval%time.Minute != 0:
+		case minutes < 60 && 60%minutes == 0:
+			if minutes == 1 {
+				return "* * * * *", nil
+			}
+			return fmt.Sprintf("*/%d * * * *", minutes), nil
+		case minutes%60 == 0 && minutes/60 < 24 && 24%(minutes/60) == 0:
+			if minutes == 60 {
+				return "0 * * * *", nil
+			}
+			return fmt.Sprintf("0 */%d * * *", minutes/60), nil
+		case minutes == 24*60:
+			return "0 0 * * *", nil
+		}
+		return "", fmt.Errorf("间隔 %s 无法转换为crontab表达式, 请改用cron表达式", interval)
+	}
+
+	// 快捷写法统一为小写, ? 统一为 *
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") {
+		return strings.ToLower(spec), nil
+	}
+	fields := strings.Fields(spec)
+	for i, field := range fields {
+		if field == "?" {
+			fields[i] = "*"
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
@@ -0,0 +1,306 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// minute 返回 UTC 时区精确到分钟的时间
+func minute(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+// nextRuns 返回定时计划从指定时间开始的前 n 次运行时间
+func nextRuns(t *testing.T, spec string, from time.Time, n int) []time.Time {
+	t.Helper()
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		t.Fatalf("ParseSchedule(%q) 返回错误: %v", spec, err)
+	}
+	var runs []time.Time
+	for i := 0; i < n; i++ {
+		from = schedule.Next(from)
+		runs = append(runs, from)
+	}
+	return runs
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2025-06-01 是星期日
+	from := minute(2025, 6, 1, 0, 0)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "每天",
+			spec: "@daily",
+			from: from,
+			want: []time.Time{minute(2025, 6, 2, 0, 0), minute(2025, 6, 3, 0, 0)},
+		},
+		{
+			// 从下一分钟开始查找, 不会返回当前时间
+			name: "跳过当前分钟",
+			spec: "0 0 * * *",
+			from: minute(2025, 6, 1, 0, 0).Add(30 * time.Second),
+			want: []time.Time{minute(2025, 6, 2, 0, 0)},
+		},
+		{
+			name: "步长",
+			spec: "*/20 9 * * *",
+			from: from,
+			want: []time.Time{minute(2025, 6, 1, 9, 0), minute(2025, 6, 1, 9, 20), minute(2025, 6, 1, 9, 40), minute(2025, 6, 2, 9, 0)},
+		},
+		{
+			// 单个值带步长表示从该值到最大值
+			name: "单个值带步长",
+			spec: "5/15 * * * *",
+			from: from,
+			want: []time.Time{minute(2025, 6, 1, 0, 5), minute(2025, 6, 1, 0, 20), minute(2025, 6, 1, 0, 35), minute(2025, 6, 1, 0, 50), minute(2025, 6, 1, 1, 5)},
+		},
+		{
+			name: "范围和列表",
+			spec: "0 8-9,18 * * *",
+			from: from,
+			want: []time.Time{minute(2025, 6, 1, 8, 0), minute(2025, 6, 1, 9, 0), minute(2025, 6, 1, 18, 0), minute(2025, 6, 2, 8, 0)},
+		},
+		{
+			// 日期和星期都有限制时满足其一即可: 每月13日或每个星期一
+			name: "日期或星期",
+			spec: "0 0 13 * 1",
+			from: minute(2025, 6, 3, 0, 0),
+			want: []time.Time{minute(2025, 6, 9, 0, 0), minute(2025, 6, 13, 0, 0), minute(2025, 6, 16, 0, 0)},
+		},
+		{
+			// 日期字段以 * 开头时需要同时满足: 奇数日且为星期一
+			name: "带步长的日期与星期同时满足",
+			spec: "0 0 */2 * 1",
+			from: from,
+			want: []time.Time{minute(2025, 6, 9, 0, 0), minute(2025, 6, 23, 0, 0), minute(2025, 7, 7, 0, 0)},
+		},
+		{
+			name: "星期字段以 * 开头时只按日期",
+			spec: "0 0 15 * */1",
+			from: from,
+			want: []time.Time{minute(2025, 6, 15, 0, 0), minute(2025, 7, 15, 0, 0)},
+		},
+		{
+			name: "星期中的7表示星期日",
+			spec: "0 0 * * 7",
+			from: minute(2025, 6, 2, 0, 0),
+			want: []time.Time{minute(2025, 6, 8, 0, 0), minute(2025, 6, 15, 0, 0)},
+		},
+		{
+			name: "星期范围包含7",
+			spec: "0 0 * * 5-7",
+			from: minute(2025, 6, 2, 0, 0),
+			want: []time.Time{minute(2025, 6, 6, 0, 0), minute(2025, 6, 7, 0, 0), minute(2025, 6, 8, 0, 0), minute(2025, 6, 13, 0, 0)},
+		},
+		{
+			// 月份和星期的英文缩写不区分大小写
+			name: "月份和星期的缩写",
+			spec: "30 12 * FEB,aug Sun",
+			from: from,
+			want: []time.Time{minute(2025, 8, 3, 12, 30), minute(2025, 8, 10, 12, 30)},
+		},
+		{
+			name: "星期缩写范围",
+			spec: "0 7 * * mon-fri",
+			from: minute(2025, 6, 6, 8, 0),
+			want: []time.Time{minute(2025, 6, 9, 7, 0), minute(2025, 6, 10, 7, 0)},
+		},
+		{
+			// 2月29日只在闰年运行
+			name: "闰日",
+			spec: "0 0 29 2 *",
+			from: from,
+			want: []time.Time{minute(2028, 2, 29, 0, 0), minute(2032, 2, 29, 0, 0)},
+		},
+		{
+			name: "跨年",
+			spec: "@yearly",
+			from: minute(2025, 12, 31, 23, 59),
+			want: []time.Time{minute(2026, 1, 1, 0, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextRuns(t, tt.spec, tt.from, len(tt.want))
+			for i := range tt.want {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("第 %d 次运行时间 = %s, 期望 %s", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCronScheduleLimit(t *testing.T) {
+	// 在查找范围内没有匹配的时间时返回零值
+	for _, spec := range []string{"0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) 返回错误: %v", spec, err)
+		}
+		if next := schedule.Next(minute(2025, 1, 1, 0, 0)); !next.IsZero() {
+			t.Errorf("%q 的下一次运行时间 = %s, 期望零值", spec, next)
+		}
+	}
+
+	// 星期字段以 * 开头时需要同时满足: 恰好是星期日的2月29日, 2032年之后是2060年
+	schedule, err := ParseSchedule("0 0 29 2 */7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := schedule.Next(minute(2028, 1, 1, 0, 0)); !next.Equal(minute(2032, 2, 29, 0, 0)) {
+		t.Errorf("下一次运行时间 = %s, 期望 2032-02-29", next)
+	}
+	// 下一次运行时间超出 maxScheduleYears 年的查找范围时返回零值
+	if next := schedule.Next(minute(2025, 1, 1, 0, 0)); !next.IsZero() {
+		t.Errorf("超出查找范围的下一次运行时间 = %s, 期望零值", next)
+	}
+}
+
+func TestCronScheduleDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("无法加载时区: %v", err)
+	}
+
+	// 2025-03-09 02:00 开始夏令时, 当天不存在 02:30, 跳过当天
+	runs := nextRuns(t, "30 2 * * *", time.Date(2025, 3, 8, 3, 0, 0, 0, loc), 2)
+	want := []time.Time{time.Date(2025, 3, 10, 2, 30, 0, 0, loc), time.Date(2025, 3, 11, 2, 30, 0, 0, loc)}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			t.Errorf("夏令时开始: 第 %d 次运行时间 = %s, 期望 %s", i+1, runs[i], want[i])
+		}
+	}
+
+	// 夏令时开始当天的其他时间正常运行
+	runs = nextRuns(t, "0 3 * * *", time.Date(2025, 3, 8, 12, 0, 0, 0, loc), 1)
+	if want := time.Date(2025, 3, 9, 3, 0, 0, 0, loc); !runs[0].Equal(want) {
+		t.Errorf("夏令时开始当天 03:00 = %s, 期望 %s", runs[0], want)
+	}
+
+	// 2025-11-02 02:00 结束夏令时, 01:30 出现两次, 只运行一次
+	runs = nextRuns(t, "30 1 * * *", time.Date(2025, 11, 1, 12, 0, 0, 0, loc), 2)
+	if runs[0].Day() != 2 || runs[0].Hour() != 1 || runs[0].Minute() != 30 {
+		t.Errorf("夏令时结束: 第 1 次运行时间 = %s", runs[0])
+	}
+	if want := time.Date(2025, 11, 3, 1, 30, 0, 0, loc); !runs[1].Equal(want) {
+		t.Errorf("夏令时结束: 第 2 次运行时间 = %s, 期望 %s", runs[1], want)
+	}
+
+	// 固定间隔按实际经过的时间计算, 不受夏令时影响
+	runs = nextRuns(t, "@every 1h", time.Date(2025, 3, 9, 1, 0, 0, 0, loc), 1)
+	if runs[0].Sub(time.Date(2025, 3, 9, 1, 0, 0, 0, loc)) != time.Hour || runs[0].Hour() != 3 {
+		t.Errorf("固定间隔跨越夏令时 = %s", runs[0])
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@foo",
+		"@every",
+		"@every 30s",
+		"@every abc",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) 未返回错误", spec)
+		}
+	}
+}
+
+func TestSystemdTimer(t *testing.T) {
+	tests := []struct {
+		spec     string
+		calendar []string
+		interval time.Duration
+	}{
+		{spec: "@daily", calendar: []string{"*-*-* 00:00:00"}},
+		{spec: "@hourly", calendar: []string{"*-*-* *:00:00"}},
+		{spec: "@weekly", calendar: []string{"Sun *-*-* 00:00:00"}},
+		{spec: "@monthly", calendar: []string{"*-*-01 00:00:00"}},
+		{spec: "*/15 * * * *", calendar: []string{"*-*-* *:00,15,30,45:00"}},
+		{spec: "30 2 * * 1-5", calendar: []string{"Mon,Tue,Wed,Thu,Fri *-*-* 02:30:00"}},
+		{spec: "0 0 * * 0,7", calendar: []string{"Sun *-*-* 00:00:00"}},
+		{spec: "0 6 1 jan,jul *", calendar: []string{"*-01,07-01 06:00:00"}},
+		// 日期和星期都有限制时满足其一即可, 生成两条
+		{spec: "0 0 13 * 5", calendar: []string{"*-*-13 00:00:00", "Fri *-*-* 00:00:00"}},
+		// 日期字段以 * 开头时需要同时满足, 合并为一条
+		{spec: "0 0 */10 * 1", calendar: []string{"Mon *-*-01,11,21,31 00:00:00"}},
+		{spec: "@every 90m", interval: 90 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			calendar, interval, err := SystemdTimer(tt.spec)
+			if err != nil {
+				t.Fatalf("SystemdTimer(%q) 返回错误: %v", tt.spec, err)
+			}
+			if strings.Join(calendar, "|") != strings.Join(tt.calendar, "|") || interval != tt.interval {
+				t.Errorf("SystemdTimer(%q) = %q, %s, 期望 %q, %s", tt.spec, calendar, interval, tt.calendar, tt.interval)
+			}
+		})
+	}
+
+	if _, _, err := SystemdTimer("bad"); err == nil {
+		t.Errorf("SystemdTimer 未对无效的定时计划返回错误")
+	}
+}
+
+func TestCrontabExpr(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "@Daily", want: "@daily"},
+		{spec: "0  3 ? * 1", want: "0 3 * * 1"},
+		{spec: "*/5 * * * mon-fri", want: "*/5 * * * mon-fri"},
+		{spec: "@every 1m", want: "* * * * *"},
+		{spec: "@every 15m", want: "*/15 * * * *"},
+		{spec: "@every 1h", want: "0 * * * *"},
+		{spec: "@every 6h", want: "0 */6 * * *"},
+		{spec: "@every 24h", want: "0 0 * * *"},
+		{spec: "@every 7m", wantErr: true},
+		{spec: "@every 90m", wantErr: true},
+		{spec: "@every 5h", wantErr: true},
+		{spec: "@every 48h", wantErr: true},
+		{spec: "@every 90s", wantErr: true},
+		{spec: "bad", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := CrontabExpr(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("CrontabExpr(%q) = %q, 期望返回错误", tt.spec, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("CrontabExpr(%q) = %q, %v, 期望 %q", tt.spec, got, err, tt.want)
+			}
+		})
+	}
+}
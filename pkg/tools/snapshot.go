@@ -0,0 +1,354 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SnapshotSuffix 快照任务的备份文件名为快照目录名加上该后缀, 用于区分快照目录和备份文件
+const SnapshotSuffix = "/"
+
+// IsSnapshotRecord 判断备份记录是否为快照任务的版本, 此类版本的备份文件是备份目录中的一个快照目录
+func IsSnapshotRecord(record globals.BackupRecord) bool {
+	return strings.HasSuffix(record.BackupFileName, SnapshotSuffix)
+}
+
+// SnapshotName 返回备份时间对应的快照目录名, 即记录中的备份文件名
+func SnapshotName(backupTime string) string {
+	return backupTime + SnapshotSuffix
+}
+
+// SnapshotStats 表示一次快照的统计信息
+type SnapshotStats struct {
+	Copied int   // 新增或变化后复制的文件数
+	Linked int   // 未变化而硬链接到上一个快照的文件数
+	Files  int   // 快照中的文件数, 包括软链接
+	Dirs   int   // 快照中的目录数
+	Bytes  int64 // 本次复制的字节数
+	Size   int64 // 快照中文件的总大小(字节)
+}
+
+// String 返回统计信息的可读描述
+func (s SnapshotStats) String() string {
+	return fmt.Sprintf("复制 %d, 硬链接 %d", s.Copied, s.Linked)
+}
+
+// CreateSnapshot 将目标路径保存为一个完整的快照目录, 目录结构与备份文件相同, 包含目标路径的顶层目录
+// 与上一个快照相比未变化的文件(大小、修改时间、权限和所有者都相同)以硬链接指向上一个快照中的文件,
+// 新增或变化的文件才会复制; 快照先在临时目录中生成, 完成后再重命名为快照目录
+// 参数:
+//   - ctx: 上下文, 取消后停止并删除未完成的快照
+//   - source: 目标目录或文件
+//   - dir: 快照目录, 不能已存在
+//   - prev: 上一个快照目录, 为空时复制所有文件
+//   - excludeFunc: 排除函数, 为nil时不排除任何文件
+//
+// 返回值:
+//   - SnapshotStats: 快照的统计信息
+//   - error: 创建失败时返回错误
+func CreateSnapshot(ctx context.Context, source, dir, prev string, excludeFunc globals.ExcludeFunc) (SnapshotStats, error) {
+	var stats SnapshotStats
+	if excludeFunc == nil {
+		excludeFunc = globals.NoExcludeFunc
+	}
+
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return stats, fmt.Errorf("获取目标目录的绝对路径失败: %w", err)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return stats, fmt.Errorf("获取快照目录的绝对路径失败: %w", err)
+	}
+	if IsInDir(source, dir) || IsInDir(dir, source) {
+		return stats, fmt.Errorf("快照目录 %s 与目标目录 %s 不能相互包含", dir, source)
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return stats, fmt.Errorf("快照目录已存在: %s", dir)
+	}
+	root := filepath.Dir(source)
+
+	// 在临时目录中生成快照, 中止备份时会被删除
+	tmpDir := dir + PartialSuffix
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return stats, fmt.Errorf("删除未完成的快照 %s 失败: %w", tmpDir, err)
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return stats, fmt.Errorf("创建快照目录失败: %w", err)
+	}
+	TrackPartial(tmpDir)
+	defer func() {
+		UntrackPartial(tmpDir)
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	var dirs []string // 需要在快照完成后恢复属性的目录
+	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("遍历目录时出错: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if excludeFunc(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("获取相对路径失败: %w", err)
+		}
+		target := filepath.Join(tmpDir, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("创建目录 %s 失败: %w", target, err)
+			}
+			stats.Dirs++
+			dirs = append(dirs, rel)
+
+		case mode.IsRegular():
+			stats.Files++
+			stats.Size += info.Size()
+			if prev != "" && linkUnchanged(filepath.Join(prev, rel), target, info) {
+				stats.Linked++
+				return nil
+			}
+			if err := mirrorFile(ctx, path, target, info); err != nil {
+				return err
+			}
+			stats.Copied++
+			stats.Bytes += info.Size()
+
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("读取软链接 %s 失败: %w", path, err)
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return fmt.Errorf("创建软链接 %s 失败: %w", target, err)
+			}
+			preserveOwner(target, info)
+			stats.Files++
+
+		default:
+			// 设备文件、管道等特殊文件不保存
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := restoreDirs(root, tmpDir, dirs); err != nil {
+		return stats, err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return stats, fmt.Errorf("重命名快照目录失败: %w", err)
+	}
+	return stats, nil
+}
+
+// linkUnchanged 文件与上一个快照中的文件相同时创建硬链接, 返回是否已创建
+// 硬链接共享文件的属性, 因此权限和所有者也必须相同; 跨文件系统或链接数达到上限时返回 false, 由调用方复制文件
+func linkUnchanged(prevPath, target string, info os.FileInfo) bool {
+	prevInfo, err := os.Lstat(prevPath)
+	if err != nil || !prevInfo.Mode().IsRegular() {
+		return false
+	}
+	if prevInfo.Size() != info.Size() || !prevInfo.ModTime().Equal(info.ModTime()) ||
+		prevInfo.Mode().Perm() != info.Mode().Perm() || !sameOwner(prevInfo, info) {
+		return false
+	}
+	return os.Link(prevPath, target) == nil
+}
+
+// SnapshotHash 计算快照目录的哈希值(MD5的后8位), 用作快照版本的版本哈希
+// 哈希值由快照中每个条目的路径、类型、大小、修改时间和权限计算, 不读取文件内容,
+// 用于发现快照中被删除、替换或修改过的文件
+// 参数:
+//   - dir: 快照目录
+//
+// 返回值:
+//   - string: 哈希值的后8位
+//   - error: 遍历失败时返回错误
+func SnapshotHash(dir string) (string, error) {
+	sum, err := SnapshotDigest(dir)
+	if err != nil {
+		return "", err
+	}
+	return sum[len(sum)-8:], nil
+}
+
+// SnapshotDigest 计算快照目录完整的MD5哈希值, 计算方式与 SnapshotHash 相同
+func SnapshotDigest(dir string) (string, error) {
+	hash := md5.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("遍历快照目录时出错: %w", err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("获取相对路径失败: %w", err)
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			fmt.Fprintf(hash, "d %s %o\n", rel, mode.Perm())
+		case mode.IsRegular():
+			fmt.Fprintf(hash, "f %s %d %d %o\n", rel, info.Size(), info.ModTime().UnixNano(), mode.Perm())
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("读取软链接 %s 失败: %w", path, err)
+			}
+			fmt.Fprintf(hash, "l %s %s\n", rel, link)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// SnapshotSize 返回快照目录占用的磁盘空间
+// 与其他快照共享的硬链接文件按链接数平均分摊, 所有快照的大小之和即为快照实际占用的空间
+func SnapshotSize(dir string) int64 {
+	var size int64
+	_ = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size() / linkCount(info)
+		}
+		return nil
+	})
+	return size
+}
+
+// LatestSnapshot 查询任务最新的快照目录, 用于创建下一个快照时硬链接未变化的文件
+// 参数:
+//   - db: 数据库连接
+//   - taskID: 任务ID
+//
+// 返回值:
+//   - string: 最新的快照目录, 没有快照或快照目录已不存在时返回空字符串
+//   - error: 查询失败时返回错误
+func LatestSnapshot(db *sqlx.DB, taskID int) (string, error) {
+	var record globals.BackupRecord
+	querySql := `SELECT backup_file_name, backup_path FROM backup_records
+		WHERE task_id = ? AND ` + SuccessStatusSql + ` AND backup_file_name LIKE ? ORDER BY timestamp DESC, rowid DESC LIMIT 1`
+	if err := db.Get(&record, querySql, taskID, "%"+SnapshotSuffix); err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("查询最新的快照失败: %w", err)
+	}
+
+	dir := filepath.Join(record.BackupPath, record.BackupFileName)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", nil
+	}
+	return dir, nil
+}
+
+// snapshotTop 返回快照目录中保存的目标路径, 即快照目录中唯一的顶层条目
+func snapshotTop(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("快照目录不存在: %w", err)
+	}
+	if len(entries) != 1 {
+		return "", fmt.Errorf("快照目录 %s 应只包含一个顶层条目, 实际包含 %d 个", dir, len(entries))
+	}
+	return filepath.Join(dir, entries[0].Name()), nil
+}
+
+// OpenSnapshot 打开快照版本的读取器, 条目路径与备份文件中的路径一致
+// 快照中的文件没有保存校验值, 打开时读取所有文件计算 CRC32
+// 参数:
+//   - record: 快照版本的备份记录
+//
+// 返回值:
+//   - VersionReader: 版本读取器
+//   - error: 快照目录不存在或读取失败时返回错误
+func OpenSnapshot(record globals.BackupRecord) (VersionReader, error) {
+	top, err := snapshotTop(filepath.Join(record.BackupPath, record.BackupFileName))
+	if err != nil {
+		return nil, err
+	}
+	reader, err := OpenDirReader(top, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := FillChecksums(reader, nil, true); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// VerifySnapshot 校验快照目录的哈希值是否与记录一致
+func VerifySnapshot(record globals.BackupRecord) error {
+	dir := filepath.Join(record.BackupPath, record.BackupFileName)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("快照目录不存在: %w", err)
+	}
+	hash, err := SnapshotHash(dir)
+	if err != nil {
+		return err
+	}
+	if hash != record.VersionHash {
+		return fmt.Errorf("快照 %s 的哈希值 %s 与记录的哈希值 %s 不一致, 快照中的文件可能已被修改", dir, hash, record.VersionHash)
+	}
+	return nil
+}
+
+// RestoreSnapshot 将快照版本复制到输出路径, 与解压备份文件相同, 输出路径下会生成目标路径的顶层目录或文件
+// 参数:
+//   - ctx: 上下文
+//   - record: 快照版本的备份记录
+//   - outputPath: 输出路径, 必须已存在
+//
+// 返回值:
+//   - string: 输出路径
+//   - error: 输出路径下存在同名或复制失败时返回错误
+func RestoreSnapshot(ctx context.Context, record globals.BackupRecord, outputPath string) (string, error) {
+	if _, err := CheckPath(outputPath); err != nil {
+		return "", fmt.Errorf("解压输出路径不存在: %w", err)
+	}
+	top, err := snapshotTop(filepath.Join(record.BackupPath, record.BackupFileName))
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(outputPath, filepath.Base(top))
+	if _, err := os.Lstat(target); err == nil {
+		return "", fmt.Errorf("解压输出路径下存在同名: %s", target)
+	}
+
+	// 复制为独立的文件, 不与快照共享硬链接; 目标为单个文件时直接复制到输出路径下
+	info, err := os.Lstat(top)
+	if err != nil {
+		return "", fmt.Errorf("读取快照失败: %w", err)
+	}
+	dest := target
+	if !info.IsDir() {
+		dest = outputPath
+	}
+	if _, err := MirrorDirectory(ctx, top, dest, nil, false); err != nil {
+		return "", fmt.Errorf("复制快照失败: %w", err)
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sameFile 判断两个路径是否为同一个文件的硬链接
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(a)
+	if err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// snapshotDigest 计算快照目录的哈希值, 出错时终止测试
+func snapshotDigest(t *testing.T, dir string) string {
+	t.Helper()
+	sum, err := SnapshotDigest(dir)
+	if err != nil {
+		t.Fatalf("计算快照 %s 的哈希值失败: %v", dir, err)
+	}
+	return sum
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	ctx := context.Background()
+	source := filepath.Join(t.TempDir(), "data")
+	backupDir := t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+		"app.log":   "log",
+	})
+
+	first := filepath.Join(backupDir, "20240101000000")
+	stats, err := CreateSnapshot(ctx, source, first, "", excludeLogs)
+	if err != nil {
+		t.Fatalf("创建第一个快照失败: %v", err)
+	}
+	want := map[string]string{"data/a.txt": "a", "data/sub/b.txt": "b"}
+	if got := readFiles(t, first); !reflect.DeepEqual(got, want) {
+		t.Fatalf("第一个快照中的文件 = %v, 期望 %v", got, want)
+	}
+	if stats.Copied != 2 || stats.Linked != 0 || stats.Files != 2 || stats.Dirs != 2 {
+		t.Errorf("第一个快照的统计 = %+v, 期望复制 2, 文件数 2, 目录数 2", stats)
+	}
+	if _, err := os.Stat(first + PartialSuffix); !os.IsNotExist(err) {
+		t.Errorf("快照完成后临时目录没有被删除: %v", err)
+	}
+
+	// 未变化的文件硬链接到上一个快照, 变化的文件重新复制
+	writeFiles(t, source, map[string]string{"sub/b.txt": "bb"})
+	second := filepath.Join(backupDir, "20240102000000")
+	stats, err = CreateSnapshot(ctx, source, second, first, excludeLogs)
+	if err != nil {
+		t.Fatalf("创建第二个快照失败: %v", err)
+	}
+	if stats.Copied != 1 || stats.Linked != 1 || stats.Bytes != 2 {
+		t.Errorf("第二个快照的统计 = %+v, 期望复制 1, 硬链接 1, 复制 2 字节", stats)
+	}
+	if !sameFile(t, filepath.Join(first, "data", "a.txt"), filepath.Join(second, "data", "a.txt")) {
+		t.Error("未变化的文件没有硬链接到上一个快照")
+	}
+	if sameFile(t, filepath.Join(first, "data", "sub", "b.txt"), filepath.Join(second, "data", "sub", "b.txt")) {
+		t.Error("变化的文件不应硬链接到上一个快照")
+	}
+	want = map[string]string{"data/a.txt": "a", "data/sub/b.txt": "b"}
+	if got := readFiles(t, first); !reflect.DeepEqual(got, want) {
+		t.Errorf("创建新快照后上一个快照中的文件 = %v, 期望不变 %v", got, want)
+	}
+	want = map[string]string{"data/a.txt": "a", "data/sub/b.txt": "bb"}
+	if got := readFiles(t, second); !reflect.DeepEqual(got, want) {
+		t.Errorf("第二个快照中的文件 = %v, 期望 %v", got, want)
+	}
+
+	if _, err := CreateSnapshot(ctx, source, second, first, excludeLogs); err == nil {
+		t.Error("快照目录已存在时应返回错误")
+	}
+}
+
+func TestSnapshotDigest(t *testing.T) {
+	ctx := context.Background()
+	source := filepath.Join(t.TempDir(), "data")
+	backupDir := t.TempDir()
+	writeFiles(t, source, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+
+	first := filepath.Join(backupDir, "first")
+	if _, err := CreateSnapshot(ctx, source, first, "", nil); err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	second := filepath.Join(backupDir, "second")
+	if _, err := CreateSnapshot(ctx, source, second, first, nil); err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+
+	digest := snapshotDigest(t, first)
+	if got := snapshotDigest(t, second); got != digest {
+		t.Errorf("内容相同的快照哈希值不同: %s, %s", got, digest)
+	}
+	hash, err := SnapshotHash(first)
+	if err != nil || hash != digest[len(digest)-8:] {
+		t.Errorf("SnapshotHash = %q, %v, 期望完整哈希值的后8位 %q", hash, err, digest[len(digest)-8:])
+	}
+
+	// 修改、删除或新增文件后哈希值变化
+	changes := []struct {
+		name   string
+		change func(dir string) error
+	}{
+		{"修改文件内容", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "data", "a.txt"), []byte("changed"), 0644)
+		}},
+		{"修改权限", func(dir string) error {
+			return os.Chmod(filepath.Join(dir, "data", "a.txt"), 0600)
+		}},
+		{"删除文件", func(dir string) error {
+			return os.Remove(filepath.Join(dir, "data", "sub", "b.txt"))
+		}},
+		{"新增文件", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "data", "c.txt"), nil, 0644)
+		}},
+	}
+	for _, tt := range changes {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(backupDir, tt.name)
+			if _, err := CreateSnapshot(ctx, source, dir, "", nil); err != nil {
+				t.Fatalf("创建快照失败: %v", err)
+			}
+			if err := tt.change(dir); err != nil {
+				t.Fatalf("修改快照失败: %v", err)
+			}
+			if got := snapshotDigest(t, dir); got == digest {
+				t.Errorf("%s后哈希值没有变化", tt.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage 表示保存备份文件的存储位置
+// 任务的备份目录和备份记录的 backup_path 保存存储位置, 本地路径使用本地存储,
+// s3:// 开头的地址使用 S3 兼容的对象存储, sftp:// 开头的地址通过 SFTP 访问远程主机
+type Storage interface {
+	// Location 返回存储位置
+	Location() string
+	// Put 将本地文件上传到存储位置中, 保存为 name
+	Put(ctx context.Context, localPath, name string) error
+	// Open 打开存储位置中的文件用于读取
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Size 返回存储位置中文件的大小, 文件不存在时返回 os.ErrNotExist
+	Size(ctx context.Context, name string) (int64, error)
+	// Remove 删除存储位置中的文件, 文件不存在时不返回错误
+	Remove(ctx context.Context, name string) error
+	// List 列出存储位置中的所有文件
+	List(ctx context.Context) ([]StorageObject, error)
+	// Close 关闭与存储的连接
+	Close() error
+}
+
+// RandomAccessStorage 表示支持随机读取文件的存储, 可以直接从存储中读取备份文件而不需要先下载到本地
+type RandomAccessStorage interface {
+	Storage
+	// OpenReaderAt 打开存储位置中的文件用于随机读取, 同时返回文件大小
+	OpenReaderAt(ctx context.Context, name string) (ReaderAtCloser, int64, error)
+}
+
+// ReaderAtCloser 表示可随机读取的文件
+type ReaderAtCloser interface {
+	io.ReaderAt
+	io.ReadCloser
+}
+
+// StorageObject 表示存储位置中的一个文件
+type StorageObject struct {
+	Name string // 文件名
+	Size int64  // 文件大小(字节)
+}
+
+// IsRemoteLocation 判断存储位置是否为远程存储, 例如 s3://bucket/prefix 或 sftp://host/path
+func IsRemoteLocation(location string) bool {
+	return strings.Contains(location, "://")
+}
+
+// OpenStorage 打开存储位置
+// 参数:
+//   - location: 本地目录或远程存储地址
+//
+// 返回值:
+//   - Storage: 存储位置
+//   - error: 地址无效或缺少凭证时返回错误
+func OpenStorage(location string) (Storage, error) {
+	scheme, _, ok := strings.Cut(location, "://")
+	if !ok {
+		return &LocalStorage{Dir: location}, nil
+	}
+	switch strings.ToLower(scheme) {
+	case "s3":
+		return NewS3Storage(location)
+	case "sftp":
+		return NewSFTPStorage(location)
+	}
+	return nil, fmt.Errorf("不支持的存储类型: %s, 可选: 本地目录, s3://, sftp://", scheme)
+}
+
+// CheckLocation 检查远程存储地址的格式, 不会连接存储或读取凭证
+func CheckLocation(location string) error {
+	scheme, _, ok := strings.Cut(location, "://")
+	if !ok {
+		return nil
+	}
+	switch strings.ToLower(scheme) {
+	case "s3":
+		_, err := parseS3Location(location)
+		return err
+	case "sftp":
+		_, err := NewSFTPStorage(location)
+		return err
+	}
+	return fmt.Errorf("不支持的存储类型: %s, 可选: 本地目录, s3://, sftp://", scheme)
+}
+
+// JoinLocation 返回存储位置中文件的完整地址
+func JoinLocation(location, name string) string {
+	if !IsRemoteLocation(location) {
+		return filepath.Join(location, name)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return strings.TrimSuffix(location, "/") + "/" + name
+	}
+	u.Path = path.Join("/", u.Path, name)
+	u.RawPath = ""
+	return u.String()
+}
+
+// SplitLocation 将存储位置拆分为上级位置和最后一级名称
+func SplitLocation(location string) (string, string) {
+	if !IsRemoteLocation(location) {
+		return filepath.Dir(location), filepath.Base(location)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location, ""
+	}
+	dir, name := path.Split(strings.TrimSuffix(u.Path, "/"))
+	u.Path = strings.TrimSuffix(dir, "/")
+	u.RawPath = ""
+	return u.String(), name
+}
+
+// OpenVersionFile 打开备份版本的备份文件用于随机读取
+// 本地存储直接打开备份文件; 支持随机读取的远程存储直接读取远程文件;
+// 其他远程存储先下载到临时目录, 关闭文件时删除
+// 参数:
+//   - ctx: 上下文
+//   - record: 备份记录
+//
+// 返回值:
+//   - ReaderAtCloser: 备份文件, 使用完毕后需要关闭
+//   - int64: 备份文件大小
+//   - error: 打开或下载失败时返回错误
+func OpenVersionFile(ctx context.Context, record globals.BackupRecord) (ReaderAtCloser, int64, error) {
+	if IsMirrorRecord(record) {
+		return nil, 0, fmt.Errorf("版本 %s 是镜像任务的同步记录, 没有备份文件, 镜像位于: %s", record.VersionID, record.BackupPath)
+	}
+	if IsSnapshotRecord(record) {
+		return nil, 0, fmt.Errorf("版本 %s 是快照任务的快照目录, 没有备份文件, 快照位于: %s", record.VersionID, filepath.Join(record.BackupPath, record.BackupFileName))
+	}
+	if !IsRemoteLocation(record.BackupPath) {
+		file, err := os.Open(filepath.Join(record.BackupPath, record.BackupFileName))
+		if err != nil {
+			return nil, 0, fmt.Errorf("备份文件不存在: %w", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, 0, fmt.Errorf("获取备份文件信息失败: %w", err)
+		}
+		return file, info.Size(), nil
+	}
+
+	store, err := OpenStorage(record.BackupPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	notExist := func(err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("备份文件不存在: %s", JoinLocation(record.BackupPath, record.BackupFileName))
+		}
+		return err
+	}
+
+	// 直接读取远程文件, 关闭文件时一并关闭与存储的连接
+	if ra, ok := store.(RandomAccessStorage); ok {
+		file, size, err := ra.OpenReaderAt(ctx, record.BackupFileName)
+		if err != nil {
+			_ = store.Close()
+			return nil, 0, notExist(err)
+		}
+		return &storageFile{ReaderAtCloser: file, cleanup: func() { _ = store.Close() }}, size, nil
+	}
+
+	defer store.Close()
+	size, err := store.Size(ctx, record.BackupFileName)
+	if err != nil {
+		return nil, 0, notExist(fmt.Errorf("获取备份文件信息失败: %w", err))
+	}
+	reader, err := store.Open(ctx, record.BackupFileName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("下载备份文件失败: %w", err)
+	}
+	defer reader.Close()
+
+	tmpDir, err := os.MkdirTemp("", "cbk-fetch-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(tmpDir) }
+
+	file, err := os.Create(filepath.Join(tmpDir, record.BackupFileName))
+	if err != nil {
+		cleanup()
+		return nil, 0, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	bar := newBytesBar(size, "正在下载")
+	if _, err := io.Copy(io.MultiWriter(file, bar), reader); err != nil {
+		_ = file.Close()
+		cleanup()
+		return nil, 0, fmt.Errorf("下载备份文件失败: %w", err)
+	}
+	_ = bar.Finish()
+	return &storageFile{ReaderAtCloser: file, cleanup: cleanup}, size, nil
+}
+
+// OpenVersion 打开备份版本的读取器, 快照版本直接读取快照目录
+func OpenVersion(ctx context.Context, record globals.BackupRecord) (VersionReader, error) {
+	if IsSnapshotRecord(record) {
+		return OpenSnapshot(record)
+	}
+	file, size, err := OpenVersionFile(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := OpenZipReaderAt(file, size)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// storageFile 关闭时执行清理, 例如删除下载的临时文件或关闭与存储的连接
+type storageFile struct {
+	ReaderAtCloser
+	cleanup func()
+}
+
+func (f *storageFile) Close() error {
+	defer f.cleanup()
+	return f.ReaderAtCloser.Close()
+}
+
+// ClearRemoteLocation 删除远程存储位置中的所有文件
+// 参数:
+//   - ctx: 上下文
+//   - location: 远程存储地址
+//   - keep: 需要保留的文件地址(由 JoinLocation 构建), 可以为 nil
+//
+// 返回值:
+//   - int: 删除的文件数量
+//   - error: 列出或删除文件失败时返回错误
+func ClearRemoteLocation(ctx context.Context, location string, keep map[string]bool) (int, error) {
+	store, err := OpenStorage(location)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	objects, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, object := range objects {
+		if keep[JoinLocation(location, object.Name)] {
+			continue
+		}
+		if err := store.Remove(ctx, object.Name); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// LocalStorage 本地目录存储
+type LocalStorage struct {
+	Dir string // 备份目录
+}
+
+// Location 返回备份目录
+func (s *LocalStorage) Location() string {
+	return s.Dir
+}
+
+// Put 将文件移动到备份目录中, 文件已在备份目录中且名称相同时不做任何操作
+func (s *LocalStorage) Put(_ context.Context, localPath, name string) error {
+	dst := filepath.Join(s.Dir, name)
+	if filepath.Clean(localPath) == filepath.Clean(dst) {
+		return nil
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(localPath, dst); err == nil {
+		return nil
+	}
+	return moveFile(localPath, dst)
+}
+
+// Open 打开备份目录中的文件
+func (s *LocalStorage) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, name))
+}
+
+// Size 返回备份目录中文件的大小
+func (s *LocalStorage) Size(_ context.Context, name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(s.Dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Remove 删除备份目录中的文件
+func (s *LocalStorage) Remove(_ context.Context, name string) error {
+	if err := os.Remove(filepath.Join(s.Dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List 列出备份目录中的所有文件
+func (s *LocalStorage) List(_ context.Context) ([]StorageObject, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var objects []StorageObject
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, StorageObject{Name: entry.Name(), Size: info.Size()})
+	}
+	return objects, nil
+}
+
+// Close 本地存储没有需要关闭的连接
+func (s *LocalStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,663 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 分片上传的默认分片大小, 小于该大小的文件使用单次上传
+const defaultS3PartSize = 16 * 1024 * 1024
+
+// S3 分片上传的分片大小下限和分片数量上限
+const (
+	minS3PartSize = 5 * 1024 * 1024
+	maxS3Parts    = 10000
+)
+
+// 空请求体的 SHA256 值
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Storage S3 兼容的对象存储
+// 地址格式为 s3://bucket/prefix, 支持以下查询参数:
+//   - endpoint: 服务地址, 例如 http://127.0.0.1:9000, 默认使用 AWS S3
+//   - region: 区域, 默认依次读取环境变量 AWS_REGION、AWS_DEFAULT_REGION 和 ~/.aws/config, 都没有时为 us-east-1
+//   - profile: 凭证配置名, 默认读取环境变量 AWS_PROFILE, 都没有时为 default
+//   - path_style: 是否使用路径风格访问, 指定 endpoint 时默认为 true
+//   - part_size: 分片上传的分片大小, 默认为 16MB, 最小为 5MB
+type S3Storage struct {
+	location  string
+	bucket    string
+	prefix    string
+	endpoint  *url.URL
+	region    string
+	profile   string
+	pathStyle bool
+	partSize  int64
+	creds     s3Credentials
+	client    *http.Client
+}
+
+// s3Credentials S3 访问凭证
+type s3Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// S3Error S3 服务返回的错误
+type S3Error struct {
+	StatusCode int    // HTTP 状态码
+	Code       string `xml:"Code"`    // 错误码
+	Message    string `xml:"Message"` // 错误信息
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 请求失败: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("S3 请求失败: HTTP %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is 使 404 错误可以通过 errors.Is(err, os.ErrNotExist) 判断
+func (e *S3Error) Is(target error) bool {
+	return target == os.ErrNotExist && (e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey")
+}
+
+// NewS3Storage 打开 S3 兼容的对象存储
+// 参数:
+//   - location: 存储地址, 例如 s3://bucket/prefix?endpoint=http://127.0.0.1:9000
+//
+// 返回值:
+//   - *S3Storage: 对象存储
+//   - error: 地址无效或缺少凭证时返回错误
+func NewS3Storage(location string) (*S3Storage, error) {
+	s, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	if s.creds, err = loadS3Credentials(s.profile); err != nil {
+		return nil, err
+	}
+	if s.region == "" {
+		s.region = loadS3Region(s.profile)
+	}
+	if s.endpoint == nil {
+		s.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", s.region)}
+	}
+	return s, nil
+}
+
+// parseS3Location 解析 S3 存储地址
+func parseS3Location(location string) (*S3Storage, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("无效的S3地址: %s: %w", location, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("无效的S3地址: %s, 缺少存储桶名称, 示例: s3://bucket/prefix", location)
+	}
+
+	s := &S3Storage{
+		location: location,
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		partSize: defaultS3PartSize,
+		client:   &http.Client{},
+	}
+	query := u.Query()
+	s.region = query.Get("region")
+	s.profile = query.Get("profile")
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		ep, err := url.Parse(endpoint)
+		if err != nil || ep.Host == "" || (ep.Scheme != "http" && ep.Scheme != "https") {
+			return nil, fmt.Errorf("无效的S3服务地址: %s, 示例: http://127.0.0.1:9000", endpoint)
+		}
+		s.endpoint = ep
+		s.pathStyle = true
+	}
+	if v := query.Get("path_style"); v != "" {
+		if s.pathStyle, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("无效的 path_style 参数: %s", v)
+		}
+	}
+	if v := query.Get("part_size"); v != "" {
+		if s.partSize, err = ParseSize(v); err != nil {
+			return nil, fmt.Errorf("无效的 part_size 参数: %w", err)
+		}
+		if s.partSize < minS3PartSize {
+			return nil, fmt.Errorf("分片大小不能小于5MB: %s", v)
+		}
+	}
+	return s, nil
+}
+
+// loadS3Credentials 读取 S3 凭证
+// 未指定配置名时优先使用环境变量 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY,
+// 否则读取 ~/.aws/credentials(可通过 AWS_SHARED_CREDENTIALS_FILE 指定)和 ~/.aws/config 中的配置
+func loadS3Credentials(profile string) (s3Credentials, error) {
+	if profile == "" {
+		accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if accessKey != "" && secretKey != "" {
+			return s3Credentials{AccessKey: accessKey, SecretKey: secretKey, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+		}
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	for _, section := range awsProfileSections(profile) {
+		values := section.values
+		if values["aws_access_key_id"] != "" && values["aws_secret_access_key"] != "" {
+			return s3Credentials{
+				AccessKey:    values["aws_access_key_id"],
+				SecretKey:    values["aws_secret_access_key"],
+				SessionToken: values["aws_session_token"],
+			}, nil
+		}
+	}
+	return s3Credentials{}, fmt.Errorf("未找到S3凭证, 请设置环境变量 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY, 或在 ~/.aws/credentials 中配置 [%s]", profile)
+}
+
+// loadS3Region 读取 S3 区域
+func loadS3Region(profile string) string {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(env); region != "" {
+			return region
+		}
+	}
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	for _, section := range awsProfileSections(profile) {
+		if region := section.values["region"]; region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// awsProfileSection AWS 配置文件中的一个配置段
+type awsProfileSection struct {
+	values map[string]string
+}
+
+// awsProfileSections 返回凭证文件和配置文件中指定配置名对应的配置段
+func awsProfileSections(profile string) []awsProfileSection {
+	homeDir, _ := os.UserHomeDir()
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = filepath.Join(homeDir, ".aws", "credentials")
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(homeDir, ".aws", "config")
+	}
+
+	var sections []awsProfileSection
+	if values, ok := readINISection(credentialsFile, profile); ok {
+		sections = append(sections, awsProfileSection{values: values})
+	}
+	// 配置文件中除 default 外的配置段名称带有 profile 前缀
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = profile
+	}
+	if values, ok := readINISection(configFile, configSection); ok {
+		sections = append(sections, awsProfileSection{values: values})
+	}
+	return sections
+}
+
+// readINISection 读取 INI 文件中指定配置段的键值
+func readINISection(path, section string) (map[string]string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	found, inSection := false, false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+			found = found || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return values, found
+}
+
+// Location 返回存储地址
+func (s *S3Storage) Location() string {
+	return s.location
+}
+
+// key 返回文件对应的对象键
+func (s *S3Storage) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+// Put 上传文件, 超过分片大小时使用分片上传
+// 每次上传都会携带 Content-MD5, 由服务端校验收到的内容, 并在完成后校验返回的 ETag
+func (s *S3Storage) Put(ctx context.Context, localPath, name string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	bar := newBytesBar(info.Size(), "正在上传")
+	defer func() { _ = bar.Finish() }()
+
+	if info.Size() <= s.partSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(data)
+		resp, err := s.do(ctx, http.MethodPut, s.key(name), nil, data, contentMD5Header(sum[:]))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		_ = bar.Add64(int64(len(data)))
+		return checkETag(resp, hex.EncodeToString(sum[:]))
+	}
+	return s.putMultipart(ctx, file, info.Size(), s.key(name), bar.Add64)
+}
+
+// putMultipart 分片上传, 失败时取消上传以释放服务端已保存的分片
+func (s *S3Storage) putMultipart(ctx context.Context, file io.Reader, size int64, key string, progress func(int64) error) (err error) {
+	// 分片数量不能超过上限, 文件过大时增大分片
+	partSize := s.partSize
+	if size/partSize >= maxS3Parts {
+		partSize = size/(maxS3Parts-1) + 1
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return fmt.Errorf("创建分片上传失败: %w", err)
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeS3Response(resp, &initiate)
+	if err != nil {
+		return fmt.Errorf("创建分片上传失败: %w", err)
+	}
+	uploadID := initiate.UploadID
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// 上下文可能已取消, 使用新的上下文取消上传
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+	var sums []byte
+	buf := make([]byte, partSize)
+	for number := 1; ; number++ {
+		n, readErr := io.ReadFull(file, buf)
+		if n == 0 {
+			if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+				break
+			}
+			return readErr
+		}
+		if readErr != nil && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+
+		data := buf[:n]
+		sum := md5.Sum(data)
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, data, contentMD5Header(sum[:]))
+		if err != nil {
+			return fmt.Errorf("上传第 %d 个分片失败: %w", number, err)
+		}
+		resp.Body.Close()
+		if err := checkETag(resp, hex.EncodeToString(sum[:])); err != nil {
+			return fmt.Errorf("上传第 %d 个分片失败: %w", number, err)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		sums = append(sums, sum[:]...)
+		_ = progress(int64(n))
+
+		if readErr == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, nil)
+	if err != nil {
+		return fmt.Errorf("完成分片上传失败: %w", err)
+	}
+	// 完成分片上传时服务端可能返回 200 状态码, 但响应体中包含错误
+	var complete struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		S3Error
+	}
+	if err = decodeS3Response(resp, &complete); err != nil {
+		return fmt.Errorf("完成分片上传失败: %w", err)
+	}
+	if complete.XMLName.Local == "Error" {
+		complete.S3Error.StatusCode = resp.StatusCode
+		return fmt.Errorf("完成分片上传失败: %w", &complete.S3Error)
+	}
+
+	// 分片上传的 ETag 为各分片 MD5 拼接后的 MD5 加上分片数量
+	total := md5.Sum(sums)
+	resp.Header.Set("ETag", complete.ETag)
+	return checkETag(resp, fmt.Sprintf("%s-%d", hex.EncodeToString(total[:]), len(parts)))
+}
+
+// Open 下载文件
+func (s *S3Storage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Size 返回文件大小
+func (s *S3Storage) Size(ctx context.Context, name string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.key(name), nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// Remove 删除文件
+func (s *S3Storage) Remove(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List 列出前缀下的所有文件, 不包含更深层级的对象
+func (s *S3Storage) List(ctx context.Context) ([]StorageObject, error) {
+	prefix := ""
+	if s.prefix != "" {
+		prefix = s.prefix + "/"
+	}
+
+	var objects []StorageObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := decodeS3Response(resp, &result); err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			name := strings.TrimPrefix(content.Key, prefix)
+			if name == "" {
+				continue
+			}
+			objects = append(objects, StorageObject{Name: name, Size: content.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	return objects, nil
+}
+
+// Close 关闭空闲的连接
+func (s *S3Storage) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// do 发送签名后的请求, 状态码不是 2xx 时返回 *S3Error
+// key 为空时请求存储桶本身
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := *s.endpoint
+	escapedPath := strings.TrimSuffix(u.EscapedPath(), "/")
+	if s.pathStyle {
+		escapedPath += "/" + s3Escape(s.bucket, false)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	escapedPath += "/" + s3Escape(key, true)
+	u.Path, _ = url.PathUnescape(escapedPath)
+	u.RawPath = escapedPath
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	s.sign(req, escapedPath, u.RawQuery, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		_ = xml.Unmarshal(data, s3Err)
+		return nil, s3Err
+	}
+	return resp, nil
+}
+
+// sign 使用 AWS Signature Version 4 对请求签名
+func (s *S3Storage) sign(req *http.Request, escapedPath, canonicalQuery, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Host = req.URL.Host
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if s.creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.creds.SessionToken)
+	}
+
+	// 参与签名的请求头
+	headers := map[string]string{"host": req.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-md5" || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapedPath,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.creds.SecretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.creds.AccessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 计算 HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape 按 AWS 签名规则对字符串进行 URI 编码, 只保留非保留字符
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3CanonicalQuery 返回按键排序并编码后的查询字符串
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// contentMD5Header 返回包含 Content-MD5 的请求头
+func contentMD5Header(sum []byte) http.Header {
+	return http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum)}}
+}
+
+// checkETag 校验上传后返回的 ETag, 使用 KMS 加密时 ETag 不是内容的 MD5, 不做校验
+func checkETag(resp *http.Response, expected string) error {
+	if resp.Header.Get("x-amz-server-side-encryption") == "aws:kms" {
+		return nil
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if etag != "" && !strings.EqualFold(etag, expected) {
+		return fmt.Errorf("上传校验失败: ETag 为 %s, 期望为 %s", etag, expected)
+	}
+	return nil
+}
+
+// decodeS3Response 解析 XML 响应体并关闭响应
+func decodeS3Response(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("解析S3响应失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,551 @@
+package tools
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 上传中断后重新连接并从断点继续上传的最大次数
+const maxSFTPUploadAttempts = 5
+
+// 上传时每次写入的大小, 一次写入中的数据包可能乱序到达, 断点续传时从最后一次写入的起点重新上传
+const sftpWriteSize = 256 * 1024
+
+// 随机读取远程文件时每次读取的块大小, 减少读取ZIP条目时的往返次数
+const sftpReadBlockSize = 1024 * 1024
+
+// SFTPStorage 通过 SFTP 访问的远程存储
+// 地址格式为 sftp://user@host:port/path, 路径以 /~/ 开头时相对于登录用户的主目录, 支持以下查询参数:
+//   - identity: 私钥文件路径, 默认依次使用 ssh-agent 和 ~/.ssh 下的 id_ed25519、id_ecdsa、id_rsa
+//   - known_hosts: known_hosts 文件路径, 默认为 ~/.ssh/known_hosts
+//
+// 私钥设置了密码时, 通过环境变量 CBK_SSH_PASSPHRASE 提供密码
+type SFTPStorage struct {
+	location   string
+	user       string
+	addr       string
+	dir        string
+	identity   string
+	knownHosts string
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+	agent  net.Conn
+}
+
+// NewSFTPStorage 打开通过 SFTP 访问的远程存储, 在第一次访问时才建立连接
+// 参数:
+//   - location: 存储地址, 例如 sftp://backup@nas:22/~/backups
+//
+// 返回值:
+//   - *SFTPStorage: 远程存储
+//   - error: 地址无效时返回错误
+func NewSFTPStorage(location string) (*SFTPStorage, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("无效的SFTP地址: %s: %w", location, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("无效的SFTP地址: %s, 缺少主机名, 示例: sftp://user@host/path", location)
+	}
+
+	s := &SFTPStorage{location: location, user: u.User.Username()}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	s.addr = net.JoinHostPort(u.Hostname(), port)
+
+	// 未指定用户名时使用当前用户
+	if s.user == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("获取当前用户失败, 请在地址中指定用户名: %w", err)
+		}
+		s.user = current.Username
+		// Windows 的用户名包含域名
+		if i := strings.LastIndex(s.user, `\`); i >= 0 {
+			s.user = s.user[i+1:]
+		}
+	}
+
+	// 路径以 /~/ 开头时使用相对路径, 由服务端解析为登录用户的主目录下
+	s.dir = u.Path
+	switch {
+	case s.dir == "" || s.dir == "/~":
+		s.dir = "."
+	case strings.HasPrefix(s.dir, "/~/"):
+		s.dir = strings.TrimPrefix(s.dir, "/~/")
+	}
+	s.dir = path.Clean(s.dir)
+
+	query := u.Query()
+	s.identity = expandHome(query.Get("identity"))
+	s.knownHosts = expandHome(query.Get("known_hosts"))
+	if s.knownHosts == "" {
+		homeDir, _ := os.UserHomeDir()
+		s.knownHosts = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+	return s, nil
+}
+
+// expandHome 将路径开头的 ~ 替换为用户主目录
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(p, "~"))
+}
+
+// Location 返回存储地址
+func (s *SFTPStorage) Location() string {
+	return s.location
+}
+
+// connect 返回已建立的 SFTP 连接, 尚未连接时建立连接
+func (s *SFTPStorage) connect(ctx context.Context) (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	hostKeyCallback, algorithms, err := s.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	auth, err := s.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:              s.user,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: algorithms,
+		Timeout:           30 * time.Second,
+	}
+
+	dialer := net.Dialer{Timeout: config.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接 %s 失败: %w", s.addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, s.addr, config)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("SSH 登录 %s@%s 失败: %w", s.user, s.addr, err)
+	}
+	s.conn = ssh.NewClient(sshConn, chans, reqs)
+	if s.client, err = sftp.NewClient(s.conn); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return nil, fmt.Errorf("启动 SFTP 会话失败: %w", err)
+	}
+	return s.client, nil
+}
+
+// hostKeyCallback 根据 known_hosts 校验主机公钥, 同时返回 known_hosts 中记录的该主机的公钥算法,
+// 使服务端优先使用已记录的公钥
+func (s *SFTPStorage) hostKeyCallback() (ssh.HostKeyCallback, []string, error) {
+	callback, err := knownhosts.New(s.knownHosts)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("known_hosts 文件不存在: %s, 请先使用 ssh-keyscan 添加 %s 的主机公钥", s.knownHosts, s.addr)
+		}
+		return nil, nil, fmt.Errorf("读取 known_hosts 文件失败: %w", err)
+	}
+
+	// 使用一个临时公钥查询 known_hosts 中记录的公钥类型
+	var algorithms []string
+	if pub, _, err := ed25519.GenerateKey(nil); err == nil {
+		if probe, err := ssh.NewPublicKey(pub); err == nil {
+			var keyErr *knownhosts.KeyError
+			if errors.As(callback(s.addr, &net.TCPAddr{IP: net.IPv4zero}, probe), &keyErr) {
+				for _, known := range keyErr.Want {
+					switch keyType := known.Key.Type(); keyType {
+					case ssh.KeyAlgoRSA:
+						algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+					default:
+						algorithms = append(algorithms, keyType)
+					}
+				}
+			}
+		}
+	}
+
+	verify := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("主机 %s 不在 %s 中, 请先使用 ssh-keyscan 添加主机公钥并核对指纹 %s", hostname, s.knownHosts, ssh.FingerprintSHA256(key))
+			}
+			return fmt.Errorf("主机 %s 的公钥与 %s 中的记录不一致, 可能存在中间人攻击, 当前公钥指纹为 %s", hostname, s.knownHosts, ssh.FingerprintSHA256(key))
+		}
+		return err
+	}
+	return verify, algorithms, nil
+}
+
+// authMethods 返回 SSH 认证方式
+// 指定了私钥时只使用该私钥, 否则依次使用 ssh-agent 和 ~/.ssh 下的默认私钥
+func (s *SFTPStorage) authMethods() ([]ssh.AuthMethod, error) {
+	if s.identity != "" {
+		signer, err := loadPrivateKey(s.identity)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			s.agent = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		keyPath := filepath.Join(homeDir, ".ssh", name)
+		if _, err := os.Stat(keyPath); err != nil {
+			continue
+		}
+		if signer, err := loadPrivateKey(keyPath); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("没有可用的SSH认证方式, 请启动 ssh-agent, 或通过 identity 参数指定私钥文件")
+	}
+	return methods, nil
+}
+
+// loadPrivateKey 读取私钥文件, 私钥设置了密码时使用环境变量 CBK_SSH_PASSPHRASE 解密
+func loadPrivateKey(keyPath string) (ssh.Signer, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥文件失败: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase := os.Getenv("CBK_SSH_PASSPHRASE")
+		if passphrase == "" {
+			return nil, fmt.Errorf("私钥 %s 设置了密码, 请通过环境变量 CBK_SSH_PASSPHRASE 提供密码, 或将私钥添加到 ssh-agent", keyPath)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥 %s 失败: %w", keyPath, err)
+	}
+	return signer, nil
+}
+
+// remotePath 返回文件在远程主机上的路径
+func (s *SFTPStorage) remotePath(name string) string {
+	return path.Join(s.dir, name)
+}
+
+// Put 上传文件
+// 文件先上传为带 .part 后缀的临时文件, 连接中断时重新连接并从临时文件的末尾继续上传,
+// 上传完成并校验大小后再重命名为正式文件名
+func (s *SFTPStorage) Put(ctx context.Context, localPath, name string) error {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 首次连接失败(例如主机公钥校验或认证失败)时直接返回, 只对传输中断的情况重试
+	if _, err := s.connect(ctx); err != nil {
+		return err
+	}
+
+	// 上下文取消时关闭连接, 中断正在进行的传输
+	stop := context.AfterFunc(ctx, func() { _ = s.Close() })
+	defer stop()
+
+	remotePath := s.remotePath(name)
+	partPath := remotePath + PartialSuffix
+	bar := newBytesBar(info.Size(), "正在上传")
+	defer func() { _ = bar.Finish() }()
+
+	for attempt := 1; ; attempt++ {
+		err = s.upload(ctx, local, info.Size(), partPath, bar)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= maxSFTPUploadAttempts {
+			if client, connErr := s.connect(ctx); connErr == nil {
+				_ = client.Remove(partPath)
+			}
+			return fmt.Errorf("上传失败(共尝试 %d 次): %w", attempt, err)
+		}
+
+		// 关闭中断的连接, 稍后重新连接并从断点继续上传
+		_ = s.Close()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	uploaded, err := client.Stat(partPath)
+	if err != nil {
+		return fmt.Errorf("获取上传文件信息失败: %w", err)
+	}
+	if uploaded.Size() != info.Size() {
+		return fmt.Errorf("上传校验失败: 远程文件大小为 %d 字节, 本地文件大小为 %d 字节", uploaded.Size(), info.Size())
+	}
+
+	// 部分服务端不支持覆盖已存在的文件, 不支持 posix-rename 扩展时先删除同名文件
+	if err := client.PosixRename(partPath, remotePath); err != nil {
+		_ = client.Remove(remotePath)
+		if err := client.Rename(partPath, remotePath); err != nil {
+			return fmt.Errorf("重命名上传文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// upload 将本地文件从远程临时文件的末尾开始继续上传
+func (s *SFTPStorage) upload(ctx context.Context, local *os.File, size int64, partPath string, bar interface{ Set64(int64) error }) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(path.Dir(partPath)); err != nil {
+		return fmt.Errorf("创建远程目录失败: %w", err)
+	}
+
+	// 远程临时文件比本地文件大时说明不是同一个文件, 重新上传
+	// 连接中断时最后一次写入可能只完成了一部分, 从最后一次写入的起点继续上传
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE
+	if info, err := client.Stat(partPath); err == nil && info.Size() <= size {
+		offset = max(0, (info.Size()/sftpWriteSize-1)*sftpWriteSize)
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	remote, err := client.OpenFile(partPath, flags)
+	if err != nil {
+		return fmt.Errorf("创建远程文件失败: %w", err)
+	}
+	defer remote.Close()
+	if _, err := remote.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := local.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_ = bar.Set64(offset)
+
+	// 按固定大小依次写入, 每次写入完成后才开始下一次写入
+	progress := &progressWriter{set: bar.Set64, written: offset}
+	writer := struct{ io.Writer }{remote} // 隐藏 ReadFrom, 避免并发写入
+	buf := make([]byte, sftpWriteSize)
+	if _, err := io.CopyBuffer(writer, io.TeeReader(contextReader{ctx: ctx, r: local}, progress), buf); err != nil {
+		return err
+	}
+	return remote.Close()
+}
+
+// progressWriter 统计写入的字节数并更新进度条
+type progressWriter struct {
+	set     func(int64) error
+	written int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	_ = w.set(w.written)
+	return len(p), nil
+}
+
+// Open 打开远程文件用于读取
+func (s *SFTPStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Open(s.remotePath(name))
+}
+
+// OpenReaderAt 打开远程文件用于随机读取, 读取时按块缓存以减少往返次数
+func (s *SFTPStorage) OpenReaderAt(ctx context.Context, name string) (ReaderAtCloser, int64, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := client.Open(s.remotePath(name))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	return &blockReaderAt{file: file, size: info.Size()}, info.Size(), nil
+}
+
+// Size 返回远程文件大小
+func (s *SFTPStorage) Size(ctx context.Context, name string) (int64, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	info, err := client.Stat(s.remotePath(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Remove 删除远程文件
+func (s *SFTPStorage) Remove(ctx context.Context, name string) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.Remove(s.remotePath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List 列出远程目录中的所有文件
+func (s *SFTPStorage) List(ctx context.Context) ([]StorageObject, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := client.ReadDirContext(ctx, s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var objects []StorageObject
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			objects = append(objects, StorageObject{Name: info.Name(), Size: info.Size()})
+		}
+	}
+	return objects, nil
+}
+
+// Close 关闭 SFTP 会话和 SSH 连接
+func (s *SFTPStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.client != nil {
+		err = s.client.Close()
+		s.client = nil
+	}
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	if s.agent != nil {
+		_ = s.agent.Close()
+		s.agent = nil
+	}
+	return err
+}
+
+// blockReaderAt 按块缓存远程文件的内容, 连续的小块读取只需要一次往返
+type blockReaderAt struct {
+	file *sftp.File
+	size int64
+
+	mu    sync.Mutex
+	block []byte
+	start int64
+}
+
+// ReadAt 从缓存的块中读取, 不在缓存中时读取偏移量所在位置开始的一整块
+func (r *blockReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		if pos < r.start || pos >= r.start+int64(len(r.block)) {
+			if r.block == nil {
+				r.block = make([]byte, sftpReadBlockSize)
+			}
+			r.block = r.block[:min(int64(cap(r.block)), r.size-pos)]
+			read, err := r.file.ReadAt(r.block, pos)
+			r.block = r.block[:read]
+			r.start = pos
+			if read == 0 {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return n, err
+			}
+		}
+		n += copy(p[n:], r.block[pos-r.start:])
+	}
+	return n, nil
+}
+
+// Read 顺序读取远程文件
+func (r *blockReaderAt) Read(p []byte) (int, error) {
+	return r.file.Read(p)
+}
+
+// Close 关闭远程文件
+func (r *blockReaderAt) Close() error {
+	return r.file.Close()
+}
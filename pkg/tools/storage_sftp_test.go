@@ -0,0 +1,480 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"cbk/pkg/globals"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSFTPServer 在 127.0.0.1 上运行的 SFTP 服务, 只接受指定公钥的登录, 文件保存在临时目录中
+type testSFTPServer struct {
+	addr    string
+	root    string        // SFTP 会话的工作目录
+	hostKey ssh.Signer    // 主机私钥
+	client  ssh.PublicKey // 允许登录的公钥
+	key     string        // 客户端私钥文件路径
+	known   string        // 记录了主机公钥的 known_hosts 文件路径
+	logins  atomic.Int32  // 登录成功的次数
+}
+
+// newTestSFTPServer 启动 SFTP 服务, 并生成客户端私钥和 known_hosts 文件
+func newTestSFTPServer(t *testing.T) *testSFTPServer {
+	t.Helper()
+	SetProgressSilent(true)
+	t.Cleanup(func() { SetProgressSilent(false) })
+
+	srv := &testSFTPServer{root: t.TempDir()}
+	srv.hostKey = newTestSigner(t)
+
+	// 客户端私钥以 OpenSSH 格式写入文件
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.key = filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(srv.key, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if srv.client, err = ssh.NewPublicKey(priv.Public()); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && bytes.Equal(key.Marshal(), srv.client.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("公钥未授权")
+		},
+	}
+	config.AddHostKey(srv.hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	srv.addr = listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+
+	srv.known = srv.writeKnownHosts(t, srv.hostKey.PublicKey())
+	return srv
+}
+
+// newTestSigner 生成 ed25519 私钥
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// serve 处理一个 SSH 连接, 只接受 sftp 子系统
+func (srv *testSFTPServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	srv.logins.Add(1)
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "只支持 session")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(srv.root))
+				if err != nil {
+					return
+				}
+				_ = server.Serve()
+				_ = server.Close()
+				return
+			}
+		}()
+	}
+}
+
+// writeKnownHosts 写入记录了指定主机公钥的 known_hosts 文件
+func (srv *testSFTPServer) writeKnownHosts(t *testing.T, key ssh.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, key)
+	if err := os.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// location 返回存储地址, dir 为相对于 SFTP 工作目录的路径
+func (srv *testSFTPServer) location(dir, identity, known string) string {
+	return fmt.Sprintf("sftp://backup@%s/~/%s?identity=%s&known_hosts=%s", srv.addr, dir, identity, known)
+}
+
+// open 打开连接到测试服务的存储
+func (srv *testSFTPServer) open(t *testing.T, dir string) *SFTPStorage {
+	t.Helper()
+	s, err := NewSFTPStorage(srv.location(dir, srv.key, srv.known))
+	if err != nil {
+		t.Fatalf("打开SFTP存储失败: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestSFTPPutAndList(t *testing.T) {
+	srv := newTestSFTPServer(t)
+	s := srv.open(t, "backups/docs")
+	ctx := context.Background()
+
+	// 上传到不存在的目录时自动创建
+	data := testContent(3*sftpWriteSize + 123)
+	if err := s.Put(ctx, writeTempFile(t, data), "docs_1.zip"); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(srv.root, "backups", "docs", "docs_1.zip"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("远程文件与本地文件不同: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(srv.root, "backups", "docs", "docs_1.zip"+PartialSuffix)); !os.IsNotExist(err) {
+		t.Errorf("上传完成后临时文件仍存在")
+	}
+
+	// 覆盖已存在的文件
+	data2 := testContent(100)
+	if err := s.Put(ctx, writeTempFile(t, data2), "docs_1.zip"); err != nil {
+		t.Fatalf("覆盖上传失败: %v", err)
+	}
+	if size, err := s.Size(ctx, "docs_1.zip"); err != nil || size != int64(len(data2)) {
+		t.Errorf("Size() = %d, %v, 期望 %d", size, err, len(data2))
+	}
+
+	// 只列出文件, 不包含子目录
+	if err := os.WriteFile(filepath.Join(srv.root, "backups", "docs", "docs_2.zip"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(srv.root, "backups", "docs", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("列出文件失败: %v", err)
+	}
+	var names []string
+	for _, object := range objects {
+		names = append(names, fmt.Sprintf("%s:%d", object.Name, object.Size))
+	}
+	sort.Strings(names)
+	if want := "docs_1.zip:100,docs_2.zip:3"; strings.Join(names, ",") != want {
+		t.Errorf("List() = %v, 期望 %s", names, want)
+	}
+
+	// 删除文件, 不存在的文件视为已删除
+	if err := s.Remove(ctx, "docs_2.zip"); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if err := s.Remove(ctx, "docs_2.zip"); err != nil {
+		t.Errorf("删除不存在的文件返回错误: %v", err)
+	}
+	if _, err := s.Size(ctx, "docs_2.zip"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("查询已删除的文件 = %v, 期望 os.ErrNotExist", err)
+	}
+
+	// 目录不存在时列出为空
+	empty := srv.open(t, "missing")
+	if objects, err := empty.List(ctx); err != nil || len(objects) != 0 {
+		t.Errorf("列出不存在的目录 = %v, %v", objects, err)
+	}
+
+	// 同一个存储的多次操作复用一个连接
+	if logins := srv.logins.Load(); logins != 2 {
+		t.Errorf("登录次数 = %d, 期望 2", logins)
+	}
+}
+
+func TestSFTPResume(t *testing.T) {
+	srv := newTestSFTPServer(t)
+	s := srv.open(t, "backups")
+	ctx := context.Background()
+	data := testContent(4*sftpWriteSize + 1000)
+	partPath := filepath.Join(srv.root, "backups", "docs_1.zip"+PartialSuffix)
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上次上传中断时已写入两块半, 最后一次写入可能不完整, 从第二块的起点继续上传
+	partial := append([]byte(nil), data[:2*sftpWriteSize+sftpWriteSize/2]...)
+	partial[0] ^= 0xff              // 断点之前的内容不会重新上传
+	partial[len(partial)-1] ^= 0xff // 最后一次写入的内容会重新上传
+	partial[sftpWriteSize] ^= 0xff  // 断点处的内容会重新上传
+	if err := os.WriteFile(partPath, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, writeTempFile(t, data), "docs_1.zip"); err != nil {
+		t.Fatalf("断点续传失败: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(srv.root, "backups", "docs_1.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("续传后的文件大小 = %d, 期望 %d", len(got), len(data))
+	}
+	if got[0] != partial[0] {
+		t.Errorf("断点之前的内容被重新上传")
+	}
+	if !bytes.Equal(got[sftpWriteSize:], data[sftpWriteSize:]) {
+		t.Errorf("断点之后的内容与本地文件不同")
+	}
+
+	// 临时文件比本地文件大时不是同一个文件, 重新上传
+	if err := os.WriteFile(partPath, testContent(len(data)+10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, writeTempFile(t, data), "docs_1.zip"); err != nil {
+		t.Fatalf("重新上传失败: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(srv.root, "backups", "docs_1.zip")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("重新上传后的文件与本地文件不同: %v", err)
+	}
+}
+
+func TestSFTPAuth(t *testing.T) {
+	srv := newTestSFTPServer(t)
+	ctx := context.Background()
+
+	// 未授权的私钥无法登录
+	block, err := ssh.MarshalPrivateKey(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := filepath.Join(t.TempDir(), "id_other")
+	if err := os.WriteFile(otherKey, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSFTPStorage(srv.location("backups", otherKey, srv.known))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.List(ctx); err == nil || !strings.Contains(err.Error(), "SSH 登录") {
+		t.Errorf("未授权的私钥登录返回 %v", err)
+	}
+
+	// 私钥文件不存在
+	s, err = NewSFTPStorage(srv.location("backups", filepath.Join(t.TempDir(), "missing"), srv.known))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.List(ctx); err == nil || !strings.Contains(err.Error(), "读取私钥文件失败") {
+		t.Errorf("私钥文件不存在时返回 %v", err)
+	}
+}
+
+func TestSFTPKnownHosts(t *testing.T) {
+	srv := newTestSFTPServer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		known string
+		want  string
+	}{
+		{"主机公钥不一致", srv.writeKnownHosts(t, newTestSigner(t).PublicKey()), "不一致"},
+		{"主机不在 known_hosts 中", writeFile(t, "known_hosts", "[example.com]:22 "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(srv.hostKey.PublicKey())))+"\n"), "不在"},
+		{"known_hosts 不存在", filepath.Join(t.TempDir(), "known_hosts"), "known_hosts 文件不存在"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSFTPStorage(srv.location("backups", srv.key, tt.known))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			err = s.Put(ctx, writeTempFile(t, []byte("data")), "docs_1.zip")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Put() = %v, 期望包含 %q", err, tt.want)
+			}
+		})
+	}
+
+	// 校验失败时不会登录, 也不会上传文件
+	if logins := srv.logins.Load(); logins != 0 {
+		t.Errorf("主机公钥校验失败后仍登录了 %d 次", logins)
+	}
+	if _, err := os.Stat(filepath.Join(srv.root, "backups")); !os.IsNotExist(err) {
+		t.Errorf("主机公钥校验失败后仍创建了远程目录")
+	}
+}
+
+func TestSFTPOpenVersion(t *testing.T) {
+	srv := newTestSFTPServer(t)
+	location := srv.location("backups", srv.key, srv.known)
+
+	// 生成包含跨越多个读取块的大文件的 ZIP
+	large := testContent(2*sftpReadBlockSize + 12345)
+	files := map[string][]byte{
+		"docs/a.txt":     []byte("hello"),
+		"docs/large.bin": large,
+		"docs/sub/b.txt": []byte("world"),
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"docs/a.txt", "docs/large.bin", "docs/sub/b.txt"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(srv.root, "backups"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srv.root, "backups", "docs_1.zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 直接从远程文件读取 ZIP 中央目录和条目, 不下载整个文件
+	record := globals.BackupRecord{VersionID: "v1", BackupFileName: "docs_1.zip", BackupPath: location}
+	reader, err := OpenVersion(context.Background(), record)
+	if err != nil {
+		t.Fatalf("打开远程版本失败: %v", err)
+	}
+	defer reader.Close()
+
+	var names []string
+	for _, entry := range reader.Entries() {
+		names = append(names, entry.Name)
+	}
+	if want := "docs,docs/a.txt,docs/large.bin,docs/sub,docs/sub/b.txt"; strings.Join(names, ",") != want {
+		t.Errorf("Entries() = %v, 期望 %s", names, want)
+	}
+	for name, want := range files {
+		rc, err := reader.Open(name)
+		if err != nil {
+			t.Fatalf("打开条目 %s 失败: %v", name, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("条目 %s 的内容不同: %v", name, err)
+		}
+	}
+
+	// 远程文件不存在
+	record.BackupFileName = "missing.zip"
+	if _, err := OpenVersion(context.Background(), record); err == nil || !strings.Contains(err.Error(), "备份文件不存在") {
+		t.Errorf("打开不存在的远程版本返回 %v", err)
+	}
+}
+
+func TestBlockReaderAt(t *testing.T) {
+	srv := newTestSFTPServer(t)
+	s := srv.open(t, ".")
+	data := testContent(sftpReadBlockSize + 500)
+	if err := os.WriteFile(filepath.Join(srv.root, "data.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, size, err := s.OpenReaderAt(context.Background(), "data.bin")
+	if err != nil {
+		t.Fatalf("打开远程文件失败: %v", err)
+	}
+	defer r.Close()
+	if size != int64(len(data)) {
+		t.Errorf("文件大小 = %d, 期望 %d", size, len(data))
+	}
+
+	tests := []struct {
+		name string
+		off  int64
+		n    int
+		want int
+		err  error
+	}{
+		{"开头", 0, 100, 100, nil},
+		{"缓存的块内", 200, 100, 100, nil},
+		{"跨越块边界", sftpReadBlockSize - 50, 100, 100, nil},
+		{"向前读取", 10, 10, 10, nil},
+		{"读到末尾", int64(len(data)) - 10, 100, 10, io.EOF},
+		{"超出末尾", int64(len(data)), 10, 0, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.n)
+			n, err := r.ReadAt(p, tt.off)
+			if n != tt.want || err != tt.err {
+				t.Fatalf("ReadAt() = %d, %v, 期望 %d, %v", n, err, tt.want, tt.err)
+			}
+			if !bytes.Equal(p[:n], data[tt.off:tt.off+int64(n)]) {
+				t.Errorf("读取的内容不同")
+			}
+		})
+	}
+}
+
+// writeFile 在临时目录中写入文件并返回路径
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
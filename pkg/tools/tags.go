@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NormalizeTags 解析逗号分隔的任务标签, 返回去重并转换为小写后的标签列表
+// 配置为空或 none 时返回空字符串, 表示不设置标签
+// 参数:
+//   - spec: 标签列表, 例如 db,prod
+//
+// 返回值:
+//   - string: 规范化后的标签列表, 以逗号分隔
+//   - error: 标签包含非法字符时返回错误
+func NormalizeTags(spec string) (string, error) {
+	if spec = strings.TrimSpace(spec); spec == "" || strings.EqualFold(spec, "none") {
+		return "", nil
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(spec, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if err := checkTag(tag); err != nil {
+			return "", err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return strings.Join(tags, ","), nil
+}
+
+// checkTag 检查标签是否只包含字母、数字、下划线、连字符和点
+func checkTag(tag string) error {
+	if strings.EqualFold(tag, "none") {
+		return fmt.Errorf("标签不能为 none")
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_-.", r) {
+			return fmt.Errorf("标签 %q 包含非法字符 %q, 只能包含字母、数字、下划线、连字符和点", tag, r)
+		}
+	}
+	return nil
+}
+
+// SplitTags 将规范化后的标签列表拆分为切片
+func SplitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// HasAnyTag 判断任务的标签中是否包含任意一个指定的标签
+// 参数:
+//   - tags: 任务的标签列表, 以逗号分隔
+//   - want: 要匹配的标签, 需要是规范化后的标签
+func HasAnyTag(tags string, want []string) bool {
+	for _, tag := range SplitTags(tags) {
+		for _, w := range want {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FormatTags 返回标签的显示文本, 未设置时返回 none
+func FormatTags(tags string) string {
+	if tags == "" {
+		return "none"
+	}
+	return tags
+}
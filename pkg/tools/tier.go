@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ParseTier 解析分层存储规则, 格式为 <天数>d:<冷存储路径>, 例如 14d:/mnt/archive 或 30d:s3://bucket/archive
+// 冷存储路径中使用与备份目录相同的目录名; 本地路径转换为绝对路径, 远程存储只检查地址格式
+// 参数:
+//   - spec: 分层存储规则, 空字符串或 none 表示不启用
+//   - dirName: 备份目录名
+//   - backupDir: 任务的备份目录, 冷存储位置不能与其相同
+//
+// 返回值:
+//   - globals.TierRule: 解析后的规则, 不启用时各字段为零值
+//   - error: 格式不正确时返回错误
+func ParseTier(spec, dirName, backupDir string) (globals.TierRule, error) {
+	var rule globals.TierRule
+	if spec = strings.TrimSpace(spec); spec == "" || strings.EqualFold(spec, "none") {
+		return rule, nil
+	}
+
+	daysText, root, ok := strings.Cut(spec, ":")
+	root = strings.TrimSpace(root)
+	if !ok || root == "" {
+		return rule, fmt.Errorf("无效的分层存储规则: '%s', 格式为 <天数>d:<冷存储路径>, 例如 14d:/mnt/archive", spec)
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(daysText)), "d"))
+	if err != nil || days <= 0 {
+		return rule, fmt.Errorf("分层存储规则的天数必须为正整数: '%s'", daysText)
+	}
+
+	if IsRemoteLocation(root) {
+		if err := CheckLocation(root); err != nil {
+			return rule, fmt.Errorf("冷存储地址无效: %w", err)
+		}
+		rule.TierLocation = JoinLocation(root, dirName)
+	} else {
+		abs, err := filepath.Abs(filepath.Clean(root))
+		if err != nil {
+			return rule, fmt.Errorf("获取冷存储路径 %s 的绝对路径失败: %w", root, err)
+		}
+		rule.TierLocation = filepath.Join(abs, dirName)
+	}
+	if rule.TierLocation == backupDir {
+		return rule, fmt.Errorf("冷存储位置不能与备份目录相同: %s", rule.TierLocation)
+	}
+	rule.TierDays = days
+	return rule, nil
+}
+
+// FormatTier 返回分层存储规则的显示文本, 例如 14d:/mnt/archive/project, 未启用时返回 none
+func FormatTier(rule globals.TierRule) string {
+	if rule.TierDays <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%dd:%s", rule.TierDays, rule.TierLocation)
+}
+
+// PlanTiering 查询任务中需要移动到冷存储位置的版本, 即超过规则天数且不在冷存储位置中的成功版本
+// 参数:
+//   - db: 数据库连接
+//   - taskID: 任务ID
+//   - rule: 分层存储规则
+//   - now: 当前时间
+//
+// 返回值:
+//   - globals.BackupRecords: 需要移动的版本, 按备份时间从旧到新排列
+//   - error: 查询失败时返回错误
+func PlanTiering(db *sqlx.DB, taskID int, rule globals.TierRule, now time.Time) (globals.BackupRecords, error) {
+	if rule.TierDays <= 0 {
+		return nil, nil
+	}
+
+	cutoff := now.AddDate(0, 0, -rule.TierDays).Format(TimestampLayout)
+	var records globals.BackupRecords
+	querySql := `SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, size_bytes, run_status FROM backup_records
+		WHERE task_id = ? AND ` + SuccessStatusSql + ` AND backup_path != ? AND timestamp < ? ORDER BY timestamp ASC, rowid ASC`
+	if err := db.Select(&records, querySql, taskID, rule.TierLocation, cutoff); err != nil {
+		return nil, fmt.Errorf("查询需要移动到冷存储的版本失败: %w", err)
+	}
+	return records, nil
+}
+
+// CopyToTier 将备份版本复制到冷存储位置, 并读取复制后的文件校验哈希值
+// 复制成功后需要调用 CommitTier 更新备份记录并删除原位置的备份文件
+// 参数:
+//   - ctx: 上下文
+//   - record: 备份记录
+//   - location: 冷存储位置
+//   - stageDir: 暂存目录, 复制到远程存储时使用
+//
+// 返回值:
+//   - error: 复制或校验失败时返回错误
+func CopyToTier(ctx context.Context, record globals.BackupRecord, location, stageDir string) error {
+	return copyVersion(ctx, record, location, stageDir)
+}
+
+// CommitTier 将备份记录的 backup_path 更新为冷存储位置, 并删除原位置的备份文件
+// 备份记录已被删除或已移动到其他位置时, 删除刚复制到冷存储位置的文件;
+// 原位置的备份文件删除失败时只打印错误信息, 不影响备份记录的更新
+// 参数:
+//   - db: 数据库连接
+//   - record: 移动前的备份记录
+//   - location: 冷存储位置
+//
+// 返回值:
+//   - error: 更新备份记录失败时返回错误
+func CommitTier(db *sqlx.DB, record globals.BackupRecord, location string) error {
+	result, err := db.Exec("UPDATE backup_records SET backup_path = ? WHERE version_id = ? AND backup_path = ?", location, record.VersionID, record.BackupPath)
+	if err != nil {
+		return fmt.Errorf("更新版本 %s 的备份路径失败: %w", record.VersionID, err)
+	}
+
+	stores := make(map[string]Storage)
+	defer func() {
+		for _, store := range stores {
+			_ = store.Close()
+		}
+	}()
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		if err := removeStoredFile(stores, location, record.BackupFileName); err != nil {
+			CL.PrintErrf("删除冷存储中的文件 %s 失败, 请稍后手动删除: %v", JoinLocation(location, record.BackupFileName), err)
+		}
+		return fmt.Errorf("版本 %s 的备份记录已被删除或修改", record.VersionID)
+	}
+
+	if err := removeStoredFile(stores, record.BackupPath, record.BackupFileName); err != nil {
+		CL.PrintErrf("删除原位置的备份文件 %s 失败, 请稍后手动删除: %v", JoinLocation(record.BackupPath, record.BackupFileName), err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bufio"
 	"cbk/pkg/globals"
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
@@ -14,6 +15,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 
@@ -229,6 +232,20 @@ func moveFile(src, dst string) error {
 //	string - 文件 MD5 哈希值的后 8 位
 //	error - 如果发生错误，返回错误信息；否则返回 nil
 func GetFileMD5Last8(filePath string) (string, error) {
+	return GetFileMD5Last8Context(context.Background(), filePath)
+}
+
+// GetFileMD5Last8Context 与 GetFileMD5Last8 相同, ctx 被取消或超时后停止读取并返回错误
+func GetFileMD5Last8Context(ctx context.Context, filePath string) (string, error) {
+	hashStr, err := GetFileMD5Context(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	return hashStr[len(hashStr)-8:], nil
+}
+
+// GetFileMD5Context 获取文件完整的 MD5 哈希值, ctx 被取消或超时后停止读取并返回错误
+func GetFileMD5Context(ctx context.Context, filePath string) (string, error) {
 	// 打开文件
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -241,11 +258,32 @@ func GetFileMD5Last8(filePath string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("获取文件大小时出错: %w", err)
 	}
-	fileSize := fileInfo.Size()
 
+	return ReaderMD5(ctx, file, fileInfo.Size())
+}
+
+// ReaderMD5Last8 读取 r 中的全部内容, 返回 MD5 哈希值的后 8 位
+// 参数:
+//   - ctx: 上下文, 被取消或超时后停止读取并返回错误
+//   - r: 要读取的内容
+//   - size: 内容大小, 用于显示进度
+//
+// 返回值:
+//   - string: MD5 哈希值的后 8 位
+//   - error: 读取失败时返回错误
+func ReaderMD5Last8(ctx context.Context, r io.Reader, size int64) (string, error) {
+	hashStr, err := ReaderMD5(ctx, r, size)
+	if err != nil {
+		return "", err
+	}
+	return hashStr[len(hashStr)-8:], nil
+}
+
+// ReaderMD5 读取 r 中的全部内容, 返回完整的 MD5 哈希值, 参数与 ReaderMD5Last8 相同
+func ReaderMD5(ctx context.Context, r io.Reader, size int64) (string, error) {
 	// 创建进度条
-	bar := progressbar.DefaultBytes(
-		fileSize,
+	bar := newBytesBar(
+		size,
 		"正在计算MD5",
 	)
 
@@ -255,7 +293,10 @@ func GetFileMD5Last8(filePath string) (string, error) {
 	// 分块读取文件内容
 	buffer := make([]byte, 32*1024) // 32KB 缓冲区
 	for {
-		n, err := file.Read(buffer)
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("计算MD5已取消: %w", err)
+		}
+		n, err := r.Read(buffer)
 		if err != nil && err != io.EOF {
 			return "", fmt.Errorf("读取文件内容时出错: %w", err)
 		}
@@ -280,8 +321,7 @@ func GetFileMD5Last8(filePath string) (string, error) {
 		return "", fmt.Errorf("进度条完成失败: %w", err)
 	}
 
-	// 返回哈希值的后 8 位
-	return hashStr[len(hashStr)-8:], nil
+	return hashStr, nil
 }
 
 // HumanReadableSize 获取文件大小并转换为人性化单位显示
@@ -300,9 +340,19 @@ func HumanReadableSize(filePath string) (string, error) {
 		return "", fmt.Errorf("获取文件信息时出错: %w", err)
 	}
 
-	// 获取文件大小（以字节为单位）
-	size := file.Size()
+	// 获取文件大小（以字节为单位）并格式化输出
+	return FormatSize(file.Size()), nil
+}
 
+// FormatSize 将字节数转换为人性化单位显示
+// 参数：
+//
+//	size - 字节数
+//
+// 返回值：
+//
+//	string - 大小的人性化表示, 例如: 12.50MB
+func FormatSize(size int64) string {
 	// 定义单位和换算关系
 	units := []string{"B", "KB", "MB", "GB"}
 	base := float64(1024)
@@ -324,7 +374,49 @@ func HumanReadableSize(filePath string) (string, error) {
 	}
 
 	// 格式化输出
-	return fmt.Sprintf("%.2f%s", sizeFloat, unit), nil
+	return fmt.Sprintf("%.2f%s", sizeFloat, unit)
+}
+
+// ParseSize 将人性化的大小字符串转换为字节数
+// 参数：
+//
+//	value - 大小字符串, 例如: 500MB, 10G, 1.5TB, 单位按1024换算, 不带单位时表示字节
+//
+// 返回值：
+//
+//	int64 - 字节数
+//	error - 格式不正确时返回错误
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, fmt.Errorf("大小不能为空")
+	}
+
+	// 定义单位和换算关系, 较长的单位在前
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+
+	multiplier := float64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("无效的大小: %s, 示例: 500MB, 10GB", value)
+	}
+
+	return int64(number * multiplier), nil
 }
 
 // GetZipFiles 获取指定目录下所有以 .zip 结尾的文件列表
@@ -390,173 +482,10 @@ func SortFilesByModTime(files []FileWithModTime, ascending bool) []FileWithModTi
 	return files
 }
 
-// RetainLatestFiles 处理文件列表，仅保留最新的指定数量的文件
-// 参数：
-//
-//	db - 数据库连接
-//	files - 文件路径列表
-//	retainCount - 保留的文件数量
-//
-// 返回值：
-//
-//	error - 如果发生错误，返回错误信息；否则返回 nil
-func RetainLatestFiles(db *sqlx.DB, files []string, retainCount, retainDays int) error {
-	// 用于存储文件及其最后修改时间
-	var fileInfos []FileWithModTime
-
-	// 检查获取到的文件列表是否为空
-	if len(files) == 0 {
-		return nil
-	}
-
-	// 获取每个文件的最后修改时间
-	for _, filePath := range files {
-		// 获取文件信息
-		info, err := os.Stat(filePath)
-		// 检查文件是否存在
-		if os.IsNotExist(err) {
-			CL.PrintErrf("备份文件不存在, 跳过: %s", filePath)
-			continue
-		} else if err != nil {
-			CL.PrintErrf("获取文件信息时出错: %v", err)
-			continue
-		}
-
-		// 将文件路径和最后修改时间存储到 fileInfos 切片中
-		fileInfos = append(fileInfos, FileWithModTime{Path: filePath, ModTime: info.ModTime()})
-	}
-
-	// 按照文件的最后修改时间排序, 旧的在前面
-	fileInfos = SortFilesByModTime(fileInfos, true)
-
-	// 根据保留天数和保留数量筛选文件
-	filesToDelete := filterFiles(fileInfos, retainDays, retainCount)
-
-	// 按照筛选后的文件列表删除文件
-	if err := deleteFiles(db, filesToDelete); err != nil {
-		return fmt.Errorf("清理文件时出错: %w", err)
-	}
-
-	return nil
-}
-
-// filterFiles 根据保留天数和保留数量筛选文件
-// 参数：
-//
-//	files - 文件列表
-//	retainDays - 保留的天数
-//	retainCount - 保留的文件数量
-//
-// 返回值：
-//
-//	[]FileWithModTime - 筛选后的文件列表
-func filterFiles(files []FileWithModTime, retainDays, retainCount int) []FileWithModTime {
-	var filesToDelete []FileWithModTime
-
-	// 如果为空，直接返回
-	if len(files) == 0 {
-		return filesToDelete
-	}
-
-	// 仅设置保留数量，没有设置保留天数
-	if retainDays == 0 && retainCount > 0 {
-		// 保留最新的retainCount个文件, 如果文件数量大于retainCount, 则将从0到len(files)-retainCount的文件添加到filesToDelete中
-		if len(files) > retainCount {
-			filesToDelete = files[0 : len(files)-retainCount] // 从0到len(files)-retainCount的文件添加到filesToDelete中
-		}
-
-		return filesToDelete
-	}
-
-	// 同时设置保留天数和保留数量
-	if retainDays > 0 && retainCount > 0 {
-		// 先按天数筛选分组，然后在每天分组中保留最新的retainCount个文件
-		retainTime := time.Now().AddDate(0, 0, -retainDays)
-		dayMap := make(map[time.Time][]FileWithModTime)
-
-		// 按天分组
-		for _, file := range files {
-			// 检查文件的最后修改时间是否在保留时间范围内
-			if file.ModTime.After(retainTime) {
-				// 将文件按天分组
-				day := time.Date(file.ModTime.Year(), file.ModTime.Month(), file.ModTime.Day(), 0, 0, 0, 0, file.ModTime.Location())
-				dayMap[day] = append(dayMap[day], file)
-			} else {
-				// 如果文件的最后修改时间不在保留时间范围内，直接添加到filesToDelete中
-				filesToDelete = append(filesToDelete, file)
-			}
-		}
-
-		// 在每天分组中保留最新的retainCount个文件
-		for _, dayFiles := range dayMap {
-			// 按照文件的最后修改时间降序排序
-			sort.Slice(dayFiles, func(i, j int) bool {
-				return dayFiles[i].ModTime.After(dayFiles[j].ModTime)
-			})
-
-			// 如果每天分组的文件数量大于保留数量，则将超出的部分添加到filesToDelete中
-			if len(dayFiles) > retainCount {
-				filesToDelete = append(filesToDelete, dayFiles[retainCount:]...)
-			}
-		}
-
-		return filesToDelete
-	}
-
-	// 返回空切片
-	return []FileWithModTime{}
-}
-
-// deleteFiles 根据文件列表删除文件
-// 参数：
-//
-//	db - 数据库连接
-//	files - 文件列表
-//
-// 返回值：
-//
-// error - 如果发生错误，返回错误信息；否则返回 nil
-func deleteFiles(db *sqlx.DB, files []FileWithModTime) error {
-	// 构建删除sql
-	deleteSql := `delete from backup_records where task_name = ? and timestamp = ?;`
-
-	// 遍历文件列表, 删除文件
-	for _, file := range files {
-		// 按小数点分割文件名，获取文件名称部分
-		baseName := filepath.Base(file.Path) // 获取文件名（带扩展名）
-		parts := strings.Split(baseName, ".")
-
-		// 按下划线分割文件名称部分，获取文件名称和扩展名部分
-		nameParts := strings.Split(parts[0], "_")
-
-		// 检查 nameParts 的长度是否足够
-		if len(nameParts) < 2 {
-			CL.PrintErrf("文件名格式不正确，无法解析出足够的部分: %s, 请在稍后手动删除", file.Path)
-			continue
-		} else {
-			// 检查文件是否存在, 如果存在, 则删除
-			if _, err := CheckPath(file.Path); err == nil {
-				if err := os.Remove(file.Path); err != nil {
-					CL.PrintErrf("清理 %s 文件时出错: %v, 请在稍后手动删除", file.Path, err)
-				}
-			}
-		}
-
-		taskName := nameParts[0]  // 任务名称
-		timestamp := nameParts[1] // 时间戳
-
-		// 执行删除操作sql, 参数: 任务名称, 时间戳
-		if _, err := db.Exec(deleteSql, taskName, timestamp); err != nil {
-			return fmt.Errorf("删除备份记录时出错: %w", err)
-		}
-	}
-
-	return nil
-}
-
 // CreateZipFromOSPaths 根据目标目录和文件名创建ZIP压缩文件
 // 参数:
 //
+//	ctx - 上下文，被取消或超时后停止压缩并删除未完成的压缩文件
 //	db - 数据库连接(当前未使用，保留参数)
 //	targetDir - 需要压缩的目标目录路径
 //	targetName - 需要压缩的目标名称(文件或目录名)
@@ -568,24 +497,86 @@ func deleteFiles(db *sqlx.DB, files []FileWithModTime) error {
 //
 //	string - 生成的ZIP文件完整路径
 //	error - 操作过程中遇到的错误
-func CreateZipFromOSPaths(db *sqlx.DB, targetDir, targetName, backupFileNamePath string, noCompression int, filter globals.ExcludeFunc) (string, error) {
+func CreateZipFromOSPaths(ctx context.Context, db *sqlx.DB, targetDir, targetName, backupFileNamePath string, noCompression int, filter globals.ExcludeFunc) (string, error) {
 	// 构建完整的压缩文件路径(添加扩展名)
 	zipFilePath := fmt.Sprintf("%s%s", backupFileNamePath, ".zip")
 
-	// 切换到目标目录以便后续操作
-	if err := os.Chdir(targetDir); err != nil {
-		return "", fmt.Errorf("切换到目标目录时出错: %w", err)
-	}
+	// 先写入临时文件, 压缩完成后再重命名, 避免中断时留下不完整的压缩文件
+	partFilePath := zipFilePath + PartialSuffix
+	TrackPartial(partFilePath)
+	defer UntrackPartial(partFilePath)
 
 	// 调用CreateZip函数执行实际压缩操作
-	if err := CreateZip(zipFilePath, targetName, noCompression, filter); err != nil {
+	// 使用完整路径而不是切换工作目录, 以便多个任务可以并发运行
+	if err := CreateZipContext(ctx, partFilePath, filepath.Join(targetDir, targetName), noCompression, filter); err != nil {
+		_ = os.Remove(partFilePath)
 		return "", fmt.Errorf("压缩文件时出错: %w", err)
 	}
+	if err := os.Rename(partFilePath, zipFilePath); err != nil {
+		_ = os.Remove(partFilePath)
+		return "", fmt.Errorf("重命名压缩文件时出错: %w", err)
+	}
 
 	// 返回生成的ZIP文件完整路径
 	return zipFilePath, nil
 }
 
+// 是否隐藏进度条, 多个任务并发运行时隐藏进度条以保持输出可读
+var progressSilent atomic.Bool
+
+// SetProgressSilent 设置是否隐藏进度条
+func SetProgressSilent(silent bool) {
+	progressSilent.Store(silent)
+}
+
+// newBytesBar 创建按字节显示的进度条, 隐藏进度条时返回不输出任何内容的进度条
+func newBytesBar(maxBytes int64, description ...string) *progressbar.ProgressBar {
+	if progressSilent.Load() {
+		return progressbar.DefaultBytesSilent(maxBytes, description...)
+	}
+	return progressbar.DefaultBytes(maxBytes, description...)
+}
+
+// PartialSuffix 正在写入的压缩文件的后缀
+const PartialSuffix = ".part"
+
+// 尚未完成的备份文件
+var (
+	partialMu    sync.Mutex
+	partialFiles = make(map[string]struct{})
+)
+
+// TrackPartial 登记尚未完成的备份文件, 中止备份时会被删除
+func TrackPartial(path string) {
+	partialMu.Lock()
+	defer partialMu.Unlock()
+	partialFiles[path] = struct{}{}
+}
+
+// UntrackPartial 注销已完成或已放弃的备份文件
+func UntrackPartial(path string) {
+	partialMu.Lock()
+	defer partialMu.Unlock()
+	delete(partialFiles, path)
+}
+
+// RemovePartialArchives 删除所有尚未完成的备份文件和快照目录, 用于中止备份时的清理
+// 返回值:
+//   - []string: 已删除的临时文件路径
+func RemovePartialArchives() []string {
+	partialMu.Lock()
+	defer partialMu.Unlock()
+
+	var removed []string
+	for path := range partialFiles {
+		if _, err := os.Lstat(path); err == nil && os.RemoveAll(path) == nil {
+			removed = append(removed, path)
+		}
+		delete(partialFiles, path)
+	}
+	return removed
+}
+
 // UncompressFilesByOS 根据目标目录和文件名解压ZIP压缩文件
 // 参数:
 //
@@ -612,6 +603,36 @@ func UncompressFilesByOS(zipDir, zipFileName, outputPath string) (string, error)
 		return "", fmt.Errorf("解压文件不存在: %w", err)
 	}
 
+	// 打开解压缩文件
+	file, err := os.Open(zipFilePath)
+	if err != nil {
+		return "", fmt.Errorf("打开解压文件失败: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("获取解压文件信息失败: %w", err)
+	}
+
+	return UncompressReaderAt(file, info.Size(), zipFileName, outputPath)
+}
+
+// UncompressReaderAt 解压可随机读取的ZIP内容, 例如远程存储中的备份文件, 不需要先下载到本地
+// 参数:
+//   - r: ZIP内容
+//   - size: ZIP内容的大小
+//   - zipFileName: ZIP文件名, 用于检查输出路径下是否存在同名
+//   - outputPath: 解压后的文件存放路径
+//
+// 返回值:
+//   - string: 解压后的文件存放路径
+//   - error: 操作过程中遇到的错误
+func UncompressReaderAt(r io.ReaderAt, size int64, zipFileName, outputPath string) (string, error) {
+	// 检查解压输出路径是否存在
+	if _, err := CheckPath(outputPath); err != nil {
+		return "", fmt.Errorf("解压输出路径不存在: %w", err)
+	}
+
 	// 检查输出路径下是否存在同名
 	baseName := strings.Split(zipFileName, "_")[0]  // 按下划线分割文件名，获取文件名称部分
 	tempPath := filepath.Join(outputPath, baseName) // 构建临时路径
@@ -620,7 +641,11 @@ func UncompressFilesByOS(zipDir, zipFileName, outputPath string) (string, error)
 	}
 
 	// 调用解压函数
-	if err := Unzip(zipFilePath, outputPath); err != nil {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", fmt.Errorf("解压文件时出错: 打开 ZIP 文件失败: %w", err)
+	}
+	if err := unzipReader(zipReader, outputPath); err != nil {
 		return "", fmt.Errorf("解压文件时出错: %w", err)
 	}
 
@@ -639,6 +664,12 @@ func UncompressFilesByOS(zipDir, zipFileName, outputPath string) (string, error)
 //
 //	error - 操作过程中遇到的错误
 func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeFunc globals.ExcludeFunc) error {
+	return CreateZipContext(context.Background(), zipFilePath, sourceDir, noCompression, excludeFunc)
+}
+
+// CreateZipContext 与 CreateZip 相同, ctx 被取消或超时后停止压缩并返回错误
+// 已写入的ZIP文件不完整, 由调用方负责删除
+func CreateZipContext(ctx context.Context, zipFilePath string, sourceDir string, noCompression int, excludeFunc globals.ExcludeFunc) error {
 	// 检查zipFilePath是否为绝对路径，如果不是，将其转换为绝对路径
 	if !filepath.IsAbs(zipFilePath) {
 		absPath, err := filepath.Abs(zipFilePath)
@@ -688,7 +719,7 @@ func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeF
 	totalSize := int64(0)
 
 	// 创建一个不确定进度的进度条
-	iBar := progressbar.DefaultBytes(
+	iBar := newBytesBar(
 		-1, // 设置总大小为 -1，表示不确定进度
 		"正在计算大小...",
 	)
@@ -698,6 +729,9 @@ func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeF
 		if err != nil {
 			return fmt.Errorf("遍历目录时出错: %w", err)
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// 检查是否需要跳过当前文件或目录
 		if excludeFunc(path, info) {
@@ -754,7 +788,7 @@ func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeF
 	}
 
 	// 初始化进度条
-	bar := progressbar.DefaultBytes(
+	bar := newBytesBar(
 		totalSize,
 		"正在打包",
 	)
@@ -764,6 +798,9 @@ func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeF
 		if err != nil {
 			return fmt.Errorf("遍历目录时出错: %w", err)
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// 检查是否需要跳过当前文件或目录
 		if excludeFunc(path, info) {
@@ -828,7 +865,7 @@ func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeF
 			bufferSize := getBufferSize(fileSize)
 
 			// 创建带缓冲的读取器
-			bufferedReader := bufio.NewReaderSize(file, bufferSize)
+			bufferedReader := bufio.NewReaderSize(contextReader{ctx: ctx, r: file}, bufferSize)
 
 			// 创建一个自定义多路写入器，用于同时写入文件和进度条
 			multiWriter := io.MultiWriter(fileWriter, bar)
@@ -936,6 +973,19 @@ func CreateZip(zipFilePath string, sourceDir string, noCompression int, excludeF
 	return nil
 }
 
+// contextReader 在每次读取前检查 ctx, 被取消或超时后返回错误, 用于中断大文件的复制
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
 // getBufferSize 根据文件大小动态设置缓冲区大小。该函数会根据传入的文件大小，
 // 选择合适的缓冲区大小，以优化文件读写操作的性能。不同的文件大小范围对应不同的缓冲区大小。
 // 参数:
@@ -981,6 +1031,11 @@ func Unzip(zipFilePath string, targetDir string) error {
 	}
 	defer zipReader.Close()
 
+	return unzipReader(&zipReader.Reader, targetDir)
+}
+
+// unzipReader 将 ZIP 中的所有条目解压到目标目录
+func unzipReader(zipReader *zip.Reader, targetDir string) error {
 	// 检查目标目录是否存在, 如果不存在, 则创建
 	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(targetDir, 0644); err != nil {
@@ -997,7 +1052,7 @@ func Unzip(zipFilePath string, targetDir string) error {
 	}
 
 	// 创建进度条
-	bar := progressbar.DefaultBytes(
+	bar := newBytesBar(
 		int64(totalSize), // progressbar 库要求传入 int64 类型
 		"正在解压",
 	)
@@ -1152,23 +1207,21 @@ func SanitizePath(path *string) error {
 //
 //	error - 如果发生错误，返回错误信息；否则返回 nil
 func RenameBackupDirectory(rootPath, oldDirName, newDirName string) error {
-	// 切换到备份存放目录的rootPath
-	if err := os.Chdir(rootPath); err != nil {
-		return fmt.Errorf("切换到备份存放目录的rootPath失败: %w, Path: %s", err, rootPath)
-	}
+	oldPath := filepath.Join(rootPath, oldDirName)
+	newPath := filepath.Join(rootPath, newDirName)
 
 	// 检查新的备份目录是否存在
-	if _, err := CheckPath(newDirName); err == nil {
-		return fmt.Errorf("备份目录已存在: %s, 请重试", filepath.Join(rootPath, newDirName))
+	if _, err := CheckPath(newPath); err == nil {
+		return fmt.Errorf("备份目录已存在: %s, 请重试", newPath)
 	}
 
 	// 检查旧的备份目录是否存在
-	if _, err := CheckPath(oldDirName); err != nil {
-		return fmt.Errorf("旧的备份目录不存在: %s", filepath.Join(rootPath, oldDirName))
+	if _, err := CheckPath(oldPath); err != nil {
+		return fmt.Errorf("旧的备份目录不存在: %s", oldPath)
 	}
 
 	// 重命名备份目录
-	if err := os.Rename(oldDirName, newDirName); err != nil {
+	if err := os.Rename(oldPath, newPath); err != nil {
 		return fmt.Errorf("重命名备份目录失败: %w, Old: %s, New: %s", err, oldDirName, newDirName)
 	}
 
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 版本选择器关键字
+const (
+	SelectorLatest        = "latest"         // 最新版本
+	SelectorLatestSuccess = "latest-success" // 最新的成功版本
+)
+
+// SuccessStatusSql 查询成功版本的条件, 运行状态为 success 和 unchanged 的记录都有可用的备份文件
+const SuccessStatusSql = "run_status IN ('success', 'unchanged')"
+
+// IsSuccessRecord 判断备份记录是否为成功的版本, 与 SuccessStatusSql 的条件相同
+func IsSuccessRecord(record globals.BackupRecord) bool {
+	return record.RunStatus == globals.RunStatusSuccess || record.RunStatus == globals.RunStatusUnchanged
+}
+
+// 备份记录中时间戳的格式
+const TimestampLayout = "20060102150405"
+
+// 版本选择器支持的日期时间格式
+var selectorTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseRecordTime 将备份记录中的时间戳解析为本地时间
+// 参数:
+//   - timestamp: 备份记录中的时间戳, 格式为 20060102150405
+//
+// 返回值:
+//   - time.Time: 解析后的时间
+//   - error: 解析失败时返回错误
+func ParseRecordTime(timestamp string) (time.Time, error) {
+	return time.ParseInLocation(TimestampLayout, timestamp, time.Local)
+}
+
+// ResolveVersion 根据版本选择器解析指定任务的备份版本
+// 参数:
+//   - db: 数据库连接
+//   - taskID: 任务ID
+//   - selector: 版本选择器, 支持以下形式:
+//     latest          最新版本
+//     latest~N        最新版本之前的第N个版本
+//     latest-success  最新的成功版本
+//     2024-05-01      指定日期当天结束前最近的版本
+//     2024-05-01T12:00[:00] 指定时间点及之前最近的版本
+//     完整版本ID或唯一的版本ID前缀
+//
+// 返回值:
+//   - globals.BackupRecord: 匹配到的备份记录
+//   - error: 未匹配或匹配不唯一时返回错误
+func ResolveVersion(db *sqlx.DB, taskID int, selector string) (globals.BackupRecord, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return globals.BackupRecord{}, fmt.Errorf("版本选择器不能为空")
+	}
+
+	// 查询该任务的所有备份记录, 新的在前
+	var records globals.BackupRecords
+	querySql := "SELECT version_id, task_id, timestamp, task_name, backup_file_name, backup_path, version_hash, pinned, label, note, attempt, error_message, files_copied, files_updated, files_deleted, files_linked, started_at, finished_at, duration_ms, size_bytes, file_count, dir_count, bytes_read, bytes_written, compression_ratio, run_status, content_hash FROM backup_records WHERE task_id = ? ORDER BY timestamp DESC, rowid DESC"
+	if err := db.Select(&records, querySql, taskID); err != nil {
+		return globals.BackupRecord{}, fmt.Errorf("查询备份记录失败: %w", err)
+	}
+	if len(records) == 0 {
+		return globals.BackupRecord{}, fmt.Errorf("任务ID %d 没有任何备份记录", taskID)
+	}
+
+	return selectVersion(records, selector)
+}
+
+// selectVersion 在按时间降序排列的备份记录中按选择器查找版本
+func selectVersion(records globals.BackupRecords, selector string) (globals.BackupRecord, error) {
+	// 完整版本ID优先匹配
+	for _, record := range records {
+		if record.VersionID == selector {
+			return record, nil
+		}
+	}
+
+	// latest 及其相对偏移
+	if selector == SelectorLatest {
+		return records[0], nil
+	}
+	if selector == SelectorLatestSuccess {
+		for _, record := range records {
+			if IsSuccessRecord(record) {
+				return record, nil
+			}
+		}
+		return globals.BackupRecord{}, fmt.Errorf("没有找到成功的备份版本")
+	}
+	if offsetStr, ok := strings.CutPrefix(selector, SelectorLatest+"~"); ok {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return globals.BackupRecord{}, fmt.Errorf("无效的相对版本偏移: %s", selector)
+		}
+		if offset >= len(records) {
+			return globals.BackupRecord{}, fmt.Errorf("相对版本偏移 %d 超出范围, 该任务共有 %d 个版本", offset, len(records))
+		}
+		return records[offset], nil
+	}
+
+	// 日期或日期时间: 取该时间点及之前最近的版本
+	if moment, ok := parseSelectorTime(selector); ok {
+		for _, record := range records {
+			recordTime, err := ParseRecordTime(record.Timestamp)
+			if err != nil {
+				continue
+			}
+			if !recordTime.After(moment) {
+				return record, nil
+			}
+		}
+		return globals.BackupRecord{}, fmt.Errorf("在 %s 及之前没有找到备份版本", moment.Format("2006-01-02 15:04:05"))
+	}
+
+	// 版本ID前缀
+	var matches globals.BackupRecords
+	for _, record := range records {
+		if strings.HasPrefix(record.VersionID, selector) {
+			matches = append(matches, record)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return globals.BackupRecord{}, fmt.Errorf("未找到与 '%s' 匹配的版本", selector)
+	case 1:
+		return matches[0], nil
+	default:
+		var candidates []string
+		for _, match := range matches {
+			candidates = append(candidates, fmt.Sprintf("%s(%s)", match.VersionID, match.Timestamp))
+		}
+		return globals.BackupRecord{}, fmt.Errorf("版本选择器 '%s' 不唯一, 匹配到 %d 个版本: %s", selector, len(matches), strings.Join(candidates, ", "))
+	}
+}
+
+// parseSelectorTime 将选择器解析为时间点, 仅包含日期时视为当天的 23:59:59
+func parseSelectorTime(selector string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, selector); err == nil {
+		return t, true
+	}
+	for _, layout := range selectorTimeLayouts {
+		t, err := time.ParseInLocation(layout, selector, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" {
+			// 夏令时切换当天不是24小时, 按日历加一天
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"cbk/pkg/globals"
+	"testing"
+	"time"
+)
+
+// testRecords 返回按时间降序排列的备份记录, 与 ResolveVersion 查询的顺序相同
+func testRecords() globals.BackupRecords {
+	return globals.BackupRecords{
+		{VersionID: "ab12cd", Timestamp: "20250310003000", RunStatus: globals.RunStatusFailed},
+		{VersionID: "ab34ef", Timestamp: "20250309230000", RunStatus: globals.RunStatusUnchanged},
+		{VersionID: "cd56ab", Timestamp: "20250309120000", RunStatus: globals.RunStatusSuccess},
+		{VersionID: "ef78cd", Timestamp: "20250308120000", RunStatus: globals.RunStatusSuccess},
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	// 使用有夏令时的时区, 2025-03-09 当天只有23小时
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = loc
+
+	tests := []struct {
+		name     string
+		selector string
+		want     string // 期望的版本ID, 为空时期望返回错误
+	}{
+		{name: "完整版本ID", selector: "cd56ab", want: "cd56ab"},
+		{name: "最新版本", selector: "latest", want: "ab12cd"},
+		{name: "相对偏移", selector: "latest~2", want: "cd56ab"},
+		{name: "相对偏移最后一个版本", selector: "latest~3", want: "ef78cd"},
+		{name: "相对偏移超出范围", selector: "latest~4"},
+		{name: "无效的相对偏移", selector: "latest~x"},
+		{name: "负数偏移", selector: "latest~-1"},
+		{name: "最新的成功版本包含无变化的版本", selector: "latest-success", want: "ab34ef"},
+		{name: "仅日期取当天结束前的版本", selector: "2025-03-09", want: "ab34ef"},
+		{name: "仅日期之前的版本", selector: "2025-03-08", want: "ef78cd"},
+		{name: "仅日期之前没有版本", selector: "2025-03-07"},
+		{name: "日期时间", selector: "2025-03-09 12:00", want: "cd56ab"},
+		{name: "日期时间之前最近的版本", selector: "2025-03-09T11:59:59", want: "ef78cd"},
+		{name: "RFC3339", selector: "2025-03-10T05:30:00Z", want: "ab12cd"},
+		{name: "唯一的版本ID前缀", selector: "ef", want: "ef78cd"},
+		{name: "不唯一的版本ID前缀", selector: "ab"},
+		{name: "不匹配的版本ID前缀", selector: "zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectVersion(testRecords(), tt.selector)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("selectVersion(%q) = %s, 期望返回错误", tt.selector, got.VersionID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectVersion(%q) 返回错误: %v", tt.selector, err)
+			}
+			if got.VersionID != tt.want {
+				t.Errorf("selectVersion(%q) = %s, 期望 %s", tt.selector, got.VersionID, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectVersionNoSuccess(t *testing.T) {
+	records := globals.BackupRecords{{VersionID: "ab12cd", Timestamp: "20250310003000", RunStatus: globals.RunStatusFailed}}
+	if _, err := selectVersion(records, SelectorLatestSuccess); err == nil {
+		t.Errorf("没有成功的版本时应返回错误")
+	}
+}